@@ -1,22 +1,37 @@
-package main
-
-import (
-	"log"
-
-	"github.com/nexus/gowhats/config"
-	"github.com/nexus/gowhats/internal/server"
-)
-
-func main() {
-	cfg := config.LoadConfig()
-
-	app := server.NewServer(cfg)
-
-	log.Printf("🚀 NexusWA API Enterprise rodando na porta %s", cfg.ServerPort)
-	log.Printf("🔑 API Key: %s", cfg.GlobalApiKey)
-	log.Printf("📡 Dashboard: http://localhost:%s", cfg.ServerPort)
-
-	if err := app.Listen(":" + cfg.ServerPort); err != nil {
-		log.Fatal(err)
-	}
-}
\ No newline at end of file
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/nexus/gowhats/config"
+	"github.com/nexus/gowhats/internal/server"
+)
+
+func main() {
+	cfg := config.LoadConfig()
+
+	db, err := sqlx.Connect("postgres", cfg.DatabaseDSN())
+	if err != nil {
+		log.Fatalf("❌ Erro ao conectar PostgreSQL: %v", err)
+	}
+	defer db.Close()
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	log.Println("✅ PostgreSQL conectado (Go)")
+
+	app := server.NewServer(cfg, db)
+
+	log.Printf("🚀 NexusWA API Enterprise rodando na porta %s", cfg.ServerPort)
+	log.Printf("📡 Dashboard: http://localhost:%s", cfg.ServerPort)
+	log.Printf("🔗 Baileys: %s", cfg.BaileysURL)
+
+	if err := app.Listen(":" + cfg.ServerPort); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,29 +1,95 @@
-package config
-
-import (
-	"os"
-	"github.com/joho/godotenv"
-)
-
-type Config struct {
-	ServerPort   string
-	GlobalApiKey string
-	WebhookURL   string
-}
-
-func LoadConfig() *Config {
-	_ = godotenv.Load()
-
-	return &Config{
-		ServerPort:   getEnv("SERVER_PORT", "8082"),
-		GlobalApiKey: getEnv("GLOBAL_API_KEY", "8msyqcp4o7065sz1nxdg8y69kp7gduijvb0zptz867"),
-		WebhookURL:   getEnv("WEBHOOK_URL", ""),
-	}
-}
-
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return fallback
-}
\ No newline at end of file
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+type Config struct {
+	ServerPort   string
+	GlobalApiKey string
+	WebhookURL   string
+	PublicURL    string // endereço do gateway visto de fora (webhooks de integrações)
+
+	// Webhooks
+	WebhookSecret      string
+	WebhookMaxAttempts int
+
+	// Fila de envio
+	QueueMaxAttempts int
+
+	// Código do país aplicado a números sem ele (ex.: "55"); vazio = exige o código
+	DefaultCountryCode string
+
+	// PostgreSQL
+	DatabaseURL string
+	DBHost      string
+	DBPort      string
+	DBUser      string
+	DBPass      string
+	DBName      string
+
+	// Sidecar Node.js (Baileys)
+	BaileysURL    string
+	BaileysApiKey string // key de serviço usada quando não há chamador (workers)
+}
+
+func LoadConfig() *Config {
+	_ = godotenv.Load()
+
+	cfg := &Config{
+		ServerPort:   getEnv("SERVER_PORT", "8082"),
+		GlobalApiKey: getEnv("GLOBAL_API_KEY", "8msyqcp4o7065sz1nxdg8y69kp7gduijvb0zptz867"),
+		WebhookURL:   getEnv("WEBHOOK_URL", ""),
+
+		WebhookSecret:      getEnv("WEBHOOK_SECRET", ""),
+		WebhookMaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 6),
+
+		QueueMaxAttempts: getEnvInt("QUEUE_MAX_ATTEMPTS", 5),
+
+		DefaultCountryCode: strings.TrimPrefix(getEnv("DEFAULT_COUNTRY_CODE", ""), "+"),
+
+		DatabaseURL: getEnv("DATABASE_URL", ""),
+		DBHost:      getEnv("DB_HOST", "localhost"),
+		DBPort:      getEnv("DB_PORT", "5432"),
+		DBUser:      getEnv("DB_USER", "postgres"),
+		DBPass:      getEnv("DB_PASS", ""),
+		DBName:      getEnv("DB_NAME", "nexuswa_db"),
+
+		BaileysURL: getEnv("BAILEYS_URL", "http://localhost:3001"),
+	}
+	cfg.BaileysApiKey = getEnv("BAILEYS_API_KEY", cfg.GlobalApiKey)
+	cfg.PublicURL = getEnv("PUBLIC_URL", "http://localhost:"+cfg.ServerPort)
+
+	return cfg
+}
+
+// DatabaseDSN monta a string de conexão do PostgreSQL. DATABASE_URL, quando
+// definida, tem prioridade sobre as variáveis DB_*.
+func (c *Config) DatabaseDSN() string {
+	if c.DatabaseURL != "" {
+		return c.DatabaseURL
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		c.DBHost, c.DBPort, c.DBUser, c.DBPass, c.DBName)
+}
+
+func getEnv(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return fallback
+}
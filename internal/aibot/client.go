@@ -0,0 +1,91 @@
+package aibot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// ChatMessage é uma mensagem do contexto enviado ao modelo.
+type ChatMessage struct {
+	Role    string `json:"role"` // system, user ou assistant
+	Content string `json:"content"`
+}
+
+// Client chama POST {base_url}/chat/completions de qualquer API compatível
+// com a da OpenAI (OpenAI, Azure com proxy, Ollama, vLLM, mocks...).
+type Client struct {
+	cfg  models.OpenAIConfig
+	http *http.Client
+}
+
+func NewClient(cfg models.OpenAIConfig) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Client{cfg: cfg, http: webhook.NewClient(60*time.Second, cfg.AllowInternal)}
+}
+
+// Complete devolve o texto da primeira escolha.
+func (c *Client) Complete(ctx context.Context, messages []ChatMessage) (string, error) {
+	body := map[string]interface{}{"model": c.cfg.Model, "messages": messages}
+	if c.cfg.MaxTokens > 0 {
+		body["max_tokens"] = c.cfg.MaxTokens
+	}
+	if c.cfg.Temperature != nil {
+		body["temperature"] = *c.cfg.Temperature
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.BaseURL+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.ApiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(raw))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return "", fmt.Errorf("chat/completions respondeu %d: %s", resp.StatusCode, msg)
+	}
+
+	var out struct {
+		Choices []struct {
+			Message ChatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return "", err
+	}
+	if len(out.Choices) == 0 {
+		return "", errors.New("chat/completions sem choices")
+	}
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
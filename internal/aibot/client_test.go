@@ -0,0 +1,58 @@
+package aibot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+func TestCompleteAgainstCompatibleAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model     string        `json:"model"`
+			Messages  []ChatMessage `json:"messages"`
+			MaxTokens int           `json:"max_tokens"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path != "/v1/chat/completions":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Header.Get("Authorization") != "Bearer sk-teste":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+		case body.Model != "llama3" || body.MaxTokens != 200 || len(body.Messages) != 2:
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"  Olá! Em que posso ajudar?\n"}}]}`))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	msgs := []ChatMessage{{Role: "system", Content: "Seja breve."}, {Role: "user", Content: "oi"}}
+	cfg := models.OpenAIConfig{BaseURL: srv.URL + "/v1/", ApiKey: "sk-teste", Model: "llama3", MaxTokens: 200}
+
+	// O httptest escuta em 127.0.0.1: um modelo local só é alcançado com a
+	// base_url gravada pelo super admin
+	if _, err := NewClient(cfg).Complete(ctx, msgs); !errors.Is(err, webhook.ErrInvalidURL) {
+		t.Fatalf("API na rede interna sem liberação: err = %v", err)
+	}
+
+	cfg.AllowInternal = true
+	got, err := NewClient(cfg).Complete(ctx, msgs)
+	if err != nil || got != "Olá! Em que posso ajudar?" {
+		t.Errorf("Complete() = %q, %v", got, err)
+	}
+
+	cfg.ApiKey = "errada"
+	if _, err := NewClient(cfg).Complete(ctx, msgs); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("key inválida: err = %v, want o status 401", err)
+	}
+}
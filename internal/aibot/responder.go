@@ -0,0 +1,220 @@
+package aibot
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nexus/gowhats/internal/handoff"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+)
+
+const (
+	workers = 4
+
+	defaultMaxHistory = 10
+	defaultRateLimit  = 5
+	maxHistoryLimit   = 50
+)
+
+type job struct {
+	instance string
+	cfg      models.OpenAIConfig
+	msg      *history.Summary
+}
+
+// Responder responde as mensagens que o motor de gatilhos destina a ele com
+// um modelo compatível com a API de chat da OpenAI. O contexto vem do
+// histórico do chat (tabela mensagens) e a resposta sai pela fila de envio.
+type Responder struct {
+	configs  *integrations.Store
+	history  *history.Store
+	handoffs *handoff.Store
+	queue    *queue.Queue
+
+	jobs []chan job
+
+	mu      sync.Mutex
+	replies map[string][]time.Time // respostas recentes por instância|jid
+}
+
+func New(configs *integrations.Store, h *history.Store, handoffs *handoff.Store, q *queue.Queue) *Responder {
+	r := &Responder{
+		configs:  configs,
+		history:  h,
+		handoffs: handoffs,
+		queue:    q,
+		jobs:     make([]chan job, workers),
+		replies:  make(map[string][]time.Time),
+	}
+	for i := range r.jobs {
+		r.jobs[i] = make(chan job, 256)
+	}
+	return r
+}
+
+// Start sobe os workers. Cada chat cai sempre no mesmo worker.
+func (r *Responder) Start(ctx context.Context) {
+	for _, ch := range r.jobs {
+		go func(ch chan job) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-ch:
+					if err := r.respond(ctx, j); err != nil {
+						log.Printf("⚠️ [ia] erro ao responder %s (%s): %v", j.msg.ChatJid, j.instance, err)
+					}
+				}
+			}
+		}(ch)
+	}
+}
+
+// Deliver agenda uma mensagem encaminhada pelo motor de gatilhos.
+func (r *Responder) Deliver(instance string, msg *history.Summary, raw json.RawMessage) {
+	if strings.TrimSpace(msg.Text) == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cfg, err := r.configs.Get(ctx, instance)
+	if err != nil || !cfg.OpenAI.Enabled {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(instance + "|" + msg.ChatJid))
+	select {
+	case r.jobs[h.Sum32()%workers] <- job{instance: instance, cfg: cfg.OpenAI, msg: msg}:
+	default:
+		log.Printf("⚠️ [ia] fila cheia, mensagem %s de %s ignorada", msg.MessageID, instance)
+	}
+}
+
+func (r *Responder) respond(ctx context.Context, j job) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	if human, err := r.handoffs.Active(ctx, j.instance, j.msg.ChatJid); err != nil || human {
+		return err
+	}
+	if !r.allow(j.instance+"|"+j.msg.ChatJid, j.cfg.RateLimit) {
+		log.Printf("⏳ [ia] limite de respostas atingido para %s (%s)", j.msg.ChatJid, j.instance)
+		return nil
+	}
+
+	messages, err := r.context(ctx, j)
+	if err != nil {
+		return err
+	}
+	answer, err := NewClient(j.cfg).Complete(ctx, messages)
+	if err != nil || answer == "" {
+		return err
+	}
+
+	_, err = r.queue.Enqueue(ctx, j.instance, models.SendMessageRequest{
+		Type: "text", Number: j.msg.ChatJid, Text: answer,
+	}, nil)
+	return err
+}
+
+// context monta system prompt + últimas mensagens do chat (a recebida já
+// está gravada no histórico quando o evento chega aqui).
+func (r *Responder) context(ctx context.Context, j job) ([]ChatMessage, error) {
+	limit := j.cfg.MaxHistory
+	if limit <= 0 {
+		limit = defaultMaxHistory
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	page, err := r.history.Messages(ctx, j.instance, j.msg.ChatJid, history.Query{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []ChatMessage
+	if j.cfg.SystemPrompt != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: j.cfg.SystemPrompt})
+	}
+
+	found := false
+	for i := len(page.Messages) - 1; i >= 0; i-- {
+		m := page.Messages[i]
+		content := historyText(m)
+		if content == "" {
+			continue
+		}
+		role := "user"
+		if m.FromMe {
+			role = "assistant"
+		}
+		messages = append(messages, ChatMessage{Role: role, Content: content})
+		if m.MessageID != nil && *m.MessageID == j.msg.MessageID {
+			found = true
+		}
+	}
+	if !found {
+		messages = append(messages, ChatMessage{Role: "user", Content: j.msg.Text})
+	}
+	return messages, nil
+}
+
+func historyText(m history.Message) string {
+	text := ""
+	if m.Texto != nil {
+		text = strings.TrimSpace(*m.Texto)
+	}
+	switch m.Tipo {
+	case "text", "reply":
+		return text
+	case "image", "video", "audio", "document", "sticker":
+		if text != "" {
+			return "[" + m.Tipo + "] " + text
+		}
+		return "[" + m.Tipo + "]"
+	}
+	return text
+}
+
+// allow aplica o limite de respostas por chat numa janela de um minuto.
+func (r *Responder) allow(key string, limit int) bool {
+	if limit <= 0 {
+		limit = defaultRateLimit
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.replies) > 4096 {
+		for k, times := range r.replies {
+			if now.Sub(times[len(times)-1]) >= time.Minute {
+				delete(r.replies, k)
+			}
+		}
+	}
+
+	recent := r.replies[key][:0]
+	for _, t := range r.replies[key] {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= limit {
+		r.replies[key] = recent
+		return false
+	}
+	r.replies[key] = append(recent, now)
+	return true
+}
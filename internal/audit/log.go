@@ -0,0 +1,267 @@
+package audit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	batchSize     = 200
+	flushInterval = time.Second
+	bufferSize    = 10000
+)
+
+var (
+	ErrInvalidCursor = errors.New("cursor inválido")
+	ErrInvalidStatus = errors.New("status inválido")
+)
+
+// Entry é uma linha de logs_acesso: uma requisição autenticada ou, com Acao
+// preenchida, uma alteração administrativa com o estado antes e depois.
+type Entry struct {
+	ID         int64           `db:"id" json:"id"`
+	ApiKeyID   *int            `db:"api_key_id" json:"apiKeyId"`
+	KeyPrefix  *string         `db:"key_prefix" json:"keyPrefix"`
+	Instance   *string         `db:"instance" json:"instance"`
+	Metodo     string          `db:"metodo" json:"method"`
+	Endpoint   string          `db:"endpoint" json:"path"`
+	Rota       *string         `db:"rota" json:"route"`
+	StatusCode int             `db:"status_code" json:"status"`
+	LatenciaMs *int            `db:"latencia_ms" json:"latencyMs"`
+	IP         string          `db:"ip" json:"ip"`
+	RequestID  *string         `db:"request_id" json:"requestId"`
+	Acao       *string         `db:"acao" json:"action,omitempty"`
+	Antes      json.RawMessage `db:"antes" json:"before,omitempty"`
+	Depois     json.RawMessage `db:"depois" json:"after,omitempty"`
+	CriadoEm   time.Time       `db:"criado_em" json:"createdAt"`
+}
+
+// Query filtra o log. Status aceita um código (404) ou uma classe (4xx).
+type Query struct {
+	Limit    int
+	Cursor   string
+	ApiKeyID *int
+	Instance string
+	Action   string
+	Status   string
+	From     *time.Time
+	To       *time.Time
+}
+
+type Page struct {
+	Entries    []Entry `json:"entries"`
+	NextCursor *string `json:"nextCursor"`
+}
+
+// Log grava as entradas em lotes numa goroutine própria para não atrasar as
+// requisições. Com o buffer cheio, as entradas excedentes são descartadas.
+type Log struct {
+	db      *sqlx.DB
+	entries chan Entry
+}
+
+func New(db *sqlx.DB) *Log {
+	return &Log{db: db, entries: make(chan Entry, bufferSize)}
+}
+
+// Start sobe o gravador; no fim do contexto o que estiver pendente é gravado.
+func (l *Log) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]Entry, 0, batchSize)
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := l.insert(batch); err != nil {
+				log.Printf("⚠️ [auditoria] erro ao gravar %d entradas: %v", len(batch), err)
+			}
+			batch = batch[:0]
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				for {
+					select {
+					case e := <-l.entries:
+						batch = append(batch, e)
+						if len(batch) >= batchSize {
+							flush()
+						}
+					default:
+						flush()
+						return
+					}
+				}
+			case e := <-l.entries:
+				batch = append(batch, e)
+				if len(batch) >= batchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
+
+// Record enfileira uma entrada sem bloquear. criado_em é o horário da
+// gravação do lote (no máximo flushInterval depois da requisição).
+func (l *Log) Record(e Entry) {
+	select {
+	case l.entries <- e:
+	default:
+		log.Printf("⚠️ [auditoria] buffer cheio, entrada %s %s descartada", e.Metodo, e.Endpoint)
+	}
+}
+
+func (l *Log) insert(batch []Entry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	const columns = 13
+	values := make([]string, len(batch))
+	args := make([]interface{}, 0, len(batch)*columns)
+	for i, e := range batch {
+		ph := make([]string, columns)
+		for j := range ph {
+			ph[j] = "$" + strconv.Itoa(i*columns+j+1)
+		}
+		values[i] = "(" + strings.Join(ph, ", ") + ")"
+		args = append(args, e.ApiKeyID, e.KeyPrefix, e.Instance, e.Metodo, truncate(e.Endpoint, 255), e.Rota, e.StatusCode,
+			e.LatenciaMs, e.IP, e.RequestID, e.Acao, jsonOrNil(e.Antes), jsonOrNil(e.Depois))
+	}
+
+	_, err := l.db.ExecContext(ctx, `
+		INSERT INTO logs_acesso (api_key_id, key_prefix, instance, metodo, endpoint, rota, status_code,
+		                         latencia_ms, ip, request_id, acao, antes, depois)
+		VALUES `+strings.Join(values, ", "), args...)
+	return err
+}
+
+// jsonOrNil converte o JSON para texto (o driver mandaria []byte como bytea).
+func jsonOrNil(raw json.RawMessage) interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return string(raw)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// Entries lista o log do mais recente para o mais antigo, paginado pelo id.
+func (l *Log) Entries(ctx context.Context, q Query) (*Page, error) {
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 100
+	}
+
+	where := []string{"TRUE"}
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.Cursor != "" {
+		id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, "id < "+arg(id))
+	}
+	if q.ApiKeyID != nil {
+		where = append(where, "api_key_id = "+arg(*q.ApiKeyID))
+	}
+	if q.Instance != "" {
+		where = append(where, "instance = "+arg(q.Instance))
+	}
+	if q.Action != "" {
+		where = append(where, "acao = "+arg(q.Action))
+	}
+	if q.From != nil {
+		where = append(where, "criado_em >= "+arg(*q.From))
+	}
+	if q.To != nil {
+		where = append(where, "criado_em < "+arg(*q.To))
+	}
+	if q.Status != "" {
+		cond, err := statusFilter(q.Status, arg)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, cond)
+	}
+
+	var entries []Entry
+	err := l.db.SelectContext(ctx, &entries, `
+		SELECT id, api_key_id, key_prefix, instance, COALESCE(metodo, '') AS metodo, COALESCE(endpoint, '') AS endpoint,
+		       rota, COALESCE(status_code, 0) AS status_code, latencia_ms, COALESCE(ip, '') AS ip, request_id, acao,
+		       antes, depois, criado_em
+		FROM logs_acesso
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY id DESC
+		LIMIT `+arg(q.Limit+1), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Entries: entries}
+	if len(entries) > q.Limit {
+		page.Entries = entries[:q.Limit]
+		cursor := encodeCursor(page.Entries[q.Limit-1].ID)
+		page.NextCursor = &cursor
+	}
+	if page.Entries == nil {
+		page.Entries = []Entry{}
+	}
+	return page, nil
+}
+
+// statusFilter traduz "404" ou "4xx" em condição SQL.
+func statusFilter(status string, arg func(interface{}) string) (string, error) {
+	if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+		class, err := strconv.Atoi(status[:1])
+		if err != nil || class < 1 || class > 5 {
+			return "", fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+		}
+		return "status_code BETWEEN " + arg(class*100) + " AND " + arg(class*100+99), nil
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil || code < 100 || code > 599 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+	}
+	return "status_code = " + arg(code), nil
+}
+
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,601 @@
+package campaign
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nexus/gowhats/internal/jid"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+	"github.com/nexus/gowhats/internal/ratelimit"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+// Status de campanha.
+const (
+	StatusRunning   = "running"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Status de destinatário. Depois de "queued" o status reportado é o do job
+// na fila de envio (sending, sent, failed).
+const (
+	RecipientPending   = "pending"
+	RecipientQueued    = "queued"
+	RecipientOptedOut  = "opted_out"
+	RecipientCancelled = "cancelled"
+)
+
+const (
+	defaultMinInterval = 8
+	defaultMaxInterval = 20
+)
+
+var ErrNotFound = errors.New("campanha não encontrada")
+
+type Campaign struct {
+	ID           int             `db:"id" json:"id"`
+	Instance     string          `db:"instance" json:"instance"`
+	Nome         string          `db:"nome" json:"name"`
+	Payload      json.RawMessage `db:"payload" json:"message"`
+	Status       string          `db:"status" json:"status"`
+	IntervaloMin int             `db:"intervalo_min" json:"minInterval"`
+	IntervaloMax int             `db:"intervalo_max" json:"maxInterval"`
+	LimiteDiario int             `db:"limite_diario" json:"dailyLimit"`
+	Timezone     string          `db:"timezone" json:"timezone"`
+	Total        int             `db:"total" json:"total"`
+	ProximoEnvio *time.Time      `db:"proximo_envio" json:"nextSendAt"`
+	ApiKeyID     *int            `db:"api_key_id" json:"-"`
+	CriadoEm     time.Time       `db:"criado_em" json:"createdAt"`
+	ConcluidoEm  *time.Time      `db:"concluido_em" json:"completedAt"`
+
+	Stats map[string]int `db:"-" json:"stats,omitempty"`
+}
+
+const campaignColumns = `id, instance, nome, payload, status, intervalo_min, intervalo_max,
+	limite_diario, timezone, total, proximo_envio, api_key_id, criado_em, concluido_em`
+
+type Recipient struct {
+	ID         int             `db:"id" json:"id"`
+	Numero     string          `db:"numero" json:"number"`
+	Variaveis  json.RawMessage `db:"variaveis" json:"variables"`
+	Status     string          `db:"status" json:"status"`
+	JobID      *string         `db:"job_id" json:"jobId"`
+	MessageID  *string         `db:"message_id" json:"messageId"`
+	Erro       *string         `db:"erro" json:"error"`
+	Atualizado time.Time       `db:"atualizado_em" json:"updatedAt"`
+}
+
+// recipientStatus é o status efetivo do destinatário: o do job quando já foi
+// entregue à fila, senão o da própria linha.
+const recipientStatus = `CASE WHEN d.status = 'queued' AND f.status IS NOT NULL THEN f.status ELSE d.status END`
+
+// Runner libera os destinatários das campanhas ativas para a fila de envio,
+// um por vez, com intervalo aleatório entre IntervaloMin e IntervaloMax e
+// respeitando o limite diário da instância.
+type Runner struct {
+	db    *sqlx.DB
+	queue *queue.Queue
+
+	DefaultCountry string // código do país aplicado a números sem ele (ex.: "55")
+
+	mu       sync.Mutex
+	nextSlot map[string]time.Time // próximo envio permitido por instância
+}
+
+func NewRunner(db *sqlx.DB, q *queue.Queue) *Runner {
+	return &Runner{db: db, queue: q, nextSlot: make(map[string]time.Time)}
+}
+
+// Start sobe o loop das campanhas; ele encerra quando ctx é cancelado.
+func (r *Runner) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.tick(ctx)
+			}
+		}
+	}()
+}
+
+// ============================================
+// CRIAÇÃO E CONSULTA
+// ============================================
+
+func (r *Runner) Create(ctx context.Context, instance string, req models.CampaignRequest, apiKeyID *int) (*Campaign, error) {
+	switch req.Message.Type {
+	case "text", "interactive", "media":
+	default:
+		return nil, &whatsapp.RequestError{Message: "message.type deve ser text, interactive ou media"}
+	}
+	if req.Message.Type == "text" && req.Message.Text == "" {
+		return nil, &whatsapp.RequestError{Message: "message.text required"}
+	}
+
+	tz := req.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return nil, &whatsapp.RequestError{Message: "timezone inválido: " + tz}
+	}
+
+	if req.MinInterval <= 0 {
+		req.MinInterval = defaultMinInterval
+	}
+	if req.MaxInterval <= 0 {
+		req.MaxInterval = defaultMaxInterval
+	}
+	if req.MaxInterval < req.MinInterval {
+		req.MaxInterval = req.MinInterval
+	}
+	if req.DailyLimit < 0 {
+		req.DailyLimit = 0
+	}
+
+	recipients := dedupe(req.Recipients, r.DefaultCountry)
+	if len(recipients) == 0 {
+		return nil, &whatsapp.RequestError{Message: "recipients required"}
+	}
+
+	req.Message.Number = ""
+	if req.Message.Options != nil {
+		opts := *req.Message.Options
+		opts.Delay = 0
+		opts.ScheduledAt = nil
+		req.Message.Options = &opts
+	}
+	payload, err := json.Marshal(req.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if req.StartAt != nil && req.StartAt.After(start) {
+		start = *req.StartAt
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c Campaign
+	err = tx.GetContext(ctx, &c, `
+		INSERT INTO campanhas (instance, nome, payload, status, intervalo_min, intervalo_max,
+		                       limite_diario, timezone, total, proximo_envio, api_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+campaignColumns,
+		instance, req.Name, string(payload), StatusRunning, req.MinInterval, req.MaxInterval,
+		req.DailyLimit, tz, len(recipients), start, apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// COPY: campanhas de dezenas de milhares de destinatários
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("campanha_destinatarios", "campanha_id", "numero", "variaveis"))
+	if err != nil {
+		return nil, err
+	}
+	for _, rcpt := range recipients {
+		vars, _ := json.Marshal(rcpt.Variables)
+		if _, err := stmt.ExecContext(ctx, c.ID, rcpt.Number, string(vars)); err != nil {
+			stmt.Close()
+			return nil, err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	if err := stmt.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *Runner) List(ctx context.Context, instance string) ([]Campaign, error) {
+	items := []Campaign{}
+	err := r.db.SelectContext(ctx, &items, `
+		SELECT `+campaignColumns+` FROM campanhas WHERE instance = $1 ORDER BY criado_em DESC
+	`, instance)
+	return items, err
+}
+
+// Get devolve a campanha com a contagem de destinatários por status.
+func (r *Runner) Get(ctx context.Context, instance string, id int) (*Campaign, error) {
+	var c Campaign
+	err := r.db.GetContext(ctx, &c, `SELECT `+campaignColumns+` FROM campanhas WHERE id = $1 AND instance = $2`, id, instance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Status string `db:"status"`
+		Total  int    `db:"total"`
+	}
+	err = r.db.SelectContext(ctx, &rows, `
+		SELECT `+recipientStatus+` AS status, COUNT(*) AS total
+		FROM campanha_destinatarios d
+		LEFT JOIN fila_mensagens f ON f.id = d.job_id
+		WHERE d.campanha_id = $1
+		GROUP BY 1
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	c.Stats = make(map[string]int, len(rows))
+	for _, row := range rows {
+		c.Stats[row.Status] = row.Total
+	}
+
+	return &c, nil
+}
+
+// Recipients lista os destinatários da campanha, opcionalmente filtrados pelo
+// status efetivo.
+func (r *Runner) Recipients(ctx context.Context, instance string, id int, status string, limit, offset int) ([]Recipient, error) {
+	if _, err := r.Get(ctx, instance, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	items := []Recipient{}
+	err := r.db.SelectContext(ctx, &items, `
+		SELECT d.id, d.numero, d.variaveis, `+recipientStatus+` AS status, d.job_id,
+		       f.message_id, COALESCE(d.erro, f.ultimo_erro) AS erro,
+		       GREATEST(d.atualizado_em, COALESCE(f.atualizado_em, d.atualizado_em)) AS atualizado_em
+		FROM campanha_destinatarios d
+		LEFT JOIN fila_mensagens f ON f.id = d.job_id
+		WHERE d.campanha_id = $1 AND ($2 = '' OR `+recipientStatus+` = $2)
+		ORDER BY d.id
+		LIMIT $3 OFFSET $4
+	`, id, status, limit, offset)
+	return items, err
+}
+
+// ============================================
+// PAUSA / RETOMADA / CANCELAMENTO
+// ============================================
+
+func (r *Runner) Pause(ctx context.Context, instance string, id int) (*Campaign, error) {
+	return r.transition(ctx, instance, id, StatusPaused, StatusRunning)
+}
+
+func (r *Runner) Resume(ctx context.Context, instance string, id int) (*Campaign, error) {
+	return r.transition(ctx, instance, id, StatusRunning, StatusPaused)
+}
+
+// Cancel encerra a campanha: pendentes viram "cancelled" e jobs ainda não
+// enviados são retirados da fila.
+func (r *Runner) Cancel(ctx context.Context, instance string, id int) (*Campaign, error) {
+	if _, err := r.transition(ctx, instance, id, StatusCancelled, StatusRunning, StatusPaused); err != nil {
+		return nil, err
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE campanha_destinatarios SET status = $2, atualizado_em = NOW()
+		WHERE campanha_id = $1 AND status = $3
+	`, id, RecipientCancelled, RecipientPending)
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []string
+	err = r.db.SelectContext(ctx, &jobs, `
+		SELECT job_id::text FROM campanha_destinatarios
+		WHERE campanha_id = $1 AND status = $2 AND job_id IS NOT NULL
+	`, id, RecipientQueued)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		// Só cancela quem ainda está "queued"; ErrNotFound = já saiu da fila
+		_ = r.queue.Cancel(ctx, job)
+	}
+
+	return r.Get(ctx, instance, id)
+}
+
+func (r *Runner) transition(ctx context.Context, instance string, id int, to string, from ...string) (*Campaign, error) {
+	var c Campaign
+	err := r.db.GetContext(ctx, &c, `
+		UPDATE campanhas SET status = $3, atualizado_em = NOW(),
+		       concluido_em = CASE WHEN $3 = 'cancelled' THEN NOW() ELSE concluido_em END
+		WHERE id = $1 AND instance = $2 AND status = ANY($4)
+		RETURNING `+campaignColumns,
+		id, instance, to, pq.Array(from))
+	if errors.Is(err, sql.ErrNoRows) {
+		current, gerr := r.Get(ctx, instance, id)
+		if gerr != nil {
+			return nil, gerr
+		}
+		return nil, &whatsapp.RequestError{Message: fmt.Sprintf("campanha está %s", current.Status)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ============================================
+// OPT-OUT
+// ============================================
+
+func (r *Runner) OptOuts(ctx context.Context, instance string) ([]string, error) {
+	items := []string{}
+	err := r.db.SelectContext(ctx, &items, `SELECT numero FROM opt_outs WHERE instance = $1 ORDER BY criado_em DESC`, instance)
+	return items, err
+}
+
+func (r *Runner) AddOptOut(ctx context.Context, instance string, numbers []string) error {
+	for _, n := range numbers {
+		n = normalizeNumber(n, r.DefaultCountry)
+		if n == "" {
+			continue
+		}
+		if _, err := r.db.ExecContext(ctx, `
+			INSERT INTO opt_outs (instance, numero) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`, instance, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) RemoveOptOut(ctx context.Context, instance, number string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM opt_outs WHERE instance = $1 AND numero = $2`, instance, normalizeNumber(number, r.DefaultCountry))
+	return err
+}
+
+// ============================================
+// DISPARO
+// ============================================
+
+func (r *Runner) tick(ctx context.Context) {
+	var campaigns []Campaign
+	err := r.db.SelectContext(ctx, &campaigns, `
+		SELECT `+campaignColumns+` FROM campanhas
+		WHERE status = $1 AND proximo_envio <= NOW()
+		ORDER BY proximo_envio
+	`, StatusRunning)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("⚠️ [campanha] erro ao buscar campanhas: %v", err)
+		}
+		return
+	}
+
+	for i := range campaigns {
+		c := &campaigns[i]
+		if !r.slotFree(c.Instance) {
+			continue
+		}
+		if err := r.step(ctx, c); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️ [campanha] campanha %d: %v", c.ID, err)
+		}
+	}
+}
+
+// step libera o próximo destinatário da campanha e agenda o seguinte.
+func (r *Runner) step(ctx context.Context, c *Campaign) error {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	if c.LimiteDiario > 0 {
+		now := time.Now().In(loc)
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+		var sentToday int
+		err := r.db.GetContext(ctx, &sentToday, `
+			SELECT COUNT(*) FROM campanha_destinatarios d
+			JOIN campanhas c ON c.id = d.campanha_id
+			WHERE c.instance = $1 AND d.status = $2 AND d.liberado_em >= $3
+		`, c.Instance, RecipientQueued, dayStart)
+		if err != nil {
+			return err
+		}
+		if sentToday >= c.LimiteDiario {
+			return r.reschedule(ctx, c.ID, dayStart.AddDate(0, 0, 1))
+		}
+	}
+
+	// Destinatário liberado cujo job não chegou à fila (processo caiu entre
+	// liberar e enfileirar) volta a ficar pendente
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE campanha_destinatarios d SET status = $2, job_id = NULL, liberado_em = NULL, atualizado_em = NOW()
+		WHERE d.campanha_id = $1 AND d.status = $3 AND d.liberado_em < NOW() - INTERVAL '1 minute'
+		  AND NOT EXISTS (SELECT 1 FROM fila_mensagens f WHERE f.id = d.job_id)
+	`, c.ID, RecipientPending, RecipientQueued)
+	if err != nil {
+		return err
+	}
+
+	// Quem pediu opt-out (inclusive depois de criada a campanha) não recebe
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE campanha_destinatarios d SET status = $3, atualizado_em = NOW()
+		FROM opt_outs o
+		WHERE d.campanha_id = $1 AND d.status = $4 AND o.instance = $2 AND o.numero = d.numero
+	`, c.ID, c.Instance, RecipientOptedOut, RecipientPending)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rcpt struct {
+		ID        int             `db:"id"`
+		Numero    string          `db:"numero"`
+		Variaveis json.RawMessage `db:"variaveis"`
+	}
+	err = tx.GetContext(ctx, &rcpt, `
+		SELECT id, numero, variaveis FROM campanha_destinatarios
+		WHERE campanha_id = $1 AND status = $2
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, c.ID, RecipientPending)
+	if errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return r.complete(ctx, c.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	var tpl models.SendMessageRequest
+	if err := json.Unmarshal(c.Payload, &tpl); err != nil {
+		return err
+	}
+	var vars map[string]string
+	_ = json.Unmarshal(rcpt.Variaveis, &vars)
+
+	// O destinatário é marcado com o id do job antes de enfileirar: se o
+	// processo cair no meio, ele não é liberado de novo (ver acima)
+	jobID := uuid.NewString()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE campanha_destinatarios
+		SET status = $2, job_id = $3, liberado_em = NOW(), atualizado_em = NOW()
+		WHERE id = $1
+	`, rcpt.ID, RecipientQueued, jobID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	_, err = r.queue.EnqueueWithID(ctx, jobID, c.Instance, personalize(tpl, rcpt.Numero, vars), c.ApiKeyID)
+	if err != nil {
+		// Cota esgotada ou erro ao gravar: o destinatário volta a ficar
+		// pendente e sai no próximo envio
+		if _, rerr := r.db.ExecContext(ctx, `
+			UPDATE campanha_destinatarios SET status = $3, job_id = NULL, liberado_em = NULL, atualizado_em = NOW()
+			WHERE id = $1 AND job_id = $2
+		`, rcpt.ID, jobID, RecipientPending); rerr != nil {
+			log.Printf("⚠️ [campanha] erro ao devolver destinatário %d: %v", rcpt.ID, rerr)
+		}
+		var exceeded *ratelimit.Exceeded
+		if errors.As(err, &exceeded) {
+			return r.reschedule(ctx, c.ID, exceeded.Reset)
+		}
+		return err
+	}
+
+	wait := jitter(c.IntervaloMin, c.IntervaloMax)
+	r.reserveSlot(c.Instance, wait)
+	return r.reschedule(ctx, c.ID, time.Now().Add(wait))
+}
+
+func (r *Runner) reschedule(ctx context.Context, id int, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE campanhas SET proximo_envio = $2, atualizado_em = NOW() WHERE id = $1 AND status = $3
+	`, id, at, StatusRunning)
+	return err
+}
+
+func (r *Runner) complete(ctx context.Context, id int) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE campanhas SET status = $2, concluido_em = NOW(), proximo_envio = NULL, atualizado_em = NOW()
+		WHERE id = $1 AND status = $3
+	`, id, StatusCompleted, StatusRunning)
+	return err
+}
+
+// slotFree/reserveSlot espaçam os envios por instância, mesmo com várias
+// campanhas rodando ao mesmo tempo na mesma instância.
+func (r *Runner) slotFree(instance string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !time.Now().Before(r.nextSlot[instance])
+}
+
+func (r *Runner) reserveSlot(instance string, wait time.Duration) {
+	r.mu.Lock()
+	r.nextSlot[instance] = time.Now().Add(wait)
+	r.mu.Unlock()
+}
+
+func jitter(minSec, maxSec int) time.Duration {
+	min := time.Duration(minSec) * time.Second
+	if maxSec <= minSec {
+		return min
+	}
+	spread := time.Duration(maxSec-minSec) * time.Second
+	return min + time.Duration(rand.Int63n(int64(spread)))
+}
+
+// ============================================
+// HELPERS
+// ============================================
+
+// normalizeNumber põe o número na forma usada para deduplicar destinatários e
+// compará-los com os opt-outs: telefones (inclusive @s.whatsapp.net) viram os
+// dígitos E.164, celulares brasileiros sempre com o nono dígito, e os demais
+// jids ficam na forma canônica. Números inválidos viram "".
+func normalizeNumber(raw, defaultCountry string) string {
+	j, err := jid.Parse(raw, defaultCountry)
+	if err != nil {
+		return ""
+	}
+	if !j.IsUser() {
+		return j.String()
+	}
+	if variants := jid.BrazilVariants(j.User); variants != nil {
+		return variants[0]
+	}
+	return j.User
+}
+
+func dedupe(in []models.CampaignRecipient, defaultCountry string) []models.CampaignRecipient {
+	seen := make(map[string]bool, len(in))
+	out := make([]models.CampaignRecipient, 0, len(in))
+	for _, rcpt := range in {
+		rcpt.Number = normalizeNumber(rcpt.Number, defaultCountry)
+		if rcpt.Number == "" || seen[rcpt.Number] {
+			continue
+		}
+		seen[rcpt.Number] = true
+		if rcpt.Variables == nil {
+			rcpt.Variables = map[string]string{}
+		}
+		out = append(out, rcpt)
+	}
+	return out
+}
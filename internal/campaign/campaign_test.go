@@ -0,0 +1,190 @@
+package campaign
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/dbtest"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+)
+
+func TestNormalizeNumberMatchesOptOutForms(t *testing.T) {
+	// Todas as formas do mesmo celular precisam cair na mesma chave
+	for _, raw := range []string{
+		"5511987654321",
+		"+55 (11) 98765-4321",
+		"551187654321",
+		"11 8765-4321",
+		"5511987654321@s.whatsapp.net",
+		"5511987654321:3@s.whatsapp.net",
+		"5511987654321@c.us",
+	} {
+		if got := normalizeNumber(raw, "55"); got != "5511987654321" {
+			t.Errorf("normalizeNumber(%q) = %q", raw, got)
+		}
+	}
+
+	cases := map[string]string{
+		"+1 (415) 555-0100":         "14155550100",
+		"551133334444":              "551133334444", // fixo: sem nono dígito
+		"120363025246125486@g.us":   "120363025246125486@g.us",
+		"120363025246125486":        "120363025246125486@g.us",
+		"abc":                       "",
+		"":                          "",
+		"5511987654321@example.com": "",
+	}
+	for raw, want := range cases {
+		if got := normalizeNumber(raw, "55"); got != want {
+			t.Errorf("normalizeNumber(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestDedupeKeepsFirstOccurrence(t *testing.T) {
+	got := dedupe([]models.CampaignRecipient{
+		{Number: "+55 11 98765-4321", Variables: map[string]string{"nome": "Ana"}},
+		{Number: "inválido"},
+		{Number: "11 8765-4321", Variables: map[string]string{"nome": "Ana de novo"}},
+		{Number: "5521998765432"},
+	}, "55")
+
+	if len(got) != 2 || got[0].Number != "5511987654321" || got[0].Variables["nome"] != "Ana" || got[1].Number != "5521998765432" {
+		t.Fatalf("dedupe() = %+v", got)
+	}
+	if got[1].Variables == nil {
+		t.Error("variáveis nil não viram mapa vazio")
+	}
+}
+
+func TestJitterStaysWithinInterval(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if d := jitter(8, 20); d < 8*time.Second || d >= 20*time.Second {
+			t.Fatalf("jitter(8, 20) = %v", d)
+		}
+	}
+	if d := jitter(10, 5); d != 10*time.Second {
+		t.Errorf("jitter com max < min = %v, want o mínimo", d)
+	}
+}
+
+// ============================================
+// DISPARO (banco)
+// ============================================
+
+func newTestRunner(t *testing.T) (*Runner, *sqlx.DB, string) {
+	t.Helper()
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db, "fila_mensagens", "uso_mensagens", "campanhas", "opt_outs")
+	r := NewRunner(db, queue.New(db, nil, queue.Options{}))
+	r.DefaultCountry = "55"
+	return r, db, instance
+}
+
+func createCampaign(t *testing.T, r *Runner, instance string, keyID *int, numbers ...string) *Campaign {
+	t.Helper()
+	req := models.CampaignRequest{Name: "promo", Message: models.SendMessageRequest{Type: "text", Text: "Oi {{number}}"}}
+	for _, n := range numbers {
+		req.Recipients = append(req.Recipients, models.CampaignRecipient{Number: n})
+	}
+	c, err := r.Create(context.Background(), instance, req, keyID)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return c
+}
+
+func recipientStatuses(t *testing.T, r *Runner, instance string, id int) map[string]Recipient {
+	t.Helper()
+	items, err := r.Recipients(context.Background(), instance, id, "", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]Recipient, len(items))
+	for _, item := range items {
+		out[item.Numero] = item
+	}
+	return out
+}
+
+func TestStepSkipsOptOutsAndCompletes(t *testing.T) {
+	r, db, instance := newTestRunner(t)
+	ctx := context.Background()
+
+	// Opt-out informado sem o país e sem o nono dígito
+	if err := r.AddOptOut(ctx, instance, []string{"(11) 8765-4321"}); err != nil {
+		t.Fatal(err)
+	}
+	c := createCampaign(t, r, instance, nil, "+55 11 98765-4321", "5511912345678@s.whatsapp.net", "11 91234-5678")
+	if c.Total != 2 {
+		t.Fatalf("total = %d, want 2 (duplicado removido)", c.Total)
+	}
+
+	if err := r.step(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	got := recipientStatuses(t, r, instance, c.ID)
+	if got["5511987654321"].Status != RecipientOptedOut {
+		t.Errorf("opt-out: status = %s", got["5511987654321"].Status)
+	}
+	queued := got["5511912345678"]
+	if queued.Status != queue.StatusQueued || queued.JobID == nil {
+		t.Fatalf("destinatário liberado = %+v", queued)
+	}
+	var numero string
+	if err := db.Get(&numero, `SELECT numero FROM fila_mensagens WHERE id = $1`, *queued.JobID); err != nil {
+		t.Fatalf("job %s não está na fila: %v", *queued.JobID, err)
+	}
+
+	if err := r.step(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if done, _ := r.Get(ctx, instance, c.ID); done.Status != StatusCompleted {
+		t.Errorf("campanha sem pendentes: status = %s", done.Status)
+	}
+}
+
+func TestStepReturnsRecipientWhenQuotaIsExhausted(t *testing.T) {
+	r, db, instance := newTestRunner(t)
+	ctx := context.Background()
+	keyID := dbtest.APIKey(t, db, 1)
+
+	if _, err := r.queue.Enqueue(ctx, instance, models.SendMessageRequest{Number: "5511900000000", Type: "text", Text: "oi"}, &keyID); err != nil {
+		t.Fatal(err)
+	}
+	c := createCampaign(t, r, instance, &keyID, "5511987654321")
+
+	if err := r.step(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	rcpt := recipientStatuses(t, r, instance, c.ID)["5511987654321"]
+	if rcpt.Status != RecipientPending || rcpt.JobID != nil {
+		t.Errorf("com a cota esgotada: %+v, want pendente sem job", rcpt)
+	}
+	if after, _ := r.Get(ctx, instance, c.ID); after.ProximoEnvio == nil || !after.ProximoEnvio.After(time.Now()) {
+		t.Errorf("próximo envio = %v, want a virada da cota", after.ProximoEnvio)
+	}
+}
+
+func TestStepReleasesRecipientWhoseJobWasNeverQueued(t *testing.T) {
+	r, db, instance := newTestRunner(t)
+	ctx := context.Background()
+	c := createCampaign(t, r, instance, nil, "5511987654321")
+
+	// Processo caiu depois de marcar o destinatário e antes de enfileirar
+	lost := "00000000-0000-4000-8000-000000000000"
+	db.MustExec(`
+		UPDATE campanha_destinatarios SET status = $2, job_id = $3, liberado_em = NOW() - INTERVAL '5 minutes'
+		WHERE campanha_id = $1
+	`, c.ID, RecipientQueued, lost)
+
+	if err := r.step(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	rcpt := recipientStatuses(t, r, instance, c.ID)["5511987654321"]
+	if rcpt.JobID == nil || *rcpt.JobID == lost || rcpt.Status != queue.StatusQueued {
+		t.Errorf("destinatário perdido não foi liberado de novo: %+v", rcpt)
+	}
+}
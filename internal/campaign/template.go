@@ -0,0 +1,124 @@
+package campaign
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// render substitui {{variavel}} pelos valores do destinatário. Variáveis
+// ausentes viram texto vazio.
+func render(text string, vars map[string]string) string {
+	if text == "" || !strings.Contains(text, "{{") {
+		return text
+	}
+	return placeholder.ReplaceAllStringFunc(text, func(m string) string {
+		key := placeholder.FindStringSubmatch(m)[1]
+		return vars[key]
+	})
+}
+
+// personalize monta a mensagem de um destinatário a partir do modelo.
+func personalize(tpl models.SendMessageRequest, number string, vars map[string]string) models.SendMessageRequest {
+	all := map[string]string{"number": number}
+	for k, v := range vars {
+		all[k] = v
+	}
+
+	msg := tpl
+	msg.Number = number
+	msg.Text = render(tpl.Text, all)
+
+	if tpl.Media != nil {
+		media := *tpl.Media
+		media.Caption = render(media.Caption, all)
+		media.FileName = render(media.FileName, all)
+		msg.Media = &media
+	}
+
+	if tpl.Interactive != nil {
+		inter := *tpl.Interactive
+		if inter.Body != nil {
+			inter.Body = &models.Body{Text: render(inter.Body.Text, all)}
+		}
+		if inter.Footer != nil {
+			inter.Footer = &models.Footer{Text: render(inter.Footer.Text, all)}
+		}
+		if inter.Header != nil {
+			header := *inter.Header
+			header.Title = render(header.Title, all)
+			header.Subtitle = render(header.Subtitle, all)
+			inter.Header = &header
+		}
+		msg.Interactive = &inter
+	}
+
+	return msg
+}
+
+// ParseCSV lê destinatários de um CSV com cabeçalho. A coluna do número pode
+// se chamar number, numero, phone ou telefone; as demais viram variáveis.
+// Aceita vírgula ou ponto e vírgula como separador.
+func ParseCSV(r io.Reader) ([]models.CampaignRecipient, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if first, _, _ := strings.Cut(text, "\n"); strings.Count(first, ";") > strings.Count(first, ",") {
+		reader.Comma = ';'
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV vazio ou inválido")
+	}
+
+	numberCol := -1
+	for i, h := range header {
+		header[i] = strings.TrimSpace(h)
+		switch strings.ToLower(header[i]) {
+		case "number", "numero", "número", "phone", "telefone":
+			if numberCol < 0 {
+				numberCol = i
+			}
+		}
+	}
+	if numberCol < 0 {
+		return nil, errors.New("CSV sem coluna number/numero/phone")
+	}
+
+	var out []models.CampaignRecipient
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if numberCol >= len(row) || strings.TrimSpace(row[numberCol]) == "" {
+			continue
+		}
+
+		rcpt := models.CampaignRecipient{Number: strings.TrimSpace(row[numberCol]), Variables: map[string]string{}}
+		for i, v := range row {
+			if i != numberCol && i < len(header) && header[i] != "" {
+				rcpt.Variables[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		out = append(out, rcpt)
+	}
+
+	return out, nil
+}
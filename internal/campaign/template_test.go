@@ -0,0 +1,77 @@
+package campaign
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestRender(t *testing.T) {
+	vars := map[string]string{"nome": "Ana", "pedido.id": "1234"}
+
+	cases := map[string]string{
+		"Olá {{nome}}!":                       "Olá Ana!",
+		"Pedido {{ pedido.id }} de {{nome}}":  "Pedido 1234 de Ana",
+		"Oi {{sobrenome}}.":                   "Oi .",
+		"sem variáveis":                       "sem variáveis",
+		"{nome} e {{ nome } ficam como estão": "{nome} e {{ nome } ficam como estão",
+		"":                                    "",
+	}
+	for text, want := range cases {
+		if got := render(text, vars); got != want {
+			t.Errorf("render(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestPersonalizeDoesNotTouchTemplate(t *testing.T) {
+	tpl := models.SendMessageRequest{
+		Type:  "media",
+		Media: &models.MediaPayload{URL: "https://cdn.example/boleto.pdf", Caption: "Boleto de {{nome}}", FileName: "boleto-{{number}}.pdf"},
+		Interactive: &models.InteractivePayload{
+			Body:   &models.Body{Text: "Oi {{nome}}"},
+			Footer: &models.Footer{Text: "Loja"},
+			Header: &models.Header{Title: "Pedido {{pedido}}"},
+		},
+	}
+
+	msg := personalize(tpl, "5511987654321", map[string]string{"nome": "Ana", "pedido": "42"})
+	if msg.Number != "5511987654321" || msg.Media.Caption != "Boleto de Ana" || msg.Media.FileName != "boleto-5511987654321.pdf" {
+		t.Errorf("mídia personalizada = %+v", msg.Media)
+	}
+	if msg.Interactive.Body.Text != "Oi Ana" || msg.Interactive.Header.Title != "Pedido 42" || msg.Interactive.Footer.Text != "Loja" {
+		t.Errorf("interativo personalizado = %+v", msg.Interactive)
+	}
+
+	// O modelo é compartilhado por todos os destinatários
+	if tpl.Media.Caption != "Boleto de {{nome}}" || tpl.Interactive.Body.Text != "Oi {{nome}}" || tpl.Interactive.Header.Title != "Pedido {{pedido}}" {
+		t.Error("personalize alterou o modelo")
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	csv := "\ufeffNome;Telefone;Cidade\n" +
+		"Ana;+55 11 98765-4321;São Paulo\n" +
+		";;\n" +
+		"Bruno;5521998765432\n"
+
+	got, err := ParseCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.CampaignRecipient{
+		{Number: "+55 11 98765-4321", Variables: map[string]string{"Nome": "Ana", "Cidade": "São Paulo"}},
+		{Number: "5521998765432", Variables: map[string]string{"Nome": "Bruno"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCSV() = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"", "nome,cidade\nAna,SP\n"} {
+		if _, err := ParseCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseCSV(%q) deveria falhar", bad)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package chatwoot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+// APIError é uma resposta de erro da API do Chatwoot.
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("chatwoot %s %s respondeu %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Inbox struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	ChannelType string `json:"channel_type"`
+	WebhookURL  string `json:"webhook_url"`
+}
+
+type Contact struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	PhoneNumber    string `json:"phone_number"`
+	Identifier     string `json:"identifier"`
+	ContactInboxes []struct {
+		SourceID string `json:"source_id"`
+		Inbox    struct {
+			ID int `json:"id"`
+		} `json:"inbox"`
+	} `json:"contact_inboxes"`
+}
+
+// Attachment é um arquivo enviado junto com uma mensagem.
+type Attachment struct {
+	FileName string
+	MimeType string
+	Data     []byte
+}
+
+// Client fala com a Application API do Chatwoot de uma conta.
+type Client struct {
+	baseURL   string
+	accountID string
+	token     string
+	http      *http.Client
+}
+
+func NewClient(cfg models.ChatwootConfig) *Client {
+	return &Client{
+		baseURL:   strings.TrimRight(cfg.URL, "/"),
+		accountID: cfg.AccountID,
+		token:     cfg.Token,
+		http:      webhook.NewClient(30*time.Second, cfg.AllowInternal),
+	}
+}
+
+func (c *Client) Inboxes(ctx context.Context) ([]Inbox, error) {
+	var out struct {
+		Payload []Inbox `json:"payload"`
+	}
+	err := c.do(ctx, http.MethodGet, "/inboxes", nil, &out)
+	return out.Payload, err
+}
+
+func (c *Client) Inbox(ctx context.Context, id int) (*Inbox, error) {
+	var out Inbox
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/inboxes/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateInbox cria uma inbox do tipo API que entrega as respostas dos
+// agentes em webhookURL.
+func (c *Client) CreateInbox(ctx context.Context, name, webhookURL string) (*Inbox, error) {
+	var out Inbox
+	err := c.do(ctx, http.MethodPost, "/inboxes", map[string]interface{}{
+		"name":    name,
+		"channel": map[string]string{"type": "api", "webhook_url": webhookURL},
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateInboxWebhook(ctx context.Context, id int, webhookURL string) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/inboxes/%d", id), map[string]interface{}{
+		"channel": map[string]string{"webhook_url": webhookURL},
+	}, nil)
+}
+
+func (c *Client) SearchContacts(ctx context.Context, query string) ([]Contact, error) {
+	var out struct {
+		Payload []Contact `json:"payload"`
+	}
+	err := c.do(ctx, http.MethodGet, "/contacts/search?q="+url.QueryEscape(query), nil, &out)
+	return out.Payload, err
+}
+
+func (c *Client) GetContact(ctx context.Context, id int) (*Contact, error) {
+	var out struct {
+		Payload Contact `json:"payload"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/contacts/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out.Payload, nil
+}
+
+func (c *Client) CreateContact(ctx context.Context, inboxID int, name, phone, identifier string) (*Contact, error) {
+	body := map[string]interface{}{"inbox_id": inboxID, "name": name, "identifier": identifier}
+	if phone != "" {
+		body["phone_number"] = phone
+	}
+
+	// Versões novas devolvem {payload: {contact}}, as antigas {payload: contato}
+	var out struct {
+		Payload struct {
+			Contact
+			Inner *Contact `json:"contact"`
+		} `json:"payload"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/contacts", body, &out); err != nil {
+		return nil, err
+	}
+	if out.Payload.Inner != nil {
+		return out.Payload.Inner, nil
+	}
+	return &out.Payload.Contact, nil
+}
+
+// ContactInbox vincula o contato à inbox com o source_id informado e devolve
+// o source_id efetivo (o existente, se o vínculo já havia sido criado).
+func (c *Client) ContactInbox(ctx context.Context, contactID, inboxID int, sourceID string) (string, error) {
+	var out struct {
+		SourceID string `json:"source_id"`
+	}
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/contacts/%d/contact_inboxes", contactID), map[string]interface{}{
+		"inbox_id": inboxID, "source_id": sourceID,
+	}, &out)
+	if err == nil && out.SourceID != "" {
+		return out.SourceID, nil
+	}
+
+	contact, getErr := c.GetContact(ctx, contactID)
+	if getErr != nil {
+		if err != nil {
+			return "", err
+		}
+		return "", getErr
+	}
+	for _, ci := range contact.ContactInboxes {
+		if ci.Inbox.ID == inboxID && ci.SourceID != "" {
+			return ci.SourceID, nil
+		}
+	}
+	if err == nil {
+		err = errors.New("chatwoot não devolveu o source_id do contato")
+	}
+	return "", err
+}
+
+func (c *Client) CreateConversation(ctx context.Context, sourceID string, inboxID, contactID int) (int, error) {
+	var out struct {
+		ID int `json:"id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/conversations", map[string]interface{}{
+		"source_id": sourceID, "inbox_id": inboxID, "contact_id": contactID, "status": "open",
+	}, &out)
+	return out.ID, err
+}
+
+// Assignee devolve o id do agente atribuído à conversa (0 = nenhum).
+func (c *Client) Assignee(ctx context.Context, conversationID int) (int, error) {
+	var out struct {
+		Meta struct {
+			Assignee *struct {
+				ID int `json:"id"`
+			} `json:"assignee"`
+		} `json:"meta"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/conversations/%d", conversationID), nil, &out); err != nil {
+		return 0, err
+	}
+	if out.Meta.Assignee == nil {
+		return 0, nil
+	}
+	return out.Meta.Assignee.ID, nil
+}
+
+// CreateMessage publica uma mensagem na conversa. messageType é "incoming"
+// (cliente) ou "outgoing"; private cria uma nota interna.
+func (c *Client) CreateMessage(ctx context.Context, conversationID int, content, messageType string, private bool, file *Attachment) error {
+	path := fmt.Sprintf("/conversations/%d/messages", conversationID)
+	if file == nil {
+		return c.do(ctx, http.MethodPost, path, map[string]interface{}{
+			"content": content, "message_type": messageType, "private": private,
+		}, nil)
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("content", content)
+	w.WriteField("message_type", messageType)
+	w.WriteField("private", fmt.Sprint(private))
+	part, err := w.CreatePart(filePartHeader(file))
+	if err != nil {
+		return err
+	}
+	part.Write(file.Data)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.send(ctx, http.MethodPost, path, w.FormDataContentType(), &buf, nil)
+}
+
+func filePartHeader(file *Attachment) map[string][]string {
+	name := strings.NewReplacer(`"`, "", "\r", "", "\n", "").Replace(file.FileName)
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="attachments[]"; filename="%s"`, name)},
+		"Content-Type":        {mimeType},
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	return c.send(ctx, method, path, contentType, body, out)
+}
+
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	endpoint := c.baseURL + "/api/v1/accounts/" + url.PathEscape(c.accountID) + path
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("api_access_token", c.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(data))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return &APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: msg}
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
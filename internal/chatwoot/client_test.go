@@ -0,0 +1,35 @@
+package chatwoot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+// O httptest escuta em 127.0.0.1: só uma URL gravada por super admin alcança.
+func TestClientHonorsAllowInternal(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/accounts/7/inboxes" || r.Header.Get("api_access_token") != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"payload":[{"id":3,"name":"WhatsApp loja1","channel_type":"Channel::Api"}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := models.ChatwootConfig{URL: srv.URL + "/", AccountID: "7", Token: "tok"}
+	if _, err := NewClient(cfg).Inboxes(context.Background()); !errors.Is(err, webhook.ErrInvalidURL) {
+		t.Fatalf("Chatwoot na rede interna sem liberação: err = %v", err)
+	}
+
+	cfg.AllowInternal = true
+	inboxes, err := NewClient(cfg).Inboxes(context.Background())
+	if err != nil || len(inboxes) != 1 || inboxes[0].ID != 3 {
+		t.Errorf("Inboxes() = %+v, %v", inboxes, err)
+	}
+}
@@ -0,0 +1,495 @@
+package chatwoot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+var ErrInvalidToken = errors.New("token do webhook inválido")
+
+const workers = 4
+
+// job é uma mensagem recebida no WhatsApp a espelhar no Chatwoot.
+type job struct {
+	instance string
+	cfg      models.ChatwootConfig
+	msg      *history.Summary
+	raw      json.RawMessage
+}
+
+// Connector espelha as mensagens recebidas de cada instância numa inbox API
+// do Chatwoot e envia pelo WhatsApp as respostas dos agentes, que chegam pelo
+// webhook da inbox. A relação conversa ↔ JID fica em chatwoot_conversas.
+type Connector struct {
+	db        *sqlx.DB
+	configs   *integrations.Store
+	service   *whatsapp.Service
+	publicURL string
+	secret    string
+
+	jobs []chan job
+}
+
+// New monta o conector. publicURL é o endereço do gateway visto pelo
+// Chatwoot; secret assina o token da URL do webhook.
+func New(db *sqlx.DB, configs *integrations.Store, service *whatsapp.Service, publicURL, secret string) *Connector {
+	c := &Connector{
+		db:        db,
+		configs:   configs,
+		service:   service,
+		publicURL: strings.TrimRight(publicURL, "/"),
+		secret:    secret,
+		jobs:      make([]chan job, workers),
+	}
+	for i := range c.jobs {
+		c.jobs[i] = make(chan job, 256)
+	}
+	return c
+}
+
+// Start sobe os workers. Cada chat cai sempre no mesmo worker, preservando
+// a ordem das mensagens.
+func (c *Connector) Start(ctx context.Context) {
+	for _, ch := range c.jobs {
+		go func(ch chan job) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-ch:
+					if err := c.mirror(ctx, j); err != nil {
+						log.Printf("⚠️ [chatwoot] erro ao espelhar mensagem de %s (%s): %v", j.msg.ChatJid, j.instance, err)
+					}
+				}
+			}
+		}(ch)
+	}
+}
+
+// HandleEvent é o listener do barramento: agenda o espelhamento das
+// mensagens novas recebidas em chats privados.
+func (c *Connector) HandleEvent(evt models.Event) {
+	if evt.Event != "messages.upsert" || evt.Instance == "" {
+		return
+	}
+
+	var upsert struct {
+		Type    string          `json:"type"`
+		Message json.RawMessage `json:"message"`
+	}
+	if json.Unmarshal(evt.Data, &upsert) != nil || upsert.Type != "notify" {
+		return
+	}
+	msg, ok := history.Summarize(evt.Data)
+	if !ok || msg.FromMe || !privateChat(msg.ChatJid) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cfg, err := c.configs.Get(ctx, evt.Instance)
+	if err != nil || !cfg.Chatwoot.Enabled || cfg.Chatwoot.InboxID == 0 {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(evt.Instance + "|" + msg.ChatJid))
+	select {
+	case c.jobs[h.Sum32()%workers] <- job{instance: evt.Instance, cfg: cfg.Chatwoot, msg: msg, raw: upsert.Message}:
+	default:
+		log.Printf("⚠️ [chatwoot] fila cheia, mensagem %s de %s não espelhada", msg.MessageID, evt.Instance)
+	}
+}
+
+func (c *Connector) mirror(ctx context.Context, j job) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	client := NewClient(j.cfg)
+	content := messageContent(j.msg)
+
+	var file *Attachment
+	if j.msg.Media != nil {
+		media, err := c.service.Client.DownloadMedia(ctx, whatsapp.DownloadMediaRequest{Instance: j.instance, Message: j.raw})
+		if err != nil {
+			log.Printf("⚠️ [chatwoot] mídia %s de %s não baixada: %v", j.msg.MessageID, j.instance, err)
+		} else if data, err := base64.StdEncoding.DecodeString(media.Base64); err == nil {
+			file = &Attachment{FileName: fileName(j.msg, media), MimeType: media.MimeType, Data: data}
+		}
+	}
+
+	conv, err := c.conversation(ctx, client, j)
+	if err != nil {
+		return err
+	}
+	err = client.CreateMessage(ctx, conv, content, "incoming", false, file)
+	if isNotFound(err) {
+		// Conversa apagada no Chatwoot: abre outra
+		if err := c.forget(ctx, j.instance, j.msg.ChatJid); err != nil {
+			return err
+		}
+		if conv, err = c.conversation(ctx, client, j); err != nil {
+			return err
+		}
+		err = client.CreateMessage(ctx, conv, content, "incoming", false, file)
+	}
+	return err
+}
+
+// conversation devolve a conversa do chat, criando contato e conversa no
+// Chatwoot na primeira mensagem.
+func (c *Connector) conversation(ctx context.Context, client *Client, j job) (int, error) {
+	var id int
+	err := c.db.GetContext(ctx, &id, `
+		SELECT conversation_id FROM chatwoot_conversas WHERE instance = $1 AND jid = $2 AND inbox_id = $3
+	`, j.instance, j.msg.ChatJid, j.cfg.InboxID)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	phone := ""
+	if strings.HasSuffix(j.msg.ChatJid, "@s.whatsapp.net") {
+		phone = "+" + strings.TrimSuffix(j.msg.ChatJid, "@s.whatsapp.net")
+	}
+
+	contact, err := c.findContact(ctx, client, j.msg.ChatJid, phone)
+	if err != nil {
+		return 0, err
+	}
+	if contact == nil {
+		name := j.msg.PushName
+		if name == "" {
+			name = strings.TrimPrefix(phone, "+")
+		}
+		if name == "" {
+			name = j.msg.ChatJid
+		}
+		if contact, err = client.CreateContact(ctx, j.cfg.InboxID, name, phone, j.msg.ChatJid); err != nil {
+			return 0, err
+		}
+	}
+
+	sourceID, err := client.ContactInbox(ctx, contact.ID, j.cfg.InboxID, j.msg.ChatJid)
+	if err != nil {
+		return 0, err
+	}
+	id, err = client.CreateConversation(ctx, sourceID, j.cfg.InboxID, contact.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = c.db.ExecContext(ctx, `
+		INSERT INTO chatwoot_conversas (instance, jid, inbox_id, contact_id, conversation_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (instance, jid) DO UPDATE
+		SET inbox_id = EXCLUDED.inbox_id, contact_id = EXCLUDED.contact_id,
+		    conversation_id = EXCLUDED.conversation_id, atualizado_em = NOW()
+	`, j.instance, j.msg.ChatJid, j.cfg.InboxID, contact.ID, id)
+	return id, err
+}
+
+// findContact procura o contato pelo identifier (JID) ou pelo telefone.
+func (c *Connector) findContact(ctx context.Context, client *Client, jid, phone string) (*Contact, error) {
+	query := phone
+	if query == "" {
+		query = jid
+	}
+	found, err := client.SearchContacts(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		if found[i].Identifier == jid || (phone != "" && found[i].PhoneNumber == phone) {
+			return &found[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *Connector) forget(ctx context.Context, instance, jid string) error {
+	_, err := c.db.ExecContext(ctx, `DELETE FROM chatwoot_conversas WHERE instance = $1 AND jid = $2`, instance, jid)
+	return err
+}
+
+// ============================================
+// INBOX E WEBHOOK
+// ============================================
+
+// Setup vincula a instância a uma inbox API: usa inbox_id se já existir,
+// senão procura pelo nome ou cria. A URL do webhook é sempre atualizada.
+func (c *Connector) Setup(ctx context.Context, instance string, cfg models.ChatwootConfig) (models.ChatwootConfig, error) {
+	client := NewClient(cfg)
+	webhookURL := c.WebhookURL(instance)
+	if cfg.InboxName == "" {
+		cfg.InboxName = "WhatsApp " + instance
+	}
+
+	if cfg.InboxID > 0 {
+		if _, err := client.Inbox(ctx, cfg.InboxID); err == nil {
+			return cfg, client.UpdateInboxWebhook(ctx, cfg.InboxID, webhookURL)
+		} else if !isNotFound(err) {
+			return cfg, err
+		}
+		cfg.InboxID = 0
+	}
+
+	inboxes, err := client.Inboxes(ctx)
+	if err != nil {
+		return cfg, err
+	}
+	for _, inbox := range inboxes {
+		if inbox.Name == cfg.InboxName && inbox.ChannelType == "Channel::Api" {
+			cfg.InboxID = inbox.ID
+			return cfg, client.UpdateInboxWebhook(ctx, inbox.ID, webhookURL)
+		}
+	}
+
+	inbox, err := client.CreateInbox(ctx, cfg.InboxName, webhookURL)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.InboxID = inbox.ID
+	return cfg, nil
+}
+
+// WebhookURL é a URL configurada na inbox para receber as respostas.
+func (c *Connector) WebhookURL(instance string) string {
+	return c.publicURL + "/integrations/chatwoot/" + url.PathEscape(instance) + "?token=" + c.token(instance)
+}
+
+func (c *Connector) token(instance string) string {
+	mac := hmac.New(sha256.New, []byte(c.secret))
+	mac.Write([]byte("chatwoot:" + instance))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// webhookPayload é o recorte do evento message_created que interessa.
+type webhookPayload struct {
+	Event       string          `json:"event"`
+	ID          int             `json:"id"`
+	Content     string          `json:"content"`
+	MessageType json.RawMessage `json:"message_type"`
+	Private     bool            `json:"private"`
+	Attachments []struct {
+		FileType string `json:"file_type"`
+		DataURL  string `json:"data_url"`
+	} `json:"attachments"`
+	Conversation struct {
+		ID   int `json:"id"`
+		Meta struct {
+			Sender struct {
+				Identifier  string `json:"identifier"`
+				PhoneNumber string `json:"phone_number"`
+			} `json:"sender"`
+		} `json:"meta"`
+	} `json:"conversation"`
+}
+
+// outgoing indica resposta pública de agente (message_type "outgoing" ou 1).
+func (p *webhookPayload) outgoing() bool {
+	t := strings.Trim(string(p.MessageType), `"`)
+	return p.Event == "message_created" && !p.Private && (t == "outgoing" || t == "1")
+}
+
+// HandleWebhook valida o token e envia a resposta do agente em segundo
+// plano; o Chatwoot não espera pelo envio.
+func (c *Connector) HandleWebhook(instance, token string, body []byte) error {
+	if !hmac.Equal([]byte(token), []byte(c.token(instance))) {
+		return ErrInvalidToken
+	}
+
+	var p webhookPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return err
+	}
+	if !p.outgoing() || (strings.TrimSpace(p.Content) == "" && len(p.Attachments) == 0) {
+		return nil
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if err := c.reply(ctx, instance, &p); err != nil {
+			log.Printf("⚠️ [chatwoot] resposta da conversa %d não enviada (%s): %v", p.Conversation.ID, instance, err)
+		}
+	}()
+	return nil
+}
+
+func (c *Connector) reply(ctx context.Context, instance string, p *webhookPayload) error {
+	cfg, err := c.configs.Get(ctx, instance)
+	if err != nil {
+		return err
+	}
+	if !cfg.Chatwoot.Enabled {
+		return nil
+	}
+
+	jid, err := c.jidFor(ctx, instance, p)
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	if len(p.Attachments) == 0 {
+		_, sendErr = c.service.SendMessage(ctx, instance, models.SendMessageRequest{Type: "text", Number: jid, Text: p.Content})
+	}
+	for i, att := range p.Attachments {
+		media := &models.MediaPayload{URL: att.DataURL, Type: mediaType(att.FileType), FileName: attachmentName(att.DataURL)}
+		if i == 0 {
+			media.Caption = p.Content
+		}
+		if _, err := c.service.SendMessage(ctx, instance, models.SendMessageRequest{Type: "media", Number: jid, Media: media}); err != nil {
+			sendErr = err
+		}
+	}
+
+	if sendErr != nil {
+		// Avisa o agente na própria conversa
+		note := "⚠️ Mensagem não entregue no WhatsApp: " + sendErr.Error()
+		if err := NewClient(cfg.Chatwoot).CreateMessage(ctx, p.Conversation.ID, note, "outgoing", true, nil); err != nil {
+			log.Printf("⚠️ [chatwoot] erro ao registrar falha na conversa %d: %v", p.Conversation.ID, err)
+		}
+	}
+	return sendErr
+}
+
+// jidFor acha o chat da conversa pelo mapeamento ou pelo contato.
+func (c *Connector) jidFor(ctx context.Context, instance string, p *webhookPayload) (string, error) {
+	var jid string
+	err := c.db.GetContext(ctx, &jid, `
+		SELECT jid FROM chatwoot_conversas WHERE instance = $1 AND conversation_id = $2
+	`, instance, p.Conversation.ID)
+	if err == nil {
+		return jid, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+
+	sender := p.Conversation.Meta.Sender
+	if strings.Contains(sender.Identifier, "@") {
+		return sender.Identifier, nil
+	}
+	if digits := onlyDigits(sender.PhoneNumber); digits != "" {
+		return digits + "@s.whatsapp.net", nil
+	}
+	return "", fmt.Errorf("conversa %d sem contato do WhatsApp", p.Conversation.ID)
+}
+
+// Assigned indica se o chat tem um agente atribuído no Chatwoot. Sem
+// Chatwoot ou sem conversa espelhada, não há agente.
+func (c *Connector) Assigned(ctx context.Context, instance, jid string) (bool, error) {
+	cfg, err := c.configs.Get(ctx, instance)
+	if err != nil || !cfg.Chatwoot.Enabled {
+		return false, err
+	}
+
+	var conv int
+	err = c.db.GetContext(ctx, &conv, `
+		SELECT conversation_id FROM chatwoot_conversas WHERE instance = $1 AND jid = $2
+	`, instance, jid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	assignee, err := NewClient(cfg.Chatwoot).Assignee(ctx, conv)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return assignee != 0, err
+}
+
+// ============================================
+// CONVERSÕES
+// ============================================
+
+var typeLabels = map[string]string{
+	"image": "imagem", "video": "vídeo", "audio": "áudio", "document": "documento",
+	"sticker": "figurinha", "location": "localização", "contact": "contato", "poll": "enquete",
+}
+
+func messageContent(m *history.Summary) string {
+	switch {
+	case m.Type == "reaction" && m.Text != "":
+		return "Reagiu com " + m.Text
+	case m.Text != "":
+		return m.Text
+	case m.Media != nil:
+		return ""
+	}
+	if label, ok := typeLabels[m.Type]; ok {
+		return "[" + label + "]"
+	}
+	return "[" + m.Type + "]"
+}
+
+func fileName(m *history.Summary, media *whatsapp.MediaFile) string {
+	if media.FileName != "" {
+		return media.FileName
+	}
+	ext := ""
+	if i := strings.Index(media.MimeType, "/"); i >= 0 {
+		ext = "." + strings.SplitN(media.MimeType[i+1:], ";", 2)[0]
+	}
+	return m.Type + "-" + m.MessageID + ext
+}
+
+func mediaType(fileType string) string {
+	switch fileType {
+	case "image", "video", "audio":
+		return fileType
+	}
+	return "document"
+}
+
+func attachmentName(dataURL string) string {
+	u, err := url.Parse(dataURL)
+	if err != nil {
+		return "arquivo"
+	}
+	if name := path.Base(u.Path); name != "." && name != "/" {
+		return name
+	}
+	return "arquivo"
+}
+
+// privateChat exclui grupos, status e canais.
+func privateChat(jid string) bool {
+	return strings.HasSuffix(jid, "@s.whatsapp.net") || strings.HasSuffix(jid, "@lid")
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+// Package dbtest abre o PostgreSQL usado pelos testes de integração dos
+// pacotes que dependem de SQL (fila, agendamentos, campanhas, histórico).
+package dbtest
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// Open conecta no banco de TEST_DATABASE_URL, que precisa ter o schema.sql
+// aplicado. Sem a variável, o teste é pulado: go test ./... roda sem banco.
+func Open(t testing.TB) *sqlx.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL não definida")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatalf("conectar em TEST_DATABASE_URL: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Instance cria uma instância com nome único e apaga, ao fim do teste, as
+// linhas dela nas tabelas informadas (coluna instance) e a própria instância.
+func Instance(t testing.TB, db *sqlx.DB, tables ...string) string {
+	t.Helper()
+	name := "teste-" + strings.SplitN(uuid.NewString(), "-", 2)[0]
+	if _, err := db.Exec(`INSERT INTO instancias (nome) VALUES ($1)`, name); err != nil {
+		t.Fatalf("criar instância de teste: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, table := range tables {
+			db.Exec(`DELETE FROM `+table+` WHERE instance = $1`, name)
+		}
+		db.Exec(`DELETE FROM instancias WHERE nome = $1`, name)
+	})
+	return name
+}
+
+// APIKey cria uma key de teste com o limite diário de mensagens informado
+// (0 = sem limite) e a apaga ao fim do teste.
+func APIKey(t testing.TB, db *sqlx.DB, dailyLimit int) int {
+	t.Helper()
+	var id int
+	err := db.Get(&id, `
+		INSERT INTO api_keys (key_hash, key_prefix, nome, scopes, limite_mensagens_dia)
+		VALUES ($1, 'teste', 'teste de integração', ARRAY['*'], NULLIF($2, 0))
+		RETURNING id
+	`, uuid.NewString(), dailyLimit)
+	if err != nil {
+		t.Fatalf("criar key de teste: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DELETE FROM api_keys WHERE id = $1`, id) })
+	return id
+}
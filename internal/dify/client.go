@@ -0,0 +1,291 @@
+package dify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+// APIError é uma resposta de erro da API do Dify.
+type APIError struct {
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("dify %s respondeu %d: %s", e.Path, e.StatusCode, e.Body)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// File é um arquivo de entrada (já enviado via /files/upload) ou de saída
+// (URL gerada pelo app).
+type File struct {
+	Type         string `json:"type"` // image, document, audio, video
+	URL          string `json:"url,omitempty"`
+	UploadFileID string `json:"upload_file_id,omitempty"`
+	Transfer     string `json:"transfer_method,omitempty"`
+	FileName     string `json:"filename,omitempty"`
+}
+
+// Answer é o resultado de uma chamada: textos e arquivos na ordem em que o
+// app os produziu.
+type Answer struct {
+	ConversationID string
+	Outputs        []Output
+}
+
+// Output é um texto ou um arquivo da resposta.
+type Output struct {
+	Text string
+	File *File
+}
+
+// Client fala com a API de um app do Dify (a key identifica o app).
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func NewClient(cfg models.DifyConfig) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(cfg.URL, "/"),
+		apiKey:  cfg.ApiKey,
+		http:    webhook.NewClient(2*time.Minute, cfg.AllowInternal),
+	}
+}
+
+// Chat envia a mensagem a um app de chat (chatbot, agente ou chatflow). Usa
+// streaming porque apps de agente não aceitam o modo blocking.
+func (c *Client) Chat(ctx context.Context, user, conversationID, query string, files []File) (*Answer, error) {
+	body := map[string]interface{}{
+		"inputs":          map[string]string{},
+		"query":           query,
+		"response_mode":   "streaming",
+		"conversation_id": conversationID,
+		"user":            user,
+	}
+	if len(files) > 0 {
+		body["files"] = files
+	}
+
+	resp, err := c.post(ctx, "/chat-messages", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	answer := &Answer{ConversationID: conversationID}
+	var text strings.Builder
+	flush := func() {
+		if t := strings.TrimSpace(text.String()); t != "" {
+			answer.Outputs = append(answer.Outputs, Output{Text: t})
+		}
+		text.Reset()
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var evt struct {
+			Event          string `json:"event"`
+			Answer         string `json:"answer"`
+			ConversationID string `json:"conversation_id"`
+			Type           string `json:"type"`
+			URL            string `json:"url"`
+			BelongsTo      string `json:"belongs_to"`
+			Message        string `json:"message"`
+		}
+		if json.Unmarshal([]byte(strings.TrimSpace(line[5:])), &evt) != nil {
+			continue
+		}
+		if evt.ConversationID != "" {
+			answer.ConversationID = evt.ConversationID
+		}
+		switch evt.Event {
+		case "message", "agent_message":
+			text.WriteString(evt.Answer)
+		case "message_replace":
+			text.Reset()
+			text.WriteString(evt.Answer)
+		case "message_file":
+			if evt.BelongsTo != "user" && evt.URL != "" {
+				flush()
+				answer.Outputs = append(answer.Outputs, Output{File: &File{Type: evt.Type, URL: c.absolute(evt.URL)}})
+			}
+		case "error":
+			return nil, &APIError{Path: "/chat-messages", StatusCode: http.StatusBadGateway, Body: evt.Message}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return answer, nil
+}
+
+// Workflow executa um app de workflow com a mensagem na variável informada.
+// Saídas de texto viram mensagens e saídas de arquivo viram mídia.
+func (c *Client) Workflow(ctx context.Context, user, variable, query string) (*Answer, error) {
+	resp, err := c.post(ctx, "/workflows/run", map[string]interface{}{
+		"inputs":        map[string]string{variable: query},
+		"response_mode": "blocking",
+		"user":          user,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Data struct {
+			Status  string                     `json:"status"`
+			Error   string                     `json:"error"`
+			Outputs map[string]json.RawMessage `json:"outputs"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&out); err != nil {
+		return nil, err
+	}
+	if out.Data.Status != "" && out.Data.Status != "succeeded" {
+		return nil, fmt.Errorf("workflow terminou com status %s: %s", out.Data.Status, out.Data.Error)
+	}
+
+	answer := &Answer{}
+	for _, key := range sortedKeys(out.Data.Outputs) {
+		c.collect(answer, out.Data.Outputs[key])
+	}
+	return answer, nil
+}
+
+// collect lê uma saída do workflow: texto, arquivo ou lista de arquivos.
+func (c *Client) collect(answer *Answer, raw json.RawMessage) {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		if text = strings.TrimSpace(text); text != "" {
+			answer.Outputs = append(answer.Outputs, Output{Text: text})
+		}
+		return
+	}
+	var file File
+	if json.Unmarshal(raw, &file) == nil && file.URL != "" {
+		file.URL = c.absolute(file.URL)
+		answer.Outputs = append(answer.Outputs, Output{File: &file})
+		return
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		for _, item := range list {
+			c.collect(answer, item)
+		}
+	}
+}
+
+// Upload envia um arquivo recebido no WhatsApp para usar em Chat.
+func (c *Client) Upload(ctx context.Context, user, fileName, mimeType string, data []byte) (string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("user", user)
+	part, err := w.CreatePart(map[string][]string{
+		"Content-Disposition": {fmt.Sprintf(`form-data; name="file"; filename="%s"`, strings.ReplaceAll(fileName, `"`, ""))},
+		"Content-Type":        {mimeType},
+	})
+	if err != nil {
+		return "", err
+	}
+	part.Write(data)
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	resp, err := c.send(ctx, "/files/upload", w.FormDataContentType(), &buf)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, in interface{}) (*http.Response, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, path, "application/json", bytes.NewReader(data))
+}
+
+// send devolve a resposta aberta quando o status é 2xx.
+func (c *Client) send(ctx context.Context, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		msg := strings.TrimSpace(string(raw))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return nil, &APIError{Path: path, StatusCode: resp.StatusCode, Body: msg}
+	}
+	return resp, nil
+}
+
+// absolute completa URLs relativas (/files/...) com o host da API.
+func (c *Client) absolute(u string) string {
+	if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+		return u
+	}
+	base := c.baseURL
+	if i := strings.Index(base, "://"); i >= 0 {
+		if j := strings.Index(base[i+3:], "/"); j >= 0 {
+			base = base[:i+3+j]
+		}
+	}
+	return base + "/" + strings.TrimLeft(u, "/")
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
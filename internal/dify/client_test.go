@@ -0,0 +1,96 @@
+package dify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+func difyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer app-teste" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/chat-messages":
+			if body["response_mode"] != "streaming" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"event\":\"agent_message\",\"answer\":\"Segue \",\"conversation_id\":\"c1\"}\n\n" +
+				"event: ping\n\n" +
+				"data: {\"event\":\"agent_message\",\"answer\":\"o catálogo\"}\n\n" +
+				"data: {\"event\":\"message_file\",\"type\":\"image\",\"url\":\"/files/tools/x.png\",\"belongs_to\":\"assistant\"}\n\n" +
+				"data: {\"event\":\"message_end\"}\n\n"))
+		case "/v1/workflows/run":
+			inputs, _ := body["inputs"].(map[string]interface{})
+			if inputs["pergunta"] != "oi" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"data":{"status":"succeeded","outputs":{"b_texto":"Olá!","a_arquivos":[{"type":"document","url":"https://cdn.exemplo.com/f.pdf"}]}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestChatStreamsTextAndFiles(t *testing.T) {
+	srv := difyServer(t)
+	ctx := context.Background()
+	cfg := models.DifyConfig{URL: srv.URL + "/v1/", ApiKey: "app-teste"}
+
+	// O httptest escuta em 127.0.0.1: sem a liberação do super admin a
+	// conexão é recusada
+	if _, err := NewClient(cfg).Chat(ctx, "5511987654321@s.whatsapp.net", "", "oi", nil); !errors.Is(err, webhook.ErrInvalidURL) {
+		t.Fatalf("Dify na rede interna sem liberação: err = %v", err)
+	}
+
+	cfg.AllowInternal = true
+	answer, err := NewClient(cfg).Chat(ctx, "5511987654321@s.whatsapp.net", "", "oi", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer.ConversationID != "c1" || len(answer.Outputs) != 2 {
+		t.Fatalf("Chat() = %+v", answer)
+	}
+	if answer.Outputs[0].Text != "Segue o catálogo" {
+		t.Errorf("texto = %q", answer.Outputs[0].Text)
+	}
+	if f := answer.Outputs[1].File; f == nil || f.URL != srv.URL+"/files/tools/x.png" {
+		t.Errorf("arquivo = %+v, want URL absoluta no host da API", f)
+	}
+}
+
+func TestWorkflowCollectsOutputs(t *testing.T) {
+	srv := difyServer(t)
+	client := NewClient(models.DifyConfig{URL: srv.URL + "/v1", ApiKey: "app-teste", AllowInternal: true})
+
+	answer, err := client.Workflow(context.Background(), "5511987654321@s.whatsapp.net", "pergunta", "oi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Saídas na ordem das chaves: a_arquivos antes de b_texto
+	if len(answer.Outputs) != 2 || answer.Outputs[0].File == nil || answer.Outputs[1].Text != "Olá!" {
+		t.Errorf("Workflow() = %+v", answer.Outputs)
+	}
+
+	bad := NewClient(models.DifyConfig{URL: srv.URL + "/v1", ApiKey: "outra", AllowInternal: true})
+	var apiErr *APIError
+	if _, err := bad.Workflow(context.Background(), "u", "pergunta", "oi"); !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Errorf("key inválida: err = %v", err)
+	}
+}
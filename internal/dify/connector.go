@@ -0,0 +1,282 @@
+package dify
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/handoff"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+const workers = 4
+
+// AgentLookup diz se um atendente humano está atribuído ao chat (ex.: no
+// Chatwoot). Usado pelo gatilho no_agent.
+type AgentLookup interface {
+	Assigned(ctx context.Context, instance, jid string) (bool, error)
+}
+
+type job struct {
+	instance string
+	cfg      models.DifyConfig
+	msg      *history.Summary
+	raw      json.RawMessage
+}
+
+// conversation é o vínculo do contato com o app (dify_conversas). Para apps
+// de workflow ConversationID fica vazio e a linha só marca a atividade.
+type conversation struct {
+	ConversationID string    `db:"conversation_id"`
+	AtualizadoEm   time.Time `db:"atualizado_em"`
+}
+
+// Connector encaminha ao app do Dify as mensagens que o motor de gatilhos
+// destina a ele e devolve as saídas (textos e arquivos) pela fila de envio.
+type Connector struct {
+	db       *sqlx.DB
+	configs  *integrations.Store
+	handoffs *handoff.Store
+	agents   AgentLookup
+	service  *whatsapp.Service
+	queue    *queue.Queue
+
+	jobs []chan job
+}
+
+func New(db *sqlx.DB, configs *integrations.Store, handoffs *handoff.Store, agents AgentLookup, service *whatsapp.Service, q *queue.Queue) *Connector {
+	c := &Connector{
+		db:       db,
+		configs:  configs,
+		handoffs: handoffs,
+		agents:   agents,
+		service:  service,
+		queue:    q,
+		jobs:     make([]chan job, workers),
+	}
+	for i := range c.jobs {
+		c.jobs[i] = make(chan job, 256)
+	}
+	return c
+}
+
+// Start sobe os workers. Cada chat cai sempre no mesmo worker.
+func (c *Connector) Start(ctx context.Context) {
+	for _, ch := range c.jobs {
+		go func(ch chan job) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-ch:
+					if err := c.handle(ctx, j); err != nil {
+						log.Printf("⚠️ [dify] erro ao responder %s (%s): %v", j.msg.ChatJid, j.instance, err)
+					}
+				}
+			}
+		}(ch)
+	}
+}
+
+// Deliver agenda uma mensagem encaminhada pelo motor de gatilhos.
+func (c *Connector) Deliver(instance string, msg *history.Summary, raw json.RawMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cfg, err := c.configs.Get(ctx, instance)
+	if err != nil || !cfg.Dify.Enabled {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(instance + "|" + msg.ChatJid))
+	select {
+	case c.jobs[h.Sum32()%workers] <- job{instance: instance, cfg: cfg.Dify, msg: msg, raw: raw}:
+	default:
+		log.Printf("⚠️ [dify] fila cheia, mensagem %s de %s ignorada", msg.MessageID, instance)
+	}
+}
+
+func (c *Connector) handle(ctx context.Context, j job) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+
+	jid, text := j.msg.ChatJid, strings.TrimSpace(j.msg.Text)
+
+	if human, err := c.handoffs.Active(ctx, j.instance, jid); err != nil || human {
+		return err
+	}
+	if j.cfg.TriggerType == "no_agent" && c.agents != nil {
+		if assigned, err := c.agents.Assigned(ctx, j.instance, jid); err != nil || assigned {
+			return err
+		}
+	}
+
+	conv, err := c.conversation(ctx, j.instance, jid)
+	if err != nil {
+		return err
+	}
+	if conv != nil && j.cfg.StopKeyword != "" && strings.EqualFold(text, j.cfg.StopKeyword) {
+		return c.forget(ctx, j.instance, jid)
+	}
+	if conv != nil && j.cfg.ExpireMinutes > 0 && time.Since(conv.AtualizadoEm) > time.Duration(j.cfg.ExpireMinutes)*time.Minute {
+		if err := c.forget(ctx, j.instance, jid); err != nil {
+			return err
+		}
+		conv = nil
+	}
+	if conv == nil && !triggered(j.cfg, text) {
+		return nil
+	}
+
+	query := text
+	if query == "" {
+		query = "[" + j.msg.Type + "]"
+	}
+
+	client := NewClient(j.cfg)
+	var answer *Answer
+	if j.cfg.AppType == "workflow" {
+		variable := j.cfg.InputVariable
+		if variable == "" {
+			variable = "query"
+		}
+		answer, err = client.Workflow(ctx, jid, variable, query)
+	} else {
+		conversationID := ""
+		if conv != nil {
+			conversationID = conv.ConversationID
+		}
+		files := c.upload(ctx, client, j)
+		answer, err = client.Chat(ctx, jid, conversationID, query, files)
+		if isNotFound(err) && conversationID != "" {
+			// Conversa apagada no Dify: recomeça
+			answer, err = client.Chat(ctx, jid, "", query, files)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = c.db.ExecContext(ctx, `
+		INSERT INTO dify_conversas (instance, jid, conversation_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (instance, jid) DO UPDATE
+		SET conversation_id = EXCLUDED.conversation_id, atualizado_em = NOW()
+	`, j.instance, jid, answer.ConversationID)
+	if err != nil {
+		return err
+	}
+
+	for _, out := range answer.Outputs {
+		req := models.SendMessageRequest{Type: "text", Number: jid, Text: out.Text}
+		if out.File != nil {
+			req = models.SendMessageRequest{Type: "media", Number: jid, Media: &models.MediaPayload{
+				Type: mediaType(out.File.Type), URL: out.File.URL, FileName: fileName(out.File),
+			}}
+		} else {
+			req.Text = strings.ReplaceAll(req.Text, "**", "*")
+		}
+		if _, err := c.queue.Enqueue(ctx, j.instance, req, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upload envia a mídia recebida ao Dify. Falhas não impedem a resposta ao
+// texto/legenda.
+func (c *Connector) upload(ctx context.Context, client *Client, j job) []File {
+	if j.msg.Media == nil {
+		return nil
+	}
+	media, err := c.service.Client.DownloadMedia(ctx, whatsapp.DownloadMediaRequest{Instance: j.instance, Message: j.raw})
+	if err != nil {
+		log.Printf("⚠️ [dify] mídia %s de %s não baixada: %v", j.msg.MessageID, j.instance, err)
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(media.Base64)
+	if err != nil {
+		return nil
+	}
+
+	name := media.FileName
+	if name == "" {
+		name = j.msg.MessageID
+	}
+	id, err := client.Upload(ctx, j.msg.ChatJid, name, media.MimeType, data)
+	if err != nil {
+		log.Printf("⚠️ [dify] mídia %s de %s não enviada: %v", j.msg.MessageID, j.instance, err)
+		return nil
+	}
+
+	kind := "document"
+	switch j.msg.Type {
+	case "image", "audio", "video":
+		kind = j.msg.Type
+	}
+	return []File{{Type: kind, Transfer: "local_file", UploadFileID: id}}
+}
+
+func (c *Connector) conversation(ctx context.Context, instance, jid string) (*conversation, error) {
+	var conv conversation
+	err := c.db.GetContext(ctx, &conv, `
+		SELECT conversation_id, atualizado_em FROM dify_conversas WHERE instance = $1 AND jid = $2
+	`, instance, jid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+func (c *Connector) forget(ctx context.Context, instance, jid string) error {
+	_, err := c.db.ExecContext(ctx, `DELETE FROM dify_conversas WHERE instance = $1 AND jid = $2`, instance, jid)
+	return err
+}
+
+// triggered decide se a mensagem inicia uma conversa para um contato sem
+// conversa ativa.
+func triggered(cfg models.DifyConfig, text string) bool {
+	if cfg.TriggerType != "keyword" {
+		return true
+	}
+	for _, kw := range cfg.Keywords {
+		if strings.EqualFold(strings.TrimSpace(kw), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func mediaType(fileType string) string {
+	switch fileType {
+	case "image", "video", "audio":
+		return fileType
+	}
+	return "document"
+}
+
+func fileName(f *File) string {
+	if f.FileName != "" {
+		return f.FileName
+	}
+	name := path.Base(strings.SplitN(f.URL, "?", 2)[0])
+	if name == "." || name == "/" {
+		return "arquivo"
+	}
+	return name
+}
@@ -0,0 +1,107 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/nexus/gowhats/internal/models"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Sink é um destino externo dos eventos de uma instância.
+type Sink interface {
+	Publish(ctx context.Context, evt Event, body []byte) error
+	Close() error
+}
+
+// amqpSink publica na fila durável configurada (exchange padrão, routing key
+// = nome da fila) com publisher confirms. A conexão é aberta na primeira
+// publicação e refeita após qualquer erro.
+type amqpSink struct {
+	cfg models.RabbitMQConfig
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func newAMQPSink(cfg models.RabbitMQConfig) *amqpSink {
+	return &amqpSink{cfg: cfg}
+}
+
+func (s *amqpSink) Publish(ctx context.Context, evt Event, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+
+	dc, err := s.ch.PublishWithDeferredConfirmWithContext(ctx, "", s.cfg.Queue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    evt.ID,
+		Type:         evt.Type,
+		Timestamp:    evt.Timestamp,
+		AppId:        "nexus-gowhats",
+		Headers:      amqp.Table{"instance": evt.Instance},
+		Body:         body,
+	})
+	if err != nil {
+		s.reset()
+		return err
+	}
+
+	acked, err := dc.WaitContext(ctx)
+	if err != nil {
+		s.reset()
+		return err
+	}
+	if !acked {
+		return errors.New("rabbitmq recusou a mensagem (nack)")
+	}
+	return nil
+}
+
+func (s *amqpSink) connect() error {
+	if s.ch != nil && !s.ch.IsClosed() {
+		return nil
+	}
+	s.reset()
+
+	conn, err := amqp.Dial(s.cfg.URI)
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := ch.QueueDeclare(s.cfg.Queue, true, false, false, false, nil); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.conn, s.ch = conn, ch
+	return nil
+}
+
+func (s *amqpSink) reset() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn, s.ch = nil, nil
+}
+
+func (s *amqpSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	return nil
+}
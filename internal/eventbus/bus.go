@@ -0,0 +1,333 @@
+package eventbus
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+var ErrInstanceNotFound = errors.New("instância não encontrada")
+
+// Bus recebe os eventos do sidecar, entrega a versão crua aos webhooks e a
+// versão tipada às filas (RabbitMQ, SQS) e ao stream WebSocket configurados
+// em instancias.eventos. Cada instância tem uma fila própria em memória,
+// preservando a ordem dos eventos.
+type Bus struct {
+	db       *sqlx.DB
+	webhooks *webhook.Dispatcher
+	hub      *Hub
+	ttl      time.Duration
+
+	ctx       context.Context
+	mu        sync.Mutex
+	lanes     map[string]*lane
+	listeners []Listener
+
+	cfgMu   sync.RWMutex
+	configs map[string]cachedConfig
+}
+
+// Listener recebe os eventos crus do sidecar dentro do gateway (conectores
+// como o Chatwoot). Roda no caminho de quem publicou e não pode bloquear.
+type Listener func(evt models.Event)
+
+type cachedConfig struct {
+	cfg      models.EventsConfig
+	loadedAt time.Time
+}
+
+// lane guarda a fila e os destinos de uma instância. Só o goroutine da lane
+// mexe em sinks.
+type lane struct {
+	instance string
+	events   chan Event
+	done     chan struct{} // fechado por Forget
+
+	rabbitCfg models.RabbitMQConfig
+	sqsCfg    models.SQSConfig
+	rabbit    Sink
+	sqs       Sink
+}
+
+const (
+	laneBuffer     = 1024
+	publishRetries = 3
+)
+
+func New(db *sqlx.DB, webhooks *webhook.Dispatcher) *Bus {
+	return &Bus{
+		db:       db,
+		webhooks: webhooks,
+		hub:      NewHub(),
+		ttl:      30 * time.Second,
+		ctx:      context.Background(),
+		lanes:    make(map[string]*lane),
+		configs:  make(map[string]cachedConfig),
+	}
+}
+
+// Start define o contexto das lanes; quando ele é cancelado as lanes
+// fecham as conexões com os brokers.
+func (b *Bus) Start(ctx context.Context) {
+	b.mu.Lock()
+	b.ctx = ctx
+	b.mu.Unlock()
+}
+
+// Hub dá acesso ao destino WebSocket para quem serve o stream.
+func (b *Bus) Hub() *Hub {
+	return b.hub
+}
+
+// Listen registra um consumidor interno dos eventos.
+func (b *Bus) Listen(fn Listener) {
+	b.mu.Lock()
+	b.listeners = append(b.listeners, fn)
+	b.mu.Unlock()
+}
+
+// Publish distribui um evento do sidecar sem bloquear quem o emitiu.
+func (b *Bus) Publish(evt models.Event) {
+	b.webhooks.Dispatch(evt)
+
+	b.mu.Lock()
+	listeners := b.listeners
+	b.mu.Unlock()
+	for _, fn := range listeners {
+		fn(evt)
+	}
+
+	if evt.Instance == "" {
+		return
+	}
+	l := b.lane(evt.Instance)
+	for _, typed := range Classify(evt) {
+		select {
+		case l.events <- typed:
+		default:
+			log.Printf("⚠️ [eventos] fila de %s cheia, descartando %s", evt.Instance, typed.Type)
+		}
+	}
+}
+
+func (b *Bus) lane(instance string) *lane {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, ok := b.lanes[instance]
+	if !ok {
+		l = &lane{instance: instance, events: make(chan Event, laneBuffer), done: make(chan struct{})}
+		b.lanes[instance] = l
+		go b.run(b.ctx, l)
+	}
+	return l
+}
+
+func (b *Bus) run(ctx context.Context, l *lane) {
+	defer l.close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.done:
+			return
+		case evt := <-l.events:
+			b.deliver(ctx, l, evt)
+		}
+	}
+}
+
+// Forget encerra a lane da instância apagada, fechando as conexões com os
+// brokers, e descarta a configuração em cache. Um evento que chegue depois
+// recria a lane.
+func (b *Bus) Forget(instance string) {
+	b.mu.Lock()
+	l, ok := b.lanes[instance]
+	delete(b.lanes, instance)
+	b.mu.Unlock()
+	if ok {
+		close(l.done)
+	}
+
+	b.cfgMu.Lock()
+	delete(b.configs, instance)
+	b.cfgMu.Unlock()
+}
+
+func (b *Bus) deliver(ctx context.Context, l *lane, evt Event) {
+	cfg, err := b.Config(ctx, l.instance)
+	if err != nil {
+		log.Printf("⚠️ [eventos] config de %s indisponível: %v", l.instance, err)
+		return
+	}
+
+	if cfg.WebSocket {
+		b.hub.publish(evt)
+	}
+
+	l.sync(cfg)
+	if l.rabbit == nil && l.sqs == nil {
+		return
+	}
+
+	body, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("❌ [eventos] evento %s inválido: %v", evt.Type, err)
+		return
+	}
+
+	if l.rabbit != nil && wants(cfg.RabbitMQ.Events, evt.Type) {
+		publish(ctx, "rabbitmq", l.rabbit, evt, body)
+	}
+	if l.sqs != nil && wants(cfg.SQS.Events, evt.Type) {
+		publish(ctx, "sqs", l.sqs, evt, body)
+	}
+}
+
+// publish tenta algumas vezes com espera crescente; depois o evento é
+// descartado (a ordem da lane vale mais que um evento preso).
+func publish(ctx context.Context, name string, sink Sink, evt Event, body []byte) {
+	var err error
+	for attempt := 1; attempt <= publishRetries; attempt++ {
+		pctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		err = sink.Publish(pctx, evt, body)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt < publishRetries {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+	}
+	log.Printf("❌ [eventos] %s de %s não entregue ao %s: %v", evt.Type, evt.Instance, name, err)
+}
+
+// sync recria os destinos da lane quando a configuração muda.
+func (l *lane) sync(cfg models.EventsConfig) {
+	rabbitCfg, sqsCfg := cfg.RabbitMQ, cfg.SQS
+	if !rabbitCfg.Enabled {
+		rabbitCfg = models.RabbitMQConfig{}
+	}
+	if !sqsCfg.Enabled {
+		sqsCfg = models.SQSConfig{}
+	}
+
+	if !reflect.DeepEqual(rabbitCfg, l.rabbitCfg) {
+		if l.rabbit != nil {
+			l.rabbit.Close()
+			l.rabbit = nil
+		}
+		if rabbitCfg.Enabled {
+			l.rabbit = newAMQPSink(rabbitCfg)
+		}
+		l.rabbitCfg = rabbitCfg
+	}
+
+	if !reflect.DeepEqual(sqsCfg, l.sqsCfg) {
+		if l.sqs != nil {
+			l.sqs.Close()
+			l.sqs = nil
+		}
+		if sqsCfg.Enabled {
+			l.sqs = newSQSSink(sqsCfg)
+		}
+		l.sqsCfg = sqsCfg
+	}
+}
+
+func (l *lane) close() {
+	if l.rabbit != nil {
+		l.rabbit.Close()
+	}
+	if l.sqs != nil {
+		l.sqs.Close()
+	}
+}
+
+// ============================================
+// CONFIGURAÇÃO POR INSTÂNCIA (instancias.eventos)
+// ============================================
+
+// Config devolve a configuração de eventos da instância (padrões quando
+// nunca foi configurada). O webhook continua em /webhook e não vem aqui. O
+// valor devolvido é uma cópia: quem chama pode alterá-lo sem mexer no cache.
+func (b *Bus) Config(ctx context.Context, instance string) (models.EventsConfig, error) {
+	b.cfgMu.RLock()
+	entry, ok := b.configs[instance]
+	b.cfgMu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < b.ttl {
+		return cloneConfig(entry.cfg), nil
+	}
+
+	var raw []byte
+	err := b.db.GetContext(ctx, &raw, `SELECT eventos FROM instancias WHERE nome = $1`, instance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.EventsConfig{}, ErrInstanceNotFound
+	}
+	if err != nil {
+		return models.EventsConfig{}, err
+	}
+
+	cfg := models.DefaultEventsConfig()
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return models.EventsConfig{}, err
+		}
+	}
+
+	b.cfgMu.Lock()
+	b.configs[instance] = cachedConfig{cfg: cfg, loadedAt: time.Now()}
+	b.cfgMu.Unlock()
+
+	return cloneConfig(cfg), nil
+}
+
+// SaveConfig grava a configuração de eventos; as lanes a aplicam no próximo
+// evento.
+func (b *Bus) SaveConfig(ctx context.Context, instance string, cfg models.EventsConfig) error {
+	cfg.Webhook = models.WebhookConfig{}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	res, err := b.db.ExecContext(ctx, `
+		UPDATE instancias SET eventos = $2, atualizado_em = NOW() WHERE nome = $1
+	`, instance, string(data))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInstanceNotFound
+	}
+
+	b.cfgMu.Lock()
+	b.configs[instance] = cachedConfig{cfg: cloneConfig(cfg), loadedAt: time.Now()}
+	b.cfgMu.Unlock()
+
+	return nil
+}
+
+// cloneConfig copia as listas de eventos, as únicas partes compartilhadas
+// numa cópia simples da configuração.
+func cloneConfig(cfg models.EventsConfig) models.EventsConfig {
+	cfg.Webhook.Events = slices.Clone(cfg.Webhook.Events)
+	cfg.RabbitMQ.Events = slices.Clone(cfg.RabbitMQ.Events)
+	cfg.SQS.Events = slices.Clone(cfg.SQS.Events)
+	return cfg
+}
@@ -0,0 +1,62 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestConfigReturnsCopy(t *testing.T) {
+	b := New(nil, nil)
+	cfg := models.EventsConfig{RabbitMQ: models.RabbitMQConfig{Enabled: true, Events: []string{"message.received", "message.ack"}}}
+	b.configs["loja1"] = cachedConfig{cfg: cfg, loadedAt: time.Now()}
+
+	got, err := b.Config(context.Background(), "loja1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.RabbitMQ.Events[0] = "alterado"
+	got.RabbitMQ.Events = append(got.RabbitMQ.Events[:1], "outro")
+
+	again, _ := b.Config(context.Background(), "loja1")
+	if again.RabbitMQ.Events[0] != "message.received" || again.RabbitMQ.Events[1] != "message.ack" {
+		t.Errorf("cache alterado por quem chamou: %v", again.RabbitMQ.Events)
+	}
+}
+
+// closingSink avisa quando a lane fecha a conexão com o broker.
+type closingSink struct{ closed chan struct{} }
+
+func (s *closingSink) Publish(context.Context, Event, []byte) error { return nil }
+func (s *closingSink) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestForgetClosesLane(t *testing.T) {
+	b := New(nil, nil)
+	b.configs["loja1"] = cachedConfig{cfg: models.DefaultEventsConfig(), loadedAt: time.Now()}
+
+	sink := &closingSink{closed: make(chan struct{})}
+	l := b.lane("loja1")
+	l.rabbit = sink
+
+	b.Forget("loja1")
+	select {
+	case <-sink.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a lane não fechou o destino")
+	}
+
+	b.mu.Lock()
+	_, hasLane := b.lanes["loja1"]
+	b.mu.Unlock()
+	_, hasConfig := b.configs["loja1"]
+	if hasLane || hasConfig {
+		t.Errorf("instância apagada ainda em memória: lane=%v config=%v", hasLane, hasConfig)
+	}
+
+	b.Forget("nunca-existiu")
+}
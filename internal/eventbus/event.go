@@ -0,0 +1,164 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// Tipos de evento publicados pelo barramento. Eventos do sidecar sem tipo
+// próprio seguem com o nome original (ex.: "contacts.upsert").
+const (
+	TypeMessageReceived   = "message.received"
+	TypeMessageAck        = "message.ack"
+	TypeConnectionState   = "connection.state"
+	TypeQRUpdated         = "qr.updated"
+	TypePairingSuccess    = "pairing.success"
+	TypeGroupParticipants = "group.participants"
+)
+
+// Event é o envelope entregue às filas e ao stream WebSocket.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Instance  string      `json:"instance"`
+	Source    string      `json:"source"` // evento original do sidecar
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+type ConnectionState struct {
+	State      string `json:"state"` // connecting, open, close
+	StatusCode int    `json:"statusCode,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+type QRUpdated struct {
+	QR    string `json:"qr"`
+	Image string `json:"image,omitempty"` // data URI PNG, preenchido no stream
+}
+
+type PairingSuccess struct {
+	Jid string `json:"jid,omitempty"`
+}
+
+type GroupParticipants struct {
+	GroupJid     string   `json:"groupJid"`
+	Action       string   `json:"action"` // add, remove, promote, demote
+	Participants []string `json:"participants"`
+	Author       string   `json:"author,omitempty"`
+}
+
+// Classify converte um evento do sidecar nos eventos tipados correspondentes.
+// Um connection.update pode gerar mais de um (QR novo, mudança de estado,
+// pareamento concluído).
+func Classify(evt models.Event) []Event {
+	base := Event{ID: evt.ID, Instance: evt.Instance, Source: evt.Event, Timestamp: evt.Timestamp}
+	if base.ID == "" {
+		base.ID = uuid.NewString()
+	}
+	if base.Timestamp.IsZero() {
+		base.Timestamp = time.Now().UTC()
+	}
+
+	typed := func(kind string, data interface{}) Event {
+		e := base
+		e.Type = kind
+		e.Data = data
+		return e
+	}
+
+	switch evt.Event {
+	case "messages.upsert":
+		if msg, ok := history.Summarize(evt.Data); ok && !msg.FromMe {
+			return []Event{typed(TypeMessageReceived, msg)}
+		}
+
+	case "message.ack":
+		return []Event{typed(TypeMessageAck, evt.Data)}
+
+	case "connection.update":
+		var u struct {
+			Connection *string `json:"connection"`
+			QR         *string `json:"qr"`
+			StatusCode *int    `json:"statusCode"`
+			Reason     *string `json:"reason"`
+			IsNewLogin bool    `json:"isNewLogin"`
+			Me         string  `json:"me"`
+		}
+		if json.Unmarshal(evt.Data, &u) != nil {
+			break
+		}
+		var out []Event
+		if u.QR != nil && *u.QR != "" {
+			e := typed(TypeQRUpdated, QRUpdated{QR: *u.QR})
+			e.ID = uuid.NewString()
+			out = append(out, e)
+		}
+		if u.Connection != nil && *u.Connection != "" {
+			state := ConnectionState{State: *u.Connection}
+			if u.StatusCode != nil {
+				state.StatusCode = *u.StatusCode
+			}
+			if u.Reason != nil {
+				state.Reason = *u.Reason
+			}
+			out = append(out, typed(TypeConnectionState, state))
+		}
+		if u.IsNewLogin {
+			e := typed(TypePairingSuccess, PairingSuccess{Jid: u.Me})
+			e.ID = uuid.NewString()
+			out = append(out, e)
+		}
+		return out
+
+	case "group-participants.update":
+		var u struct {
+			ID           string            `json:"id"`
+			Action       string            `json:"action"`
+			Participants []json.RawMessage `json:"participants"`
+			Author       string            `json:"author"`
+		}
+		if json.Unmarshal(evt.Data, &u) == nil && u.ID != "" {
+			gp := GroupParticipants{GroupJid: u.ID, Action: u.Action, Participants: []string{}, Author: u.Author}
+			for _, raw := range u.Participants {
+				if jid := participantJid(raw); jid != "" {
+					gp.Participants = append(gp.Participants, jid)
+				}
+			}
+			return []Event{typed(TypeGroupParticipants, gp)}
+		}
+	}
+
+	return []Event{typed(evt.Event, evt.Data)}
+}
+
+// participantJid aceita o jid puro (Baileys 6) ou o objeto {id, ...} do
+// Baileys 7.
+func participantJid(raw json.RawMessage) string {
+	var jid string
+	if json.Unmarshal(raw, &jid) == nil {
+		return jid
+	}
+	var p struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(raw, &p)
+	return p.ID
+}
+
+// wants aplica o filtro de eventos de um destino (vazio = todos).
+func wants(events []string, kind string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == kind || e == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestClassify(t *testing.T) {
+	ts := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	upsert := func(fromMe bool) string {
+		return `{"type":"notify","message":{"key":{"id":"ABC","remoteJid":"5511987654321@s.whatsapp.net","fromMe":` +
+			strconv.FormatBool(fromMe) + `},"message":{"conversation":"oi"},"messageTimestamp":1705320000}}`
+	}
+
+	tests := []struct {
+		name  string
+		event string
+		data  string
+		types []string
+		check func(t *testing.T, out []Event)
+	}{
+		{
+			name: "mensagem recebida", event: "messages.upsert", data: upsert(false),
+			types: []string{TypeMessageReceived},
+			check: func(t *testing.T, out []Event) {
+				msg, ok := out[0].Data.(*history.Summary)
+				if !ok || msg.MessageID != "ABC" || msg.Text != "oi" || msg.FromMe {
+					t.Errorf("Data = %+v", out[0].Data)
+				}
+			},
+		},
+		{name: "mensagem enviada segue com o nome original", event: "messages.upsert", data: upsert(true), types: []string{"messages.upsert"}},
+		{name: "upsert sem conteúdo", event: "messages.upsert", data: `{"message":{"key":{"id":"X","remoteJid":"status@broadcast"}}}`, types: []string{"messages.upsert"}},
+		{name: "ack", event: "message.ack", data: `{"id":"ABC","status":3}`, types: []string{TypeMessageAck}},
+		{
+			name: "QR novo", event: "connection.update", data: `{"qr":"2@abc"}`,
+			types: []string{TypeQRUpdated},
+			check: func(t *testing.T, out []Event) {
+				if qr := out[0].Data.(QRUpdated); qr.QR != "2@abc" {
+					t.Errorf("QR = %q", qr.QR)
+				}
+			},
+		},
+		{
+			name: "queda com motivo", event: "connection.update", data: `{"connection":"close","statusCode":401,"reason":"loggedOut"}`,
+			types: []string{TypeConnectionState},
+			check: func(t *testing.T, out []Event) {
+				want := ConnectionState{State: "close", StatusCode: 401, Reason: "loggedOut"}
+				if got := out[0].Data.(ConnectionState); got != want {
+					t.Errorf("Data = %+v, want %+v", got, want)
+				}
+			},
+		},
+		{
+			name: "pareamento concluído", event: "connection.update", data: `{"connection":"open","isNewLogin":true,"me":"5511987654321@s.whatsapp.net"}`,
+			types: []string{TypeConnectionState, TypePairingSuccess},
+			check: func(t *testing.T, out []Event) {
+				if p := out[1].Data.(PairingSuccess); p.Jid != "5511987654321@s.whatsapp.net" {
+					t.Errorf("Jid = %q", p.Jid)
+				}
+			},
+		},
+		{name: "connection.update vazio", event: "connection.update", data: `{"receivedPendingNotifications":true}`, types: nil},
+		{name: "connection.update inválido", event: "connection.update", data: `[]`, types: []string{"connection.update"}},
+		{
+			name: "participantes (Baileys 6)", event: "group-participants.update",
+			data:  `{"id":"120363012345678901@g.us","action":"add","participants":["5511987654321@s.whatsapp.net"],"author":"5511912345678@s.whatsapp.net"}`,
+			types: []string{TypeGroupParticipants},
+			check: func(t *testing.T, out []Event) {
+				want := GroupParticipants{
+					GroupJid: "120363012345678901@g.us", Action: "add",
+					Participants: []string{"5511987654321@s.whatsapp.net"}, Author: "5511912345678@s.whatsapp.net",
+				}
+				if got := out[0].Data.(GroupParticipants); !reflect.DeepEqual(got, want) {
+					t.Errorf("Data = %+v, want %+v", got, want)
+				}
+			},
+		},
+		{
+			name: "participantes (Baileys 7)", event: "group-participants.update",
+			data:  `{"id":"120363012345678901@g.us","action":"remove","participants":[{"id":"5511987654321@s.whatsapp.net","admin":null}]}`,
+			types: []string{TypeGroupParticipants},
+			check: func(t *testing.T, out []Event) {
+				if got := out[0].Data.(GroupParticipants).Participants; !reflect.DeepEqual(got, []string{"5511987654321@s.whatsapp.net"}) {
+					t.Errorf("Participants = %v", got)
+				}
+			},
+		},
+		{name: "participantes sem grupo", event: "group-participants.update", data: `{"action":"add"}`, types: []string{"group-participants.update"}},
+		{name: "evento sem tipo próprio", event: "contacts.upsert", data: `[{"id":"x"}]`, types: []string{"contacts.upsert"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evt := models.Event{ID: "evt-1", Instance: "loja1", Event: tt.event, Data: json.RawMessage(tt.data), Timestamp: ts}
+			out := Classify(evt)
+
+			var types []string
+			for _, e := range out {
+				types = append(types, e.Type)
+				if e.Instance != "loja1" || e.Source != tt.event || !e.Timestamp.Equal(ts) {
+					t.Errorf("envelope = %+v", e)
+				}
+			}
+			if !reflect.DeepEqual(types, tt.types) {
+				t.Fatalf("tipos = %v, want %v", types, tt.types)
+			}
+			if tt.check != nil {
+				tt.check(t, out)
+			}
+		})
+	}
+}
+
+func TestClassifyFillsIDAndTimestamp(t *testing.T) {
+	out := Classify(models.Event{Instance: "loja1", Event: "message.ack", Data: json.RawMessage(`{}`)})
+	if len(out) != 1 || out[0].ID == "" || out[0].Timestamp.IsZero() {
+		t.Fatalf("Classify sem id/timestamp = %+v", out)
+	}
+
+	// Eventos derivados do mesmo connection.update têm ids distintos
+	out = Classify(models.Event{ID: "evt-1", Event: "connection.update", Data: json.RawMessage(`{"qr":"2@abc","connection":"connecting"}`)})
+	if len(out) != 2 {
+		t.Fatalf("eventos = %d, want 2", len(out))
+	}
+	if out[0].ID == out[1].ID {
+		t.Errorf("ids = %q e %q, want distintos", out[0].ID, out[1].ID)
+	}
+}
+
+func TestWants(t *testing.T) {
+	tests := []struct {
+		events []string
+		kind   string
+		want   bool
+	}{
+		{events: nil, kind: TypeMessageReceived, want: true},
+		{events: []string{"*"}, kind: TypeQRUpdated, want: true},
+		{events: []string{TypeMessageReceived, TypeMessageAck}, kind: TypeMessageAck, want: true},
+		{events: []string{TypeMessageReceived}, kind: TypeQRUpdated, want: false},
+	}
+	for _, tt := range tests {
+		if got := wants(tt.events, tt.kind); got != tt.want {
+			t.Errorf("wants(%v, %q) = %v, want %v", tt.events, tt.kind, got, tt.want)
+		}
+	}
+}
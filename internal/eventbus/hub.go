@@ -0,0 +1,147 @@
+package eventbus
+
+import (
+	"sync"
+)
+
+// Subscription recebe os eventos de uma instância enquanto estiver aberta.
+// Assinantes lentos perdem eventos em vez de travar o barramento; Dropped
+// conta quantos.
+type Subscription struct {
+	C        <-chan Event
+	Instance string
+
+	ch      chan Event
+	hub     *Hub
+	mu      sync.Mutex
+	closed  bool
+	dropped int
+}
+
+func (s *Subscription) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close encerra a assinatura e fecha C.
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+}
+
+// Hub é o destino WebSocket: distribui os eventos em memória para as
+// conexões abertas de cada instância. O último estado de conexão e o QR
+// vigente ficam guardados e são entregues primeiro a quem assina depois.
+type Hub struct {
+	mu       sync.RWMutex
+	subs     map[string]map[*Subscription]struct{}
+	retained map[string]map[string]Event
+}
+
+// Ordem em que os eventos guardados são reenviados.
+var retainedTypes = []string{TypeConnectionState, TypeQRUpdated}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs:     make(map[string]map[*Subscription]struct{}),
+		retained: make(map[string]map[string]Event),
+	}
+}
+
+// Subscribe abre uma assinatura dos eventos da instância.
+func (h *Hub) Subscribe(instance string, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, Instance: instance, ch: ch, hub: h}
+
+	h.mu.Lock()
+	if h.subs[instance] == nil {
+		h.subs[instance] = make(map[*Subscription]struct{})
+	}
+	h.subs[instance][sub] = struct{}{}
+	for _, kind := range retainedTypes {
+		if evt, ok := h.retained[instance][kind]; ok && len(ch) < cap(ch) {
+			ch <- evt
+		}
+	}
+	h.mu.Unlock()
+
+	return sub
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	if set := h.subs[sub.Instance]; set != nil {
+		delete(set, sub)
+		if len(set) == 0 {
+			delete(h.subs, sub.Instance)
+		}
+	}
+	h.mu.Unlock()
+
+	sub.mu.Lock()
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+	sub.mu.Unlock()
+}
+
+// Last devolve o último evento guardado da instância do tipo informado
+// (TypeConnectionState ou TypeQRUpdated).
+func (h *Hub) Last(instance, kind string) (Event, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	evt, ok := h.retained[instance][kind]
+	return evt, ok
+}
+
+// Subscribers indica quantas conexões acompanham a instância.
+func (h *Hub) Subscribers(instance string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs[instance])
+}
+
+func (h *Hub) publish(evt Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.retain(evt)
+
+	for sub := range h.subs[evt.Instance] {
+		sub.mu.Lock()
+		if !sub.closed {
+			select {
+			case sub.ch <- evt:
+			default:
+				sub.dropped++
+			}
+		}
+		sub.mu.Unlock()
+	}
+}
+
+// retain atualiza o estado guardado da instância. O QR deixa de valer quando
+// a instância conecta ou é pareada.
+func (h *Hub) retain(evt Event) {
+	last := h.retained[evt.Instance]
+	if last == nil {
+		last = make(map[string]Event)
+		h.retained[evt.Instance] = last
+	}
+
+	switch evt.Type {
+	case TypeQRUpdated:
+		last[TypeQRUpdated] = evt
+	case TypeConnectionState:
+		last[TypeConnectionState] = evt
+		if state, ok := evt.Data.(ConnectionState); ok && state.State == "open" {
+			delete(last, TypeQRUpdated)
+		}
+	case TypePairingSuccess:
+		delete(last, TypeQRUpdated)
+	}
+}
@@ -0,0 +1,149 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+// sqsSink envia para uma fila SQS pela Query API (Action=SendMessage) com
+// assinatura SigV4, sem depender do SDK da AWS. Funciona com qualquer
+// serviço compatível (ElasticMQ, LocalStack) apontando queue_url para ele.
+type sqsSink struct {
+	cfg    models.SQSConfig
+	client *http.Client
+}
+
+// Fora as filas gravadas por um super admin, o endereço é conferido a cada
+// conexão, como nos webhooks.
+func newSQSSink(cfg models.SQSConfig) *sqsSink {
+	return &sqsSink{cfg: cfg, client: webhook.NewClient(15*time.Second, cfg.AllowInternal)}
+}
+
+func (s *sqsSink) Publish(ctx context.Context, evt Event, body []byte) error {
+	form := url.Values{}
+	form.Set("Action", "SendMessage")
+	form.Set("Version", "2012-11-05")
+	form.Set("MessageBody", string(body))
+	form.Set("MessageAttribute.1.Name", "event")
+	form.Set("MessageAttribute.1.Value.DataType", "String")
+	form.Set("MessageAttribute.1.Value.StringValue", evt.Type)
+	form.Set("MessageAttribute.2.Name", "instance")
+	form.Set("MessageAttribute.2.Value.DataType", "String")
+	form.Set("MessageAttribute.2.Value.StringValue", evt.Instance)
+
+	// Filas FIFO exigem grupo (ordem por instância) e id de deduplicação
+	if strings.HasSuffix(s.cfg.QueueURL, ".fifo") {
+		form.Set("MessageGroupId", evt.Instance)
+		form.Set("MessageDeduplicationId", evt.ID)
+	}
+
+	payload := []byte(form.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.QueueURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signV4(req, payload, s.cfg.Region, "sqs", s.cfg.AccessKey, s.cfg.SecretKey, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(respBody, &e) == nil && e.Code != "" {
+			return fmt.Errorf("sqs respondeu %d: %s: %s", resp.StatusCode, e.Code, e.Message)
+		}
+		return fmt.Errorf("sqs respondeu %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *sqsSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// ============================================
+// ASSINATURA AWS SIGNATURE V4
+// ============================================
+
+// signV4 assina a requisição com os cabeçalhos host, content-type (se houver)
+// e x-amz-date.
+func signV4(req *http.Request, body []byte, region, service, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{
+		"host":       req.URL.Host,
+		"x-amz-date": amzDate,
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		headers["content-type"] = ct
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	query := strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method, path, query, canonicalHeaders.String(), signedHeaders, sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/audit"
+)
+
+type AuditHandler struct {
+	Log *audit.Log
+}
+
+func NewAuditHandler(l *audit.Log) *AuditHandler {
+	return &AuditHandler{Log: l}
+}
+
+// Middleware registra em logs_acesso cada requisição autenticada (key,
+// instância, rota, status, latência, request id e IP). Deve vir antes do
+// AuthMiddleware para ver o status final da resposta.
+func (h *AuditHandler) Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	apiKey, ok := c.Locals("apiKey").(*ApiKey)
+	if !ok {
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		}
+	}
+	latency := int(time.Since(start).Milliseconds())
+
+	entry := accessEntry(c, apiKey)
+	entry.StatusCode = status
+	entry.LatenciaMs = &latency
+	h.Log.Record(entry)
+	return err
+}
+
+// List consulta o log. Filtros: ?api_key_id=, ?instance=, ?action=
+// (api_key.update...), ?status= (404 ou 4xx), ?from= e ?to= (RFC 3339 ou
+// epoch em segundos), ?limit= e ?cursor= (nextCursor da página anterior).
+func (h *AuditHandler) List(c *fiber.Ctx) error {
+	q := audit.Query{
+		Limit:    c.QueryInt("limit", 100),
+		Cursor:   c.Query("cursor"),
+		Instance: c.Query("instance"),
+		Action:   c.Query("action"),
+		Status:   c.Query("status"),
+	}
+	if v := c.Query("api_key_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "api_key_id inválido"})
+		}
+		q.ApiKeyID = &id
+	}
+
+	var err error
+	if q.From, err = parseTimeQuery(c.Query("from")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "from inválido"})
+	}
+	if q.To, err = parseTimeQuery(c.Query("to")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "to inválido"})
+	}
+
+	page, err := h.Log.Entries(c.UserContext(), q)
+	if errors.Is(err, audit.ErrInvalidCursor) || errors.Is(err, audit.ErrInvalidStatus) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar auditoria"})
+	}
+	return c.JSON(page)
+}
+
+// accessEntry monta a entrada com os dados da requisição.
+func accessEntry(c *fiber.Ctx, apiKey *ApiKey) audit.Entry {
+	entry := audit.Entry{
+		Metodo:     c.Method(),
+		Endpoint:   c.Path(),
+		IP:         c.IP(),
+		StatusCode: c.Response().StatusCode(),
+	}
+	if apiKey != nil {
+		entry.ApiKeyID = &apiKey.ID
+		entry.KeyPrefix = &apiKey.KeyPrefix
+	}
+	if instance := requestInstance(c); instance != "" {
+		entry.Instance = &instance
+	}
+	if route := c.Route(); route != nil && route.Path != "" {
+		path := route.Path
+		entry.Rota = &path
+	}
+	if id, ok := c.Locals("requestid").(string); ok && id != "" {
+		entry.RequestID = &id
+	}
+	return entry
+}
+
+// auditChange registra uma alteração administrativa (api_key.create,
+// instance.delete...) com o estado antes e depois. nil vira NULL.
+func (h *DatabaseHandler) auditChange(c *fiber.Ctx, action, instance string, before, after interface{}) {
+	recordChange(h.audit, c, action, instance, before, after)
+}
+
+// recordChange é o auditChange dos demais handlers (settings, webhook,
+// integrações...). Os snapshots não devem levar segredos.
+func recordChange(l *audit.Log, c *fiber.Ctx, action, instance string, before, after interface{}) {
+	apiKey, _ := c.Locals("apiKey").(*ApiKey)
+	entry := accessEntry(c, apiKey)
+	entry.Acao = &action
+	if instance != "" {
+		entry.Instance = &instance
+	} else {
+		entry.Instance = nil
+	}
+	entry.Antes = snapshotJSON(before)
+	entry.Depois = snapshotJSON(after)
+	l.Record(entry)
+}
+
+func snapshotJSON(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
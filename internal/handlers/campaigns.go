@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/campaign"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+type CampaignHandler struct {
+	Runner *campaign.Runner
+}
+
+func NewCampaignHandler(r *campaign.Runner) *CampaignHandler {
+	return &CampaignHandler{Runner: r}
+}
+
+// Create aceita JSON com "recipients" ou multipart/form-data com a campanha
+// (sem destinatários) no campo "campaign" e o CSV no arquivo "recipients".
+func (h *CampaignHandler) Create(c *fiber.Ctx) error {
+	var req models.CampaignRequest
+
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		if err := json.Unmarshal([]byte(c.FormValue("campaign")), &req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "campo campaign deve conter o JSON da campanha"})
+		}
+
+		fh, err := c.FormFile("recipients")
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "arquivo recipients (CSV) required"})
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		defer f.Close()
+
+		recipients, err := campaign.ParseCSV(f)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		req.Recipients = append(req.Recipients, recipients...)
+	} else if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	if req.Message.Type == "media" && req.Message.Media != nil {
+		if err := whatsapp.NormalizeMedia(req.Message.Media, c.App().Config().BodyLimit); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	var keyID *int
+	if apiKey, ok := c.Locals("apiKey").(*ApiKey); ok && apiKey != nil {
+		keyID = &apiKey.ID
+	}
+
+	item, err := h.Runner.Create(c.UserContext(), c.Params("instance"), req, keyID)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(item)
+}
+
+func (h *CampaignHandler) List(c *fiber.Ctx) error {
+	items, err := h.Runner.List(c.UserContext(), c.Params("instance"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(items)
+}
+
+func (h *CampaignHandler) Get(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Runner.Get(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+// Recipients aceita ?status=pending|queued|sending|sent|failed|opted_out|cancelled
+// e paginação com ?limit= e ?offset=.
+func (h *CampaignHandler) Recipients(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	items, err := h.Runner.Recipients(c.UserContext(), c.Params("instance"), id,
+		c.Query("status"), c.QueryInt("limit", 100), c.QueryInt("offset", 0))
+	if errors.Is(err, campaign.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(items)
+}
+
+func (h *CampaignHandler) Pause(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Runner.Pause(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+func (h *CampaignHandler) Resume(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Runner.Resume(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+func (h *CampaignHandler) Cancel(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Runner.Cancel(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+func (h *CampaignHandler) respond(c *fiber.Ctx, item *campaign.Campaign, err error) error {
+	if errors.Is(err, campaign.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(item)
+}
+
+// ============================================
+// OPT-OUT
+// ============================================
+
+func (h *CampaignHandler) ListOptOuts(c *fiber.Ctx) error {
+	items, err := h.Runner.OptOuts(c.UserContext(), c.Params("instance"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(items)
+}
+
+func (h *CampaignHandler) AddOptOuts(c *fiber.Ctx) error {
+	var body struct {
+		Numbers []string `json:"numbers"`
+	}
+	if err := c.BodyParser(&body); err != nil || len(body.Numbers) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "numbers required"})
+	}
+
+	if err := h.Runner.AddOptOut(c.UserContext(), c.Params("instance"), body.Numbers); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+func (h *CampaignHandler) RemoveOptOut(c *fiber.Ctx) error {
+	if err := h.Runner.RemoveOptOut(c.UserContext(), c.Params("instance"), c.Params("number")); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/history"
+)
+
+type ChatHandler struct {
+	Store *history.Store
+}
+
+func NewChatHandler(s *history.Store) *ChatHandler {
+	return &ChatHandler{Store: s}
+}
+
+// Messages devolve o histórico do chat, do mais recente para o mais antigo.
+// Filtros: ?limit=, ?cursor= (nextCursor da página anterior), ?before= e
+// ?after= (RFC 3339 ou epoch em segundos), ?type=image,video, ?from_me= e
+// ?raw=true para incluir o WAMessage original.
+func (h *ChatHandler) Messages(c *fiber.Ctx) error {
+	if c.Params("jid") == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "jid required"})
+	}
+	chatJid := jidParam(c)
+
+	q := history.Query{
+		Limit:      c.QueryInt("limit", 50),
+		Cursor:     c.Query("cursor"),
+		IncludeRaw: c.QueryBool("raw", false),
+	}
+
+	var err error
+	if q.Before, err = parseTimeQuery(c.Query("before")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "before inválido"})
+	}
+	if q.After, err = parseTimeQuery(c.Query("after")); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "after inválido"})
+	}
+	if types := c.Query("type"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				q.Types = append(q.Types, t)
+			}
+		}
+	}
+	if v := c.Query("from_me"); v != "" {
+		fromMe, err := strconv.ParseBool(v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "from_me inválido"})
+		}
+		q.FromMe = &fromMe
+	}
+
+	page, err := h.Store.Messages(c.UserContext(), c.Params("instance"), chatJid, q)
+	if errors.Is(err, history.ErrInvalidCursor) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(page)
+}
+
+func parseTimeQuery(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		t := time.Unix(secs, 0).UTC()
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
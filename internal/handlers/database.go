@@ -1,598 +1,927 @@
-package handlers
-
-import (
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
-	"time"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/jmoiron/sqlx"
-	"github.com/nexus/gowhats/internal/whatsapp" // <-- IMPORT CORRETO
-)
-
-type DatabaseHandler struct {
-	db     *sqlx.DB
-	client *whatsapp.BaileysClient // <-- Ajustado
-}
-
-func NewDatabaseHandler(db *sqlx.DB, client *whatsapp.BaileysClient) *DatabaseHandler { // <-- Ajustado
-	return &DatabaseHandler{
-		db:     db,
-		client: client,
-	}
-}
-
-// ============================================
-// STRUCTS
-// ============================================
-
-type ApiKey struct {
-	ID                   int        `db:"id" json:"id"`
-	KeyHash              string     `db:"key_hash" json:"-"`
-	KeyPrefix            string     `db:"key_prefix" json:"prefix"`
-	Nome                 string     `db:"nome" json:"nome"`
-	Tipo                 string     `db:"tipo" json:"tipo"`
-	Ativa                bool       `db:"ativa" json:"ativa"`
-	InstanciasPermitidas []string   `db:"instancias_permitidas" json:"instanciasPermitidas"`
-	CriadoEm             time.Time  `db:"criado_em" json:"criadoEm"`
-	ExpiraEm             *time.Time `db:"expira_em" json:"expiraEm"`
-	UltimoUso            *time.Time `db:"ultimo_uso" json:"ultimoUso"`
-	TotalRequisicoes     int        `db:"total_requisicoes" json:"totalRequisicoes"`
-}
-
-type ApiKeyValidation struct {
-	Valid        bool
-	Error        string
-	ApiKey       *ApiKey
-	IsSuperAdmin bool
-}
-
-type Instancia struct {
-	ID          int        `db:"id" json:"id"`
-	Nome        string     `db:"nome" json:"name"`
-	Status      string     `db:"status" json:"status"`
-	PushName    *string    `db:"push_name" json:"pushName"`
-	Jid         *string    `db:"jid" json:"jid"`
-	Avatar      *string    `db:"avatar" json:"avatar"`
-	WebhookURL  *string    `db:"webhook_url" json:"webhookUrl"`
-	WebhookOn   bool       `db:"webhook_enabled" json:"webhookEnabled"`
-	CriadoPor   *int       `db:"criado_por" json:"criadoPor"`
-	CriadoEm    time.Time  `db:"criado_em" json:"createdAt"`
-	AtualizadoEm time.Time `db:"atualizado_em" json:"updatedAt"`
-}
-
-type Contato struct {
-	ID       int       `db:"id" json:"id"`
-	Instance string    `db:"instance" json:"instance"`
-	Jid      string    `db:"jid" json:"jid"`
-	Nome     string    `db:"nome" json:"name"`
-	CriadoEm time.Time `db:"criado_em" json:"createdAt"`
-}
-
-type Grupo struct {
-	ID       int       `db:"id" json:"id"`
-	Instance string    `db:"instance" json:"instance"`
-	Jid      string    `db:"jid" json:"jid"`
-	Nome     string    `db:"nome" json:"name"`
-	CriadoEm time.Time `db:"criado_em" json:"createdAt"`
-}
-
-type DBStats struct {
-	Contacts int `json:"contacts"`
-	Groups   int `json:"groups"`
-	Messages int `json:"messages"`
-}
-
-// ============================================
-// FUNÇÕES DE HASH
-// ============================================
-
-func hashApiKey(key string) string {
-	hash := sha256.Sum256([]byte(key))
-	return hex.EncodeToString(hash[:])
-}
-
-func getKeyPrefix(key string) string {
-	if len(key) >= 8 {
-		return key[:8]
-	}
-	return key
-}
-
-// ============================================
-// VALIDAÇÃO DE API KEY
-// ============================================
-
-func (h *DatabaseHandler) ValidateApiKey(key string) ApiKeyValidation {
-	if key == "" {
-		return ApiKeyValidation{Valid: false, Error: "API Key não fornecida"}
-	}
-
-	keyHash := hashApiKey(key)
-
-	var apiKey ApiKey
-	err := h.db.Get(&apiKey, `
-		SELECT id, key_hash, key_prefix, nome, tipo, ativa, instancias_permitidas, 
-		       criado_em, expira_em, ultimo_uso, total_requisicoes
-		FROM api_keys WHERE key_hash = $1
-	`, keyHash)
-
-	if err != nil {
-		return ApiKeyValidation{Valid: false, Error: "API Key inválida"}
-	}
-
-	if !apiKey.Ativa {
-		return ApiKeyValidation{Valid: false, Error: "API Key desativada"}
-	}
-
-	if apiKey.ExpiraEm != nil && apiKey.ExpiraEm.Before(time.Now()) {
-		return ApiKeyValidation{Valid: false, Error: "API Key expirada"}
-	}
-
-	// Atualiza último uso
-	h.db.Exec(`UPDATE api_keys SET ultimo_uso = NOW(), total_requisicoes = total_requisicoes + 1 WHERE id = $1`, apiKey.ID)
-
-	return ApiKeyValidation{
-		Valid:        true,
-		ApiKey:       &apiKey,
-		IsSuperAdmin: apiKey.Tipo == "super_admin",
-	}
-}
-
-// ============================================
-// MIDDLEWARE DE AUTENTICAÇÃO
-// ============================================
-
-func (h *DatabaseHandler) AuthMiddleware(c *fiber.Ctx) error {
-	apiKey := c.Get("apikey")
-	if apiKey == "" {
-		apiKey = c.Get("x-api-key")
-	}
-	if apiKey == "" {
-		apiKey = c.Query("apikey")
-	}
-
-	validation := h.ValidateApiKey(apiKey)
-	if !validation.Valid {
-		return c.Status(401).JSON(fiber.Map{"error": validation.Error})
-	}
-
-	c.Locals("apiKey", validation.ApiKey)
-	c.Locals("isSuperAdmin", validation.IsSuperAdmin)
-
-	return c.Next()
-}
-
-func (h *DatabaseHandler) SuperAdminOnly(c *fiber.Ctx) error {
-	isSuperAdmin, ok := c.Locals("isSuperAdmin").(bool)
-	if !ok || !isSuperAdmin {
-		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a Super Admin"})
-	}
-	return c.Next()
-}
-
-func (h *DatabaseHandler) InstanceAccessMiddleware(c *fiber.Ctx) error {
-	instanceName := c.Params("instance")
-	if instanceName == "" {
-		instanceName = c.Params("name")
-	}
-
-	if instanceName == "" {
-		return c.Next()
-	}
-
-	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
-	if isSuperAdmin {
-		return c.Next()
-	}
-
-	apiKey, ok := c.Locals("apiKey").(*ApiKey)
-	if !ok {
-		return c.Status(403).JSON(fiber.Map{"error": "Sem permissão"})
-	}
-
-	// Verifica se tem acesso à instância
-	hasAccess := false
-	for _, inst := range apiKey.InstanciasPermitidas {
-		if inst == instanceName {
-			hasAccess = true
-			break
-		}
-	}
-
-	if !hasAccess {
-		return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-	}
-
-	return c.Next()
-}
-
-// ============================================
-// ROTAS DE API KEYS
-// ============================================
-
-func (h *DatabaseHandler) ListApiKeys(c *fiber.Ctx) error {
-	var keys []ApiKey
-	err := h.db.Select(&keys, `
-		SELECT id, key_prefix, nome, tipo, ativa, instancias_permitidas, 
-		       criado_em, expira_em, ultimo_uso, total_requisicoes
-		FROM api_keys ORDER BY criado_em DESC
-	`)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar API Keys"})
-	}
-
-	// Adiciona campo expirada
-	type ApiKeyResponse struct {
-		ApiKey
-		Expirada bool `json:"expirada"`
-	}
-
-	var response []ApiKeyResponse
-	for _, k := range keys {
-		expirada := false
-		if k.ExpiraEm != nil && k.ExpiraEm.Before(time.Now()) {
-			expirada = true
-		}
-		response = append(response, ApiKeyResponse{ApiKey: k, Expirada: expirada})
-	}
-
-	return c.JSON(response)
-}
-
-func (h *DatabaseHandler) CreateApiKey(c *fiber.Ctx) error {
-	var body struct {
-		Nome                 string   `json:"nome"`
-		Tipo                 string   `json:"tipo"`
-		Validade             *string  `json:"validade"`
-		InstanciasPermitidas []string `json:"instanciasPermitidas"`
-	}
-
-	if err := c.BodyParser(&body); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-	}
-
-	if body.Nome == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Nome obrigatório"})
-	}
-
-	if body.Tipo == "" {
-		body.Tipo = "user"
-	}
-
-	// Gera a key
-	prefix := "nxus_"
-	if body.Tipo == "super_admin" {
-		prefix = "nxsa_"
-	}
-	randomBytes := make([]byte, 24)
-	for i := range randomBytes {
-		randomBytes[i] = byte(time.Now().UnixNano() % 256)
-	}
-	key := prefix + hex.EncodeToString(randomBytes)
-	keyHash := hashApiKey(key)
-	keyPrefix := getKeyPrefix(key)
-
-	// Calcula expiração
-	var expiraEm *time.Time
-	if body.Validade != nil {
-		var dias int
-		switch *body.Validade {
-		case "30":
-			dias = 30
-		case "90":
-			dias = 90
-		case "180":
-			dias = 180
-		case "365":
-			dias = 365
-		}
-		if dias > 0 {
-			exp := time.Now().AddDate(0, 0, dias)
-			expiraEm = &exp
-		}
-	}
-
-	var id int
-	err := h.db.QueryRow(`
-		INSERT INTO api_keys (key_hash, key_prefix, nome, tipo, instancias_permitidas, expira_em)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id
-	`, keyHash, keyPrefix, body.Nome, body.Tipo, body.InstanciasPermitidas, expiraEm).Scan(&id)
-
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Erro ao criar API Key: " + err.Error()})
-	}
-
-	return c.JSON(fiber.Map{
-		"status":  "success",
-		"message": "API Key criada! Guarde a key, ela não será mostrada novamente.",
-		"apiKey": fiber.Map{
-			"id":       id,
-			"key":      key,
-			"prefix":   keyPrefix,
-			"nome":     body.Nome,
-			"tipo":     body.Tipo,
-			"expiraEm": expiraEm,
-		},
-	})
-}
-
-func (h *DatabaseHandler) UpdateApiKey(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	var body struct {
-		Nome                 *string  `json:"nome"`
-		Ativa                *bool    `json:"ativa"`
-		Tipo                 *string  `json:"tipo"`
-		InstanciasPermitidas []string `json:"instanciasPermitidas"`
-		RenovarValidade      *string  `json:"renovarValidade"`
-	}
-
-	if err := c.BodyParser(&body); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-	}
-
-	// Monta a query dinamicamente
-	updates := []string{}
-	args := []interface{}{}
-	argIdx := 1
-
-	if body.Nome != nil {
-		updates = append(updates, fmt.Sprintf("nome = $%d", argIdx))
-		args = append(args, *body.Nome)
-		argIdx++
-	}
-
-	if body.Ativa != nil {
-		updates = append(updates, fmt.Sprintf("ativa = $%d", argIdx))
-		args = append(args, *body.Ativa)
-		argIdx++
-	}
-
-	if body.Tipo != nil {
-		updates = append(updates, fmt.Sprintf("tipo = $%d", argIdx))
-		args = append(args, *body.Tipo)
-		argIdx++
-	}
-
-	if body.InstanciasPermitidas != nil {
-		updates = append(updates, fmt.Sprintf("instancias_permitidas = $%d", argIdx))
-		args = append(args, body.InstanciasPermitidas)
-		argIdx++
-	}
-
-	if body.RenovarValidade != nil {
-		var dias int
-		switch *body.RenovarValidade {
-		case "30":
-			dias = 30
-		case "90":
-			dias = 90
-		case "180":
-			dias = 180
-		case "365":
-			dias = 365
-		}
-		if dias > 0 {
-			exp := time.Now().AddDate(0, 0, dias)
-			updates = append(updates, fmt.Sprintf("expira_em = $%d", argIdx))
-			args = append(args, exp)
-			argIdx++
-		}
-	}
-
-	if len(updates) == 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "Nada para atualizar"})
-	}
-
-	args = append(args, id)
-	query := fmt.Sprintf("UPDATE api_keys SET %s WHERE id = $%d", 
-		joinStrings(updates, ", "), argIdx)
-
-	_, err := h.db.Exec(query, args...)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Erro ao atualizar"})
-	}
-
-	return c.JSON(fiber.Map{"status": "success"})
-}
-
-func (h *DatabaseHandler) DeleteApiKey(c *fiber.Ctx) error {
-	id := c.Params("id")
-
-	// Não permite deletar a própria key
-	apiKey, _ := c.Locals("apiKey").(*ApiKey)
-	if apiKey != nil && fmt.Sprintf("%d", apiKey.ID) == id {
-		return c.Status(400).JSON(fiber.Map{"error": "Não é possível deletar sua própria API Key"})
-	}
-
-	_, err := h.db.Exec(`DELETE FROM api_keys WHERE id = $1`, id)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Erro ao deletar"})
-	}
-
-	return c.JSON(fiber.Map{"status": "success"})
-}
-
-// ============================================
-// ROTAS DE INSTÂNCIAS
-// ============================================
-
-func (h *DatabaseHandler) ListInstances(c *fiber.Ctx) error {
-	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
-	apiKey, _ := c.Locals("apiKey").(*ApiKey)
-
-	var instances []Instancia
-	var err error
-
-	if isSuperAdmin {
-		err = h.db.Select(&instances, `SELECT * FROM instancias ORDER BY criado_em DESC`)
-	} else if apiKey != nil && len(apiKey.InstanciasPermitidas) > 0 {
-		query, args, _ := sqlx.In(`SELECT * FROM instancias WHERE nome IN (?) ORDER BY criado_em DESC`, apiKey.InstanciasPermitidas)
-		query = h.db.Rebind(query)
-		err = h.db.Select(&instances, query, args...)
-	} else {
-		instances = []Instancia{}
-	}
-
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar instâncias"})
-	}
-
-	// Adiciona stats para cada instância
-	type InstanceResponse struct {
-		Instancia
-		Stats DBStats `json:"stats"`
-	}
-
-	var response []InstanceResponse
-	for _, inst := range instances {
-		stats := h.getDBStats(inst.Nome)
-		response = append(response, InstanceResponse{Instancia: inst, Stats: stats})
-	}
-
-	return c.JSON(response)
-}
-
-func (h *DatabaseHandler) CreateInstance(c *fiber.Ctx) error {
-	var body struct {
-		Name string `json:"name"`
-	}
-
-	if err := c.BodyParser(&body); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-	}
-
-	if body.Name == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "Nome obrigatório"})
-	}
-
-	apiKey, _ := c.Locals("apiKey").(*ApiKey)
-	var criadoPor *int
-	if apiKey != nil {
-		criadoPor = &apiKey.ID
-	}
-
-	_, err := h.db.Exec(`
-		INSERT INTO instancias (nome, criado_por)
-		VALUES ($1, $2)
-		ON CONFLICT (nome) DO UPDATE SET atualizado_em = NOW()
-	`, body.Name, criadoPor)
-
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Erro ao criar instância"})
-	}
-
-	return c.JSON(fiber.Map{
-		"status": "success",
-		"instance": fiber.Map{
-			"name":   body.Name,
-			"status": "disconnected",
-		},
-	})
-}
-
-func (h *DatabaseHandler) DeleteInstance(c *fiber.Ctx) error {
-	name := c.Params("name")
-
-	// Deleta dados relacionados
-	h.db.Exec(`DELETE FROM contatos WHERE instance = $1`, name)
-	h.db.Exec(`DELETE FROM grupos WHERE instance = $1`, name)
-	h.db.Exec(`DELETE FROM mensagens WHERE instance = $1`, name)
-	h.db.Exec(`DELETE FROM instancias WHERE nome = $1`, name)
-
-	return c.JSON(fiber.Map{"status": "success"})
-}
-
-// ============================================
-// ROTAS DE CONTATOS E GRUPOS
-// ============================================
-
-func (h *DatabaseHandler) GetContacts(c *fiber.Ctx) error {
-	instance := c.Params("instance")
-
-	var contatos []Contato
-	err := h.db.Select(&contatos, `
-		SELECT id, instance, jid, nome, criado_em 
-		FROM contatos WHERE instance = $1 ORDER BY nome ASC
-	`, instance)
-
-	if err != nil {
-		return c.JSON([]Contato{})
-	}
-
-	return c.JSON(contatos)
-}
-
-func (h *DatabaseHandler) GetGroups(c *fiber.Ctx) error {
-	instance := c.Params("instance")
-
-	var grupos []Grupo
-	err := h.db.Select(&grupos, `
-		SELECT id, instance, jid, nome, criado_em 
-		FROM grupos WHERE instance = $1 ORDER BY nome ASC
-	`, instance)
-
-	if err != nil {
-		return c.JSON([]Grupo{})
-	}
-
-	return c.JSON(grupos)
-}
-
-func (h *DatabaseHandler) GetStats(c *fiber.Ctx) error {
-	instance := c.Params("instance")
-	stats := h.getDBStats(instance)
-	return c.JSON(stats)
-}
-
-func (h *DatabaseHandler) getDBStats(instance string) DBStats {
-	var stats DBStats
-
-	h.db.Get(&stats.Contacts, `SELECT COUNT(*) FROM contatos WHERE instance = $1`, instance)
-	h.db.Get(&stats.Groups, `SELECT COUNT(*) FROM grupos WHERE instance = $1`, instance)
-	h.db.Get(&stats.Messages, `SELECT COUNT(*) FROM mensagens WHERE instance = $1`, instance)
-
-	return stats
-}
-
-// ============================================
-// ROTA /v1/me
-// ============================================
-
-func (h *DatabaseHandler) GetMe(c *fiber.Ctx) error {
-	apiKey, ok := c.Locals("apiKey").(*ApiKey)
-	if !ok {
-		return c.Status(401).JSON(fiber.Map{"error": "Não autenticado"})
-	}
-
-	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
-
-	return c.JSON(fiber.Map{
-		"id":                   apiKey.ID,
-		"nome":                 apiKey.Nome,
-		"tipo":                 apiKey.Tipo,
-		"isSuperAdmin":         isSuperAdmin,
-		"instanciasPermitidas": apiKey.InstanciasPermitidas,
-		"criadoEm":             apiKey.CriadoEm,
-		"expiraEm":             apiKey.ExpiraEm,
-		"ultimoUso":            apiKey.UltimoUso,
-	})
-}
-
-// ============================================
-// HELPER
-// ============================================
-
-func joinStrings(strs []string, sep string) string {
-	result := ""
-	for i, s := range strs {
-		if i > 0 {
-			result += sep
-		}
-		result += s
-	}
-	return result
-}
\ No newline at end of file
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/nexus/gowhats/internal/ratelimit"
+	"github.com/nexus/gowhats/internal/whatsapp" // <-- IMPORT CORRETO
+)
+
+type DatabaseHandler struct {
+	db     *sqlx.DB
+	client *whatsapp.BaileysClient // <-- Ajustado
+
+	limiter *ratelimit.Limiter
+	counter *ratelimit.Counter
+	limits  limitsCache
+	audit   *audit.Log
+
+	Events *eventbus.Bus // definido pelo servidor; libera a lane da instância apagada
+}
+
+func NewDatabaseHandler(db *sqlx.DB, client *whatsapp.BaileysClient, auditLog *audit.Log) *DatabaseHandler { // <-- Ajustado
+	return &DatabaseHandler{
+		db:      db,
+		client:  client,
+		audit:   auditLog,
+		limiter: ratelimit.NewLimiter(),
+		counter: ratelimit.NewCounter(db),
+		limits:  limitsCache{items: make(map[string]instanceLimits)},
+	}
+}
+
+// ============================================
+// STRUCTS
+// ============================================
+
+type ApiKey struct {
+	ID                   int            `db:"id" json:"id"`
+	KeyHash              string         `db:"key_hash" json:"-"`
+	KeyPrefix            string         `db:"key_prefix" json:"prefix"`
+	Nome                 string         `db:"nome" json:"nome"`
+	Tipo                 string         `db:"tipo" json:"tipo"`
+	Ativa                bool           `db:"ativa" json:"ativa"`
+	InstanciasPermitidas pq.StringArray `db:"instancias_permitidas" json:"instanciasPermitidas"`
+	CriadoEm             time.Time      `db:"criado_em" json:"criadoEm"`
+	ExpiraEm             *time.Time     `db:"expira_em" json:"expiraEm"`
+	UltimoUso            *time.Time     `db:"ultimo_uso" json:"ultimoUso"`
+	TotalRequisicoes     int            `db:"total_requisicoes" json:"totalRequisicoes"`
+	Scopes               pq.StringArray `db:"scopes" json:"scopes"`                            // * = acesso total; vazio = nenhum
+	SubstituidaPor       *int           `db:"substituida_por" json:"substituidaPor,omitempty"` // key nova após rotação
+	LimiteRps            *float64       `db:"limite_rps" json:"limiteRps"`                     // requisições por segundo
+	LimiteMensagensDia   *int           `db:"limite_mensagens_dia" json:"limiteMensagensDia"`
+	CotaMensagensMes     *int           `db:"cota_mensagens_mes" json:"cotaMensagensMes"`
+}
+
+// apiKeyColumns lista as colunas de ApiKey, exceto key_hash.
+const apiKeyColumns = `id, key_prefix, nome, tipo, ativa, instancias_permitidas, criado_em, expira_em,
+	ultimo_uso, total_requisicoes, scopes, substituida_por, limite_rps, limite_mensagens_dia, cota_mensagens_mes`
+
+type ApiKeyValidation struct {
+	Valid        bool
+	Error        string
+	ApiKey       *ApiKey
+	IsSuperAdmin bool
+}
+
+type Instancia struct {
+	ID           int       `db:"id" json:"id"`
+	Nome         string    `db:"nome" json:"name"`
+	Status       string    `db:"status" json:"status"`
+	PushName     *string   `db:"push_name" json:"pushName"`
+	Jid          *string   `db:"jid" json:"jid"`
+	Avatar       *string   `db:"avatar" json:"avatar"`
+	WebhookURL   *string   `db:"webhook_url" json:"webhookUrl"`
+	WebhookOn    bool      `db:"webhook_enabled" json:"webhookEnabled"`
+	CriadoPor    *int      `db:"criado_por" json:"criadoPor"`
+	CriadoEm     time.Time `db:"criado_em" json:"createdAt"`
+	AtualizadoEm time.Time `db:"atualizado_em" json:"updatedAt"`
+
+	LimiteRps          *float64 `db:"limite_rps" json:"limiteRps"`
+	LimiteMensagensDia *int     `db:"limite_mensagens_dia" json:"limiteMensagensDia"`
+
+	Estado       *string    `db:"estado" json:"state"`
+	EstadoMotivo *string    `db:"estado_motivo" json:"stateReason"`
+	EstadoDesde  *time.Time `db:"estado_desde" json:"stateSince"`
+}
+
+// instanciaColumns lista as colunas de Instancia; evita SELECT * quebrar
+// quando novas colunas são adicionadas à tabela.
+const instanciaColumns = `id, nome, status, push_name, jid, avatar, webhook_url, webhook_enabled,
+	criado_por, criado_em, atualizado_em, limite_rps, limite_mensagens_dia, estado, estado_motivo, estado_desde`
+
+type Contato struct {
+	ID       int       `db:"id" json:"id"`
+	Instance string    `db:"instance" json:"instance"`
+	Jid      string    `db:"jid" json:"jid"`
+	Nome     string    `db:"nome" json:"name"`
+	CriadoEm time.Time `db:"criado_em" json:"createdAt"`
+}
+
+type Grupo struct {
+	ID       int       `db:"id" json:"id"`
+	Instance string    `db:"instance" json:"instance"`
+	Jid      string    `db:"jid" json:"jid"`
+	Nome     string    `db:"nome" json:"name"`
+	CriadoEm time.Time `db:"criado_em" json:"createdAt"`
+}
+
+type DBStats struct {
+	Contacts int `json:"contacts"`
+	Groups   int `json:"groups"`
+	Messages int `json:"messages"`
+}
+
+// ============================================
+// FUNÇÕES DE HASH
+// ============================================
+
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// generateApiKey gera a key com 32 bytes do crypto/rand.
+func generateApiKey(tipo string) (string, error) {
+	prefix := "nxus_"
+	if tipo == "super_admin" {
+		prefix = "nxsa_"
+	}
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(randomBytes), nil
+}
+
+func getKeyPrefix(key string) string {
+	if len(key) >= 8 {
+		return key[:8]
+	}
+	return key
+}
+
+// ============================================
+// VALIDAÇÃO DE API KEY
+// ============================================
+
+func (h *DatabaseHandler) ValidateApiKey(key string) ApiKeyValidation {
+	if key == "" {
+		return ApiKeyValidation{Valid: false, Error: "API Key não fornecida"}
+	}
+
+	keyHash := hashApiKey(key)
+
+	var apiKey ApiKey
+	err := h.db.Get(&apiKey, `
+		SELECT `+apiKeyColumns+`, key_hash
+		FROM api_keys WHERE key_hash = $1
+	`, keyHash)
+
+	if err != nil {
+		return ApiKeyValidation{Valid: false, Error: "API Key inválida"}
+	}
+
+	if !apiKey.Ativa {
+		return ApiKeyValidation{Valid: false, Error: "API Key desativada"}
+	}
+
+	if apiKey.ExpiraEm != nil && apiKey.ExpiraEm.Before(time.Now()) {
+		return ApiKeyValidation{Valid: false, Error: "API Key expirada"}
+	}
+
+	// Atualiza último uso
+	h.db.Exec(`UPDATE api_keys SET ultimo_uso = NOW(), total_requisicoes = total_requisicoes + 1 WHERE id = $1`, apiKey.ID)
+
+	return ApiKeyValidation{
+		Valid:        true,
+		ApiKey:       &apiKey,
+		IsSuperAdmin: apiKey.Tipo == "super_admin",
+	}
+}
+
+// ============================================
+// MIDDLEWARE DE AUTENTICAÇÃO
+// ============================================
+
+func (h *DatabaseHandler) AuthMiddleware(c *fiber.Ctx) error {
+	apiKey := c.Get("apikey")
+	if apiKey == "" {
+		apiKey = c.Get("x-api-key")
+	}
+	if apiKey == "" {
+		apiKey = c.Query("apikey")
+	}
+
+	validation := h.ValidateApiKey(apiKey)
+	if !validation.Valid {
+		return c.Status(401).JSON(fiber.Map{"error": validation.Error})
+	}
+
+	c.Locals("apiKey", validation.ApiKey)
+	c.Locals("isSuperAdmin", validation.IsSuperAdmin)
+
+	if ok, err := h.rateLimit(c, validation.ApiKey); !ok {
+		return err
+	}
+
+	// Propaga a key do chamador para as chamadas ao sidecar Node.js
+	c.SetUserContext(whatsapp.WithAPIKey(c.UserContext(), apiKey))
+
+	return c.Next()
+}
+
+func (h *DatabaseHandler) SuperAdminOnly(c *fiber.Ctx) error {
+	isSuperAdmin, ok := c.Locals("isSuperAdmin").(bool)
+	if !ok || !isSuperAdmin {
+		return c.Status(403).JSON(fiber.Map{"error": "Acesso restrito a Super Admin"})
+	}
+	return c.Next()
+}
+
+func (h *DatabaseHandler) InstanceAccessMiddleware(c *fiber.Ctx) error {
+	instanceName := c.Params("instance")
+	if instanceName == "" {
+		instanceName = c.Params("name")
+	}
+
+	if instanceName == "" {
+		return c.Next()
+	}
+
+	if !HasInstanceAccess(c, instanceName) {
+		return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
+	}
+
+	return c.Next()
+}
+
+// HasInstanceAccess informa se a key autenticada pode operar a instância.
+// Usado pelas rotas que recebem a instância no corpo e não na URL.
+func HasInstanceAccess(c *fiber.Ctx, instanceName string) bool {
+	if instanceName == "" {
+		return true
+	}
+
+	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
+	if isSuperAdmin {
+		return true
+	}
+
+	apiKey, ok := c.Locals("apiKey").(*ApiKey)
+	if !ok {
+		return false
+	}
+
+	for _, inst := range apiKey.InstanciasPermitidas {
+		if inst == instanceName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ============================================
+// ESCOPOS
+// ============================================
+
+const (
+	ScopeAll            = "*"
+	ScopeReadOnly       = "read-only"       // qualquer GET
+	ScopeMessagesSend   = "messages:send"   // envios, agendamentos e campanhas
+	ScopeGroupsWrite    = "groups:write"    // gerenciamento de grupos
+	ScopeInstancesAdmin = "instances:admin" // conexão, configurações, webhooks e integrações
+)
+
+var validScopes = map[string]bool{
+	ScopeAll:            true,
+	ScopeReadOnly:       true,
+	ScopeMessagesSend:   true,
+	ScopeGroupsWrite:    true,
+	ScopeInstancesAdmin: true,
+}
+
+// RequireScope bloqueia a rota para keys sem o escopo. Cada grupo de rotas
+// declara o escopo de escrita dele; read-only libera os GETs, exceto os de
+// administração da instância (configurações, webhooks, integrações...).
+func (h *DatabaseHandler) RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !HasScope(c, scope) {
+			return c.Status(403).JSON(fiber.Map{"error": "API Key sem o escopo " + scope})
+		}
+		return c.Next()
+	}
+}
+
+// HasScope informa se a key autenticada tem o escopo. Só o super admin e o
+// escopo * liberam tudo; keys sem escopos não passam (as criadas antes dos
+// escopos foram migradas para *).
+func HasScope(c *fiber.Ctx, scope string) bool {
+	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
+	if isSuperAdmin {
+		return true
+	}
+
+	apiKey, ok := c.Locals("apiKey").(*ApiKey)
+	if !ok {
+		return false
+	}
+
+	readOnly := c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+	for _, s := range apiKey.Scopes {
+		if s == ScopeAll || s == scope {
+			return true
+		}
+		if s == ScopeReadOnly && readOnly && scope != ScopeInstancesAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("informe ao menos um escopo (* para acesso total)")
+	}
+	for _, s := range scopes {
+		if !validScopes[s] {
+			return fmt.Errorf("escopo inválido: %s (use *, read-only, messages:send, groups:write ou instances:admin)", s)
+		}
+	}
+	return nil
+}
+
+// parseValidade aceita a validade em dias ("30", "45"...) ou uma data
+// explícita em expiraEm. Sem nenhuma das duas, a key não expira.
+func parseValidade(dias *string, expiraEm *time.Time) (*time.Time, error) {
+	if expiraEm != nil {
+		if !expiraEm.After(time.Now()) {
+			return nil, errors.New("expiraEm deve estar no futuro")
+		}
+		return expiraEm, nil
+	}
+	if dias == nil || *dias == "" || *dias == "0" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(*dias)
+	if err != nil || n < 0 || n > 3650 {
+		return nil, errors.New("validade deve ser o número de dias (1 a 3650)")
+	}
+	exp := time.Now().AddDate(0, 0, n)
+	return &exp, nil
+}
+
+// ============================================
+// ROTAS DE API KEYS
+// ============================================
+
+func (h *DatabaseHandler) ListApiKeys(c *fiber.Ctx) error {
+	var keys []ApiKey
+	err := h.db.Select(&keys, `
+		SELECT `+apiKeyColumns+`
+		FROM api_keys ORDER BY criado_em DESC
+	`)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar API Keys"})
+	}
+
+	// Adiciona campo expirada
+	type ApiKeyResponse struct {
+		ApiKey
+		Expirada bool `json:"expirada"`
+	}
+
+	var response []ApiKeyResponse
+	for _, k := range keys {
+		expirada := false
+		if k.ExpiraEm != nil && k.ExpiraEm.Before(time.Now()) {
+			expirada = true
+		}
+		response = append(response, ApiKeyResponse{ApiKey: k, Expirada: expirada})
+	}
+
+	return c.JSON(response)
+}
+
+func (h *DatabaseHandler) CreateApiKey(c *fiber.Ctx) error {
+	var body struct {
+		Nome                 string     `json:"nome"`
+		Tipo                 string     `json:"tipo"`
+		Validade             *string    `json:"validade"` // dias
+		ExpiraEm             *time.Time `json:"expiraEm"`
+		InstanciasPermitidas []string   `json:"instanciasPermitidas"`
+		Scopes               []string   `json:"scopes"`
+		LimiteRps            *float64   `json:"limiteRps"`
+		LimiteMensagensDia   *int       `json:"limiteMensagensDia"`
+		CotaMensagensMes     *int       `json:"cotaMensagensMes"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+
+	if body.Nome == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Nome obrigatório"})
+	}
+
+	if body.Tipo == "" {
+		body.Tipo = "user"
+	}
+
+	if err := validateScopes(body.Scopes); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validateLimits(body.LimiteRps, body.LimiteMensagensDia, body.CotaMensagensMes); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	expiraEm, err := parseValidade(body.Validade, body.ExpiraEm)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Gera a key
+	key, err := generateApiKey(body.Tipo)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar API Key"})
+	}
+	keyHash := hashApiKey(key)
+	keyPrefix := getKeyPrefix(key)
+
+	var id int
+	err = h.db.QueryRow(`
+		INSERT INTO api_keys (key_hash, key_prefix, nome, tipo, instancias_permitidas, expira_em, scopes,
+		                      limite_rps, limite_mensagens_dia, cota_mensagens_mes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, keyHash, keyPrefix, body.Nome, body.Tipo, pq.Array(body.InstanciasPermitidas), expiraEm, pq.Array(body.Scopes),
+		nullIfZeroFloat(body.LimiteRps), nullIfZero(body.LimiteMensagensDia), nullIfZero(body.CotaMensagensMes)).Scan(&id)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao criar API Key: " + err.Error()})
+	}
+	h.auditChange(c, "api_key.create", "", nil, h.apiKeySnapshot(id))
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "API Key criada! Guarde a key, ela não será mostrada novamente.",
+		"apiKey": fiber.Map{
+			"id":       id,
+			"key":      key,
+			"prefix":   keyPrefix,
+			"nome":     body.Nome,
+			"tipo":     body.Tipo,
+			"scopes":   body.Scopes,
+			"expiraEm": expiraEm,
+		},
+	})
+}
+
+func (h *DatabaseHandler) UpdateApiKey(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var body struct {
+		Nome                 *string    `json:"nome"`
+		Ativa                *bool      `json:"ativa"`
+		Tipo                 *string    `json:"tipo"`
+		InstanciasPermitidas []string   `json:"instanciasPermitidas"`
+		Scopes               []string   `json:"scopes"`
+		RenovarValidade      *string    `json:"renovarValidade"` // dias a partir de agora
+		ExpiraEm             *time.Time `json:"expiraEm"`
+		LimiteRps            *float64   `json:"limiteRps"` // 0 remove o limite
+		LimiteMensagensDia   *int       `json:"limiteMensagensDia"`
+		CotaMensagensMes     *int       `json:"cotaMensagensMes"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+
+	// Monta a query dinamicamente
+	updates := []string{}
+	args := []interface{}{}
+	argIdx := 1
+
+	if body.Nome != nil {
+		updates = append(updates, fmt.Sprintf("nome = $%d", argIdx))
+		args = append(args, *body.Nome)
+		argIdx++
+	}
+
+	if body.Ativa != nil {
+		updates = append(updates, fmt.Sprintf("ativa = $%d", argIdx))
+		args = append(args, *body.Ativa)
+		argIdx++
+	}
+
+	if body.Tipo != nil {
+		updates = append(updates, fmt.Sprintf("tipo = $%d", argIdx))
+		args = append(args, *body.Tipo)
+		argIdx++
+	}
+
+	if body.InstanciasPermitidas != nil {
+		updates = append(updates, fmt.Sprintf("instancias_permitidas = $%d", argIdx))
+		args = append(args, pq.Array(body.InstanciasPermitidas))
+		argIdx++
+	}
+
+	if body.Scopes != nil {
+		if err := validateScopes(body.Scopes); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		updates = append(updates, fmt.Sprintf("scopes = $%d", argIdx))
+		args = append(args, pq.Array(body.Scopes))
+		argIdx++
+	}
+
+	if err := validateLimits(body.LimiteRps, body.LimiteMensagensDia, body.CotaMensagensMes); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.LimiteRps != nil {
+		updates = append(updates, fmt.Sprintf("limite_rps = $%d", argIdx))
+		args = append(args, nullIfZeroFloat(body.LimiteRps))
+		argIdx++
+	}
+	if body.LimiteMensagensDia != nil {
+		updates = append(updates, fmt.Sprintf("limite_mensagens_dia = $%d", argIdx))
+		args = append(args, nullIfZero(body.LimiteMensagensDia))
+		argIdx++
+	}
+	if body.CotaMensagensMes != nil {
+		updates = append(updates, fmt.Sprintf("cota_mensagens_mes = $%d", argIdx))
+		args = append(args, nullIfZero(body.CotaMensagensMes))
+		argIdx++
+	}
+
+	if body.RenovarValidade != nil || body.ExpiraEm != nil {
+		exp, err := parseValidade(body.RenovarValidade, body.ExpiraEm)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		// "0" remove a expiração
+		updates = append(updates, fmt.Sprintf("expira_em = $%d", argIdx))
+		args = append(args, exp)
+		argIdx++
+	}
+
+	if len(updates) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Nada para atualizar"})
+	}
+
+	before := h.apiKeySnapshot(id)
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE api_keys SET %s WHERE id = $%d",
+		joinStrings(updates, ", "), argIdx)
+
+	_, err := h.db.Exec(query, args...)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao atualizar"})
+	}
+	h.auditChange(c, "api_key.update", "", before, h.apiKeySnapshot(id))
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// maxRotationGrace limita o tempo em que a key antiga continua válida.
+const maxRotationGrace = 30 * 24 * time.Hour
+
+// RotateApiKey gera uma key nova com os mesmos dados da atual. A antiga
+// continua válida por graceMinutes (padrão 24h) para dar tempo de trocar a
+// key nos clientes; com 0 ela é desativada na hora.
+func (h *DatabaseHandler) RotateApiKey(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "ID inválido"})
+	}
+
+	var body struct {
+		GraceMinutes *int `json:"graceMinutes"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+		}
+	}
+	grace := 24 * time.Hour
+	if body.GraceMinutes != nil {
+		grace = time.Duration(*body.GraceMinutes) * time.Minute
+	}
+	if grace < 0 || grace > maxRotationGrace {
+		return c.Status(400).JSON(fiber.Map{"error": "graceMinutes deve estar entre 0 e 43200"})
+	}
+
+	var old ApiKey
+	err = h.db.Get(&old, `SELECT `+apiKeyColumns+`, key_hash FROM api_keys WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "API Key não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar API Key"})
+	}
+	if !old.Ativa || old.SubstituidaPor != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "API Key desativada ou já rotacionada"})
+	}
+
+	key, err := generateApiKey(old.Tipo)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao gerar API Key"})
+	}
+	keyPrefix := getKeyPrefix(key)
+
+	tx, err := h.db.Beginx()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao rotacionar API Key"})
+	}
+	defer tx.Rollback()
+
+	var newID int
+	err = tx.QueryRow(`
+		INSERT INTO api_keys (key_hash, key_prefix, nome, tipo, instancias_permitidas, expira_em, scopes,
+		                      limite_rps, limite_mensagens_dia, cota_mensagens_mes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, hashApiKey(key), keyPrefix, old.Nome, old.Tipo, old.InstanciasPermitidas, old.ExpiraEm, old.Scopes,
+		old.LimiteRps, old.LimiteMensagensDia, old.CotaMensagensMes).Scan(&newID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao rotacionar API Key: " + err.Error()})
+	}
+
+	// A antiga expira no fim da carência (ou antes, se já ia expirar)
+	graceEnd := time.Now().Add(grace)
+	if old.ExpiraEm != nil && old.ExpiraEm.Before(graceEnd) {
+		graceEnd = *old.ExpiraEm
+	}
+	_, err = tx.Exec(`
+		UPDATE api_keys SET substituida_por = $2, expira_em = $3, ativa = $4 WHERE id = $1
+	`, id, newID, graceEnd, grace > 0)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao rotacionar API Key"})
+	}
+	if err := tx.Commit(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao rotacionar API Key"})
+	}
+	h.auditChange(c, "api_key.rotate", "", old, fiber.Map{
+		"previous": h.apiKeySnapshot(id),
+		"current":  h.apiKeySnapshot(newID),
+	})
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "API Key rotacionada! Guarde a key, ela não será mostrada novamente.",
+		"apiKey": fiber.Map{
+			"id":       newID,
+			"key":      key,
+			"prefix":   keyPrefix,
+			"nome":     old.Nome,
+			"tipo":     old.Tipo,
+			"scopes":   old.Scopes,
+			"expiraEm": old.ExpiraEm,
+		},
+		"previous": fiber.Map{
+			"id":       id,
+			"expiraEm": graceEnd,
+		},
+	})
+}
+
+func (h *DatabaseHandler) DeleteApiKey(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	// Não permite deletar a própria key
+	apiKey, _ := c.Locals("apiKey").(*ApiKey)
+	if apiKey != nil && fmt.Sprintf("%d", apiKey.ID) == id {
+		return c.Status(400).JSON(fiber.Map{"error": "Não é possível deletar sua própria API Key"})
+	}
+
+	before := h.apiKeySnapshot(id)
+
+	_, err := h.db.Exec(`DELETE FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao deletar"})
+	}
+	if before != nil {
+		h.auditChange(c, "api_key.delete", "", before, nil)
+	}
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// ============================================
+// ROTAS DE INSTÂNCIAS
+// ============================================
+
+func (h *DatabaseHandler) ListInstances(c *fiber.Ctx) error {
+	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
+	apiKey, _ := c.Locals("apiKey").(*ApiKey)
+
+	var instances []Instancia
+	var err error
+
+	if isSuperAdmin {
+		err = h.db.Select(&instances, `SELECT `+instanciaColumns+` FROM instancias ORDER BY criado_em DESC`)
+	} else if apiKey != nil && len(apiKey.InstanciasPermitidas) > 0 {
+		query, args, _ := sqlx.In(`SELECT `+instanciaColumns+` FROM instancias WHERE nome IN (?) ORDER BY criado_em DESC`, []string(apiKey.InstanciasPermitidas))
+		query = h.db.Rebind(query)
+		err = h.db.Select(&instances, query, args...)
+	} else {
+		instances = []Instancia{}
+	}
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar instâncias"})
+	}
+
+	// Adiciona stats para cada instância
+	type InstanceResponse struct {
+		Instancia
+		Stats DBStats `json:"stats"`
+	}
+
+	var response []InstanceResponse
+	for _, inst := range instances {
+		stats := h.getDBStats(inst.Nome)
+		response = append(response, InstanceResponse{Instancia: inst, Stats: stats})
+	}
+
+	return c.JSON(response)
+}
+
+func (h *DatabaseHandler) CreateInstance(c *fiber.Ctx) error {
+	var body struct {
+		Name string `json:"name"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+
+	if body.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Nome obrigatório"})
+	}
+
+	apiKey, _ := c.Locals("apiKey").(*ApiKey)
+	var criadoPor *int
+	if apiKey != nil {
+		criadoPor = &apiKey.ID
+	}
+
+	before := h.instanceSnapshot(body.Name)
+
+	_, err := h.db.Exec(`
+		INSERT INTO instancias (nome, criado_por)
+		VALUES ($1, $2)
+		ON CONFLICT (nome) DO UPDATE SET atualizado_em = NOW()
+	`, body.Name, criadoPor)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao criar instância"})
+	}
+	h.auditChange(c, "instance.create", body.Name, before, h.instanceSnapshot(body.Name))
+
+	return c.JSON(fiber.Map{
+		"status": "success",
+		"instance": fiber.Map{
+			"name":   body.Name,
+			"status": "disconnected",
+		},
+	})
+}
+
+func (h *DatabaseHandler) DeleteInstance(c *fiber.Ctx) error {
+	name := c.Params("name")
+	before := h.instanceSnapshot(name)
+
+	// Deleta dados relacionados
+	h.db.Exec(`DELETE FROM contatos WHERE instance = $1`, name)
+	h.db.Exec(`DELETE FROM grupos WHERE instance = $1`, name)
+	h.db.Exec(`DELETE FROM mensagens WHERE instance = $1`, name)
+	h.db.Exec(`DELETE FROM instancias WHERE nome = $1`, name)
+	if h.Events != nil {
+		h.Events.Forget(name)
+	}
+
+	if before != nil {
+		h.auditChange(c, "instance.delete", name, before, nil)
+	}
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// ============================================
+// SNAPSHOTS (auditoria)
+// ============================================
+
+// apiKeySnapshot lê a key para o registro de auditoria; nil se não existir.
+func (h *DatabaseHandler) apiKeySnapshot(id interface{}) *ApiKey {
+	var k ApiKey
+	if err := h.db.Get(&k, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id); err != nil {
+		return nil
+	}
+	return &k
+}
+
+func (h *DatabaseHandler) instanceSnapshot(name string) *Instancia {
+	var inst Instancia
+	if err := h.db.Get(&inst, `SELECT `+instanciaColumns+` FROM instancias WHERE nome = $1`, name); err != nil {
+		return nil
+	}
+	return &inst
+}
+
+// ============================================
+// ROTAS DE CONTATOS E GRUPOS
+// ============================================
+
+func (h *DatabaseHandler) GetContacts(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+
+	var contatos []Contato
+	err := h.db.Select(&contatos, `
+		SELECT id, instance, jid, nome, criado_em 
+		FROM contatos WHERE instance = $1 ORDER BY nome ASC
+	`, instance)
+
+	if err != nil {
+		return c.JSON([]Contato{})
+	}
+
+	return c.JSON(contatos)
+}
+
+func (h *DatabaseHandler) GetGroups(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+
+	var grupos []Grupo
+	err := h.db.Select(&grupos, `
+		SELECT id, instance, jid, nome, criado_em 
+		FROM grupos WHERE instance = $1 ORDER BY nome ASC
+	`, instance)
+
+	if err != nil {
+		return c.JSON([]Grupo{})
+	}
+
+	return c.JSON(grupos)
+}
+
+func (h *DatabaseHandler) GetStats(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+	stats := h.getDBStats(instance)
+	return c.JSON(stats)
+}
+
+func (h *DatabaseHandler) getDBStats(instance string) DBStats {
+	var stats DBStats
+
+	h.db.Get(&stats.Contacts, `SELECT COUNT(*) FROM contatos WHERE instance = $1`, instance)
+	h.db.Get(&stats.Groups, `SELECT COUNT(*) FROM grupos WHERE instance = $1`, instance)
+	h.db.Get(&stats.Messages, `SELECT COUNT(*) FROM mensagens WHERE instance = $1`, instance)
+
+	return stats
+}
+
+// ============================================
+// ROTA /v1/me
+// ============================================
+
+func (h *DatabaseHandler) GetMe(c *fiber.Ctx) error {
+	apiKey, ok := c.Locals("apiKey").(*ApiKey)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Não autenticado"})
+	}
+
+	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
+
+	usage, err := h.counter.KeyUsage(c.UserContext(), apiKey.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar uso da API Key"})
+	}
+
+	return c.JSON(fiber.Map{
+		"id":                   apiKey.ID,
+		"nome":                 apiKey.Nome,
+		"tipo":                 apiKey.Tipo,
+		"isSuperAdmin":         isSuperAdmin,
+		"instanciasPermitidas": apiKey.InstanciasPermitidas,
+		"scopes":               apiKey.Scopes,
+		"criadoEm":             apiKey.CriadoEm,
+		"expiraEm":             apiKey.ExpiraEm,
+		"ultimoUso":            apiKey.UltimoUso,
+		"limites": fiber.Map{
+			"limiteRps":          apiKey.LimiteRps,
+			"limiteMensagensDia": apiKey.LimiteMensagensDia,
+			"cotaMensagensMes":   apiKey.CotaMensagensMes,
+		},
+		"uso": usage,
+	})
+}
+
+// ============================================
+// HELPER
+// ============================================
+
+func joinStrings(strs []string, sep string) string {
+	result := ""
+	for i, s := range strs {
+		if i > 0 {
+			result += sep
+		}
+		result += s
+	}
+	return result
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/settings"
+)
+
+// EventHandler recebe os eventos que o sidecar Node.js publica em
+// POST /internal/events e os repassa ao barramento de eventos.
+type EventHandler struct {
+	Bus      *eventbus.Bus
+	History  *history.Store
+	Settings *settings.Store
+}
+
+func NewEventHandler(b *eventbus.Bus, h *history.Store, s *settings.Store) *EventHandler {
+	return &EventHandler{Bus: b, History: h, Settings: s}
+}
+
+func (h *EventHandler) Ingest(c *fiber.Ctx) error {
+	var evt models.Event
+	if err := c.BodyParser(&evt); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+	if evt.Event == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "event required"})
+	}
+
+	if evt.Event == "connection.update" && evt.Instance != "" {
+		h.onConnection(evt)
+	}
+
+	// Com ignore_groups, eventos de grupo continuam no histórico mas não
+	// chegam aos webhooks nem às filas
+	muted := evt.Instance != "" && isGroupEvent(evt) && h.Settings.IgnoresGroups(c.UserContext(), evt.Instance)
+
+	if evt.Instance != "" {
+		h.record(c, evt, muted)
+	}
+
+	if !muted {
+		h.Bus.Publish(evt)
+	}
+
+	return c.Status(202).JSON(fiber.Map{"status": "accepted"})
+}
+
+// record grava mensagens e acks no histórico. Cada ack vira também um evento
+// "message.ack" normalizado.
+func (h *EventHandler) record(c *fiber.Ctx, evt models.Event, muted bool) {
+	ctx := c.UserContext()
+
+	var acks []history.Ack
+	var err error
+	switch evt.Event {
+	case "messages.upsert":
+		err = h.History.SaveUpsert(ctx, evt.Instance, evt.Data)
+	case "messages.update":
+		var ack *history.Ack
+		if ack, err = h.History.SaveUpdate(ctx, evt.Instance, evt.Data); ack != nil {
+			acks = append(acks, *ack)
+		}
+	case "message-receipt.update":
+		acks, err = h.History.SaveReceipt(ctx, evt.Instance, evt.Data)
+	}
+	if err != nil {
+		log.Printf("⚠️ [historico] erro ao gravar %s de %s: %v", evt.Event, evt.Instance, err)
+	}
+
+	if muted {
+		return
+	}
+	for _, ack := range acks {
+		data, _ := json.Marshal(fiber.Map{
+			"messageId":   ack.MessageID,
+			"chatJid":     ack.ChatJid,
+			"fromMe":      ack.FromMe,
+			"participant": ack.Participant,
+			"status":      ack.Status,
+			"timestamp":   ack.Timestamp,
+		})
+		h.Bus.Publish(models.Event{Instance: evt.Instance, Event: "message.ack", Data: data})
+	}
+}
+
+// onConnection reenvia as configurações ao sidecar quando a instância
+// conecta, já que ele as mantém só em memória.
+func (h *EventHandler) onConnection(evt models.Event) {
+	var u struct {
+		Connection string `json:"connection"`
+	}
+	if err := json.Unmarshal(evt.Data, &u); err != nil || u.Connection != "open" {
+		return
+	}
+
+	go func(instance string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.Settings.Push(ctx, instance); err != nil {
+			log.Printf("⚠️ [settings] erro ao aplicar configurações de %s: %v", instance, err)
+		}
+	}(evt.Instance)
+}
+
+// isGroupEvent indica se o evento de mensagem pertence a um chat de grupo.
+func isGroupEvent(evt models.Event) bool {
+	var key struct {
+		RemoteJid string `json:"remoteJid"`
+	}
+	switch evt.Event {
+	case "messages.upsert":
+		var d struct {
+			Message struct {
+				Key json.RawMessage `json:"key"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(evt.Data, &d) != nil || json.Unmarshal(d.Message.Key, &key) != nil {
+			return false
+		}
+	case "messages.update", "message-receipt.update":
+		var d struct {
+			Key json.RawMessage `json:"key"`
+		}
+		if json.Unmarshal(evt.Data, &d) != nil || json.Unmarshal(d.Key, &key) != nil {
+			return false
+		}
+	default:
+		return false
+	}
+	return strings.HasSuffix(key.RemoteJid, "@g.us")
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+// EventsConfigHandler configura os destinos do barramento de eventos de cada
+// instância (RabbitMQ, SQS e stream WebSocket).
+type EventsConfigHandler struct {
+	DB    *sqlx.DB
+	Bus   *eventbus.Bus
+	Audit *audit.Log
+}
+
+func NewEventsConfigHandler(db *sqlx.DB, b *eventbus.Bus, l *audit.Log) *EventsConfigHandler {
+	return &EventsConfigHandler{DB: db, Bus: b, Audit: l}
+}
+
+func (h *EventsConfigHandler) GetConfig(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+
+	cfg, err := h.Bus.Config(c.UserContext(), instance)
+	if errors.Is(err, eventbus.ErrInstanceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar configuração de eventos"})
+	}
+
+	// Webhook é configurado em /webhook; aqui só para consulta
+	if wh, err := webhook.GetConfig(h.DB, instance); err == nil {
+		wh.Secret = ""
+		cfg.Webhook = *wh
+	}
+
+	// Credenciais nunca são devolvidas
+	cfg.RabbitMQ.URI = redactURI(cfg.RabbitMQ.URI)
+	hasSecret := cfg.SQS.SecretKey != ""
+	cfg.SQS.SecretKey = ""
+
+	return c.JSON(fiber.Map{"events": cfg, "sqsHasSecret": hasSecret})
+}
+
+// eventsUpdate é o corpo de UpdateConfig: blocos ausentes mantêm a
+// configuração atual.
+type eventsUpdate struct {
+	RabbitMQ  json.RawMessage `json:"rabbitmq"`
+	SQS       json.RawMessage `json:"sqs"`
+	WebSocket *bool           `json:"websocket_enabled"`
+}
+
+// UpdateConfig aceita a configuração completa ou só os blocos a alterar; dentro
+// de um bloco, campos ausentes também mantêm o valor atual. A URI mascarada
+// devolvida pelo GET e secret_key vazio mantêm os valores atuais.
+func (h *EventsConfigHandler) UpdateConfig(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+	ctx := c.UserContext()
+
+	current, err := h.Bus.Config(ctx, instance)
+	if errors.Is(err, eventbus.ErrInstanceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar configuração de eventos"})
+	}
+
+	var body eventsUpdate
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+
+	// Cada bloco é lido sobre uma cópia própria do atual, que segue intacto
+	// para a auditoria
+	cfg, err := h.Bus.Config(ctx, instance)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar configuração de eventos"})
+	}
+	if len(body.RabbitMQ) > 0 {
+		if err := json.Unmarshal(body.RabbitMQ, &cfg.RabbitMQ); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Bloco rabbitmq inválido"})
+		}
+	}
+	if len(body.SQS) > 0 {
+		if err := json.Unmarshal(body.SQS, &cfg.SQS); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Bloco sqs inválido"})
+		}
+	}
+	if body.WebSocket != nil {
+		cfg.WebSocket = *body.WebSocket
+	}
+
+	if cfg.RabbitMQ.URI != "" && cfg.RabbitMQ.URI == redactURI(current.RabbitMQ.URI) {
+		cfg.RabbitMQ.URI = current.RabbitMQ.URI
+	}
+	if cfg.SQS.SecretKey == "" {
+		cfg.SQS.SecretKey = current.SQS.SecretKey
+	}
+
+	if cfg.RabbitMQ.Enabled {
+		u, err := url.Parse(cfg.RabbitMQ.URI)
+		if err != nil || (u.Scheme != "amqp" && u.Scheme != "amqps") || u.Host == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "URI do RabbitMQ inválida (amqp:// ou amqps://)"})
+		}
+		if cfg.RabbitMQ.Queue == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "Fila do RabbitMQ obrigatória"})
+		}
+	}
+
+	// Só o super admin aponta a fila SQS para a rede interna
+	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
+	cfg.SQS.AllowInternal = isSuperAdmin
+	if cfg.SQS.Enabled {
+		if err := webhook.ValidateURL(ctx, cfg.SQS.QueueURL, isSuperAdmin); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "queue_url do SQS inválida: " + err.Error()})
+		}
+		if cfg.SQS.Region == "" || cfg.SQS.AccessKey == "" || cfg.SQS.SecretKey == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "region, access_key e secret_key obrigatórios para o SQS"})
+		}
+	}
+
+	if err := h.Bus.SaveConfig(ctx, instance, cfg); err != nil {
+		if errors.Is(err, eventbus.ErrInstanceNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar configuração de eventos"})
+	}
+	recordChange(h.Audit, c, "events.update", instance, eventsSnapshot(current), eventsSnapshot(cfg))
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// eventsSnapshot é a configuração registrada na auditoria, sem credenciais.
+func eventsSnapshot(cfg models.EventsConfig) models.EventsConfig {
+	cfg.Webhook.Secret = ""
+	cfg.RabbitMQ.URI = redactURI(cfg.RabbitMQ.URI)
+	cfg.SQS.SecretKey = ""
+	return cfg
+}
+
+// redactURI esconde a senha da URI do broker.
+func redactURI(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/dbtest"
+	"github.com/nexus/gowhats/internal/eventbus"
+)
+
+func TestUpdateEventsConfigMergesBlocks(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db)
+	bus := eventbus.New(db, nil)
+	h := NewEventsConfigHandler(db, bus, audit.New(nil))
+
+	superAdmin := false
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("isSuperAdmin", superAdmin)
+		return c.Next()
+	})
+	app.Put("/:instance/events", h.UpdateConfig)
+
+	put := func(body string) int {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/"+instance+"/events", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if code := put(`{"rabbitmq":{"enabled":true,"uri":"amqp://u:p@broker.example:5672/","queue":"eventos","events":["message.received","message.ack"]}}`); code != 200 {
+		t.Fatalf("PUT rabbitmq = %d", code)
+	}
+	before, _ := bus.Config(context.Background(), instance)
+
+	// Só a lista de eventos muda; URI e fila continuam, e o valor lido antes
+	// não é tocado
+	if code := put(`{"rabbitmq":{"events":["instance.state"]}}`); code != 200 {
+		t.Fatalf("PUT parcial = %d", code)
+	}
+	after, _ := bus.Config(context.Background(), instance)
+	if after.RabbitMQ.URI != "amqp://u:p@broker.example:5672/" || after.RabbitMQ.Queue != "eventos" || !reflect.DeepEqual(after.RabbitMQ.Events, []string{"instance.state"}) {
+		t.Errorf("rabbitmq após PUT parcial = %+v", after.RabbitMQ)
+	}
+	if !reflect.DeepEqual(before.RabbitMQ.Events, []string{"message.received", "message.ack"}) {
+		t.Errorf("configuração lida antes foi alterada: %v", before.RabbitMQ.Events)
+	}
+
+	sqs := `{"sqs":{"enabled":true,"queue_url":"http://127.0.0.1:9324/000000000000/eventos","region":"us-east-1","access_key":"AK","secret_key":"SK","allow_internal":true}}`
+	if code := put(sqs); code != 400 {
+		t.Errorf("fila SQS interna gravada por key comum: status %d, want 400", code)
+	}
+	superAdmin = true
+	if code := put(sqs); code != 200 {
+		t.Fatalf("fila SQS interna gravada pelo super admin: status %d", code)
+	}
+	if cfg, _ := bus.Config(context.Background(), instance); !cfg.SQS.AllowInternal || cfg.RabbitMQ.Queue != "eventos" {
+		t.Errorf("config após PUT do SQS = %+v", cfg)
+	}
+}
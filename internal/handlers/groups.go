@@ -1,53 +1,134 @@
-package handlers
-
-import (
-	"github.com/gofiber/fiber/v2"
-	"github.com/nexus/gowhats/internal/models"
-	"github.com/nexus/gowhats/internal/whatsapp"
-)
-
-type GroupHandler struct {
-	Service *whatsapp.Service
-}
-
-func NewGroupHandler(s *whatsapp.Service) *GroupHandler {
-	return &GroupHandler{Service: s}
-}
-
-func (h *GroupHandler) Create(c *fiber.Ctx) error {
-	instanceKey := c.Params("instance")
-	var req models.CreateGroupRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-
-	gid, err := h.Service.CreateGroup(instanceKey, req)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	return c.JSON(fiber.Map{"status": "success", "group_id": gid})
-}
-
-func (h *GroupHandler) UpdateParticipants(c *fiber.Ctx) error {
-	instanceKey := c.Params("instance")
-	groupID := c.Params("group_id")
-	
-	var req models.GroupActionRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-	req.GroupID = groupID
-
-	action := c.Query("action")
-	if action == "" {
-		return c.Status(400).JSON(fiber.Map{"error": "action required"})
-	}
-
-	err := h.Service.ManageGroup(instanceKey, action, req)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	return c.JSON(fiber.Map{"status": "success"})
-}
\ No newline at end of file
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+type GroupHandler struct {
+	Service *whatsapp.Service
+}
+
+func NewGroupHandler(s *whatsapp.Service) *GroupHandler {
+	return &GroupHandler{Service: s}
+}
+
+func (h *GroupHandler) Create(c *fiber.Ctx) error {
+	instanceKey := c.Params("instance")
+	var req models.CreateGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	group, err := h.Service.CreateGroup(c.UserContext(), instanceKey, req)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "group_id": group.ID, "group": group})
+}
+
+func (h *GroupHandler) Get(c *fiber.Ctx) error {
+	group, err := h.Service.GetGroup(c.UserContext(), c.Params("instance"), c.Params("group_id"))
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(group)
+}
+
+// UpdateParticipants executa add/remove/promote/demote. A ação vem em
+// ?action= ou no campo "action" do corpo.
+func (h *GroupHandler) UpdateParticipants(c *fiber.Ctx) error {
+	instanceKey := c.Params("instance")
+	groupID := c.Params("group_id")
+
+	var req models.GroupActionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+	req.GroupID = groupID
+
+	action := c.Query("action", req.Action)
+	if action == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "action required"})
+	}
+
+	group, results, err := h.Service.ManageGroup(c.UserContext(), instanceKey, action, req)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "group": group, "results": results})
+}
+
+// Update altera assunto, descrição e/ou foto do grupo.
+func (h *GroupHandler) Update(c *fiber.Ctx) error {
+	var req models.UpdateGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	group, err := h.Service.UpdateGroup(c.UserContext(), c.Params("instance"), c.Params("group_id"), req)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "group": group})
+}
+
+func (h *GroupHandler) UpdateSettings(c *fiber.Ctx) error {
+	var req models.GroupSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	group, err := h.Service.UpdateGroupSettings(c.UserContext(), c.Params("instance"), c.Params("group_id"), req)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "group": group})
+}
+
+func (h *GroupHandler) GetInvite(c *fiber.Ctx) error {
+	invite, err := h.Service.GetGroupInvite(c.UserContext(), c.Params("instance"), c.Params("group_id"))
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(invite)
+}
+
+func (h *GroupHandler) RevokeInvite(c *fiber.Ctx) error {
+	invite, err := h.Service.RevokeGroupInvite(c.UserContext(), c.Params("instance"), c.Params("group_id"))
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(invite)
+}
+
+func (h *GroupHandler) Join(c *fiber.Ctx) error {
+	var req models.JoinGroupRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	group, err := h.Service.JoinGroup(c.UserContext(), c.Params("instance"), req)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "group": group})
+}
+
+func (h *GroupHandler) Leave(c *fiber.Ctx) error {
+	err := h.Service.LeaveGroup(c.UserContext(), c.Params("instance"), c.Params("group_id"))
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/handoff"
+)
+
+// HandoffHandler liga e desliga o atendimento humano por chat. Enquanto o
+// chat estiver com um atendente, os bots da instância ficam em silêncio.
+type HandoffHandler struct {
+	Store *handoff.Store
+	Audit *audit.Log
+}
+
+func NewHandoffHandler(s *handoff.Store, l *audit.Log) *HandoffHandler {
+	return &HandoffHandler{Store: s, Audit: l}
+}
+
+func (h *HandoffHandler) List(c *fiber.Ctx) error {
+	items, err := h.Store.List(c.UserContext(), c.Params("instance"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao listar atendimentos"})
+	}
+	return c.JSON(fiber.Map{"handoffs": items})
+}
+
+// Start aceita {"minutes": 60, "reason": "..."}; sem minutes vale até ser
+// liberado.
+func (h *HandoffHandler) Start(c *fiber.Ctx) error {
+	var body struct {
+		Minutes int    `json:"minutes"`
+		Reason  string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+		}
+	}
+	if body.Minutes < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "minutes não pode ser negativo"})
+	}
+
+	instance, jid := c.Params("instance"), jidParam(c)
+	before := h.snapshot(c, instance, jid)
+	t, err := h.Store.Start(c.UserContext(), instance, jid, body.Reason, time.Duration(body.Minutes)*time.Minute)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao registrar atendimento"})
+	}
+	recordChange(h.Audit, c, "handoff.start", instance, before, t)
+	return c.JSON(fiber.Map{"status": "success", "handoff": t})
+}
+
+func (h *HandoffHandler) Release(c *fiber.Ctx) error {
+	instance, jid := c.Params("instance"), jidParam(c)
+	before := h.snapshot(c, instance, jid)
+	err := h.Store.Release(c.UserContext(), instance, jid)
+	if errors.Is(err, handoff.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao liberar atendimento"})
+	}
+	recordChange(h.Audit, c, "handoff.release", instance, before, nil)
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// snapshot devolve o atendimento vigente para a auditoria (nil se não há).
+func (h *HandoffHandler) snapshot(c *fiber.Ctx, instance, jid string) interface{} {
+	t, err := h.Store.Get(c.UserContext(), instance, jid)
+	if err != nil {
+		return nil
+	}
+	return t
+}
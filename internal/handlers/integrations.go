@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/chatwoot"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/triggers"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+const maskedSecret = "********"
+
+// IntegrationsHandler configura as integrações da instância
+// (instancias.integracoes) e recebe os webhooks delas.
+type IntegrationsHandler struct {
+	Store    *integrations.Store
+	Chatwoot *chatwoot.Connector
+	Audit    *audit.Log
+}
+
+func NewIntegrationsHandler(s *integrations.Store, cw *chatwoot.Connector, l *audit.Log) *IntegrationsHandler {
+	return &IntegrationsHandler{Store: s, Chatwoot: cw, Audit: l}
+}
+
+func (h *IntegrationsHandler) Get(c *fiber.Ctx) error {
+	cfg, err := h.Store.Get(c.UserContext(), c.Params("instance"))
+	if errors.Is(err, integrations.ErrInstanceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar integrações"})
+	}
+
+	return c.JSON(fiber.Map{"integrations": masked(cfg)})
+}
+
+// integrationsUpdate é o corpo de Update: blocos ausentes mantêm a
+// configuração atual.
+type integrationsUpdate struct {
+	Typebot  json.RawMessage `json:"typebot"`
+	Chatwoot json.RawMessage `json:"chatwoot"`
+	OpenAI   json.RawMessage `json:"openai"`
+	Dify     json.RawMessage `json:"dify"`
+	Triggers json.RawMessage `json:"triggers"`
+}
+
+// Update aceita a configuração completa ou só os blocos a alterar; dentro de
+// um bloco, campos ausentes também mantêm o valor atual. Tokens vazios ou
+// mascarados mantêm os valores atuais. Com o Chatwoot ligado, a inbox é
+// vinculada (ou criada) na hora.
+func (h *IntegrationsHandler) Update(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+	ctx := c.UserContext()
+
+	current, err := h.Store.Get(ctx, instance)
+	if errors.Is(err, integrations.ErrInstanceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar integrações"})
+	}
+
+	var body integrationsUpdate
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+
+	// Os blocos são lidos sobre uma cópia própria do atual, que segue
+	// intacto para a auditoria
+	cfg, err := h.Store.Get(ctx, instance)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar integrações"})
+	}
+	blocks := []struct {
+		name string
+		raw  json.RawMessage
+		dst  interface{}
+	}{
+		{"typebot", body.Typebot, &cfg.Typebot},
+		{"chatwoot", body.Chatwoot, &cfg.Chatwoot},
+		{"openai", body.OpenAI, &cfg.OpenAI},
+		{"dify", body.Dify, &cfg.Dify},
+		{"triggers", body.Triggers, &cfg.Triggers},
+	}
+	for _, b := range blocks {
+		if len(b.raw) == 0 {
+			continue
+		}
+		if err := mergeBlock(b.dst, b.raw); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Bloco " + b.name + " inválido"})
+		}
+	}
+
+	if cfg.Chatwoot.Token == "" || cfg.Chatwoot.Token == maskedSecret {
+		cfg.Chatwoot.Token = current.Chatwoot.Token
+	}
+	if cfg.OpenAI.ApiKey == "" || cfg.OpenAI.ApiKey == maskedSecret {
+		cfg.OpenAI.ApiKey = current.OpenAI.ApiKey
+	}
+	if cfg.Dify.ApiKey == "" || cfg.Dify.ApiKey == maskedSecret {
+		cfg.Dify.ApiKey = current.Dify.ApiKey
+	}
+	// Trocar de conta ou servidor invalida a inbox vinculada
+	if cfg.Chatwoot.URL != current.Chatwoot.URL || cfg.Chatwoot.AccountID != current.Chatwoot.AccountID {
+		cfg.Chatwoot.InboxID = 0
+	}
+
+	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
+	cfg.Chatwoot.AllowInternal = allowInternalURL(isSuperAdmin, cfg.Chatwoot.URL, current.Chatwoot.URL, current.Chatwoot.AllowInternal)
+	if cfg.Chatwoot.Enabled {
+		if err := webhook.ValidateURL(ctx, cfg.Chatwoot.URL, cfg.Chatwoot.AllowInternal); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "URL do Chatwoot inválida: " + err.Error()})
+		}
+		if strings.TrimSpace(cfg.Chatwoot.AccountID) == "" || cfg.Chatwoot.Token == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "account_id e token do Chatwoot são obrigatórios"})
+		}
+	}
+
+	cfg.Typebot.AllowInternal = allowInternalURL(isSuperAdmin, cfg.Typebot.URL, current.Typebot.URL, current.Typebot.AllowInternal)
+	if cfg.Typebot.Enabled {
+		if err := webhook.ValidateURL(ctx, cfg.Typebot.URL, cfg.Typebot.AllowInternal); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "URL do Typebot inválida: " + err.Error()})
+		}
+		if strings.TrimSpace(cfg.Typebot.Typebot) == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "typebot_name (public id do fluxo) é obrigatório"})
+		}
+		switch cfg.Typebot.TriggerType {
+		case "", "all":
+		case "keyword":
+			if len(cfg.Typebot.Keywords) == 0 {
+				return c.Status(400).JSON(fiber.Map{"error": "keywords é obrigatório com trigger_type keyword"})
+			}
+		default:
+			return c.Status(400).JSON(fiber.Map{"error": "trigger_type inválido (all ou keyword)"})
+		}
+		if cfg.Typebot.ExpireMinutes < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "expire_minutes não pode ser negativo"})
+		}
+	}
+
+	cfg.OpenAI.AllowInternal = allowInternalURL(isSuperAdmin, cfg.OpenAI.BaseURL, current.OpenAI.BaseURL, current.OpenAI.AllowInternal)
+	if cfg.OpenAI.Enabled {
+		if cfg.OpenAI.BaseURL != "" {
+			if err := webhook.ValidateURL(ctx, cfg.OpenAI.BaseURL, cfg.OpenAI.AllowInternal); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "base_url da IA inválida: " + err.Error()})
+			}
+		} else if cfg.OpenAI.ApiKey == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "api_key é obrigatório para a API da OpenAI"})
+		}
+		if strings.TrimSpace(cfg.OpenAI.Model) == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "model é obrigatório"})
+		}
+		if cfg.OpenAI.MaxHistory < 0 || cfg.OpenAI.MaxTokens < 0 || cfg.OpenAI.RateLimit < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "max_history, max_tokens e rate_limit_per_minute não podem ser negativos"})
+		}
+	}
+
+	cfg.Dify.AllowInternal = allowInternalURL(isSuperAdmin, cfg.Dify.URL, current.Dify.URL, current.Dify.AllowInternal)
+	if cfg.Dify.Enabled {
+		if err := webhook.ValidateURL(ctx, cfg.Dify.URL, cfg.Dify.AllowInternal); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "URL do Dify inválida: " + err.Error()})
+		}
+		if cfg.Dify.ApiKey == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "api_key do Dify é obrigatório"})
+		}
+		if cfg.Dify.AppType != "" && cfg.Dify.AppType != "chat" && cfg.Dify.AppType != "workflow" {
+			return c.Status(400).JSON(fiber.Map{"error": "app_type inválido (chat ou workflow)"})
+		}
+		switch cfg.Dify.TriggerType {
+		case "", "all", "no_agent":
+		case "keyword":
+			if len(cfg.Dify.Keywords) == 0 {
+				return c.Status(400).JSON(fiber.Map{"error": "keywords é obrigatório com trigger_type keyword"})
+			}
+		default:
+			return c.Status(400).JSON(fiber.Map{"error": "trigger_type inválido (all, keyword ou no_agent)"})
+		}
+		if cfg.Dify.ExpireMinutes < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "expire_minutes não pode ser negativo"})
+		}
+	}
+
+	if err := validateTriggers(cfg.Triggers); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	resp := fiber.Map{"status": "success"}
+	if cfg.Chatwoot.Enabled {
+		linked, err := h.Chatwoot.Setup(ctx, instance, cfg.Chatwoot)
+		if err != nil {
+			resp["warning"] = "salvo, mas a inbox do Chatwoot não foi vinculada: " + err.Error()
+		}
+		cfg.Chatwoot = linked
+	}
+
+	if err := h.Store.Save(ctx, instance, cfg); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar integrações"})
+	}
+	recordChange(h.Audit, c, "integrations.update", instance, masked(current), masked(cfg))
+
+	resp["integrations"] = masked(cfg)
+	return c.JSON(resp)
+}
+
+// ChatwootWebhook recebe os eventos da inbox. Rota pública: a autenticação é
+// o token assinado na URL configurada pelo gateway.
+func (h *IntegrationsHandler) ChatwootWebhook(c *fiber.Ctx) error {
+	err := h.Chatwoot.HandleWebhook(c.Params("instance"), c.Query("token"), c.Body())
+	if errors.Is(err, chatwoot.ErrInvalidToken) {
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+var triggerBots = map[string]bool{"typebot": true, "openai": true, "dify": true, "none": true}
+
+func validateTriggers(cfg models.TriggersConfig) error {
+	if cfg.DebounceSeconds < 0 || cfg.DebounceSeconds > 300 {
+		return errors.New("debounce_seconds deve estar entre 0 e 300")
+	}
+	if cfg.HandoffMinutes < 0 {
+		return errors.New("handoff_minutes não pode ser negativo")
+	}
+	for i, rule := range cfg.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if !triggerBots[rule.Bot] {
+			return fmt.Errorf("regra %s: bot inválido (typebot, openai, dify ou none)", name)
+		}
+		switch rule.Chat {
+		case "", "private", "group", "any":
+		default:
+			return fmt.Errorf("regra %s: chat inválido (private, group ou any)", name)
+		}
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return fmt.Errorf("regra %s: regex inválida: %v", name, err)
+			}
+		}
+		if rule.BusinessHours != nil {
+			if err := triggers.ValidateBusinessHours(rule.BusinessHours); err != nil {
+				return fmt.Errorf("regra %s: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// mergeBlock aplica sobre dst (ponteiro para um bloco da configuração) os
+// campos enviados em raw. Cada campo enviado substitui o atual por inteiro:
+// decodificar direto sobre dst misturaria as regras novas com as antigas de
+// mesma posição.
+func mergeBlock(dst interface{}, raw json.RawMessage) error {
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &sent); err != nil {
+		return err
+	}
+	current, err := json.Marshal(dst)
+	if err != nil {
+		return err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(current, &fields); err != nil {
+		return err
+	}
+	for k, v := range sent {
+		fields[k] = v
+	}
+	merged, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	v.Set(reflect.Zero(v.Type()))
+	return json.Unmarshal(merged, dst)
+}
+
+// allowInternalURL diz se a URL de uma integração pode apontar para a rede
+// interna: só um super admin libera, e a liberação vale enquanto a URL for a
+// que ele gravou.
+func allowInternalURL(isSuperAdmin bool, url, currentURL string, currentAllow bool) bool {
+	return isSuperAdmin || (currentAllow && url == currentURL)
+}
+
+// masked esconde as credenciais devolvidas pela API.
+func masked(cfg models.IntegrationsConfig) models.IntegrationsConfig {
+	if cfg.Chatwoot.Token != "" {
+		cfg.Chatwoot.Token = maskedSecret
+	}
+	if cfg.OpenAI.ApiKey != "" {
+		cfg.OpenAI.ApiKey = maskedSecret
+	}
+	if cfg.Dify.ApiKey != "" {
+		cfg.Dify.ApiKey = maskedSecret
+	}
+	return cfg
+}
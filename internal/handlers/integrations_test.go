@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/dbtest"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestMergeBlock(t *testing.T) {
+	cfg := models.TriggersConfig{
+		StopWords:       []string{"atendente"},
+		DebounceSeconds: 4,
+		Rules: []models.TriggerRule{
+			{Name: "pedidos", Bot: "dify", Keywords: []string{"pedido"}, Tags: []string{"vip"}},
+		},
+	}
+
+	if err := mergeBlock(&cfg, json.RawMessage(`{"rules":[{"bot":"openai"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	// A regra enviada substitui a antiga inteira, sem herdar keywords e tags
+	if !reflect.DeepEqual(cfg.Rules, []models.TriggerRule{{Bot: "openai"}}) {
+		t.Errorf("rules = %+v", cfg.Rules)
+	}
+	if cfg.DebounceSeconds != 4 || !reflect.DeepEqual(cfg.StopWords, []string{"atendente"}) {
+		t.Errorf("campos não enviados mudaram: %+v", cfg)
+	}
+
+	if err := mergeBlock(&cfg, json.RawMessage(`{"debounce_seconds":0,"stop_words":null}`)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DebounceSeconds != 0 || cfg.StopWords != nil || len(cfg.Rules) != 1 {
+		t.Errorf("após zerar campos: %+v", cfg)
+	}
+
+	if err := mergeBlock(&cfg, json.RawMessage(`[1,2]`)); err == nil {
+		t.Error("bloco que não é objeto aceito")
+	}
+}
+
+func TestUpdateIntegrationsMergesBlocks(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db)
+	store := integrations.NewStore(db)
+	h := NewIntegrationsHandler(store, nil, audit.New(nil))
+
+	superAdmin := false
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("isSuperAdmin", superAdmin)
+		return c.Next()
+	})
+	app.Put("/:instance/integrations", h.Update)
+
+	put := func(body string) int {
+		t.Helper()
+		req := httptest.NewRequest("PUT", "/"+instance+"/integrations", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	rules := `{"triggers":{"stop_words":["atendente"],"rules":[{"bot":"dify","keywords":["pedido"]},{"bot":"none"}]}}`
+	if code := put(rules); code != 200 {
+		t.Fatalf("PUT triggers = %d", code)
+	}
+	before, _ := store.Get(context.Background(), instance)
+
+	if code := put(`{"triggers":{"rules":[{"bot":"openai"}]}}`); code != 200 {
+		t.Fatalf("PUT parcial = %d", code)
+	}
+	after, _ := store.Get(context.Background(), instance)
+	if !reflect.DeepEqual(after.Triggers.Rules, []models.TriggerRule{{Bot: "openai"}}) || !reflect.DeepEqual(after.Triggers.StopWords, []string{"atendente"}) {
+		t.Errorf("triggers após PUT parcial = %+v", after.Triggers)
+	}
+	if len(before.Triggers.Rules) != 2 || before.Triggers.Rules[0].Keywords[0] != "pedido" {
+		t.Errorf("configuração lida antes foi alterada: %+v", before.Triggers.Rules)
+	}
+
+	// Typebot na rede interna: só o super admin grava, e a liberação segue
+	// nas gravações seguintes enquanto a URL não muda
+	typebot := `{"typebot":{"enabled":true,"url":"http://127.0.0.1:8081","typebot_name":"menu"}}`
+	if code := put(typebot); code != 400 {
+		t.Errorf("Typebot interno gravado por key comum: status %d, want 400", code)
+	}
+	superAdmin = true
+	if code := put(typebot); code != 200 {
+		t.Fatalf("Typebot interno gravado pelo super admin: status %d", code)
+	}
+	superAdmin = false
+	if code := put(`{"typebot":{"expire_minutes":30}}`); code != 200 {
+		t.Errorf("alteração sem trocar a URL liberada: status %d", code)
+	}
+	if cfg, _ := store.Get(context.Background(), instance); !cfg.Typebot.AllowInternal || cfg.Typebot.ExpireMinutes != 30 {
+		t.Errorf("typebot = %+v", cfg.Typebot)
+	}
+	if code := put(`{"typebot":{"url":"http://127.0.0.1:9000"}}`); code != 400 {
+		t.Errorf("troca para outra URL interna por key comum: status %d, want 400", code)
+	}
+}
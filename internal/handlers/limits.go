@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/ratelimit"
+)
+
+// instanceLimitsTTL é quanto tempo os limites da instância ficam em cache.
+const instanceLimitsTTL = 30 * time.Second
+
+type instanceLimits struct {
+	RPS float64 `db:"rps"`
+	at  time.Time
+}
+
+// limitsCache guarda os limites lidos de instancias para não consultar o
+// banco a cada requisição.
+type limitsCache struct {
+	mu    sync.Mutex
+	items map[string]instanceLimits
+}
+
+// ============================================
+// LIMITE DE REQUISIÇÕES (token bucket)
+// ============================================
+
+// rateLimit aplica os limites de requisições por segundo da key e da
+// instância. Devolve false quando a resposta 429 já foi escrita.
+func (h *DatabaseHandler) rateLimit(c *fiber.Ctx, key *ApiKey) (bool, error) {
+	var results []ratelimit.Result
+	var blocked string
+
+	if key.LimiteRps != nil && *key.LimiteRps > 0 {
+		res := h.limiter.Take("key:"+strconv.Itoa(key.ID), *key.LimiteRps)
+		results = append(results, res)
+		if !res.Allowed {
+			blocked = "key"
+		}
+	}
+	// Só conta no bucket da instância quem pode operá-la
+	if instance := requestInstance(c); instance != "" && blocked == "" && HasInstanceAccess(c, instance) {
+		if limits := h.instanceLimits(c.UserContext(), instance); limits.RPS > 0 {
+			res := h.limiter.Take("instance:"+instance, limits.RPS)
+			results = append(results, res)
+			if !res.Allowed {
+				blocked = "instance"
+			}
+		}
+	}
+	if len(results) == 0 {
+		return true, nil
+	}
+
+	// Os cabeçalhos mostram o limite mais apertado
+	tightest := results[0]
+	for _, res := range results[1:] {
+		if !res.Allowed || res.Remaining < tightest.Remaining {
+			tightest = res
+		}
+	}
+	c.Set("X-RateLimit-Limit", strconv.Itoa(tightest.Limit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(tightest.Remaining))
+	c.Set("X-RateLimit-Reset", ceilSeconds(tightest.Reset))
+
+	if blocked != "" {
+		c.Set("Retry-After", ceilSeconds(tightest.RetryAfter))
+		return false, c.Status(429).JSON(fiber.Map{
+			"error": "Limite de requisições excedido",
+			"scope": blocked,
+		})
+	}
+	return true, nil
+}
+
+// ============================================
+// COTAS DE MENSAGENS
+// ============================================
+
+// As cotas diária e mensal da key e a diária da instância são contadas pela
+// fila de envio (queue.Enqueue), por onde passam os envios diretos, os
+// agendamentos e as campanhas. quotaExceeded escreve a resposta 429 quando
+// o envio foi recusado.
+func quotaExceeded(c *fiber.Ctx, exceeded *ratelimit.Exceeded) error {
+	c.Set("X-Quota-Limit", strconv.Itoa(exceeded.Limit))
+	c.Set("X-Quota-Remaining", "0")
+	c.Set("X-Quota-Reset", strconv.FormatInt(exceeded.Reset.Unix(), 10))
+	c.Set("Retry-After", ceilSeconds(time.Until(exceeded.Reset)))
+	return c.Status(429).JSON(fiber.Map{
+		"error": "Cota de mensagens esgotada",
+		"quota": exceeded.Scope,
+		"limit": exceeded.Limit,
+		"reset": exceeded.Reset,
+	})
+}
+
+// UpdateInstanceLimits define os limites da instância (0 remove o limite).
+func (h *DatabaseHandler) UpdateInstanceLimits(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	var body struct {
+		LimiteRps          *float64 `json:"limiteRps"`
+		LimiteMensagensDia *int     `json:"limiteMensagensDia"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+	if err := validateLimits(body.LimiteRps, body.LimiteMensagensDia, nil); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	before := h.instanceSnapshot(name)
+
+	res, err := h.db.Exec(`
+		UPDATE instancias SET limite_rps = $2, limite_mensagens_dia = $3, atualizado_em = NOW()
+		WHERE nome = $1
+	`, name, nullIfZeroFloat(body.LimiteRps), nullIfZero(body.LimiteMensagensDia))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao atualizar limites"})
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+
+	h.limits.mu.Lock()
+	delete(h.limits.items, name)
+	h.limits.mu.Unlock()
+
+	h.auditChange(c, "instance.limits", name, before, h.instanceSnapshot(name))
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// instanceLimits lê os limites da instância (com cache). Em caso de erro a
+// instância fica sem limites.
+func (h *DatabaseHandler) instanceLimits(ctx context.Context, name string) instanceLimits {
+	h.limits.mu.Lock()
+	cached, ok := h.limits.items[name]
+	h.limits.mu.Unlock()
+	if ok && time.Since(cached.at) < instanceLimitsTTL {
+		return cached
+	}
+
+	var limits instanceLimits
+	err := h.db.GetContext(ctx, &limits, `
+		SELECT COALESCE(limite_rps, 0) AS rps
+		FROM instancias WHERE nome = $1
+	`, name)
+	if err != nil {
+		limits = instanceLimits{}
+	}
+	limits.at = time.Now()
+
+	h.limits.mu.Lock()
+	if len(h.limits.items) > 10000 {
+		h.limits.items = make(map[string]instanceLimits)
+	}
+	h.limits.items[name] = limits
+	h.limits.mu.Unlock()
+	return limits
+}
+
+// requestInstance descobre a instância da requisição: parâmetro da rota,
+// caminho (/v1/instance/:instance/..., /v1/db/contacts/:instance...) ou o
+// campo "instance" do corpo.
+func requestInstance(c *fiber.Ctx) string {
+	if name := c.Params("instance"); name != "" {
+		return name
+	}
+
+	path := strings.TrimPrefix(c.Path(), "/v1/")
+	path = strings.TrimPrefix(path, "db/")
+	for _, prefix := range []string{"instance/", "contacts/", "groups/", "stats/"} {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			name, _, _ := strings.Cut(rest, "/")
+			if unescaped, err := url.PathUnescape(name); err == nil {
+				return unescaped
+			}
+			return name
+		}
+	}
+
+	if c.Method() == fiber.MethodGet {
+		return ""
+	}
+	contentType := string(c.Request().Header.ContentType())
+	if strings.HasPrefix(contentType, "multipart/form-data") || strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return c.FormValue("instance")
+	}
+	var body struct {
+		Instance string `json:"instance"`
+	}
+	json.Unmarshal(c.Body(), &body)
+	return body.Instance
+}
+
+func validateLimits(rps *float64, daily, monthly *int) error {
+	if rps != nil && *rps < 0 {
+		return errors.New("limiteRps não pode ser negativo")
+	}
+	if (daily != nil && *daily < 0) || (monthly != nil && *monthly < 0) {
+		return errors.New("limites de mensagens não podem ser negativos")
+	}
+	return nil
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func nullIfZero(v *int) interface{} {
+	if v == nil || *v == 0 {
+		return nil
+	}
+	return *v
+}
+
+func nullIfZeroFloat(v *float64) interface{} {
+	if v == nil || *v == 0 {
+		return nil
+	}
+	return *v
+}
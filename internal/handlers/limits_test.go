@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	rps := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name     string
+		limit    *float64
+		requests int
+		want     []int // status de cada requisição
+		headers  bool
+	}{
+		{name: "sem limite", limit: nil, requests: 3, want: []int{200, 200, 200}},
+		{name: "limite zero", limit: rps(0), requests: 3, want: []int{200, 200, 200}},
+		{name: "estoura a rajada", limit: rps(2), requests: 3, want: []int{200, 200, 429}, headers: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &DatabaseHandler{limiter: ratelimit.NewLimiter()}
+			key := &ApiKey{ID: 7, LimiteRps: tt.limit}
+
+			app := fiber.New()
+			app.Get("/v1/me", func(c *fiber.Ctx) error {
+				if ok, err := h.rateLimit(c, key); !ok {
+					return err
+				}
+				return c.SendStatus(200)
+			})
+
+			for i := 0; i < tt.requests; i++ {
+				resp, err := app.Test(httptest.NewRequest("GET", "/v1/me", nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != tt.want[i] {
+					t.Fatalf("requisição %d: status = %d, want %d", i+1, resp.StatusCode, tt.want[i])
+				}
+				if got := resp.Header.Get("X-RateLimit-Limit"); tt.headers && got != "2" {
+					t.Errorf("requisição %d: X-RateLimit-Limit = %q, want 2", i+1, got)
+				} else if !tt.headers && got != "" {
+					t.Errorf("requisição %d: X-RateLimit-Limit = %q sem limite configurado", i+1, got)
+				}
+				if resp.StatusCode == 429 && resp.Header.Get("Retry-After") != "1" {
+					t.Errorf("Retry-After = %q, want 1", resp.Header.Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+func TestRequestInstance(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{name: "rota de instância", method: "GET", path: "/v1/instance/loja1/info", want: "loja1"},
+		{name: "nome escapado", method: "GET", path: "/v1/instance/loja%201/info", want: "loja 1"},
+		{name: "contatos do banco", method: "GET", path: "/v1/db/contacts/loja2", want: "loja2"},
+		{name: "estatísticas", method: "GET", path: "/v1/stats/loja3", want: "loja3"},
+		{name: "GET sem instância", method: "GET", path: "/v1/me", want: ""},
+		{name: "corpo JSON", method: "POST", path: "/v1/message/text", contentType: "application/json", body: `{"instance":"loja4","number":"5511"}`, want: "loja4"},
+		{name: "formulário", method: "POST", path: "/v1/message/media", contentType: "application/x-www-form-urlencoded", body: "instance=loja5", want: "loja5"},
+		{name: "corpo inválido", method: "POST", path: "/v1/message/text", contentType: "application/json", body: `{`, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				got = requestInstance(c)
+				return c.SendStatus(200)
+			})
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("requestInstance() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCeilSeconds(t *testing.T) {
+	tests := []struct {
+		in   time.Duration
+		want string
+	}{
+		{in: 0, want: "0"},
+		{in: time.Millisecond, want: "1"},
+		{in: time.Second, want: "1"},
+		{in: 1500 * time.Millisecond, want: "2"},
+	}
+	for _, tt := range tests {
+		if got := ceilSeconds(tt.in); got != tt.want {
+			t.Errorf("ceilSeconds(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
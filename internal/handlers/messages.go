@@ -1,53 +1,277 @@
-package handlers
-
-import (
-	"github.com/gofiber/fiber/v2"
-	"github.com/nexus/gowhats/internal/models"
-	"github.com/nexus/gowhats/internal/whatsapp"
-)
-
-type MessageHandler struct {
-	Service *whatsapp.Service
-}
-
-func NewMessageHandler(s *whatsapp.Service) *MessageHandler {
-	return &MessageHandler{Service: s}
-}
-
-func (h *MessageHandler) SendText(c *fiber.Ctx) error {
-	instanceKey := c.Params("instance")
-	var req models.SendMessageRequest
-	
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-	req.Type = "text"
-
-	msgID, err := h.Service.SendMessage(instanceKey, req)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	return c.JSON(fiber.Map{"status": "success", "messageId": msgID})
-}
-
-func (h *MessageHandler) SendInteractive(c *fiber.Ctx) error {
-	instanceKey := c.Params("instance")
-	var req models.SendMessageRequest
-	
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
-	}
-	req.Type = "interactive"
-
-	if req.Interactive == nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Interactive payload required"})
-	}
-
-	msgID, err := h.Service.SendMessage(instanceKey, req)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-	}
-
-	return c.JSON(fiber.Map{"status": "success", "messageId": msgID})
-}
\ No newline at end of file
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+	"github.com/nexus/gowhats/internal/ratelimit"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+// MessageHandler não envia direto: grava na fila de envio e devolve o id do
+// job, que é acompanhado em GET /v1/message/status/:id.
+type MessageHandler struct {
+	Service *whatsapp.Service
+	Queue   *queue.Queue
+	History *history.Store
+}
+
+func NewMessageHandler(s *whatsapp.Service, q *queue.Queue, h *history.Store) *MessageHandler {
+	return &MessageHandler{Service: s, Queue: q, History: h}
+}
+
+func (h *MessageHandler) SendText(c *fiber.Ctx) error {
+	instanceKey := c.Params("instance")
+	var req models.SendMessageRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+	req.Type = "text"
+
+	if req.Number == "" || req.Text == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "number and text required"})
+	}
+
+	return h.enqueue(c, instanceKey, req)
+}
+
+func (h *MessageHandler) SendInteractive(c *fiber.Ctx) error {
+	instanceKey := c.Params("instance")
+	var req models.SendMessageRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+	req.Type = "interactive"
+
+	if req.Interactive == nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Interactive payload required"})
+	}
+
+	return h.enqueue(c, instanceKey, req)
+}
+
+// legacyRequest é o corpo das rotas antigas /v1/message/*, com a instância
+// no corpo e não na URL.
+type legacyRequest struct {
+	Instance string `json:"instance"`
+	models.SendMessageRequest
+}
+
+// SendLegacy atende as rotas antigas /v1/message/{text,buttons,list,...}:
+// também passam pela fila e devolvem o id do job. Botões, listas e botões de
+// URL/copiar guardam o corpo original, repassado ao sidecar no envio.
+func (h *MessageHandler) SendLegacy(kind string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req legacyRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+		}
+		if req.Instance == "" || req.Number == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "instance and number required"})
+		}
+		if !HasInstanceAccess(c, req.Instance) {
+			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
+		}
+
+		req.Type = kind
+		switch kind {
+		case "text":
+			if req.Text == "" {
+				return c.Status(400).JSON(fiber.Map{"error": "number and text required"})
+			}
+		case "interactive":
+			// Compatibilidade: aceita o payload interativo na raiz do corpo
+			if req.Interactive == nil {
+				req.Interactive = &models.InteractivePayload{}
+				if err := json.Unmarshal(c.Body(), req.Interactive); err != nil {
+					return c.Status(400).JSON(fiber.Map{"error": "Payload interativo inválido"})
+				}
+			}
+		default:
+			req.Payload = append(json.RawMessage(nil), c.Body()...)
+		}
+
+		return h.enqueue(c, req.Instance, req.SendMessageRequest)
+	}
+}
+
+// jobStatus é o job da fila acrescido da situação de entrega da mensagem,
+// quando ela já foi enviada.
+type jobStatus struct {
+	*queue.Job
+	Delivery *history.Delivery `json:"delivery,omitempty"`
+}
+
+// Status aceita o id do job da fila ou o id da mensagem no WhatsApp e devolve
+// o status atual com a linha do tempo de acks (server_ack, delivered, read,
+// played). Só responde para keys com acesso à instância da mensagem.
+func (h *MessageHandler) Status(c *fiber.Ctx) error {
+	id := c.Params("id")
+	ctx := c.UserContext()
+
+	job, err := h.Queue.Get(ctx, id)
+	if err != nil && !errors.Is(err, queue.ErrNotFound) {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if job != nil {
+		if !HasInstanceAccess(c, job.Instance) {
+			return c.Status(404).JSON(fiber.Map{"error": "Mensagem não encontrada"})
+		}
+
+		resp := jobStatus{Job: job}
+		if job.MessageID != nil {
+			delivery, err := h.History.Delivery(ctx, job.Instance, *job.MessageID)
+			if err != nil && !errors.Is(err, history.ErrMessageNotFound) {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+			resp.Delivery = delivery
+		}
+		return c.JSON(resp)
+	}
+
+	instance, err := h.History.InstanceOf(ctx, id)
+	if errors.Is(err, history.ErrMessageNotFound) || (err == nil && !HasInstanceAccess(c, instance)) {
+		return c.Status(404).JSON(fiber.Map{"error": "Mensagem não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	delivery, err := h.History.Delivery(ctx, instance, id)
+	if errors.Is(err, history.ErrMessageNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Mensagem não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(delivery)
+}
+
+// enqueue valida o conteúdo com as regras do envio e grava o job na fila.
+func (h *MessageHandler) enqueue(c *fiber.Ctx, instanceKey string, req models.SendMessageRequest) error {
+	var keyID *int
+	if apiKey, ok := c.Locals("apiKey").(*ApiKey); ok && apiKey != nil {
+		keyID = &apiKey.ID
+	}
+
+	if err := whatsapp.ValidateMessage(&req, c.App().Config().BodyLimit); err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	job, err := h.Queue.Enqueue(c.UserContext(), instanceKey, req, keyID)
+	var exceeded *ratelimit.Exceeded
+	if errors.As(err, &exceeded) {
+		return quotaExceeded(c, exceeded)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"status":      job.Status,
+		"jobId":       job.ID,
+		"scheduledAt": job.AgendadoPara,
+	})
+}
+
+// mediaRequest aceita o payload de mídia achatado no corpo, no mesmo formato
+// das demais rotas /v1/message/*.
+type mediaRequest struct {
+	Instance string `json:"instance"`
+	Number   string `json:"number"`
+	models.MediaPayload
+	Options *models.MessageOptions `json:"options,omitempty"`
+}
+
+// SendMedia envia imagem, vídeo, áudio, documento ou figurinha. Aceita JSON
+// (url ou base64) ou multipart/form-data com o arquivo no campo "file".
+func (h *MessageHandler) SendMedia(c *fiber.Ctx) error {
+	maxSize := c.App().Config().BodyLimit
+
+	var req mediaRequest
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		if err := parseMediaForm(c, &req, maxSize); err != nil {
+			if errors.Is(err, whatsapp.ErrMediaTooLarge) {
+				return c.Status(413).JSON(fiber.Map{"error": err.Error()})
+			}
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	} else if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	instanceKey := c.Params("instance")
+	if instanceKey == "" {
+		instanceKey = req.Instance
+	}
+	if instanceKey == "" || req.Number == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "instance and number required"})
+	}
+	if !HasInstanceAccess(c, instanceKey) {
+		return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
+	}
+
+	// A mídia é normalizada e validada em enqueue
+	return h.enqueue(c, instanceKey, models.SendMessageRequest{
+		Number:  req.Number,
+		Type:    "media",
+		Media:   &req.MediaPayload,
+		Options: req.Options,
+	})
+}
+
+func parseMediaForm(c *fiber.Ctx, req *mediaRequest, maxSize int) error {
+	req.Instance = c.FormValue("instance")
+	req.Number = c.FormValue("number")
+	req.Type = c.FormValue("type")
+	req.URL = c.FormValue("url")
+	req.Base64 = c.FormValue("base64")
+	req.MimeType = c.FormValue("mimetype")
+	req.Caption = c.FormValue("caption")
+	req.FileName = c.FormValue("filename")
+	req.PTT, _ = strconv.ParseBool(c.FormValue("ptt"))
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		// Sem arquivo: url/base64 vieram como campos do formulário
+		return nil
+	}
+	if maxSize > 0 && fh.Size > int64(maxSize) {
+		return whatsapp.ErrMediaTooLarge
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	req.Base64 = base64.StdEncoding.EncodeToString(data)
+	if req.MimeType == "" {
+		req.MimeType = fh.Header.Get("Content-Type")
+		if req.MimeType == "" || req.MimeType == "application/octet-stream" {
+			req.MimeType = http.DetectContentType(data)
+		}
+	}
+	if req.FileName == "" {
+		req.FileName = fh.Filename
+	}
+	return nil
+}
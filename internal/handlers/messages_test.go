@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Os casos abaixo param antes da fila, então o handler não precisa de Queue.
+func TestSendLegacyRejectsBadBodies(t *testing.T) {
+	h := &MessageHandler{}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("isSuperAdmin", true)
+		return c.Next()
+	})
+	app.Post("/v1/message/text", h.SendLegacy("text"))
+	app.Post("/v1/message/interactive", h.SendLegacy("interactive"))
+	app.Post("/v1/message/buttons", h.SendLegacy("buttons"))
+	app.Post("/v1/message/copy-button", h.SendLegacy("copy-button"))
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "JSON quebrado", path: "/v1/message/text", body: `{"instance":`},
+		{name: "sem número", path: "/v1/message/text", body: `{"instance":"loja1","text":"oi"}`},
+		{name: "texto vazio", path: "/v1/message/text", body: `{"instance":"loja1","number":"5511987654321"}`},
+		{name: "interativo malformado na raiz", path: "/v1/message/interactive", body: `{"instance":"loja1","number":"5511987654321","body":"oi"}`},
+		{name: "botões sem botões", path: "/v1/message/buttons", body: `{"instance":"loja1","number":"5511987654321","message":"oi"}`},
+		{name: "botão de copiar sem código", path: "/v1/message/copy-button", body: `{"instance":"loja1","number":"5511987654321","message":"oi"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 400 {
+				t.Errorf("status = %d, want 400", resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/scheduler"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+type ScheduleHandler struct {
+	Scheduler *scheduler.Scheduler
+}
+
+func NewScheduleHandler(s *scheduler.Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{Scheduler: s}
+}
+
+func (h *ScheduleHandler) Create(c *fiber.Ctx) error {
+	var req models.ScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	var keyID *int
+	if apiKey, ok := c.Locals("apiKey").(*ApiKey); ok && apiKey != nil {
+		keyID = &apiKey.ID
+	}
+
+	item, err := h.Scheduler.Create(c.UserContext(), c.Params("instance"), req, keyID)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(item)
+}
+
+// List aceita ?status=active|paused|cancelled|done.
+func (h *ScheduleHandler) List(c *fiber.Ctx) error {
+	items, err := h.Scheduler.List(c.UserContext(), c.Params("instance"), c.Query("status"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(items)
+}
+
+func (h *ScheduleHandler) Get(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Scheduler.Get(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+func (h *ScheduleHandler) Pause(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Scheduler.Pause(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+func (h *ScheduleHandler) Resume(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Scheduler.Resume(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+func (h *ScheduleHandler) Cancel(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	item, err := h.Scheduler.Cancel(c.UserContext(), c.Params("instance"), id)
+	return h.respond(c, item, err)
+}
+
+func (h *ScheduleHandler) Executions(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "id inválido"})
+	}
+
+	items, err := h.Scheduler.Executions(c.UserContext(), c.Params("instance"), id, c.QueryInt("limit", 100))
+	if errors.Is(err, scheduler.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(items)
+}
+
+func (h *ScheduleHandler) respond(c *fiber.Ctx, item *scheduler.Schedule, err error) error {
+	if errors.Is(err, scheduler.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(item)
+}
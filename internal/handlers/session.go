@@ -1,78 +1,170 @@
-package handlers
-
-import (
-	"encoding/base64"
-	"fmt"
-	"time"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/nexus/gowhats/internal/whatsapp"
-	"github.com/skip2/go-qrcode"
-)
-
-type SessionHandler struct {
-	Service *whatsapp.Service
-}
-
-func NewSessionHandler(s *whatsapp.Service) *SessionHandler {
-	return &SessionHandler{Service: s}
-}
-
-func (h *SessionHandler) Connect(c *fiber.Ctx) error {
-	instanceKey := c.Params("instance")
-	
-	// Solicita conexão ao Node
-	qrChan, err := h.Service.Client.Connect(instanceKey)
-	
-	if err != nil {
-		if err.Error() == "already_connected" {
-			return c.JSON(fiber.Map{"status": "success", "message": "Already connected", "qrcode": ""})
-		}
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": err.Error()})
-	}
-
-	select {
-	case code, ok := <-qrChan:
-		if !ok || code == "" {
-			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to get QR Code from Node"})
-		}
-		
-		fmt.Printf("\n>>> QR CODE (%s) GERADO <<<\n", instanceKey)
-
-		png, err := qrcode.Encode(code, qrcode.Low, 512)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to generate QR Image"})
-		}
-
-		qrBase64 := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
-		
-		return c.JSON(fiber.Map{
-			"status":   "success",
-			"instance": instanceKey,
-			"qrcode":   qrBase64,
-		})
-
-	// AUMENTADO PARA 45 SEGUNDOS (para aguentar os retries do Node)
-	case <-time.After(45 * time.Second):
-		return c.Status(408).JSON(fiber.Map{"status": "error", "message": "Timeout waiting for QR"})
-	}
-}
-
-func (h *SessionHandler) Logout(c *fiber.Ctx) error {
-	instance := c.Params("instance")
-
-	_, err := h.Service.Client.Logout(map[string]interface{}{
-		"instance": instance,
-	})
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"status":  "error",
-			"message": err.Error(),
-		})
-	}
-
-	return c.JSON(fiber.Map{
-		"status":  "success",
-		"message": "Logout realizado",
-	})
-}
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/nexus/gowhats/internal/whatsapp"
+	"github.com/skip2/go-qrcode"
+)
+
+// AUMENTADO PARA 45 SEGUNDOS (para aguentar os retries do Node)
+const connectTimeout = 45 * time.Second
+
+type SessionHandler struct {
+	Service *whatsapp.Service
+}
+
+func NewSessionHandler(s *whatsapp.Service) *SessionHandler {
+	return &SessionHandler{Service: s}
+}
+
+// Connect inicia a sessão e espera o QR Code do sidecar (até 45s), como
+// sempre fez. Com ?wait=false não espera: dispara o início da sessão pelo
+// supervisor e responde 202 com o estado atual e o QR Code vigente, se já
+// houver um; os QRs seguintes chegam pelo stream /events (qr.updated).
+func (h *SessionHandler) Connect(c *fiber.Ctx) error {
+	instanceKey := c.Params("instance")
+	if h.Service.Connections == nil {
+		return c.Status(503).JSON(fiber.Map{"status": "error", "message": "Supervisor de conexões indisponível"})
+	}
+
+	st := h.Service.Connections.State(instanceKey)
+	if st.State == whatsapp.StateConnected {
+		return c.JSON(fiber.Map{"status": "success", "message": "Already connected", "state": st.State, "qrcode": ""})
+	}
+
+	if c.Query("wait") != "false" {
+		return h.connectAndWait(c, instanceKey)
+	}
+
+	h.Service.Connections.Connect(c.UserContext(), instanceKey)
+
+	qrImage := ""
+	if h.Service.Events != nil {
+		if evt, ok := h.Service.Events.Hub().Last(instanceKey, eventbus.TypeQRUpdated); ok {
+			if qr, ok := withQRImage(evt).Data.(eventbus.QRUpdated); ok {
+				qrImage = qr.Image
+			}
+		}
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"status":   "success",
+		"instance": instanceKey,
+		"state":    st.State,
+		"qrcode":   qrImage,
+	})
+}
+
+// connectAndWait é o modo bloqueante de Connect: devolve o QR em PNG.
+func (h *SessionHandler) connectAndWait(c *fiber.Ctx, instanceKey string) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), connectTimeout)
+	defer cancel()
+
+	result, err := h.Service.Connections.StartSession(ctx, instanceKey)
+	// O erro do sidecar não embrulha o do contexto
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return c.Status(408).JSON(fiber.Map{"status": "error", "message": "Timeout waiting for QR"})
+	}
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"status": "error", "message": err.Error()})
+	}
+
+	if result.Status == "CONNECTED" {
+		return c.JSON(fiber.Map{"status": "success", "message": "Already connected", "qrcode": ""})
+	}
+	if result.Status != "QRCODE" || result.QRCode == "" {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to get QR Code from Node"})
+	}
+
+	png, err := qrcode.Encode(result.QRCode, qrcode.Low, 512)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "Failed to generate QR Image"})
+	}
+
+	return c.JSON(fiber.Map{
+		"status":   "success",
+		"instance": instanceKey,
+		"qrcode":   "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+func (h *SessionHandler) Logout(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+
+	_, err := h.Service.Client.Logout(c.UserContext(), whatsapp.SessionRequest{Instance: instance})
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
+	if h.Service.Connections != nil {
+		h.Service.Connections.LoggedOut(instance, "logout via API")
+	}
+
+	return c.JSON(fiber.Map{
+		"status":  "success",
+		"message": "Logout realizado",
+	})
+}
+
+// Pair gera o código de pareamento para login sem QR Code. O número vai em
+// E.164 (com ou sem +, espaços e traços) e o código vale por alguns minutos;
+// o andamento é consultado em GET /pair.
+func (h *SessionHandler) Pair(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+
+	var body struct {
+		Number      string `json:"number"`
+		PhoneNumber string `json:"phoneNumber"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+	if body.Number == "" {
+		body.Number = body.PhoneNumber
+	}
+
+	pairing, err := h.Service.PairPhone(c.UserContext(), instance, body.Number)
+	if err != nil {
+		return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"status":        "success",
+		"instance":      instance,
+		"phone":         pairing.Phone,
+		"code":          pairing.Code,
+		"formattedCode": pairing.FormattedCode(),
+		"pairing":       pairing.Status,
+		"expiresAt":     pairing.ExpiresAt,
+	})
+}
+
+// PairStatus devolve o andamento do último pareamento por código
+// (code_issued, linked ou failed).
+func (h *SessionHandler) PairStatus(c *fiber.Ctx) error {
+	if h.Service.Connections == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "Supervisor de conexões indisponível"})
+	}
+	pairing, ok := h.Service.Connections.PairingStatus(c.Params("instance"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Nenhum pareamento solicitado"})
+	}
+	return c.JSON(pairing)
+}
+
+// State devolve o estado da conexão mantido pelo supervisor, sem consultar o
+// sidecar.
+func (h *SessionHandler) State(c *fiber.Ctx) error {
+	if h.Service.Connections == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "Supervisor de conexões indisponível"})
+	}
+	return c.JSON(h.Service.Connections.State(c.Params("instance")))
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+func TestConnectWaitsForQRUnlessAsked(t *testing.T) {
+	// loja3 tem sessão salva e loja4 não gera QR a tempo
+	statuses := map[string]string{"loja3": "CONNECTED", "loja4": "TIMEOUT"}
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req whatsapp.SessionRequest
+		if r.URL.Path != "/session/start" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp := whatsapp.StartSessionResponse{Status: "QRCODE", QRCode: "2@abc,def,ghi"}
+		if s, ok := statuses[req.Instance]; ok {
+			resp = whatsapp.StartSessionResponse{Status: s}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer sidecar.Close()
+
+	sup := whatsapp.NewSupervisor(nil, whatsapp.NewBaileysClient(sidecar.URL, "", nil))
+	h := NewSessionHandler(&whatsapp.Service{Connections: sup})
+	app := fiber.New()
+	app.Get("/v1/instance/:instance/connect", h.Connect)
+
+	get := func(path string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	// Padrão: espera o QR e devolve o PNG, como antes
+	code, body := get("/v1/instance/loja1/connect")
+	if code != 200 || !strings.HasPrefix(body["qrcode"].(string), "data:image/png;base64,") {
+		t.Fatalf("connect = %d %v, want 200 com o QR em PNG", code, body)
+	}
+	if st := sup.State("loja1").State; st != whatsapp.StateQRPending {
+		t.Errorf("estado após o QR = %s, want qr_pending", st)
+	}
+
+	// Opt-in: responde na hora com o estado, sem esperar o sidecar
+	code, body = get("/v1/instance/loja2/connect?wait=false")
+	if code != 202 || body["state"] != string(whatsapp.StateCreated) {
+		t.Errorf("connect?wait=false = %d %v, want 202 com o estado", code, body)
+	}
+
+	// Sessão salva no sidecar conecta sem QR
+	code, body = get("/v1/instance/loja3/connect")
+	if code != 200 || body["message"] != "Already connected" || body["qrcode"] != "" {
+		t.Errorf("connect de sessão salva = %d %v", code, body)
+	}
+	if st := sup.State("loja3").State; st != whatsapp.StateConnected {
+		t.Errorf("estado após CONNECTED = %s, want connected", st)
+	}
+
+	if code, _ := get("/v1/instance/loja4/connect"); code != 500 {
+		t.Errorf("sidecar sem QR: status %d, want 500", code)
+	}
+}
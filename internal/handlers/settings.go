@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/settings"
+)
+
+type SettingsHandler struct {
+	Store *settings.Store
+	Audit *audit.Log
+}
+
+func NewSettingsHandler(s *settings.Store, l *audit.Log) *SettingsHandler {
+	return &SettingsHandler{Store: s, Audit: l}
+}
+
+func (h *SettingsHandler) Get(c *fiber.Ctx) error {
+	current, configured, err := h.Store.Get(c.UserContext(), c.Params("instance"))
+	if errors.Is(err, settings.ErrInstanceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"settings": current, "configured": configured})
+}
+
+// Update aceita as configurações completas ou só os campos a alterar. Se o
+// sidecar não puder aplicá-las agora (instância offline), elas ficam salvas e
+// são aplicadas na próxima conexão.
+func (h *SettingsHandler) Update(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+	ctx := c.UserContext()
+
+	current, _, err := h.Store.Get(ctx, instance)
+	if errors.Is(err, settings.ErrInstanceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	before := current
+	if err := c.BodyParser(&current); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid JSON"})
+	}
+
+	if err := h.Store.Save(ctx, instance, current); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	recordChange(h.Audit, c, "settings.update", instance, before, current)
+
+	resp := fiber.Map{"status": "success", "settings": current, "applied": true}
+	if err := h.Store.Push(ctx, instance); err != nil {
+		resp["applied"] = false
+		resp["warning"] = "salvo; será aplicado na próxima conexão: " + err.Error()
+	}
+
+	return c.JSON(resp)
+}
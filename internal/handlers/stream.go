@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	streamBuffer    = 256
+	streamKeepAlive = 25 * time.Second
+	streamWriteWait = 10 * time.Second
+)
+
+// StreamHandler serve GET /v1/instance/:instance/events em WebSocket (com
+// Upgrade) ou Server-Sent Events. A autenticação e o filtro de instâncias
+// permitidas vêm dos middlewares do grupo /instance/:instance.
+type StreamHandler struct {
+	Bus *eventbus.Bus
+}
+
+func NewStreamHandler(b *eventbus.Bus) *StreamHandler {
+	return &StreamHandler{Bus: b}
+}
+
+func (h *StreamHandler) Stream(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+
+	cfg, err := h.Bus.Config(c.UserContext(), instance)
+	if errors.Is(err, eventbus.ErrInstanceNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar configuração de eventos"})
+	}
+	if !cfg.WebSocket {
+		return c.Status(409).JSON(fiber.Map{"error": "Stream desabilitado para esta instância (websocket_enabled)"})
+	}
+
+	// ?events=qr.updated,connection.state limita os tipos (vazio = todos)
+	var types []string
+	if raw := c.Query("events"); raw != "" {
+		types = strings.Split(raw, ",")
+	}
+
+	if websocket.IsWebSocketUpgrade(c) {
+		return websocket.New(func(conn *websocket.Conn) {
+			h.serveWebSocket(conn, instance, types)
+		})(c)
+	}
+	return h.serveSSE(c, instance, types)
+}
+
+func (h *StreamHandler) serveWebSocket(conn *websocket.Conn, instance string, types []string) {
+	sub := h.Bus.Hub().Subscribe(instance, streamBuffer)
+	defer sub.Close()
+
+	// Só lê para perceber o fechamento; mensagens do cliente são ignoradas
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamKeepAlive)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case evt, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if !wantsType(types, evt.Type) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteJSON(withQRImage(evt)); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (h *StreamHandler) serveSSE(c *fiber.Ctx, instance string, types []string) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	sub := h.Bus.Hub().Subscribe(instance, streamBuffer)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if w.Flush() != nil {
+			return
+		}
+
+		for {
+			select {
+			case evt, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if !wantsType(types, evt.Type) {
+					continue
+				}
+				data, err := json.Marshal(withQRImage(evt))
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// Flush falha quando o cliente desconecta
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// withQRImage acrescenta o PNG do QR para o cliente exibir direto.
+func withQRImage(evt eventbus.Event) eventbus.Event {
+	qr, ok := evt.Data.(eventbus.QRUpdated)
+	if !ok || qr.Image != "" {
+		return evt
+	}
+	if png, err := qrcode.Encode(qr.QR, qrcode.Low, 512); err == nil {
+		qr.Image = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		evt.Data = qr
+	}
+	return evt
+}
+
+func wantsType(types []string, kind string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if strings.TrimSpace(t) == kind {
+			return true
+		}
+	}
+	return false
+}
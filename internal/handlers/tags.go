@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nexus/gowhats/internal/audit"
+)
+
+// TagsHandler mantém as tags dos contatos (contatos.tags), usadas nas
+// regras do motor de gatilhos.
+type TagsHandler struct {
+	DB    *sqlx.DB
+	Audit *audit.Log
+}
+
+func NewTagsHandler(db *sqlx.DB, l *audit.Log) *TagsHandler {
+	return &TagsHandler{DB: db, Audit: l}
+}
+
+func (h *TagsHandler) Get(c *fiber.Ctx) error {
+	var tags pq.StringArray
+	err := h.DB.GetContext(c.UserContext(), &tags, `
+		SELECT tags FROM contatos WHERE instance = $1 AND jid = $2
+	`, c.Params("instance"), jidParam(c))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar tags"})
+	}
+	if tags == nil {
+		tags = pq.StringArray{}
+	}
+	return c.JSON(fiber.Map{"jid": jidParam(c), "tags": tags})
+}
+
+// Update substitui as tags do contato: {"tags": ["vip", "suporte"]}.
+func (h *TagsHandler) Update(c *fiber.Ctx) error {
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+
+	tags := pq.StringArray{}
+	seen := map[string]bool{}
+	for _, t := range body.Tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+
+	instance, jid := c.Params("instance"), jidParam(c)
+	var before pq.StringArray
+	err := h.DB.GetContext(c.UserContext(), &before, `
+		SELECT tags FROM contatos WHERE instance = $1 AND jid = $2
+	`, instance, jid)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar tags"})
+	}
+
+	_, err = h.DB.ExecContext(c.UserContext(), `
+		INSERT INTO contatos (instance, jid, tags) VALUES ($1, $2, $3)
+		ON CONFLICT (instance, jid) DO UPDATE SET tags = EXCLUDED.tags
+	`, instance, jid, tags)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar tags"})
+	}
+	recordChange(h.Audit, c, "contact.tags", instance,
+		fiber.Map{"jid": jid, "tags": before}, fiber.Map{"jid": jid, "tags": tags})
+	return c.JSON(fiber.Map{"status": "success", "jid": jidParam(c), "tags": tags})
+}
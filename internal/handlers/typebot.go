@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nexus/gowhats/internal/jid"
+	"github.com/nexus/gowhats/internal/typebot"
+)
+
+// TypebotHandler controla as sessões do Typebot por contato: listar, pausar
+// (atendimento humano), retomar e encerrar.
+type TypebotHandler struct {
+	Sessions *typebot.Sessions
+}
+
+func NewTypebotHandler(s *typebot.Sessions) *TypebotHandler {
+	return &TypebotHandler{Sessions: s}
+}
+
+// List aceita ?status=active|paused.
+func (h *TypebotHandler) List(c *fiber.Ctx) error {
+	status := c.Query("status")
+	if status != "" && status != typebot.StatusActive && status != typebot.StatusPaused {
+		return c.Status(400).JSON(fiber.Map{"error": "status inválido (active ou paused)"})
+	}
+
+	sessions, err := h.Sessions.List(c.UserContext(), c.Params("instance"), status)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao listar sessões"})
+	}
+	return c.JSON(fiber.Map{"sessions": sessions})
+}
+
+func (h *TypebotHandler) Pause(c *fiber.Ctx) error {
+	sess, err := h.Sessions.Pause(c.UserContext(), c.Params("instance"), jidParam(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao pausar sessão"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "session": sess})
+}
+
+func (h *TypebotHandler) Resume(c *fiber.Ctx) error {
+	sess, err := h.Sessions.Resume(c.UserContext(), c.Params("instance"), jidParam(c))
+	if errors.Is(err, typebot.ErrSessionNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Contato não está pausado"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao retomar sessão"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "session": sess})
+}
+
+// End encerra a sessão; a próxima mensagem do contato passa pelos gatilhos.
+func (h *TypebotHandler) End(c *fiber.Ctx) error {
+	if err := h.Sessions.Delete(c.UserContext(), c.Params("instance"), jidParam(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao encerrar sessão"})
+	}
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// jidParam aceita o número (com ou sem +, espaços e traços) ou o JID
+// completo em :jid.
+func jidParam(c *fiber.Ctx) string {
+	raw := c.Params("jid")
+	if unescaped, err := url.PathUnescape(raw); err == nil {
+		raw = unescaped
+	}
+	if j, err := jid.Parse(raw, ""); err == nil {
+		return j.String()
+	}
+	if !strings.Contains(raw, "@") {
+		raw += "@" + jid.ServerUser
+	}
+	return raw
+}
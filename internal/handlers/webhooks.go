@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+type WebhookHandler struct {
+	DB         *sqlx.DB
+	Dispatcher *webhook.Dispatcher
+	Audit      *audit.Log
+}
+
+func NewWebhookHandler(db *sqlx.DB, d *webhook.Dispatcher, l *audit.Log) *WebhookHandler {
+	return &WebhookHandler{DB: db, Dispatcher: d, Audit: l}
+}
+
+func (h *WebhookHandler) GetConfig(c *fiber.Ctx) error {
+	cfg, err := webhook.GetConfig(h.DB, c.Params("instance"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar webhook"})
+	}
+
+	// O segredo nunca é devolvido, apenas se está configurado
+	hasSecret := cfg.Secret != ""
+	cfg.Secret = ""
+	return c.JSON(fiber.Map{"webhook": cfg, "hasSecret": hasSecret})
+}
+
+func (h *WebhookHandler) UpdateConfig(c *fiber.Ctx) error {
+	instance := c.Params("instance")
+
+	var body models.WebhookConfig
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+	}
+
+	// Só o super admin aponta webhooks para a rede interna
+	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
+	body.AllowInternal = isSuperAdmin
+	if body.URL != "" {
+		if err := webhook.ValidateURL(c.UserContext(), body.URL, isSuperAdmin); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	} else if body.Enabled {
+		return c.Status(400).JSON(fiber.Map{"error": "URL obrigatória para habilitar o webhook"})
+	}
+
+	// Sem segredo no corpo: mantém o atual
+	var before interface{}
+	if current, err := webhook.GetConfig(h.DB, instance); err == nil {
+		if body.Secret == "" {
+			body.Secret = current.Secret
+		}
+		before = webhookSnapshot(*current)
+	}
+
+	err := webhook.SaveConfig(h.DB, instance, body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{"error": "Instância não encontrada"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao salvar webhook"})
+	}
+	h.Dispatcher.Invalidate(instance)
+	recordChange(h.Audit, c, "webhook.update", instance, before, webhookSnapshot(body))
+
+	return c.JSON(fiber.Map{"status": "success"})
+}
+
+// webhookSnapshot é a configuração registrada na auditoria, sem o segredo.
+func webhookSnapshot(cfg models.WebhookConfig) fiber.Map {
+	hasSecret := cfg.Secret != ""
+	cfg.Secret = ""
+	return fiber.Map{"webhook": cfg, "hasSecret": hasSecret}
+}
+
+func (h *WebhookHandler) ListDeadLetters(c *fiber.Ctx) error {
+	items, err := h.Dispatcher.DeadLetters(c.Params("instance"), c.QueryInt("limit", 100))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao buscar entregas"})
+	}
+	return c.JSON(items)
+}
+
+// Replay reenvia as dead letters informadas em {"ids": [...]} ou todas da
+// instância quando a lista vem vazia. Fora de /instance/:instance (rotas do
+// super admin), trata as de eventos sem instância.
+func (h *WebhookHandler) Replay(c *fiber.Ctx) error {
+	var body struct {
+		IDs []int `json:"ids"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+		}
+	}
+	if id, err := c.ParamsInt("id"); err == nil && id > 0 {
+		body.IDs = []int{id}
+	}
+
+	n, err := h.Dispatcher.Replay(c.Params("instance"), body.IDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Erro ao reprocessar entregas"})
+	}
+	return c.JSON(fiber.Map{"status": "success", "requeued": n})
+}
@@ -0,0 +1,106 @@
+package handoff
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrNotFound = errors.New("chat não está com atendimento humano")
+
+// Takeover marca um chat assumido por um atendente: enquanto valer, os bots
+// da instância não respondem o contato.
+type Takeover struct {
+	Instance string     `db:"instance" json:"instance"`
+	Jid      string     `db:"jid" json:"jid"`
+	Motivo   string     `db:"motivo" json:"reason,omitempty"`
+	CriadoEm time.Time  `db:"criado_em" json:"createdAt"`
+	ExpiraEm *time.Time `db:"expira_em" json:"expiresAt"` // nil = até ser liberado
+}
+
+// Store guarda os chats em atendimento humano (atendimento_humano).
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+// Active indica se o chat está com um atendente agora.
+func (s *Store) Active(ctx context.Context, instance, jid string) (bool, error) {
+	var active bool
+	err := s.db.GetContext(ctx, &active, `
+		SELECT EXISTS (
+			SELECT 1 FROM atendimento_humano
+			WHERE instance = $1 AND jid = $2 AND (expira_em IS NULL OR expira_em > NOW())
+		)
+	`, instance, jid)
+	return active, err
+}
+
+// Get devolve o atendimento vigente do chat ou ErrNotFound.
+func (s *Store) Get(ctx context.Context, instance, jid string) (*Takeover, error) {
+	var t Takeover
+	err := s.db.GetContext(ctx, &t, `
+		SELECT instance, jid, COALESCE(motivo, '') AS motivo, criado_em, expira_em
+		FROM atendimento_humano
+		WHERE instance = $1 AND jid = $2 AND (expira_em IS NULL OR expira_em > NOW())
+	`, instance, jid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Start assume o chat. ttl zero mantém até Release.
+func (s *Store) Start(ctx context.Context, instance, jid, reason string, ttl time.Duration) (*Takeover, error) {
+	var expires *time.Time
+	if ttl > 0 {
+		t := time.Now().Add(ttl)
+		expires = &t
+	}
+
+	var t Takeover
+	err := s.db.GetContext(ctx, &t, `
+		INSERT INTO atendimento_humano (instance, jid, motivo, expira_em)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		ON CONFLICT (instance, jid) DO UPDATE
+		SET motivo = EXCLUDED.motivo, criado_em = NOW(), expira_em = EXCLUDED.expira_em
+		RETURNING instance, jid, COALESCE(motivo, '') AS motivo, criado_em, expira_em
+	`, instance, jid, reason, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Release devolve o chat aos bots.
+func (s *Store) Release(ctx context.Context, instance, jid string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM atendimento_humano WHERE instance = $1 AND jid = $2`, instance, jid)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List devolve os chats em atendimento humano vigentes.
+func (s *Store) List(ctx context.Context, instance string) ([]Takeover, error) {
+	items := []Takeover{}
+	err := s.db.SelectContext(ctx, &items, `
+		SELECT instance, jid, COALESCE(motivo, '') AS motivo, criado_em, expira_em
+		FROM atendimento_humano
+		WHERE instance = $1 AND (expira_em IS NULL OR expira_em > NOW())
+		ORDER BY criado_em DESC
+	`, instance)
+	return items, err
+}
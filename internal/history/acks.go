@@ -0,0 +1,231 @@
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status de entrega, na ordem em que avançam. "error" só substitui pending.
+const (
+	AckPending   = "pending"
+	AckError     = "error"
+	AckServer    = "server_ack"
+	AckDelivered = "delivered"
+	AckRead      = "read"
+	AckPlayed    = "played"
+)
+
+var ErrMessageNotFound = errors.New("mensagem não encontrada")
+
+// Valores de proto.WebMessageInfo.Status do Baileys.
+var ackNames = map[int]string{
+	0: AckError,
+	1: AckPending,
+	2: AckServer,
+	3: AckDelivered,
+	4: AckRead,
+	5: AckPlayed,
+}
+
+// Ack é uma mudança de status de uma mensagem. Participant vem preenchido
+// nos recibos de grupo (quem recebeu/leu).
+type Ack struct {
+	MessageID   string    `db:"message_id" json:"messageId"`
+	ChatJid     string    `db:"jid" json:"chatJid"`
+	FromMe      bool      `db:"-" json:"-"`
+	Participant string    `db:"participant" json:"participant,omitempty"`
+	Status      string    `db:"status" json:"status"`
+	Timestamp   time.Time `db:"criado_em" json:"timestamp"`
+}
+
+// Delivery é a situação de entrega de uma mensagem com a linha do tempo.
+type Delivery struct {
+	MessageID string `json:"messageId"`
+	Instance  string `json:"instance"`
+	ChatJid   string `json:"chatJid"`
+	Status    string `json:"status"`
+	Timeline  []Ack  `json:"timeline"`
+}
+
+// SaveUpdate grava o status de um evento messages.update ({key, update}).
+// Atualizações sem status (edições, reações) devolvem nil.
+func (s *Store) SaveUpdate(ctx context.Context, instance string, data json.RawMessage) (*Ack, error) {
+	var u struct {
+		Key    waKey `json:"key"`
+		Update struct {
+			Status json.RawMessage `json:"status"`
+		} `json:"update"`
+	}
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+
+	status := parseAckStatus(u.Update.Status)
+	if status == "" || u.Key.ID == "" {
+		return nil, nil
+	}
+
+	ack := &Ack{
+		MessageID: u.Key.ID, ChatJid: u.Key.RemoteJid, FromMe: u.Key.FromMe,
+		Participant: u.Key.Participant, Status: status, Timestamp: time.Now().UTC(),
+	}
+	return ack, s.saveAck(ctx, instance, ack)
+}
+
+// SaveReceipt grava um evento message-receipt.update ({key, receipt}), que
+// pode carregar entrega, leitura e reprodução ao mesmo tempo.
+func (s *Store) SaveReceipt(ctx context.Context, instance string, data json.RawMessage) ([]Ack, error) {
+	var r struct {
+		Key     waKey `json:"key"`
+		Receipt struct {
+			UserJid          string          `json:"userJid"`
+			ReceiptTimestamp json.RawMessage `json:"receiptTimestamp"`
+			ReadTimestamp    json.RawMessage `json:"readTimestamp"`
+			PlayedTimestamp  json.RawMessage `json:"playedTimestamp"`
+		} `json:"receipt"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Key.ID == "" {
+		return nil, nil
+	}
+
+	var acks []Ack
+	for _, item := range []struct {
+		status string
+		ts     json.RawMessage
+	}{
+		{AckDelivered, r.Receipt.ReceiptTimestamp},
+		{AckRead, r.Receipt.ReadTimestamp},
+		{AckPlayed, r.Receipt.PlayedTimestamp},
+	} {
+		secs := parseInt(item.ts)
+		if secs <= 0 {
+			continue
+		}
+		ack := Ack{
+			MessageID: r.Key.ID, ChatJid: r.Key.RemoteJid, FromMe: r.Key.FromMe,
+			Participant: r.Receipt.UserJid, Status: item.status, Timestamp: time.Unix(secs, 0).UTC(),
+		}
+		if err := s.saveAck(ctx, instance, &ack); err != nil {
+			return acks, err
+		}
+		acks = append(acks, ack)
+	}
+	return acks, nil
+}
+
+func (s *Store) saveAck(ctx context.Context, instance string, ack *Ack) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO mensagens_status (instance, message_id, jid, participant, status, criado_em)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (instance, message_id, status, participant) DO NOTHING
+	`, instance, ack.MessageID, ack.ChatJid, ack.Participant, ack.Status, ack.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	// O status da mensagem só avança (um "delivered" atrasado não desfaz "read")
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE mensagens SET status = $3
+		WHERE instance = $1 AND message_id = $2
+		  AND COALESCE(array_position($4::text[], status), 0) < array_position($4::text[], $3)
+	`, instance, ack.MessageID, ack.Status, ackOrder)
+	return err
+}
+
+// Ordem usada para decidir se um status avança o anterior.
+const ackOrder = "{pending,error,server_ack,delivered,read,played}"
+
+// Delivery monta a linha do tempo de entrega da mensagem.
+func (s *Store) Delivery(ctx context.Context, instance, messageID string) (*Delivery, error) {
+	d := &Delivery{MessageID: messageID, Instance: instance, Timeline: []Ack{}}
+
+	var row struct {
+		Jid    string         `db:"jid"`
+		Status sql.NullString `db:"status"`
+	}
+	err := s.db.GetContext(ctx, &row, `
+		SELECT jid, status FROM mensagens WHERE instance = $1 AND message_id = $2
+	`, instance, messageID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	d.ChatJid = row.Jid
+	d.Status = row.Status.String
+
+	err = s.db.SelectContext(ctx, &d.Timeline, `
+		SELECT message_id, jid, participant, status, criado_em
+		FROM mensagens_status
+		WHERE instance = $1 AND message_id = $2
+		ORDER BY criado_em, id
+	`, instance, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ChatJid == "" && len(d.Timeline) == 0 {
+		return nil, ErrMessageNotFound
+	}
+	if d.ChatJid == "" {
+		d.ChatJid = d.Timeline[0].ChatJid
+	}
+	if d.Status == "" && len(d.Timeline) > 0 {
+		d.Status = d.Timeline[len(d.Timeline)-1].Status
+	}
+	return d, nil
+}
+
+// InstanceOf descobre a instância dona de um message_id do WhatsApp.
+func (s *Store) InstanceOf(ctx context.Context, messageID string) (string, error) {
+	var instance string
+	err := s.db.GetContext(ctx, &instance, `
+		SELECT instance FROM mensagens WHERE message_id = $1
+		UNION
+		SELECT instance FROM mensagens_status WHERE message_id = $1
+		LIMIT 1
+	`, messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrMessageNotFound
+	}
+	return instance, err
+}
+
+// parseAckStatus aceita o número do enum ou o nome (ex.: "DELIVERY_ACK").
+func parseAckStatus(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	if n, err := strconv.Atoi(string(raw)); err == nil {
+		return ackNames[n]
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return ""
+	}
+	switch strings.ToUpper(name) {
+	case "ERROR":
+		return AckError
+	case "PENDING":
+		return AckPending
+	case "SERVER_ACK":
+		return AckServer
+	case "DELIVERY_ACK", "DELIVERED":
+		return AckDelivered
+	case "READ":
+		return AckRead
+	case "PLAYED":
+		return AckPlayed
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		return ackNames[n]
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/dbtest"
+)
+
+func TestParseAckStatus(t *testing.T) {
+	cases := map[string]string{
+		`3`:              AckDelivered,
+		`"4"`:            AckRead,
+		`"DELIVERY_ACK"`: AckDelivered,
+		`"server_ack"`:   AckServer,
+		`"PLAYED"`:       AckPlayed,
+		`0`:              AckError,
+		`9`:              "",
+		`"REVOKED"`:      "",
+		`null`:           "",
+		``:               "",
+		`{"status":3}`:   "",
+	}
+	for raw, want := range cases {
+		if got := parseAckStatus(json.RawMessage(raw)); got != want {
+			t.Errorf("parseAckStatus(%s) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestAcksOnlyMoveStatusForward(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db, "mensagens", "mensagens_status")
+	s := NewStore(db)
+	ctx := context.Background()
+	chat := "5511987654321@s.whatsapp.net"
+
+	sent := `{"key":{"remoteJid":"` + chat + `","fromMe":true,"id":"3EB0ACK"},"messageTimestamp":1700000000,"message":{"conversation":"oi"}}`
+	if err := s.SaveUpsert(ctx, instance, upsert(sent)); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(status string) {
+		t.Helper()
+		data := `{"key":{"remoteJid":"` + chat + `","fromMe":true,"id":"3EB0ACK"},"update":{"status":` + status + `}}`
+		if _, err := s.SaveUpdate(ctx, instance, json.RawMessage(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A leitura chega antes da entrega, que chega atrasada e repetida
+	update(`2`)
+	update(`"READ"`)
+	update(`3`)
+	update(`3`)
+
+	d, err := s.Delivery(ctx, instance, "3EB0ACK")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != AckRead {
+		t.Errorf("status = %s, want read (entrega atrasada não volta o status)", d.Status)
+	}
+	var timeline []string
+	for _, ack := range d.Timeline {
+		timeline = append(timeline, ack.Status)
+	}
+	if len(timeline) != 3 {
+		t.Errorf("linha do tempo = %v, want server_ack, read e delivered uma vez cada", timeline)
+	}
+
+	// Recibo de grupo com entrega e leitura no mesmo evento
+	receipt := `{"key":{"remoteJid":"` + chat + `","fromMe":true,"id":"3EB0ACK"},
+		"receipt":{"userJid":"5511912345678@s.whatsapp.net","receiptTimestamp":1700000100,"readTimestamp":"1700000200"}}`
+	acks, err := s.SaveReceipt(ctx, instance, json.RawMessage(receipt))
+	if err != nil || len(acks) != 2 || acks[0].Status != AckDelivered || acks[1].Status != AckRead {
+		t.Fatalf("SaveReceipt() = %+v, %v", acks, err)
+	}
+	if acks[1].Participant != "5511912345678@s.whatsapp.net" || acks[1].Timestamp.Unix() != 1700000200 {
+		t.Errorf("recibo = %+v", acks[1])
+	}
+
+	if owner, err := s.InstanceOf(ctx, "3EB0ACK"); err != nil || owner != instance {
+		t.Errorf("InstanceOf() = %q, %v", owner, err)
+	}
+	if _, err := s.Delivery(ctx, instance, "NAOEXISTE"); err != ErrMessageNotFound {
+		t.Errorf("Delivery() de id desconhecido: err = %v", err)
+	}
+}
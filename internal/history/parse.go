@@ -0,0 +1,316 @@
+package history
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================
+// PARSE DO WAMessage DO BAILEYS
+// ============================================
+
+type waKey struct {
+	RemoteJid   string `json:"remoteJid"`
+	FromMe      bool   `json:"fromMe"`
+	ID          string `json:"id"`
+	Participant string `json:"participant"`
+}
+
+type waMessage struct {
+	Key              waKey                      `json:"key"`
+	MessageTimestamp json.RawMessage            `json:"messageTimestamp"`
+	PushName         string                     `json:"pushName"`
+	Participant      string                     `json:"participant"`
+	Message          map[string]json.RawMessage `json:"message"`
+}
+
+type contextInfo struct {
+	StanzaID string `json:"stanzaId"`
+}
+
+type waContent struct {
+	Text        string          `json:"text"`
+	Caption     string          `json:"caption"`
+	Mimetype    string          `json:"mimetype"`
+	FileName    string          `json:"fileName"`
+	FileLength  json.RawMessage `json:"fileLength"`
+	Seconds     int             `json:"seconds"`
+	PTT         bool            `json:"ptt"`
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	URL         string          `json:"url"`
+	DirectPath  string          `json:"directPath"`
+	Name        string          `json:"name"`
+	Address     string          `json:"address"`
+	DisplayName string          `json:"displayName"`
+	Title       string          `json:"title"`
+	ContextInfo *contextInfo    `json:"contextInfo"`
+
+	// Respostas a botões/listas
+	SelectedDisplayText string `json:"selectedDisplayText"`
+	Body                *struct {
+		Text string `json:"text"`
+	} `json:"body"`
+
+	// Reações
+	Key *waKey `json:"key"`
+}
+
+// Media é o metadado de mídia gravado em mensagens.midia.
+type Media struct {
+	Mimetype   string `json:"mimetype,omitempty"`
+	FileName   string `json:"fileName,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Seconds    int    `json:"seconds,omitempty"`
+	PTT        bool   `json:"ptt,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	URL        string `json:"url,omitempty"`
+	DirectPath string `json:"directPath,omitempty"`
+}
+
+// parsed é a mensagem já normalizada para gravação.
+type parsed struct {
+	MessageID string
+	Jid       string
+	FromMe    bool
+	Sender    string
+	PushName  string
+	Type      string
+	Text      string
+	QuotedID  string
+	Media     *Media
+	Timestamp time.Time
+}
+
+// Envelopes que só embrulham outra mensagem em {"message": {...}}.
+var wrappers = map[string]bool{
+	"ephemeralMessage":           true,
+	"viewOnceMessage":            true,
+	"viewOnceMessageV2":          true,
+	"viewOnceMessageV2Extension": true,
+	"documentWithCaptionMessage": true,
+	"editedMessage":              true,
+}
+
+// Chaves que acompanham o conteúdo mas não são o conteúdo.
+var ignoredKeys = map[string]bool{
+	"messageContextInfo":           true,
+	"senderKeyDistributionMessage": true,
+}
+
+var typeNames = map[string]string{
+	"conversation":               "text",
+	"extendedTextMessage":        "text",
+	"imageMessage":               "image",
+	"videoMessage":               "video",
+	"audioMessage":               "audio",
+	"documentMessage":            "document",
+	"stickerMessage":             "sticker",
+	"locationMessage":            "location",
+	"liveLocationMessage":        "location",
+	"contactMessage":             "contact",
+	"contactsArrayMessage":       "contact",
+	"reactionMessage":            "reaction",
+	"buttonsMessage":             "buttons",
+	"listMessage":                "list",
+	"interactiveMessage":         "interactive",
+	"templateMessage":            "template",
+	"buttonsResponseMessage":     "reply",
+	"listResponseMessage":        "reply",
+	"templateButtonReplyMessage": "reply",
+	"interactiveResponseMessage": "reply",
+	"pollCreationMessage":        "poll",
+	"pollCreationMessageV2":      "poll",
+	"pollCreationMessageV3":      "poll",
+}
+
+// Summary é a mensagem normalizada publicada nos eventos tipados
+// (message.received).
+type Summary struct {
+	MessageID string    `json:"messageId"`
+	ChatJid   string    `json:"chatJid"`
+	FromMe    bool      `json:"fromMe"`
+	SenderJid string    `json:"senderJid,omitempty"`
+	PushName  string    `json:"pushName,omitempty"`
+	Type      string    `json:"type"`
+	Text      string    `json:"text,omitempty"`
+	QuotedID  string    `json:"quotedId,omitempty"`
+	Media     *Media    `json:"media,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Summarize normaliza o payload de um messages.upsert ({type, message}). ok é
+// falso quando não é conteúdo de conversa.
+func Summarize(data json.RawMessage) (*Summary, bool) {
+	p, _, ok, err := decodeUpsert(data)
+	if err != nil || !ok {
+		return nil, false
+	}
+	return &Summary{
+		MessageID: p.MessageID, ChatJid: p.Jid, FromMe: p.FromMe, SenderJid: p.Sender,
+		PushName: p.PushName, Type: p.Type, Text: p.Text, QuotedID: p.QuotedID,
+		Media: p.Media, Timestamp: p.Timestamp,
+	}, true
+}
+
+// decodeUpsert abre o envelope do messages.upsert e devolve também o
+// WAMessage original.
+func decodeUpsert(data json.RawMessage) (parsed, json.RawMessage, bool, error) {
+	var evt struct {
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(data, &evt); err != nil {
+		return parsed{}, nil, false, err
+	}
+
+	var m waMessage
+	if err := json.Unmarshal(evt.Message, &m); err != nil {
+		return parsed{}, nil, false, err
+	}
+	p, ok := parseMessage(&m)
+	return p, evt.Message, ok, nil
+}
+
+// parseMessage extrai os campos indexáveis do WAMessage. ok é falso para o que
+// não é conteúdo de conversa (status, protocolMessage, mensagens vazias).
+func parseMessage(m *waMessage) (p parsed, ok bool) {
+	if m.Key.ID == "" || m.Key.RemoteJid == "" || m.Key.RemoteJid == "status@broadcast" {
+		return p, false
+	}
+
+	p.MessageID = m.Key.ID
+	p.Jid = m.Key.RemoteJid
+	p.FromMe = m.Key.FromMe
+	p.PushName = m.PushName
+	p.Timestamp = parseTimestamp(m.MessageTimestamp)
+
+	p.Sender = m.Key.Participant
+	if p.Sender == "" {
+		p.Sender = m.Participant
+	}
+	if p.Sender == "" && !p.FromMe && !strings.HasSuffix(p.Jid, "@g.us") {
+		p.Sender = p.Jid
+	}
+
+	key, raw := unwrap(m.Message)
+	if key == "" || key == "protocolMessage" {
+		return p, false
+	}
+
+	p.Type = typeNames[key]
+	if p.Type == "" {
+		p.Type = strings.TrimSuffix(key, "Message")
+	}
+
+	if key == "conversation" {
+		_ = json.Unmarshal(raw, &p.Text)
+		return p, true
+	}
+
+	var c waContent
+	_ = json.Unmarshal(raw, &c)
+
+	switch p.Type {
+	case "text":
+		p.Text = c.Text
+	case "image", "video", "audio", "document", "sticker":
+		p.Text = c.Caption
+		p.Media = &Media{
+			Mimetype: c.Mimetype, FileName: c.FileName, Size: parseInt(c.FileLength),
+			Seconds: c.Seconds, PTT: c.PTT, Width: c.Width, Height: c.Height,
+			URL: c.URL, DirectPath: c.DirectPath,
+		}
+	case "location":
+		p.Text = strings.TrimSpace(c.Name + " " + c.Address)
+	case "contact":
+		p.Text = c.DisplayName
+	case "reaction":
+		p.Text = c.Text
+		if c.Key != nil {
+			p.QuotedID = c.Key.ID
+		}
+	case "reply":
+		p.Text = c.SelectedDisplayText
+		if p.Text == "" && c.Title != "" {
+			p.Text = c.Title
+		}
+		if p.Text == "" && c.Body != nil {
+			p.Text = c.Body.Text
+		}
+	case "poll":
+		p.Text = c.Name
+	default:
+		p.Text = c.Text
+		if p.Text == "" {
+			p.Text = c.Caption
+		}
+	}
+
+	if c.ContextInfo != nil && c.ContextInfo.StanzaID != "" && p.QuotedID == "" {
+		p.QuotedID = c.ContextInfo.StanzaID
+	}
+
+	return p, true
+}
+
+// unwrap devolve a chave e o corpo do conteúdo, abrindo os envelopes.
+func unwrap(msg map[string]json.RawMessage) (string, json.RawMessage) {
+	for depth := 0; depth < 4 && msg != nil; depth++ {
+		var next map[string]json.RawMessage
+		for key, raw := range msg {
+			if ignoredKeys[key] || string(raw) == "null" {
+				continue
+			}
+			if wrappers[key] {
+				var inner struct {
+					Message map[string]json.RawMessage `json:"message"`
+				}
+				if json.Unmarshal(raw, &inner) == nil && inner.Message != nil {
+					next = inner.Message
+					break
+				}
+				continue
+			}
+			return key, raw
+		}
+		msg = next
+	}
+	return "", nil
+}
+
+// parseTimestamp aceita segundos como número, string ou Long serializado
+// ({"low":..,"high":..}).
+func parseTimestamp(raw json.RawMessage) time.Time {
+	if secs := parseInt(raw); secs > 0 {
+		return time.Unix(secs, 0).UTC()
+	}
+	return time.Now().UTC()
+}
+
+func parseInt(raw json.RawMessage) int64 {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		v, _ := strconv.ParseInt(n.String(), 10, 64)
+		return v
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		v, _ := strconv.ParseInt(s, 10, 64)
+		return v
+	}
+	var long struct {
+		Low  int64 `json:"low"`
+		High int64 `json:"high"`
+	}
+	if err := json.Unmarshal(raw, &long); err == nil {
+		return long.High<<32 | (long.Low & 0xffffffff)
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func upsert(message string) json.RawMessage {
+	return json.RawMessage(`{"type":"notify","message":` + message + `}`)
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    Summary
+	}{
+		{
+			name:    "conversa simples",
+			message: `{"key":{"remoteJid":"5511987654321@s.whatsapp.net","id":"A1"},"messageTimestamp":1700000000,"pushName":"Ana","message":{"conversation":"oi"}}`,
+			want:    Summary{MessageID: "A1", ChatJid: "5511987654321@s.whatsapp.net", SenderJid: "5511987654321@s.whatsapp.net", PushName: "Ana", Type: "text", Text: "oi"},
+		},
+		{
+			name:    "resposta citando outra mensagem, timestamp como Long",
+			message: `{"key":{"remoteJid":"5511987654321@s.whatsapp.net","fromMe":true,"id":"A2"},"messageTimestamp":{"low":1700000000,"high":0},"message":{"extendedTextMessage":{"text":"pode ser","contextInfo":{"stanzaId":"A1"}}}}`,
+			want:    Summary{MessageID: "A2", ChatJid: "5511987654321@s.whatsapp.net", FromMe: true, Type: "text", Text: "pode ser", QuotedID: "A1"},
+		},
+		{
+			name: "imagem em grupo dentro de mensagem temporária",
+			message: `{"key":{"remoteJid":"120363025246125486@g.us","participant":"5511987654321@s.whatsapp.net","id":"A3"},"messageTimestamp":"1700000000",
+				"message":{"messageContextInfo":{},"ephemeralMessage":{"message":{"imageMessage":{"caption":"nota","mimetype":"image/jpeg","fileLength":"2048","width":800,"height":600}}}}}`,
+			want: Summary{
+				MessageID: "A3", ChatJid: "120363025246125486@g.us", SenderJid: "5511987654321@s.whatsapp.net", Type: "image", Text: "nota",
+				Media: &Media{Mimetype: "image/jpeg", Size: 2048, Width: 800, Height: 600},
+			},
+		},
+		{
+			name:    "resposta de lista",
+			message: `{"key":{"remoteJid":"5511987654321@s.whatsapp.net","id":"A4"},"messageTimestamp":1700000000,"message":{"listResponseMessage":{"title":"Calabresa"}}}`,
+			want:    Summary{MessageID: "A4", ChatJid: "5511987654321@s.whatsapp.net", SenderJid: "5511987654321@s.whatsapp.net", Type: "reply", Text: "Calabresa"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Summarize(upsert(tt.message))
+			if !ok {
+				t.Fatal("Summarize() ok = false")
+			}
+			if want := time.Unix(1700000000, 0).UTC(); !got.Timestamp.Equal(want) {
+				t.Errorf("timestamp = %v, want %v", got.Timestamp, want)
+			}
+			tt.want.Timestamp = got.Timestamp
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("Summarize() =\n%s\nwant\n%s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestSummarizeSkipsNonConversation(t *testing.T) {
+	for name, message := range map[string]string{
+		"status":          `{"key":{"remoteJid":"status@broadcast","id":"S1"},"message":{"conversation":"story"}}`,
+		"protocolMessage": `{"key":{"remoteJid":"5511987654321@s.whatsapp.net","id":"P1"},"message":{"protocolMessage":{"type":0}}}`,
+		"sem conteúdo":    `{"key":{"remoteJid":"5511987654321@s.whatsapp.net","id":"E1"},"message":{"messageContextInfo":{}}}`,
+		"sem id":          `{"key":{"remoteJid":"5511987654321@s.whatsapp.net"},"message":{"conversation":"oi"}}`,
+		"não é objeto":    `"oi"`,
+	} {
+		if got, ok := Summarize(upsert(message)); ok {
+			t.Errorf("%s: Summarize() = %+v, want ignorada", name, got)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package history
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var ErrInvalidCursor = errors.New("cursor inválido")
+
+// Message é uma linha da tabela mensagens no formato da API de histórico.
+type Message struct {
+	ID        int64           `db:"id" json:"id"`
+	MessageID *string         `db:"message_id" json:"messageId"`
+	Jid       string          `db:"jid" json:"chatJid"`
+	FromMe    bool            `db:"from_me" json:"fromMe"`
+	SenderJid *string         `db:"sender_jid" json:"senderJid"`
+	PushName  *string         `db:"push_name" json:"pushName"`
+	Tipo      string          `db:"tipo" json:"type"`
+	Texto     *string         `db:"texto" json:"text"`
+	QuotedID  *string         `db:"quoted_id" json:"quotedId"`
+	Midia     json.RawMessage `db:"midia" json:"media,omitempty"`
+	Status    *string         `db:"status" json:"status"`
+	Timestamp time.Time       `db:"enviado_em" json:"timestamp"`
+	Raw       json.RawMessage `db:"raw" json:"raw,omitempty"`
+}
+
+// Query filtra o histórico de um chat. Before/After limitam pelo horário da
+// mensagem; Cursor continua a página anterior (mais antigas primeiro).
+type Query struct {
+	Limit      int
+	Cursor     string
+	Before     *time.Time
+	After      *time.Time
+	Types      []string
+	FromMe     *bool
+	IncludeRaw bool
+}
+
+type Page struct {
+	Messages   []Message `json:"messages"`
+	NextCursor *string   `json:"nextCursor"`
+}
+
+// Store grava as mensagens recebidas via messages.upsert e atende a API de
+// histórico. Envios feitos pelo sidecar caem na mesma linha pelo message_id.
+type Store struct {
+	db *sqlx.DB
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db}
+}
+
+// SaveUpsert grava o payload de um evento messages.upsert ({type, message}).
+// Mensagens que não são conteúdo de conversa são ignoradas.
+func (s *Store) SaveUpsert(ctx context.Context, instance string, data json.RawMessage) error {
+	p, raw, ok, err := decodeUpsert(data)
+	if err != nil || !ok {
+		return err
+	}
+
+	var media interface{}
+	if p.Media != nil {
+		b, _ := json.Marshal(p.Media)
+		media = string(b)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO mensagens (instance, jid, tipo, conteudo, message_id, from_me, sender_jid, push_name,
+		                       enviado_em, texto, quoted_id, midia, raw)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, NULLIF($4, ''), NULLIF($10, ''), $11, $12)
+		ON CONFLICT (instance, message_id) WHERE message_id IS NOT NULL DO UPDATE
+		SET sender_jid = COALESCE(EXCLUDED.sender_jid, mensagens.sender_jid),
+		    push_name = COALESCE(EXCLUDED.push_name, mensagens.push_name),
+		    enviado_em = EXCLUDED.enviado_em,
+		    texto = COALESCE(EXCLUDED.texto, mensagens.texto),
+		    quoted_id = COALESCE(EXCLUDED.quoted_id, mensagens.quoted_id),
+		    midia = COALESCE(EXCLUDED.midia, mensagens.midia),
+		    raw = EXCLUDED.raw
+	`, instance, p.Jid, p.Type, p.Text, p.MessageID, p.FromMe, p.Sender, p.PushName,
+		p.Timestamp, p.QuotedID, media, string(raw))
+	return err
+}
+
+// Messages lista o histórico do chat do mais recente para o mais antigo, com
+// paginação por cursor (keyset em enviado_em, id).
+func (s *Store) Messages(ctx context.Context, instance, jid string, q Query) (*Page, error) {
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+	if q.Limit > 200 {
+		q.Limit = 200
+	}
+
+	raw := "NULL::jsonb AS raw"
+	if q.IncludeRaw {
+		raw = "raw"
+	}
+
+	where := []string{"instance = $1", "jid = $2"}
+	args := []interface{}{instance, jid}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if q.Cursor != "" {
+		ts, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf("(enviado_em, id) < (%s, %s)", arg(ts), arg(id)))
+	}
+	if q.Before != nil {
+		where = append(where, "enviado_em < "+arg(*q.Before))
+	}
+	if q.After != nil {
+		where = append(where, "enviado_em > "+arg(*q.After))
+	}
+	if len(q.Types) > 0 {
+		where = append(where, "tipo = ANY("+arg(pq.Array(q.Types))+")")
+	}
+	if q.FromMe != nil {
+		where = append(where, "from_me = "+arg(*q.FromMe))
+	}
+
+	// Uma linha a mais indica se existe próxima página
+	limit := arg(q.Limit + 1)
+
+	items := []Message{}
+	err := s.db.SelectContext(ctx, &items, `
+		SELECT id, message_id, jid, from_me, sender_jid, push_name, tipo,
+		       COALESCE(texto, conteudo) AS texto, quoted_id, midia, status, enviado_em, `+raw+`
+		FROM mensagens
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY enviado_em DESC, id DESC
+		LIMIT `+limit, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{Messages: items}
+	if len(items) > q.Limit {
+		page.Messages = items[:q.Limit]
+		last := page.Messages[q.Limit-1]
+		cursor := encodeCursor(last.Timestamp, last.ID)
+		page.NextCursor = &cursor
+	}
+	return page, nil
+}
+
+func encodeCursor(ts time.Time, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(ts.UnixNano(), 10) + ":" + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (time.Time, int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	tsPart, idPart, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	ns, err1 := strconv.ParseInt(tsPart, 10, 64)
+	id, err2 := strconv.ParseInt(idPart, 10, 64)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, ns).UTC(), id, nil
+}
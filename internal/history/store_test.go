@@ -0,0 +1,74 @@
+package history
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/dbtest"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 3, 15, 12, 30, 0, 123456789, time.UTC)
+	gotTS, gotID, err := decodeCursor(encodeCursor(ts, 98765))
+	if err != nil || !gotTS.Equal(ts) || gotID != 98765 {
+		t.Errorf("decodeCursor(encodeCursor()) = %v, %d, %v", gotTS, gotID, err)
+	}
+
+	for _, bad := range []string{
+		"não é base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("sem-separador")),
+		base64.RawURLEncoding.EncodeToString([]byte("abc:1")),
+		base64.RawURLEncoding.EncodeToString([]byte("1700000000:xyz")),
+	} {
+		if _, _, err := decodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) err = %v, want ErrInvalidCursor", bad, err)
+		}
+	}
+}
+
+func TestMessagesPagesWithoutGapsOrRepeats(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db, "mensagens")
+	s := NewStore(db)
+	ctx := context.Background()
+	chat := "5511987654321@s.whatsapp.net"
+
+	// Cinco mensagens, duas no mesmo segundo: o desempate é pelo id
+	for i, ts := range []int{100, 200, 200, 300, 400} {
+		msg := fmt.Sprintf(`{"key":{"remoteJid":%q,"id":"M%d"},"messageTimestamp":%d,"message":{"conversation":"msg %d"}}`, chat, i, 1700000000+ts, i)
+		if err := s.SaveUpsert(ctx, instance, upsert(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []string
+	q := Query{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("paginação não termina")
+		}
+		page, err := s.Messages(ctx, instance, chat, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range page.Messages {
+			seen = append(seen, *m.MessageID)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		q.Cursor = *page.NextCursor
+	}
+
+	if got := fmt.Sprint(seen); got != "[M4 M3 M2 M1 M0]" {
+		t.Errorf("ordem paginada = %s, want [M4 M3 M2 M1 M0]", got)
+	}
+
+	if _, err := s.Messages(ctx, instance, chat, Query{Cursor: "lixo"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor inválido: err = %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package integrations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+var ErrInstanceNotFound = errors.New("instância não encontrada")
+
+type cached struct {
+	cfg      models.IntegrationsConfig
+	loadedAt time.Time
+}
+
+// Store guarda a configuração das integrações de cada instância
+// (instancias.integracoes). Os conectores consultam a cada mensagem recebida,
+// por isso o cache.
+type Store struct {
+	db  *sqlx.DB
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cached
+}
+
+func NewStore(db *sqlx.DB) *Store {
+	return &Store{db: db, ttl: 30 * time.Second, entries: make(map[string]cached)}
+}
+
+// Get devolve a configuração da instância (tudo desligado quando nunca foi
+// configurada). O valor é uma cópia: quem chama pode alterá-lo sem mexer no
+// cache.
+func (s *Store) Get(ctx context.Context, instance string) (models.IntegrationsConfig, error) {
+	s.mu.RLock()
+	entry, ok := s.entries[instance]
+	s.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < s.ttl {
+		return cloneConfig(entry.cfg), nil
+	}
+
+	var raw []byte
+	err := s.db.GetContext(ctx, &raw, `SELECT integracoes FROM instancias WHERE nome = $1`, instance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.IntegrationsConfig{}, ErrInstanceNotFound
+	}
+	if err != nil {
+		return models.IntegrationsConfig{}, err
+	}
+
+	entry = cached{loadedAt: time.Now()}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &entry.cfg); err != nil {
+			return models.IntegrationsConfig{}, err
+		}
+	}
+
+	s.mu.Lock()
+	s.entries[instance] = entry
+	s.mu.Unlock()
+
+	return cloneConfig(entry.cfg), nil
+}
+
+// Save grava a configuração das integrações da instância.
+func (s *Store) Save(ctx context.Context, instance string, cfg models.IntegrationsConfig) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE instancias SET integracoes = $2, atualizado_em = NOW() WHERE nome = $1
+	`, instance, string(data))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInstanceNotFound
+	}
+
+	s.mu.Lock()
+	s.entries[instance] = cached{cfg: cloneConfig(cfg), loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// cloneConfig copia as listas e ponteiros da configuração, que de outra
+// forma seriam compartilhados entre o cache e quem chamou.
+func cloneConfig(cfg models.IntegrationsConfig) models.IntegrationsConfig {
+	cfg.Typebot.Keywords = slices.Clone(cfg.Typebot.Keywords)
+	cfg.Dify.Keywords = slices.Clone(cfg.Dify.Keywords)
+	if cfg.OpenAI.Temperature != nil {
+		t := *cfg.OpenAI.Temperature
+		cfg.OpenAI.Temperature = &t
+	}
+
+	cfg.Triggers.StopWords = slices.Clone(cfg.Triggers.StopWords)
+	cfg.Triggers.Rules = slices.Clone(cfg.Triggers.Rules)
+	for i := range cfg.Triggers.Rules {
+		rule := &cfg.Triggers.Rules[i]
+		rule.Keywords = slices.Clone(rule.Keywords)
+		rule.Tags = slices.Clone(rule.Tags)
+		if rule.BusinessHours != nil {
+			bh := *rule.BusinessHours
+			bh.Days = slices.Clone(bh.Days)
+			rule.BusinessHours = &bh
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,39 @@
+package integrations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestGetReturnsCopy(t *testing.T) {
+	s := NewStore(nil)
+	var cfg models.IntegrationsConfig
+	cfg.Typebot.Keywords = []string{"menu"}
+	cfg.Triggers.StopWords = []string{"atendente"}
+	cfg.Triggers.Rules = []models.TriggerRule{{
+		Bot: "openai", Keywords: []string{"pedido"},
+		BusinessHours: &models.BusinessHours{Start: "08:00", End: "18:00", Days: []int{1, 2, 3}},
+	}}
+	s.entries["loja1"] = cached{cfg: cfg, loadedAt: time.Now()}
+
+	got, err := s.Get(context.Background(), "loja1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Typebot.Keywords[0] = "alterado"
+	got.Triggers.StopWords[0] = "alterado"
+	got.Triggers.Rules[0].Bot = "dify"
+	got.Triggers.Rules[0].Keywords[0] = "alterado"
+	got.Triggers.Rules[0].BusinessHours.Days[0] = 0
+	got.Triggers.Rules[0].BusinessHours.Start = "00:00"
+
+	again, _ := s.Get(context.Background(), "loja1")
+	rule := again.Triggers.Rules[0]
+	if again.Typebot.Keywords[0] != "menu" || again.Triggers.StopWords[0] != "atendente" ||
+		rule.Bot != "openai" || rule.Keywords[0] != "pedido" || rule.BusinessHours.Days[0] != 1 || rule.BusinessHours.Start != "08:00" {
+		t.Errorf("cache alterado por quem chamou: %+v", again)
+	}
+}
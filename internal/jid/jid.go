@@ -0,0 +1,174 @@
+package jid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Servidores (parte depois do @) aceitos pelo WhatsApp.
+const (
+	ServerUser       = "s.whatsapp.net"
+	ServerGroup      = "g.us"
+	ServerLID        = "lid"
+	ServerBroadcast  = "broadcast"
+	ServerNewsletter = "newsletter"
+
+	legacyUserServer = "c.us"
+)
+
+var ErrInvalid = errors.New("número ou jid inválido")
+
+// JID é um endereço do WhatsApp: usuário (telefone), grupo, LID, lista de
+// transmissão ou canal.
+type JID struct {
+	User   string
+	Server string
+}
+
+func (j JID) String() string {
+	return j.User + "@" + j.Server
+}
+
+func (j JID) IsUser() bool  { return j.Server == ServerUser }
+func (j JID) IsGroup() bool { return j.Server == ServerGroup }
+func (j JID) IsLID() bool   { return j.Server == ServerLID }
+
+// nationalLength é o tamanho do número nacional (sem o código do país) nos
+// países em que dá para distinguir pelo tamanho se o código foi omitido.
+var nationalLength = map[string]int{
+	"1":   10, // EUA e Canadá
+	"34":  9,  // Espanha
+	"351": 9,  // Portugal
+	"51":  9,  // Peru
+	"52":  10, // México
+	"55":  11, // Brasil (DDD + 9 dígitos)
+	"56":  9,  // Chile
+	"57":  10, // Colômbia
+	"595": 9,  // Paraguai
+	"598": 8,  // Uruguai
+}
+
+// Parse interpreta um telefone ou jid. Telefones aceitam +, 00, espaços,
+// traços, pontos e parênteses; sem código do país, defaultCountry (ex.: "55")
+// é aplicado quando informado. JIDs perdem o sufixo de dispositivo (:12) e
+// @c.us vira @s.whatsapp.net.
+func Parse(raw, defaultCountry string) (JID, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return JID{}, fmt.Errorf("%w: vazio", ErrInvalid)
+	}
+
+	if at := strings.LastIndex(raw, "@"); at >= 0 {
+		user, server := raw[:at], strings.ToLower(raw[at+1:])
+		if server == legacyUserServer {
+			server = ServerUser
+		}
+		switch server {
+		case ServerUser, ServerLID:
+			user, _, _ = strings.Cut(user, ":")
+			if !digits(user) {
+				return JID{}, fmt.Errorf("%w: %q", ErrInvalid, raw)
+			}
+		case ServerGroup:
+			if !groupID(user) {
+				return JID{}, fmt.Errorf("%w: %q", ErrInvalid, raw)
+			}
+		case ServerBroadcast, ServerNewsletter:
+			if user == "" {
+				return JID{}, fmt.Errorf("%w: %q", ErrInvalid, raw)
+			}
+		default:
+			return JID{}, fmt.Errorf("%w: servidor %q desconhecido", ErrInvalid, server)
+		}
+		return JID{User: user, Server: server}, nil
+	}
+
+	// Ids de grupo sem o sufixo: 120363... (atuais) ou telefone-timestamp (antigos)
+	creator, created, legacy := strings.Cut(raw, "-")
+	legacy = legacy && len(creator) >= 10 && len(created) >= 9 && digits(creator) && digits(created)
+	if legacy || (len(raw) >= 18 && strings.HasPrefix(raw, "120363") && digits(raw)) {
+		return JID{User: raw, Server: ServerGroup}, nil
+	}
+
+	phone, err := Phone(raw, defaultCountry)
+	if err != nil {
+		return JID{}, err
+	}
+	return JID{User: phone, Server: ServerUser}, nil
+}
+
+// Phone reduz o telefone aos dígitos com o código do país (E.164 sem o +).
+func Phone(raw, defaultCountry string) (string, error) {
+	phone := strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "").Replace(strings.TrimSpace(raw))
+
+	international := false
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		phone, international = phone[1:], true
+	case strings.HasPrefix(phone, "00"):
+		phone, international = phone[2:], true
+	}
+	if phone == "" {
+		return "", fmt.Errorf("%w: vazio", ErrInvalid)
+	}
+	if !digits(phone) {
+		return "", fmt.Errorf("%w: %q (use só dígitos, +, espaços e traços)", ErrInvalid, raw)
+	}
+
+	if !international {
+		switch {
+		case defaultCountry != "" && phone[0] == '0':
+			// Prefixo de discagem nacional (0 11 ...)
+			phone = defaultCountry + strings.TrimLeft(phone, "0")
+		case defaultCountry != "" && len(phone) <= nationalLength[defaultCountry]:
+			phone = defaultCountry + phone
+		case phone[0] == '0':
+			return "", fmt.Errorf("%w: %q (inclua o código do país)", ErrInvalid, raw)
+		}
+	}
+
+	if len(phone) < 8 || len(phone) > 15 {
+		return "", fmt.Errorf("%w: %q (números E.164 têm de 8 a 15 dígitos)", ErrInvalid, raw)
+	}
+	return phone, nil
+}
+
+// BrazilVariants devolve as duas formas de um celular brasileiro, com e sem
+// o nono dígito (a com 9 primeiro). Contas antigas continuam registradas sem
+// ele, então só o WhatsApp sabe qual existe. Fora desse caso devolve nil.
+func BrazilVariants(user string) []string {
+	rest, ok := strings.CutPrefix(user, "55")
+	if !ok || !digits(rest) {
+		return nil
+	}
+	ddd := rest[:min(2, len(rest))]
+	switch {
+	case len(rest) == 11 && rest[2] == '9' && rest[3] >= '6':
+		return []string{user, "55" + ddd + rest[3:]}
+	case len(rest) == 10 && rest[2] >= '6':
+		return []string{"55" + ddd + "9" + rest[2:], user}
+	}
+	return nil
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// groupID aceita 120363... ou o formato antigo telefone-timestamp.
+func groupID(s string) bool {
+	first, second, found := strings.Cut(s, "-")
+	if !found {
+		return digits(s)
+	}
+	return digits(first) && digits(second)
+}
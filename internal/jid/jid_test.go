@@ -0,0 +1,82 @@
+package jid
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		country string
+		want    JID
+		wantErr bool
+	}{
+		{name: "telefone completo", raw: "5511987654321", want: JID{"5511987654321", ServerUser}},
+		{name: "telefone formatado", raw: "+55 (11) 98765-4321", want: JID{"5511987654321", ServerUser}},
+		{name: "prefixo internacional 00", raw: "0055 11 98765.4321", want: JID{"5511987654321", ServerUser}},
+		{name: "sem código do país", raw: "11987654321", country: "55", want: JID{"5511987654321", ServerUser}},
+		{name: "prefixo nacional 0", raw: "011987654321", country: "55", want: JID{"5511987654321", ServerUser}},
+		{name: "com + ignora o país padrão", raw: "+14155550123", country: "55", want: JID{"14155550123", ServerUser}},
+		{name: "jid c.us", raw: "5511987654321@c.us", want: JID{"5511987654321", ServerUser}},
+		{name: "jid com dispositivo", raw: "5511987654321:12@s.whatsapp.net", want: JID{"5511987654321", ServerUser}},
+		{name: "jid em maiúsculas", raw: "5511987654321@S.WHATSAPP.NET", want: JID{"5511987654321", ServerUser}},
+		{name: "lid", raw: "123456789012345@lid", want: JID{"123456789012345", ServerLID}},
+		{name: "grupo com sufixo", raw: "120363012345678901@g.us", want: JID{"120363012345678901", ServerGroup}},
+		{name: "grupo sem sufixo", raw: "120363012345678901", want: JID{"120363012345678901", ServerGroup}},
+		{name: "grupo antigo", raw: "5511987654321-1600000000", want: JID{"5511987654321-1600000000", ServerGroup}},
+		{name: "lista de transmissão", raw: "status@broadcast", want: JID{"status", ServerBroadcast}},
+		{name: "vazio", raw: "  ", wantErr: true},
+		{name: "letras", raw: "11abc", wantErr: true},
+		{name: "servidor desconhecido", raw: "5511987654321@example.com", wantErr: true},
+		{name: "usuário inválido", raw: "abc@s.whatsapp.net", wantErr: true},
+		{name: "grupo inválido", raw: "abc@g.us", wantErr: true},
+		{name: "zero sem país padrão", raw: "011987654321", wantErr: true},
+		{name: "curto demais", raw: "1234567", wantErr: true},
+		{name: "longo demais", raw: "1234567890123456", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.raw, tt.country)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalid) {
+					t.Fatalf("Parse(%q) err = %v, want ErrInvalid", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBrazilVariants(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		want []string
+	}{
+		{name: "celular com nono dígito", user: "5511987654321", want: []string{"5511987654321", "551187654321"}},
+		{name: "celular sem nono dígito", user: "551187654321", want: []string{"5511987654321", "551187654321"}},
+		{name: "fixo", user: "551133334444", want: nil},
+		{name: "nove seguido de dígito baixo", user: "5511912345678", want: nil},
+		{name: "outro país", user: "14155550123", want: nil},
+		{name: "só o código do país", user: "55", want: nil},
+		{name: "tamanho inesperado", user: "55119876543210", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BrazilVariants(tt.user); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BrazilVariants(%q) = %v, want %v", tt.user, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package jid
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	resolvedTTL   = 24 * time.Hour
+	unresolvedTTL = time.Hour // nenhuma das formas está no WhatsApp
+	cacheMaxItems = 50000
+)
+
+// Checker consulta quais jids têm conta no WhatsApp (onWhatsApp do Baileys).
+// Devolve os jids canônicos dos que existem.
+type Checker interface {
+	OnWhatsApp(ctx context.Context, instance string, jids []string) ([]string, error)
+}
+
+type cacheEntry struct {
+	user string
+	at   time.Time
+	ttl  time.Duration
+}
+
+// Resolver normaliza os destinatários e resolve o nono dígito dos celulares
+// brasileiros informados como número, perguntando ao WhatsApp qual das formas
+// existe. O resultado fica em cache por instância.
+type Resolver struct {
+	DefaultCountry string // código do país aplicado a números sem ele (ex.: "55")
+
+	checker Checker
+	mu      sync.Mutex
+	cache   map[string]cacheEntry
+}
+
+func NewResolver(checker Checker, defaultCountry string) *Resolver {
+	return &Resolver{
+		DefaultCountry: defaultCountry,
+		checker:        checker,
+		cache:          make(map[string]cacheEntry),
+	}
+}
+
+// Resolve interpreta o número ou jid e devolve o jid a usar no envio.
+func (r *Resolver) Resolve(ctx context.Context, instance, raw string) (JID, error) {
+	jids, err := r.ResolveAll(ctx, instance, []string{raw})
+	if err != nil {
+		return JID{}, err
+	}
+	return jids[0], nil
+}
+
+// ResolveAll resolve uma lista (participantes de grupo) com uma única
+// consulta ao WhatsApp para os números ambíguos. Se a consulta falhar, os
+// números seguem na forma com o nono dígito.
+func (r *Resolver) ResolveAll(ctx context.Context, instance string, raws []string) ([]JID, error) {
+	out := make([]JID, len(raws))
+	pending := map[int][]string{}
+	var query []string
+
+	for i, raw := range raws {
+		j, err := Parse(raw, r.DefaultCountry)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = j
+		// JIDs explícitos (ex.: de uma mensagem recebida) já são canônicos
+		if !j.IsUser() || strings.Contains(raw, "@") {
+			continue
+		}
+		variants := BrazilVariants(j.User)
+		if variants == nil {
+			continue
+		}
+		if user, ok := r.cached(instance, variants[0]); ok {
+			out[i].User = user
+			continue
+		}
+		out[i].User = variants[0]
+		pending[i] = variants
+		for _, v := range variants {
+			query = append(query, v+"@"+ServerUser)
+		}
+	}
+	if len(pending) == 0 || r.checker == nil {
+		return out, nil
+	}
+
+	found, err := r.checker.OnWhatsApp(ctx, instance, query)
+	if err != nil {
+		log.Printf("⚠️ [jid] erro ao consultar números de %s no WhatsApp: %v", instance, err)
+		return out, nil
+	}
+	exists := make(map[string]bool, len(found))
+	for _, f := range found {
+		if j, err := Parse(f, ""); err == nil {
+			exists[j.User] = true
+		}
+	}
+
+	for i, variants := range pending {
+		resolved, ttl := variants[0], unresolvedTTL
+		for _, v := range variants {
+			if exists[v] {
+				resolved, ttl = v, resolvedTTL
+				break
+			}
+		}
+		out[i].User = resolved
+		r.store(instance, variants[0], resolved, ttl)
+	}
+	return out, nil
+}
+
+func (r *Resolver) cached(instance, key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.cache[instance+"|"+key]
+	if !ok || time.Since(e.at) > e.ttl {
+		return "", false
+	}
+	return e.user, true
+}
+
+func (r *Resolver) store(instance, key, user string, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) > cacheMaxItems {
+		r.cache = make(map[string]cacheEntry)
+	}
+	r.cache[instance+"|"+key] = cacheEntry{user: user, at: time.Now(), ttl: ttl}
+}
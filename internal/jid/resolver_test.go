@@ -0,0 +1,128 @@
+package jid
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeChecker responde onWhatsApp com os jids de exists e conta as consultas.
+type fakeChecker struct {
+	exists map[string]bool
+	err    error
+	calls  int
+}
+
+func (f *fakeChecker) OnWhatsApp(ctx context.Context, instance string, jids []string) ([]string, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	var found []string
+	for _, j := range jids {
+		if f.exists[j] {
+			found = append(found, j)
+		}
+	}
+	return found, nil
+}
+
+func TestResolverResolve(t *testing.T) {
+	const (
+		withNine    = "5511987654321@s.whatsapp.net"
+		withoutNine = "551187654321@s.whatsapp.net"
+	)
+
+	tests := []struct {
+		name      string
+		raw       string
+		exists    []string
+		err       error
+		want      string
+		wantCalls int
+	}{
+		{name: "conta com o nono dígito", raw: "11987654321", exists: []string{withNine}, want: withNine, wantCalls: 1},
+		{name: "conta antiga sem o nono dígito", raw: "11987654321", exists: []string{withoutNine}, want: withoutNine, wantCalls: 1},
+		{name: "informado sem o nono dígito", raw: "+55 11 8765-4321", exists: []string{withNine}, want: withNine, wantCalls: 1},
+		{name: "nenhuma das formas existe", raw: "11987654321", want: withNine, wantCalls: 1},
+		{name: "falha na consulta", raw: "11987654321", err: errors.New("sidecar fora"), want: withNine, wantCalls: 1},
+		{name: "jid explícito não é consultado", raw: withoutNine, exists: []string{withNine}, want: withoutNine},
+		{name: "fixo não é consultado", raw: "1133334444", want: "551133334444@s.whatsapp.net"},
+		{name: "outro país não é consultado", raw: "+14155550123", want: "14155550123@s.whatsapp.net"},
+		{name: "grupo não é consultado", raw: "120363012345678901", want: "120363012345678901@g.us"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := &fakeChecker{exists: map[string]bool{}, err: tt.err}
+			for _, j := range tt.exists {
+				checker.exists[j] = true
+			}
+			r := NewResolver(checker, "55")
+
+			got, err := r.Resolve(context.Background(), "loja1", tt.raw)
+			if err != nil {
+				t.Fatalf("Resolve(%q): %v", tt.raw, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Resolve(%q) = %s, want %s", tt.raw, got, tt.want)
+			}
+			if checker.calls != tt.wantCalls {
+				t.Errorf("consultas = %d, want %d", checker.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestResolverCache(t *testing.T) {
+	checker := &fakeChecker{exists: map[string]bool{"551187654321@s.whatsapp.net": true}}
+	r := NewResolver(checker, "55")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		got, err := r.Resolve(ctx, "loja1", "11987654321")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.User != "551187654321" {
+			t.Fatalf("Resolve #%d = %s, want 551187654321", i, got)
+		}
+	}
+	if checker.calls != 1 {
+		t.Errorf("consultas = %d, want 1 (cache)", checker.calls)
+	}
+
+	// O cache é por instância
+	if _, err := r.Resolve(ctx, "loja2", "11987654321"); err != nil {
+		t.Fatal(err)
+	}
+	if checker.calls != 2 {
+		t.Errorf("consultas = %d, want 2", checker.calls)
+	}
+}
+
+func TestResolverResolveAll(t *testing.T) {
+	checker := &fakeChecker{exists: map[string]bool{
+		"5511987654321@s.whatsapp.net": true,
+		"552187654321@s.whatsapp.net":  true,
+	}}
+	r := NewResolver(checker, "55")
+
+	got, err := r.ResolveAll(context.Background(), "loja1", []string{"11987654321", "21987654321", "+14155550123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"5511987654321", "552187654321", "14155550123"}
+	for i := range want {
+		if got[i].User != want[i] {
+			t.Errorf("ResolveAll[%d] = %s, want %s", i, got[i].User, want[i])
+		}
+	}
+	if checker.calls != 1 {
+		t.Errorf("consultas = %d, want 1 (lista numa consulta só)", checker.calls)
+	}
+
+	if _, err := r.ResolveAll(context.Background(), "loja1", []string{"11987654321", "abc"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("ResolveAll com número inválido: err = %v, want ErrInvalid", err)
+	}
+}
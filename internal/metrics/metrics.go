@@ -0,0 +1,247 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gowhats"
+
+// Métricas do gateway. As funções de registro abaixo são chamadas pelos
+// pacotes instrumentados (cliente do sidecar, webhooks...).
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requisições HTTP atendidas, por rota e status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latência das requisições HTTP, por rota.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	bridgeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "bridge_request_duration_seconds",
+		Help:      "Latência das chamadas ao sidecar Node.js, por operação.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"operation"})
+
+	bridgeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bridge_errors_total",
+		Help:      "Chamadas ao sidecar com erro, por operação e código (status HTTP ou network).",
+	}, []string{"operation", "code"})
+
+	messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "Mensagens enviadas e recebidas, por instância.",
+	}, []string{"instance", "direction"})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Tentativas de entrega de webhook, por resultado (success, retry, dead_letter).",
+	}, []string{"instance", "result"})
+
+	instanceConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "instance_connected",
+		Help:      "1 quando a instância está conectada ao WhatsApp.",
+	}, []string{"instance"})
+
+	instancesConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "instances_connected",
+		Help:      "Instâncias conectadas ao WhatsApp.",
+	})
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		bridgeDuration, bridgeErrors,
+		messages, webhookDeliveries,
+		instanceConnected, instancesConnected,
+	)
+}
+
+// ============================================
+// HTTP
+// ============================================
+
+// Middleware mede as requisições pela rota (padrão com :params), para não
+// criar uma série por instância ou jid.
+func Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		if fe, ok := err.(*fiber.Error); ok {
+			status = fe.Code
+		}
+	}
+
+	route := "unmatched"
+	if r := c.Route(); r != nil && r.Path != "" && status != fiber.StatusNotFound {
+		route = r.Path
+	}
+	httpRequests.WithLabelValues(c.Method(), route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(c.Method(), route).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Handler expõe as métricas no formato do Prometheus.
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
+
+// ============================================
+// SIDECAR, WEBHOOKS E MENSAGENS
+// ============================================
+
+// ObserveBridge registra uma chamada ao sidecar. code vazio = sucesso.
+func ObserveBridge(operation, code string, d time.Duration) {
+	bridgeDuration.WithLabelValues(operation).Observe(d.Seconds())
+	if code != "" {
+		bridgeErrors.WithLabelValues(operation, code).Inc()
+	}
+}
+
+// WebhookDelivery registra o resultado de uma tentativa de entrega.
+func WebhookDelivery(instance, result string) {
+	webhookDeliveries.WithLabelValues(instance, result).Inc()
+}
+
+// Events acompanha os eventos do sidecar: mensagens por instância e estado
+// das conexões. É um listener do barramento.
+type Events struct {
+	mu        sync.Mutex
+	connected map[string]bool
+}
+
+func NewEvents() *Events {
+	return &Events{connected: make(map[string]bool)}
+}
+
+func (e *Events) HandleEvent(evt models.Event) {
+	if evt.Instance == "" {
+		return
+	}
+	switch evt.Event {
+	case "messages.upsert":
+		var upsert struct {
+			Type    string `json:"type"`
+			Message struct {
+				Key struct {
+					FromMe bool `json:"fromMe"`
+				} `json:"key"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(evt.Data, &upsert) != nil {
+			return
+		}
+		// Envios chegam como append; recebidas como notify
+		if upsert.Message.Key.FromMe {
+			messages.WithLabelValues(evt.Instance, "sent").Inc()
+		} else if upsert.Type == "notify" {
+			messages.WithLabelValues(evt.Instance, "received").Inc()
+		}
+
+	case "connection.update":
+		var u struct {
+			Connection string `json:"connection"`
+		}
+		if json.Unmarshal(evt.Data, &u) != nil || u.Connection == "" || u.Connection == "connecting" {
+			return
+		}
+		e.setConnected(evt.Instance, u.Connection == "open")
+	}
+}
+
+func (e *Events) setConnected(instance string, connected bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if connected {
+		e.connected[instance] = true
+		instanceConnected.WithLabelValues(instance).Set(1)
+	} else {
+		delete(e.connected, instance)
+		instanceConnected.WithLabelValues(instance).Set(0)
+	}
+	instancesConnected.Set(float64(len(e.connected)))
+}
+
+// ============================================
+// BANCO E FILA
+// ============================================
+
+// RegisterDB expõe as estatísticas do pool (sql.DBStats) e a profundidade
+// da fila de envio, lida do banco a cada coleta.
+func RegisterDB(db *sqlx.DB) {
+	registry.MustRegister(
+		collectors.NewDBStatsCollector(db.DB, "postgres"),
+		&queueCollector{db: db},
+	)
+}
+
+var queueDepth = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "queue", "depth"),
+	"Mensagens na fila de envio (fila_mensagens), por instância e status.",
+	[]string{"instance", "status"}, nil,
+)
+
+type queueCollector struct {
+	db *sqlx.DB
+}
+
+func (q *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepth
+}
+
+func (q *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rows []struct {
+		Instance string `db:"instance"`
+		Status   string `db:"status"`
+		Total    int    `db:"total"`
+	}
+	err := q.db.SelectContext(ctx, &rows, `
+		SELECT instance, status, COUNT(*) AS total
+		FROM fila_mensagens
+		WHERE status IN ('queued', 'sending')
+		GROUP BY instance, status
+	`)
+	if err != nil {
+		log.Printf("⚠️ [metrics] erro ao medir a fila de envio: %v", err)
+		return
+	}
+	for _, r := range rows {
+		ch <- prometheus.MustNewConstMetric(queueDepth, prometheus.GaugeValue, float64(r.Total), r.Instance, r.Status)
+	}
+}
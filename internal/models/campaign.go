@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CampaignRequest cria uma campanha. Message é o modelo enviado a cada
+// destinatário (o campo number é ignorado); {{variavel}} no texto, legenda ou
+// corpo interativo é substituída pelas variáveis do destinatário, além de
+// {{number}}.
+type CampaignRequest struct {
+	Name        string              `json:"name"`
+	Message     SendMessageRequest  `json:"message"`
+	Recipients  []CampaignRecipient `json:"recipients,omitempty"`
+	MinInterval int                 `json:"min_interval,omitempty"` // segundos entre envios (padrão 8)
+	MaxInterval int                 `json:"max_interval,omitempty"` // segundos entre envios (padrão 20)
+	DailyLimit  int                 `json:"daily_limit,omitempty"`  // envios por dia na instância (0 = sem limite)
+	Timezone    string              `json:"timezone,omitempty"`     // define a virada do limite diário (padrão UTC)
+	StartAt     *time.Time          `json:"start_at,omitempty"`
+}
+
+type CampaignRecipient struct {
+	Number    string            `json:"number"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
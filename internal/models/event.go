@@ -0,0 +1,16 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event é um evento emitido pelo sidecar Node.js (messages.upsert,
+// connection.update, contacts.upsert, groups.update, ...).
+type Event struct {
+	ID        string          `json:"id"`
+	Instance  string          `json:"instance"`
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"timestamp"`
+}
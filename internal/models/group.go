@@ -1,22 +1,51 @@
-package models
-
-type CreateGroupRequest struct {
-	Subject      string   `json:"subject"`
-	Participants []string `json:"participants"`
-	Description  string   `json:"description,omitempty"`
-}
-
-type GroupActionRequest struct {
-	GroupID      string   `json:"group_id"`
-	Participants []string `json:"participants,omitempty"`
-	Action       string   `json:"action"`
-}
-
-type GroupInfo struct {
-	ID           string   `json:"id"`
-	Subject      string   `json:"subject"`
-	Owner        string   `json:"owner"`
-	Participants []string `json:"participants"`
-	Admins       []string `json:"admins"`
-	Creation     int64    `json:"creation"`
-}
\ No newline at end of file
+package models
+
+type CreateGroupRequest struct {
+	Subject      string   `json:"subject"`
+	Participants []string `json:"participants"`
+	Description  string   `json:"description,omitempty"`
+}
+
+type GroupActionRequest struct {
+	GroupID      string   `json:"group_id"`
+	Participants []string `json:"participants,omitempty"`
+	Action       string   `json:"action"` // add, remove, promote ou demote
+}
+
+type UpdateGroupRequest struct {
+	Subject       *string `json:"subject,omitempty"`
+	Description   *string `json:"description,omitempty"`
+	PictureURL    string  `json:"picture_url,omitempty"`
+	PictureBase64 string  `json:"picture_base64,omitempty"`
+}
+
+type GroupSettingsRequest struct {
+	Announce *bool `json:"announce,omitempty"` // só admins enviam mensagens
+	Locked   *bool `json:"locked,omitempty"`   // só admins editam dados do grupo
+}
+
+type JoinGroupRequest struct {
+	Code string `json:"code"` // código ou link https://chat.whatsapp.com/...
+}
+
+type GroupInfo struct {
+	ID           string   `json:"id"`
+	Subject      string   `json:"subject"`
+	Description  string   `json:"description,omitempty"`
+	Owner        string   `json:"owner"`
+	Participants []string `json:"participants"`
+	Admins       []string `json:"admins"`
+	Creation     int64    `json:"creation"`
+	Announce     bool     `json:"announce"`
+	Locked       bool     `json:"locked"`
+}
+
+type GroupInvite struct {
+	Code string `json:"code"`
+	Link string `json:"link"`
+}
+
+type ParticipantResult struct {
+	Jid    string `json:"jid"`
+	Status string `json:"status"` // código devolvido pelo WhatsApp ("200" = ok)
+}
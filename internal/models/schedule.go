@@ -0,0 +1,12 @@
+package models
+
+// ScheduleRequest cria um agendamento. Informe "at" para envio único ou
+// "cron" (5 campos, ex.: "0 9 * * 1-5") para envio recorrente. "at" aceita
+// RFC 3339 ou "2006-01-02T15:04:05", interpretado no timezone informado.
+type ScheduleRequest struct {
+	Name     string             `json:"name"`
+	At       string             `json:"at,omitempty"`
+	Cron     string             `json:"cron,omitempty"`
+	Timezone string             `json:"timezone,omitempty"` // IANA, ex.: America/Sao_Paulo (padrão UTC)
+	Message  SendMessageRequest `json:"message"`
+}
@@ -1,67 +1,165 @@
-package models
-
-type InstanceSettings struct {
-	RejectCalls  bool `json:"reject_calls"`
-	IgnoreGroups bool `json:"ignore_groups"`
-	AlwaysOnline bool `json:"always_online"`
-	ReadMessages bool `json:"read_messages"`
-	SyncHistory  bool `json:"sync_history"`
-	ReadStatus   bool `json:"read_status"`
-}
-
-type EventsConfig struct {
-	Webhook   WebhookConfig  `json:"webhook"`
-	RabbitMQ  RabbitMQConfig `json:"rabbitmq"`
-	SQS       SQSConfig      `json:"sqs"`
-	WebSocket bool           `json:"websocket_enabled"`
-}
-
-type WebhookConfig struct {
-	Enabled bool   `json:"enabled"`
-	URL     string `json:"url"`
-}
-
-type RabbitMQConfig struct {
-	Enabled bool   `json:"enabled"`
-	URI     string `json:"uri"`
-	Queue   string `json:"queue"`
-}
-
-type SQSConfig struct {
-	Enabled   bool   `json:"enabled"`
-	Region    string `json:"region"`
-	AccessKey string `json:"access_key"`
-	SecretKey string `json:"secret_key"`
-}
-
-type IntegrationsConfig struct {
-	Typebot  TypebotConfig  `json:"typebot"`
-	Chatwoot ChatwootConfig `json:"chatwoot"`
-	OpenAI   OpenAIConfig   `json:"openai"`
-	Dify     DifyConfig     `json:"dify"`
-}
-
-type TypebotConfig struct {
-	Enabled bool   `json:"enabled"`
-	URL     string `json:"url"`
-	Typebot string `json:"typebot_name"`
-}
-
-type ChatwootConfig struct {
-	Enabled   bool   `json:"enabled"`
-	AccountID string `json:"account_id"`
-	Token     string `json:"token"`
-	URL       string `json:"url"`
-}
-
-type OpenAIConfig struct {
-	Enabled bool   `json:"enabled"`
-	ApiKey  string `json:"api_key"`
-	Model   string `json:"model"`
-}
-
-type DifyConfig struct {
-	Enabled bool   `json:"enabled"`
-	ApiKey  string `json:"api_key"`
-	URL     string `json:"url"`
-}
\ No newline at end of file
+package models
+
+type InstanceSettings struct {
+	RejectCalls       bool   `json:"reject_calls"`
+	RejectCallMessage string `json:"reject_call_message"` // resposta enviada a quem ligou (opcional)
+	IgnoreGroups      bool   `json:"ignore_groups"`
+	AlwaysOnline      bool   `json:"always_online"`
+	ReadMessages      bool   `json:"read_messages"`
+	SyncHistory       bool   `json:"sync_history"`
+	ReadStatus        bool   `json:"read_status"`
+}
+
+// DefaultInstanceSettings reproduz o comportamento do sidecar para instâncias
+// que nunca foram configuradas.
+func DefaultInstanceSettings() InstanceSettings {
+	return InstanceSettings{SyncHistory: true}
+}
+
+type EventsConfig struct {
+	Webhook   WebhookConfig  `json:"webhook"`
+	RabbitMQ  RabbitMQConfig `json:"rabbitmq"`
+	SQS       SQSConfig      `json:"sqs"`
+	WebSocket bool           `json:"websocket_enabled"`
+}
+
+type WebhookConfig struct {
+	Enabled bool     `json:"enabled"`
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret,omitempty"` // chave do HMAC-SHA256 (vazio = global)
+	Events  []string `json:"events,omitempty"` // vazio = todos os eventos
+
+	// AllowInternal libera a rede interna na entrega; é gravado pelo gateway
+	// (URL salva por um super admin), nunca lido do corpo
+	AllowInternal bool `json:"-"`
+}
+
+type RabbitMQConfig struct {
+	Enabled bool     `json:"enabled"`
+	URI     string   `json:"uri"`
+	Queue   string   `json:"queue"`
+	Events  []string `json:"events,omitempty"` // vazio = todos os eventos
+}
+
+type SQSConfig struct {
+	Enabled   bool     `json:"enabled"`
+	QueueURL  string   `json:"queue_url"` // AWS ou compatível (ElasticMQ, LocalStack)
+	Region    string   `json:"region"`
+	AccessKey string   `json:"access_key"`
+	SecretKey string   `json:"secret_key"`
+	Events    []string `json:"events,omitempty"`
+
+	// Gravada por um super admin: pode apontar para a rede interna. Definido
+	// pelo gateway a cada gravação, nunca pelo corpo da requisição
+	AllowInternal bool `json:"allow_internal,omitempty"`
+}
+
+// DefaultEventsConfig vale para instâncias sem eventos configurados: só o
+// stream WebSocket fica ligado.
+func DefaultEventsConfig() EventsConfig {
+	return EventsConfig{WebSocket: true}
+}
+
+type IntegrationsConfig struct {
+	Typebot  TypebotConfig  `json:"typebot"`
+	Chatwoot ChatwootConfig `json:"chatwoot"`
+	OpenAI   OpenAIConfig   `json:"openai"`
+	Dify     DifyConfig     `json:"dify"`
+	Triggers TriggersConfig `json:"triggers"`
+}
+
+// TriggersConfig decide qual bot atende cada mensagem recebida. As regras
+// são avaliadas em ordem e a primeira que casar escolhe o bot; sem regras,
+// atende o primeiro bot habilitado (typebot, dify, openai) em chats privados.
+type TriggersConfig struct {
+	Rules           []TriggerRule `json:"rules"`
+	StopWords       []string      `json:"stop_words,omitempty"`       // passam o chat para atendimento humano
+	HandoffMessage  string        `json:"handoff_message,omitempty"`  // enviada ao contato na passagem
+	HandoffMinutes  int           `json:"handoff_minutes,omitempty"`  // 0 = até ser liberado
+	DebounceSeconds int           `json:"debounce_seconds,omitempty"` // junta mensagens seguidas do contato
+}
+
+type TriggerRule struct {
+	Name string `json:"name,omitempty"`
+	Bot  string `json:"bot"` // typebot, openai, dify ou none (ninguém responde)
+
+	Keywords         []string       `json:"keywords,omitempty"` // a mensagem contém uma delas
+	Regex            string         `json:"regex,omitempty"`
+	FirstMessageOnly bool           `json:"first_message_only,omitempty"` // primeira conversa do contato
+	BusinessHours    *BusinessHours `json:"business_hours,omitempty"`
+	Chat             string         `json:"chat,omitempty"`     // private (padrão), group ou any
+	Tags             []string       `json:"tags,omitempty"`     // contato com ao menos uma das tags
+	NoAgent          bool           `json:"no_agent,omitempty"` // sem agente atribuído no Chatwoot
+}
+
+// BusinessHours casa dentro do expediente (ou fora, com Outside).
+type BusinessHours struct {
+	Timezone string `json:"timezone,omitempty"` // padrão America/Sao_Paulo
+	Days     []int  `json:"days,omitempty"`     // 0 = domingo ... 6 = sábado; padrão seg-sex
+	Start    string `json:"start"`              // "08:00"
+	End      string `json:"end"`                // "18:00"
+	Outside  bool   `json:"outside,omitempty"`
+}
+
+type TypebotConfig struct {
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"`
+	Typebot string `json:"typebot_name"` // public id do fluxo publicado
+
+	TriggerType    string   `json:"trigger_type,omitempty"`     // all (padrão) ou keyword
+	Keywords       []string `json:"keywords,omitempty"`         // iniciam o fluxo quando trigger_type = keyword
+	StopKeyword    string   `json:"stop_keyword,omitempty"`     // encerra a sessão do contato (ex.: #sair)
+	ExpireMinutes  int      `json:"expire_minutes,omitempty"`   // sessão ociosa expira; 0 = nunca
+	ListButtonText string   `json:"list_button_text,omitempty"` // botão das listas de opções
+
+	// URL gravada por um super admin: pode apontar para a rede interna.
+	// Definido pelo gateway, nunca pelo corpo da requisição
+	AllowInternal bool `json:"allow_internal,omitempty"`
+}
+
+type ChatwootConfig struct {
+	Enabled   bool   `json:"enabled"`
+	AccountID string `json:"account_id"`
+	Token     string `json:"token"`
+	URL       string `json:"url"`
+	InboxName string `json:"inbox_name,omitempty"` // padrão: "WhatsApp <instância>"
+	InboxID   int    `json:"inbox_id,omitempty"`   // preenchido ao vincular a inbox
+
+	// URL gravada por um super admin: pode apontar para a rede interna.
+	// Definido pelo gateway, nunca pelo corpo da requisição
+	AllowInternal bool `json:"allow_internal,omitempty"`
+}
+
+type OpenAIConfig struct {
+	Enabled bool   `json:"enabled"`
+	ApiKey  string `json:"api_key"`
+	Model   string `json:"model"`
+
+	BaseURL      string   `json:"base_url,omitempty"` // qualquer API compatível; padrão https://api.openai.com/v1
+	SystemPrompt string   `json:"system_prompt,omitempty"`
+	MaxHistory   int      `json:"max_history,omitempty"` // mensagens do chat no contexto; padrão 10
+	MaxTokens    int      `json:"max_tokens,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	RateLimit    int      `json:"rate_limit_per_minute,omitempty"` // respostas por chat por minuto; padrão 5
+
+	// base_url gravada por um super admin: pode apontar para a rede interna.
+	// Definido pelo gateway, nunca pelo corpo da requisição
+	AllowInternal bool `json:"allow_internal,omitempty"`
+}
+
+type DifyConfig struct {
+	Enabled bool   `json:"enabled"`
+	ApiKey  string `json:"api_key"`
+	URL     string `json:"url"` // base da API, ex.: https://api.dify.ai/v1
+
+	AppType       string   `json:"app_type,omitempty"`       // chat (padrão: chatbot, agente, chatflow) ou workflow
+	InputVariable string   `json:"input_variable,omitempty"` // workflow: variável que recebe a mensagem; padrão "query"
+	TriggerType   string   `json:"trigger_type,omitempty"`   // all (padrão), keyword ou no_agent
+	Keywords      []string `json:"keywords,omitempty"`       // iniciam a conversa quando trigger_type = keyword
+	StopKeyword   string   `json:"stop_keyword,omitempty"`   // encerra a conversa do contato
+	ExpireMinutes int      `json:"expire_minutes,omitempty"` // conversa ociosa recomeça do zero; 0 = nunca
+
+	// URL gravada por um super admin: pode apontar para a rede interna.
+	// Definido pelo gateway, nunca pelo corpo da requisição
+	AllowInternal bool `json:"allow_internal,omitempty"`
+}
@@ -0,0 +1,427 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/ratelimit"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+// Status possíveis de um job da fila.
+const (
+	StatusQueued    = "queued"
+	StatusSending   = "sending"
+	StatusSent      = "sent"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var ErrNotFound = errors.New("job não encontrado")
+
+type Job struct {
+	ID           string          `db:"id" json:"id"`
+	Instance     string          `db:"instance" json:"instance"`
+	Numero       string          `db:"numero" json:"number"`
+	Tipo         string          `db:"tipo" json:"type"`
+	Payload      json.RawMessage `db:"payload" json:"-"`
+	Status       string          `db:"status" json:"status"`
+	Tentativas   int             `db:"tentativas" json:"attempts"`
+	AgendadoPara time.Time       `db:"agendado_para" json:"scheduledAt"`
+	MessageID    *string         `db:"message_id" json:"messageId"`
+	UltimoErro   *string         `db:"ultimo_erro" json:"error"`
+	ApiKeyID     *int            `db:"api_key_id" json:"-"`
+	CotaDia      *time.Time      `db:"cota_dia" json:"-"`
+	CriadoEm     time.Time       `db:"criado_em" json:"createdAt"`
+	EnviadoEm    *time.Time      `db:"enviado_em" json:"sentAt"`
+}
+
+const jobColumns = `id, instance, numero, tipo, payload, status, tentativas, agendado_para,
+	message_id, ultimo_erro, api_key_id, cota_dia, criado_em, enviado_em`
+
+type Options struct {
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	SendTimeout  time.Duration
+}
+
+// Queue é a fila durável de envio (tabela fila_mensagens). Cada instância tem
+// no máximo um worker ativo, que envia os jobs vencidos em ordem de
+// agendamento e criação, retentando falhas transitórias do sidecar. O job em
+// envio fica reservado até locked_until; só reservas vencidas voltam para a
+// fila, então réplicas e reinícios não reenviam o que outro processo envia.
+// Jobs com key contam nas cotas de mensagens ao entrar na fila e são
+// devolvidos à cota se terminarem em failed ou cancelled.
+type Queue struct {
+	db      *sqlx.DB
+	service *whatsapp.Service
+	quota   *ratelimit.Counter
+	opts    Options
+	wake    chan struct{}
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+func New(db *sqlx.DB, service *whatsapp.Service, opts Options) *Queue {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 2 * time.Second
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = time.Minute
+	}
+	if opts.SendTimeout <= 0 {
+		opts.SendTimeout = 60 * time.Second
+	}
+
+	return &Queue{
+		db:      db,
+		service: service,
+		quota:   ratelimit.NewCounter(db),
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+		active:  make(map[string]bool),
+	}
+}
+
+// Start sobe o loop de despacho, que também devolve à fila os jobs cuja
+// reserva venceu (processo que caiu no meio do envio).
+func (q *Queue) Start(ctx context.Context) {
+	q.reclaim(ctx)
+	go q.loop(ctx)
+}
+
+// lease é por quanto tempo um job em envio fica reservado. Cada tentativa
+// renova a reserva, então ela cobre um envio e a espera até o próximo.
+func (q *Queue) lease() int {
+	return int((q.opts.SendTimeout + q.opts.MaxDelay + 30*time.Second).Seconds())
+}
+
+// reclaim devolve à fila os jobs em "sending" com a reserva vencida. Jobs sem
+// locked_until são de antes da reserva existir.
+func (q *Queue) reclaim(ctx context.Context) {
+	res, err := q.db.ExecContext(ctx, `
+		UPDATE fila_mensagens SET status = $1, locked_until = NULL, atualizado_em = NOW()
+		WHERE status = $2 AND (locked_until IS NULL OR locked_until < NOW())
+	`, StatusQueued, StatusSending)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("⚠️ [fila] erro ao recuperar jobs: %v", err)
+		}
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("🔄 [fila] %d jobs com reserva vencida voltaram para a fila", n)
+	}
+}
+
+// Enqueue grava o envio e devolve o job imediatamente. Options.Delay e
+// Options.ScheduledAt definem quando o envio fica elegível. Com apiKeyID o
+// envio conta nas cotas da key e da instância; cota esgotada devolve
+// *ratelimit.Exceeded e nada é gravado.
+func (q *Queue) Enqueue(ctx context.Context, instance string, req models.SendMessageRequest, apiKeyID *int) (*Job, error) {
+	return q.EnqueueWithID(ctx, uuid.NewString(), instance, req, apiKeyID)
+}
+
+// EnqueueWithID é o Enqueue com o id do job escolhido por quem chama, que
+// assim pode gravá-lo antes de enfileirar (ex.: destinatários de campanha).
+func (q *Queue) EnqueueWithID(ctx context.Context, id, instance string, req models.SendMessageRequest, apiKeyID *int) (*Job, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	runAt := time.Now()
+	if req.Options != nil {
+		if req.Options.ScheduledAt != nil && req.Options.ScheduledAt.After(runAt) {
+			runAt = *req.Options.ScheduledAt
+		}
+		if req.Options.Delay > 0 {
+			runAt = runAt.Add(time.Duration(req.Options.Delay) * time.Second)
+		}
+	}
+
+	var quotaDay *time.Time
+	if apiKeyID != nil {
+		day, err := q.quota.Reserve(ctx, *apiKeyID, instance)
+		if err != nil {
+			return nil, err
+		}
+		if !day.IsZero() {
+			quotaDay = &day
+		}
+	}
+
+	var job Job
+	err = q.db.GetContext(ctx, &job, `
+		INSERT INTO fila_mensagens (id, instance, numero, tipo, payload, agendado_para, api_key_id, cota_dia)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8::date)
+		RETURNING `+jobColumns,
+		id, instance, req.Number, req.Type, string(payload), runAt, apiKeyID, dateValue(quotaDay))
+	if err != nil {
+		q.refund(&Job{Instance: instance, ApiKeyID: apiKeyID, CotaDia: quotaDay})
+		return nil, err
+	}
+
+	q.notify()
+	return &job, nil
+}
+
+func (q *Queue) Get(ctx context.Context, id string) (*Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	var job Job
+	err := q.db.GetContext(ctx, &job, `SELECT `+jobColumns+` FROM fila_mensagens WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Cancel cancela um job que ainda não começou a ser enviado.
+func (q *Queue) Cancel(ctx context.Context, id string) error {
+	var job Job
+	err := q.db.GetContext(ctx, &job, `
+		UPDATE fila_mensagens SET status = $2, atualizado_em = NOW()
+		WHERE id = $1 AND status = $3
+		RETURNING `+jobColumns,
+		id, StatusCancelled, StatusQueued)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	q.refund(&job)
+	return nil
+}
+
+// Depth devolve quantos jobs aguardam envio.
+func (q *Queue) Depth(ctx context.Context) (int, error) {
+	var n int
+	err := q.db.GetContext(ctx, &n, `SELECT COUNT(*) FROM fila_mensagens WHERE status IN ($1, $2)`, StatusQueued, StatusSending)
+	return n, err
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) loop(ctx context.Context) {
+	ticker := time.NewTicker(q.opts.PollInterval)
+	defer ticker.Stop()
+	reclaim := time.NewTicker(30 * time.Second)
+	defer reclaim.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reclaim.C:
+			q.reclaim(ctx)
+		case <-ticker.C:
+		case <-q.wake:
+		}
+		q.dispatch(ctx)
+	}
+}
+
+// dispatch sobe um worker para cada instância com jobs vencidos.
+func (q *Queue) dispatch(ctx context.Context) {
+	var instances []string
+	err := q.db.SelectContext(ctx, &instances, `
+		SELECT DISTINCT instance FROM fila_mensagens
+		WHERE status = $1 AND agendado_para <= NOW()
+	`, StatusQueued)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("⚠️ [fila] erro ao buscar jobs: %v", err)
+		}
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, inst := range instances {
+		if q.active[inst] {
+			continue
+		}
+		q.active[inst] = true
+		go q.runInstance(ctx, inst)
+	}
+}
+
+func (q *Queue) runInstance(ctx context.Context, instance string) {
+	defer func() {
+		q.mu.Lock()
+		delete(q.active, instance)
+		q.mu.Unlock()
+	}()
+
+	for ctx.Err() == nil {
+		job, err := q.claim(ctx, instance)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				log.Printf("⚠️ [fila] erro ao reservar job de %s: %v", instance, err)
+			}
+			return
+		}
+		q.process(ctx, job)
+	}
+}
+
+// claim reserva o próximo job vencido da instância, respeitando a ordem. Não
+// reserva enquanto outra réplica tem um job da instância em envio.
+func (q *Queue) claim(ctx context.Context, instance string) (*Job, error) {
+	var job Job
+	err := q.db.GetContext(ctx, &job, `
+		UPDATE fila_mensagens
+		SET status = $2, locked_until = NOW() + $4 * INTERVAL '1 second', atualizado_em = NOW()
+		WHERE id = (
+			SELECT id FROM fila_mensagens
+			WHERE instance = $1 AND status = $3 AND agendado_para <= NOW()
+			  AND NOT EXISTS (
+				SELECT 1 FROM fila_mensagens
+				WHERE instance = $1 AND status = $2 AND locked_until >= NOW()
+			  )
+			ORDER BY agendado_para, criado_em
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		instance, StatusSending, StatusQueued, q.lease())
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// process envia o job. Falhas transitórias são retentadas ali mesmo, com
+// backoff, para que as mensagens seguintes da instância não passem na frente.
+func (q *Queue) process(ctx context.Context, job *Job) {
+	var req models.SendMessageRequest
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		q.finish(job, StatusFailed, "", "payload inválido: "+err.Error())
+		return
+	}
+	// O atraso já foi aplicado no agendamento
+	if req.Options != nil {
+		req.Options.Delay = 0
+		req.Options.ScheduledAt = nil
+	}
+
+	for {
+		job.Tentativas++
+		sendCtx, cancel := context.WithTimeout(ctx, q.opts.SendTimeout)
+		msgID, err := q.service.SendMessage(sendCtx, job.Instance, req)
+		cancel()
+
+		if err == nil {
+			q.finish(job, StatusSent, msgID, "")
+			return
+		}
+		if ctx.Err() != nil {
+			// Desligando: o envio foi interrompido, não falhou
+			q.requeue(job)
+			return
+		}
+		if !whatsapp.IsTransient(err) || job.Tentativas >= q.opts.MaxAttempts {
+			q.finish(job, StatusFailed, "", err.Error())
+			return
+		}
+
+		// Sem renovar a reserva, o job segue com ela até vencer e ser
+		// recuperado; a tentativa continua mesmo assim
+		if _, dbErr := q.db.Exec(`
+			UPDATE fila_mensagens
+			SET tentativas = $2, ultimo_erro = $3, locked_until = NOW() + $4 * INTERVAL '1 second', atualizado_em = NOW()
+			WHERE id = $1
+		`, job.ID, job.Tentativas, err.Error(), q.lease()); dbErr != nil {
+			log.Printf("⚠️ [fila] erro ao registrar tentativa %d do job %s: %v", job.Tentativas, job.ID, dbErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			q.requeue(job)
+			return
+		case <-time.After(q.backoff(job.Tentativas)):
+		}
+	}
+}
+
+// requeue devolve à fila um job interrompido pelo desligamento; ele é retomado
+// na próxima execução. Se a gravação falhar, volta quando a reserva vencer.
+func (q *Queue) requeue(job *Job) {
+	if _, err := q.db.Exec(`
+		UPDATE fila_mensagens SET status = $2, tentativas = $3, locked_until = NULL, atualizado_em = NOW() WHERE id = $1
+	`, job.ID, StatusQueued, job.Tentativas); err != nil {
+		log.Printf("⚠️ [fila] erro ao devolver o job %s à fila: %v", job.ID, err)
+	}
+}
+
+func (q *Queue) finish(job *Job, status, msgID, errMsg string) {
+	_, err := q.db.Exec(`
+		UPDATE fila_mensagens
+		SET status = $2, tentativas = $3, message_id = NULLIF($4, ''), ultimo_erro = NULLIF($5, ''),
+		    enviado_em = CASE WHEN $2 = 'sent' THEN NOW() ELSE enviado_em END,
+		    locked_until = NULL, atualizado_em = NOW()
+		WHERE id = $1
+	`, job.ID, status, job.Tentativas, msgID, errMsg)
+	if err != nil {
+		log.Printf("❌ [fila] erro ao finalizar job %s: %v", job.ID, err)
+		return
+	}
+	if status == StatusFailed {
+		q.refund(job)
+	}
+}
+
+// refund devolve à cota o envio de um job que não foi enviado.
+func (q *Queue) refund(job *Job) {
+	if job.ApiKeyID == nil || job.CotaDia == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.quota.Refund(ctx, *job.ApiKeyID, job.Instance, *job.CotaDia); err != nil {
+		log.Printf("⚠️ [cotas] erro ao devolver envio da key %d (%s): %v", *job.ApiKeyID, job.Instance, err)
+	}
+}
+
+func dateValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+func (q *Queue) backoff(attempt int) time.Duration {
+	wait := q.opts.BaseDelay << uint(attempt-1)
+	if wait <= 0 || wait > q.opts.MaxDelay {
+		wait = q.opts.MaxDelay
+	}
+	return wait
+}
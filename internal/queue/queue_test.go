@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/dbtest"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/ratelimit"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+func TestLeaseCoversSendAndBackoff(t *testing.T) {
+	q := New(nil, nil, Options{SendTimeout: 10 * time.Second, MaxDelay: 20 * time.Second})
+	if got := q.lease(); got != 60 {
+		t.Errorf("lease() = %ds, want 60s (envio + maior espera + folga)", got)
+	}
+
+	q = New(nil, nil, Options{BaseDelay: time.Second, MaxDelay: 5 * time.Second})
+	var waits []time.Duration
+	for attempt := 1; attempt <= 5; attempt++ {
+		waits = append(waits, q.backoff(attempt))
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("backoff = %v, want %v", waits, want)
+		}
+	}
+}
+
+// enqueueDue grava um texto e o deixa vencido pelo relógio do banco.
+func enqueueDue(t *testing.T, q *Queue, instance string, keyID *int) *Job {
+	t.Helper()
+	job, err := q.Enqueue(context.Background(), instance, models.SendMessageRequest{Number: "5511987654321", Type: "text", Text: "oi"}, keyID)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	q.db.MustExec(`UPDATE fila_mensagens SET agendado_para = criado_em - INTERVAL '1 minute' WHERE id = $1`, job.ID)
+	return job
+}
+
+func jobStatus(t *testing.T, db *sqlx.DB, id string) string {
+	t.Helper()
+	var status string
+	if err := db.Get(&status, `SELECT status FROM fila_mensagens WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestClaimHoldsLeaseUntilItExpires(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db, "fila_mensagens")
+	q := New(db, nil, Options{})
+	ctx := context.Background()
+
+	first := enqueueDue(t, q, instance, nil)
+	enqueueDue(t, q, instance, nil)
+
+	claimed, err := q.claim(ctx, instance)
+	if err != nil || claimed.ID != first.ID || claimed.Status != StatusSending {
+		t.Fatalf("claim() = %+v, %v; want o primeiro job em sending", claimed, err)
+	}
+
+	// Com a reserva valendo, nenhuma réplica pega o próximo job da instância
+	if _, err := q.claim(ctx, instance); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("segundo claim com reserva ativa: err = %v, want sql.ErrNoRows", err)
+	}
+	q.reclaim(ctx)
+	if got := jobStatus(t, db, first.ID); got != StatusSending {
+		t.Fatalf("reclaim devolveu job com reserva ativa: status = %s", got)
+	}
+
+	// Reserva vencida (processo caiu no meio do envio): volta para a fila e
+	// é o próximo a sair, na ordem original
+	db.MustExec(`UPDATE fila_mensagens SET locked_until = NOW() - INTERVAL '1 second' WHERE id = $1`, first.ID)
+	q.reclaim(ctx)
+	if got := jobStatus(t, db, first.ID); got != StatusQueued {
+		t.Fatalf("status após reclaim = %s, want queued", got)
+	}
+	claimed, err = q.claim(ctx, instance)
+	if err != nil || claimed.ID != first.ID {
+		t.Fatalf("claim após reclaim = %+v, %v; want o primeiro job", claimed, err)
+	}
+}
+
+func TestQuotaRefundedWhenJobIsNotSent(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db, "fila_mensagens", "uso_mensagens")
+	keyID := dbtest.APIKey(t, db, 2)
+	q := New(db, nil, Options{})
+	ctx := context.Background()
+
+	used := func() int {
+		t.Helper()
+		var n int
+		if err := db.Get(&n, `SELECT COALESCE(SUM(mensagens), 0) FROM uso_mensagens WHERE api_key_id = $1 AND instance = $2`, keyID, instance); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	cancelled := enqueueDue(t, q, instance, &keyID)
+	failed := enqueueDue(t, q, instance, &keyID)
+	var exceeded *ratelimit.Exceeded
+	if _, err := q.Enqueue(ctx, instance, models.SendMessageRequest{Number: "5511987654321", Type: "text", Text: "oi"}, &keyID); !errors.As(err, &exceeded) {
+		t.Fatalf("terceiro envio com limite 2: err = %v, want *ratelimit.Exceeded", err)
+	}
+	if n := used(); n != 2 {
+		t.Fatalf("uso = %d, want 2", n)
+	}
+
+	if err := q.Cancel(ctx, cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := used(); n != 1 {
+		t.Errorf("uso após cancelar = %d, want 1", n)
+	}
+
+	q.finish(failed, StatusFailed, "", "invalid jid")
+	if n := used(); n != 0 {
+		t.Errorf("uso após falha = %d, want 0", n)
+	}
+
+	sent := enqueueDue(t, q, instance, &keyID)
+	q.finish(sent, StatusSent, "3EB0ABC", "")
+	if n := used(); n != 1 {
+		t.Errorf("uso após envio = %d, want 1 (enviado não é devolvido)", n)
+	}
+}
+
+// fakeSidecar responde conectado e devolve, a cada envio, o próximo status
+// da lista (o último se repete).
+func fakeSidecar(t *testing.T, statuses ...int) (*whatsapp.Service, *int32) {
+	t.Helper()
+	var sends int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			io.WriteString(w, `{"status":"connected"}`)
+			return
+		}
+		n := int(atomic.AddInt32(&sends, 1))
+		status := statuses[min(n, len(statuses))-1]
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			io.WriteString(w, `{"status":"success","key":{"id":"3EB0ABC"}}`)
+		} else {
+			io.WriteString(w, `{"error":"falha simulada"}`)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	svc := whatsapp.NewService(whatsapp.NewBaileysClient(srv.URL, "", nil))
+	svc.Numbers = nil
+	return svc, &sends
+}
+
+func TestProcessRetriesOnlyTransientFailures(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db, "fila_mensagens")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		statuses []int
+		status   string
+		attempts int
+	}{
+		{name: "503 e depois sucesso", statuses: []int{503, 200}, status: StatusSent, attempts: 2},
+		{name: "400 não é retentado", statuses: []int{400}, status: StatusFailed, attempts: 1},
+		{name: "esgota as tentativas", statuses: []int{503}, status: StatusFailed, attempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, sends := fakeSidecar(t, tt.statuses...)
+			q := New(db, svc, Options{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+			enqueueDue(t, q, instance, nil)
+			claimed, err := q.claim(ctx, instance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q.process(ctx, claimed)
+
+			job, err := q.Get(ctx, claimed.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != tt.status || job.Tentativas != tt.attempts || int(atomic.LoadInt32(sends)) != tt.attempts {
+				t.Errorf("status %s, %d tentativas, %d envios; want %s, %d", job.Status, job.Tentativas, *sends, tt.status, tt.attempts)
+			}
+			if (job.Status == StatusSent) != (job.MessageID != nil) {
+				t.Errorf("message_id = %v com status %s", job.MessageID, job.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maxIdleBuckets é o tamanho a partir do qual os buckets ociosos são
+// descartados.
+const maxIdleBuckets = 10000
+
+// Result é o resultado de Take, usado para montar os cabeçalhos X-RateLimit-*.
+type Result struct {
+	Allowed    bool
+	Limit      int           // capacidade do bucket
+	Remaining  int           // tokens restantes após a requisição
+	Reset      time.Duration // até o bucket encher de novo
+	RetryAfter time.Duration // até o próximo token, quando bloqueado
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter é um conjunto de token buckets em memória, um por chave (key da
+// API, instância...). Cada chamada informa a taxa, então mudar o limite no
+// banco vale na requisição seguinte.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket)}
+}
+
+// Take consome um token do bucket da chave. rate é a reposição por segundo e
+// a capacidade é max(1, rate) — permite rajadas de até um segundo.
+func (l *Limiter) Take(key string, rate float64) Result {
+	burst := math.Max(1, math.Floor(rate))
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buckets) > maxIdleBuckets {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: int(burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / rate)
+	return res
+}
+
+// sweep descarta os buckets sem uso há mais de um minuto.
+func (l *Limiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > time.Minute {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterTake(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      float64
+		takes     int
+		allowed   int
+		wantLimit int
+	}{
+		{name: "rajada igual à taxa", rate: 5, takes: 8, allowed: 5, wantLimit: 5},
+		{name: "taxa fracionária arredonda para baixo", rate: 2.7, takes: 4, allowed: 2, wantLimit: 2},
+		{name: "taxa abaixo de 1 permite uma", rate: 0.5, takes: 3, allowed: 1, wantLimit: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter()
+			allowed := 0
+			var last Result
+			for i := 0; i < tt.takes; i++ {
+				last = l.Take("key:1", tt.rate)
+				if last.Allowed {
+					allowed++
+				}
+				if last.Limit != tt.wantLimit {
+					t.Fatalf("Limit = %d, want %d", last.Limit, tt.wantLimit)
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("permitidas = %d, want %d", allowed, tt.allowed)
+			}
+			if last.Allowed || last.Remaining != 0 {
+				t.Errorf("última = %+v, want bloqueada sem tokens", last)
+			}
+			if last.RetryAfter <= 0 || last.RetryAfter > time.Duration(float64(time.Second)/tt.rate) {
+				t.Errorf("RetryAfter = %s fora de (0, 1/rate]", last.RetryAfter)
+			}
+			if last.Reset < last.RetryAfter {
+				t.Errorf("Reset = %s menor que RetryAfter = %s", last.Reset, last.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestLimiterRefill(t *testing.T) {
+	tests := []struct {
+		name          string
+		rate          float64
+		elapsed       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+	}{
+		{name: "meio token não libera", rate: 2, elapsed: 250 * time.Millisecond, wantAllowed: false},
+		{name: "um token libera", rate: 2, elapsed: 600 * time.Millisecond, wantAllowed: true},
+		{name: "reposição limitada à capacidade", rate: 2, elapsed: time.Hour, wantAllowed: true, wantRemaining: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter()
+			for l.Take("k", tt.rate).Allowed {
+			}
+			// Volta o relógio do bucket em vez de dormir
+			l.buckets["k"].last = l.buckets["k"].last.Add(-tt.elapsed)
+
+			res := l.Take("k", tt.rate)
+			if res.Allowed != tt.wantAllowed {
+				t.Fatalf("Allowed = %v, want %v", res.Allowed, tt.wantAllowed)
+			}
+			if res.Remaining != tt.wantRemaining {
+				t.Errorf("Remaining = %d, want %d", res.Remaining, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	l := NewLimiter()
+	if !l.Take("key:1", 1).Allowed {
+		t.Fatal("primeira de key:1 bloqueada")
+	}
+	if l.Take("key:1", 1).Allowed {
+		t.Fatal("segunda de key:1 permitida")
+	}
+	if !l.Take("instance:loja1", 1).Allowed {
+		t.Error("bucket de outra chave afetado")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := NewLimiter()
+	now := time.Now()
+	l.buckets["idle"] = &bucket{tokens: 1, last: now.Add(-2 * time.Minute)}
+	l.buckets["active"] = &bucket{tokens: 1, last: now.Add(-time.Second)}
+
+	l.sweep(now)
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("bucket ocioso não foi descartado")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("bucket ativo foi descartado")
+	}
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Quotas são os limites de mensagens aplicados numa requisição de envio.
+// Zero = sem limite.
+type Quotas struct {
+	KeyDaily      int // mensagens por dia da key
+	KeyMonthly    int // mensagens por mês da key (planos revendidos)
+	InstanceDaily int // mensagens por dia da instância
+}
+
+// Exceeded descreve a cota estourada.
+type Exceeded struct {
+	Scope string // key_daily, key_monthly ou instance_daily
+	Limit int
+	Reset time.Time // quando a cota volta
+}
+
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("cota de mensagens esgotada (%s: %d)", e.Scope, e.Limit)
+}
+
+// Usage é o consumo atual de uma key.
+type Usage struct {
+	Today int `json:"today"`
+	Month int `json:"month"`
+}
+
+// Counter conta as mensagens enviadas por key e instância em uso_mensagens
+// (uma linha por key, instância e dia). Contar no banco mantém as cotas entre
+// reinícios e réplicas do gateway.
+type Counter struct {
+	db *sqlx.DB
+}
+
+func NewCounter(db *sqlx.DB) *Counter {
+	return &Counter{db: db}
+}
+
+// Reserve conta uma mensagem da key na instância com os limites gravados em
+// api_keys e instancias. Devolve o dia em que ela foi contada (para Refund) ou
+// *Exceeded quando alguma cota está esgotada. Key apagada não é contada.
+func (c *Counter) Reserve(ctx context.Context, keyID int, instance string) (time.Time, error) {
+	var q Quotas
+	err := c.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(k.limite_mensagens_dia, 0),
+			COALESCE(k.cota_mensagens_mes, 0),
+			COALESCE((SELECT limite_mensagens_dia FROM instancias WHERE nome = $2), 0)
+		FROM api_keys k WHERE k.id = $1
+	`, keyID, instance).Scan(&q.KeyDaily, &q.KeyMonthly, &q.InstanceDaily)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.Consume(ctx, keyID, instance, q)
+}
+
+// Consume reserva uma mensagem se nenhuma cota estiver estourada e devolve o
+// dia em que ela foi contada; cota estourada volta como *Exceeded. Os locks
+// (key e depois instância) serializam requisições concorrentes, então a cota
+// é um teto rígido.
+func (c *Counter) Consume(ctx context.Context, keyID int, instance string, q Quotas) (time.Time, error) {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('uso_key:' || $1::text))`, keyID); err != nil {
+		return time.Time{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('uso_instance:' || $1))`, instance); err != nil {
+		return time.Time{}, err
+	}
+
+	var used struct {
+		KeyDay      int `db:"key_day"`
+		KeyMonth    int `db:"key_month"`
+		InstanceDay int `db:"instance_day"`
+	}
+	err = tx.GetContext(ctx, &used, `
+		SELECT
+			COALESCE(SUM(mensagens) FILTER (WHERE api_key_id = $1 AND dia = CURRENT_DATE), 0) AS key_day,
+			COALESCE(SUM(mensagens) FILTER (WHERE api_key_id = $1), 0) AS key_month,
+			COALESCE(SUM(mensagens) FILTER (WHERE instance = $2 AND dia = CURRENT_DATE), 0) AS instance_day
+		FROM uso_mensagens
+		WHERE (api_key_id = $1 OR instance = $2) AND dia >= date_trunc('month', CURRENT_DATE)
+	`, keyID, instance)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := time.Now()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+	switch {
+	case q.KeyMonthly > 0 && used.KeyMonth >= q.KeyMonthly:
+		return time.Time{}, &Exceeded{Scope: "key_monthly", Limit: q.KeyMonthly, Reset: nextMonth}
+	case q.KeyDaily > 0 && used.KeyDay >= q.KeyDaily:
+		return time.Time{}, &Exceeded{Scope: "key_daily", Limit: q.KeyDaily, Reset: tomorrow}
+	case q.InstanceDaily > 0 && used.InstanceDay >= q.InstanceDaily:
+		return time.Time{}, &Exceeded{Scope: "instance_daily", Limit: q.InstanceDaily, Reset: tomorrow}
+	}
+
+	var day time.Time
+	err = tx.GetContext(ctx, &day, `
+		INSERT INTO uso_mensagens (api_key_id, instance, dia, mensagens)
+		VALUES ($1, $2, CURRENT_DATE, 1)
+		ON CONFLICT (api_key_id, instance, dia) DO UPDATE SET mensagens = uso_mensagens.mensagens + 1
+		RETURNING dia
+	`, keyID, instance)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day, tx.Commit()
+}
+
+// Refund devolve a mensagem contada por Consume no dia informado quando o
+// envio não aconteceu.
+func (c *Counter) Refund(ctx context.Context, keyID int, instance string, day time.Time) error {
+	_, err := c.db.ExecContext(ctx, `
+		UPDATE uso_mensagens SET mensagens = mensagens - 1
+		WHERE api_key_id = $1 AND instance = $2 AND dia = $3::date AND mensagens > 0
+	`, keyID, instance, day.Format("2006-01-02"))
+	return err
+}
+
+// KeyUsage devolve o consumo da key hoje e no mês.
+func (c *Counter) KeyUsage(ctx context.Context, keyID int) (Usage, error) {
+	var u Usage
+	err := c.db.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(mensagens) FILTER (WHERE dia = CURRENT_DATE), 0),
+			COALESCE(SUM(mensagens), 0)
+		FROM uso_mensagens
+		WHERE api_key_id = $1 AND dia >= date_trunc('month', CURRENT_DATE)
+	`, keyID).Scan(&u.Today, &u.Month)
+	return u, err
+}
@@ -0,0 +1,402 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+	"github.com/nexus/gowhats/internal/whatsapp"
+	"github.com/robfig/cron/v3"
+)
+
+// Status possíveis de um agendamento.
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusDone      = "done"
+)
+
+// Tipos de agendamento.
+const (
+	KindOnce = "once"
+	KindCron = "cron"
+)
+
+var ErrNotFound = errors.New("agendamento não encontrado")
+
+type Schedule struct {
+	ID              int             `db:"id" json:"id"`
+	Instance        string          `db:"instance" json:"instance"`
+	Nome            string          `db:"nome" json:"name"`
+	Tipo            string          `db:"tipo" json:"kind"`
+	CronExpr        *string         `db:"cron_expr" json:"cron,omitempty"`
+	Timezone        string          `db:"timezone" json:"timezone"`
+	Payload         json.RawMessage `db:"payload" json:"message"`
+	Status          string          `db:"status" json:"status"`
+	ProximaExecucao *time.Time      `db:"proxima_execucao" json:"nextRunAt"`
+	UltimaExecucao  *time.Time      `db:"ultima_execucao" json:"lastRunAt"`
+	Execucoes       int             `db:"execucoes" json:"runs"`
+	ApiKeyID        *int            `db:"api_key_id" json:"-"`
+	CriadoEm        time.Time       `db:"criado_em" json:"createdAt"`
+}
+
+const scheduleColumns = `id, instance, nome, tipo, cron_expr, timezone, payload, status,
+	proxima_execucao, ultima_execucao, execucoes, api_key_id, criado_em`
+
+// Execution é uma entrada do histórico: o job criado na fila de envio (e o
+// status atual dele) ou o erro que impediu o enfileiramento.
+type Execution struct {
+	ID          int       `db:"id" json:"id"`
+	JobID       *string   `db:"job_id" json:"jobId"`
+	Status      string    `db:"status" json:"status"`
+	Erro        *string   `db:"erro" json:"error"`
+	ExecutadoEm time.Time `db:"executado_em" json:"executedAt"`
+}
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Scheduler dispara os agendamentos vencidos gravados na tabela agendamentos,
+// entregando cada execução à fila de envio. Como o estado fica no banco,
+// execuções perdidas durante um restart são disparadas (uma vez) na volta.
+type Scheduler struct {
+	db       *sqlx.DB
+	queue    *queue.Queue
+	interval time.Duration
+}
+
+func New(db *sqlx.DB, q *queue.Queue, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &Scheduler{db: db, queue: q, interval: interval}
+}
+
+// Start sobe o loop de disparo; ele encerra quando ctx é cancelado.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.runDue(ctx)
+			}
+		}
+	}()
+}
+
+// ============================================
+// CRUD
+// ============================================
+
+func (s *Scheduler) Create(ctx context.Context, instance string, req models.ScheduleRequest, apiKeyID *int) (*Schedule, error) {
+	tz := req.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, &whatsapp.RequestError{Message: "timezone inválido: " + tz}
+	}
+
+	if req.Message.Number == "" {
+		return nil, &whatsapp.RequestError{Message: "message.number required"}
+	}
+	// Mesmas regras do envio direto; o tamanho de mídia em base64 já é
+	// limitado pelo tamanho do corpo da requisição
+	if err := whatsapp.ValidateMessage(&req.Message, 0); err != nil {
+		var re *whatsapp.RequestError
+		if errors.As(err, &re) {
+			return nil, &whatsapp.RequestError{Message: "message: " + re.Message}
+		}
+		return nil, err
+	}
+	// Delay/scheduled_at não se aplicam: quem decide quando enviar é o agendamento
+	req.Message.Options = clearTiming(req.Message.Options)
+
+	var kind string
+	var cronExpr *string
+	var next time.Time
+	switch {
+	case req.At != "" && req.Cron != "":
+		return nil, &whatsapp.RequestError{Message: "informe at ou cron, não ambos"}
+	case req.At != "":
+		kind = KindOnce
+		next, err = parseAt(req.At, loc)
+		if err != nil {
+			return nil, &whatsapp.RequestError{Message: "at inválido: use RFC 3339 ou 2006-01-02T15:04:05"}
+		}
+		if next.Before(time.Now()) {
+			return nil, &whatsapp.RequestError{Message: "at está no passado"}
+		}
+	case req.Cron != "":
+		kind = KindCron
+		sched, err := cronParser.Parse(req.Cron)
+		if err != nil {
+			return nil, &whatsapp.RequestError{Message: "cron inválido: " + err.Error()}
+		}
+		expr := req.Cron
+		cronExpr = &expr
+		next = sched.Next(time.Now().In(loc))
+	default:
+		return nil, &whatsapp.RequestError{Message: "at ou cron required"}
+	}
+
+	payload, err := json.Marshal(req.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	var item Schedule
+	err = s.db.GetContext(ctx, &item, `
+		INSERT INTO agendamentos (instance, nome, tipo, cron_expr, timezone, payload, proxima_execucao, api_key_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+scheduleColumns,
+		instance, req.Name, kind, cronExpr, tz, string(payload), next.UTC(), apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *Scheduler) List(ctx context.Context, instance, status string) ([]Schedule, error) {
+	items := []Schedule{}
+	err := s.db.SelectContext(ctx, &items, `
+		SELECT `+scheduleColumns+` FROM agendamentos
+		WHERE instance = $1 AND ($2 = '' OR status = $2)
+		ORDER BY criado_em DESC
+	`, instance, status)
+	return items, err
+}
+
+func (s *Scheduler) Get(ctx context.Context, instance string, id int) (*Schedule, error) {
+	var item Schedule
+	err := s.db.GetContext(ctx, &item, `
+		SELECT `+scheduleColumns+` FROM agendamentos WHERE id = $1 AND instance = $2
+	`, id, instance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *Scheduler) Pause(ctx context.Context, instance string, id int) (*Schedule, error) {
+	return s.transition(ctx, instance, id, StatusPaused, StatusActive)
+}
+
+// Resume reativa um agendamento pausado. Recorrentes recalculam a próxima
+// execução a partir de agora; únicos vencidos disparam no próximo ciclo.
+func (s *Scheduler) Resume(ctx context.Context, instance string, id int) (*Schedule, error) {
+	return s.transition(ctx, instance, id, StatusActive, StatusPaused)
+}
+
+func (s *Scheduler) Cancel(ctx context.Context, instance string, id int) (*Schedule, error) {
+	return s.transition(ctx, instance, id, StatusCancelled, StatusActive, StatusPaused)
+}
+
+func (s *Scheduler) transition(ctx context.Context, instance string, id int, to string, from ...string) (*Schedule, error) {
+	item, err := s.Get(ctx, instance, id)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	for _, f := range from {
+		if item.Status == f {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, &whatsapp.RequestError{Message: fmt.Sprintf("agendamento está %s", item.Status)}
+	}
+
+	next := item.ProximaExecucao
+	if to == StatusActive && item.Tipo == KindCron {
+		if n, err := nextRun(item, time.Now()); err == nil {
+			next = &n
+		}
+	}
+
+	err = s.db.GetContext(ctx, item, `
+		UPDATE agendamentos SET status = $3, proxima_execucao = $4, atualizado_em = NOW()
+		WHERE id = $1 AND instance = $2
+		RETURNING `+scheduleColumns,
+		id, instance, to, next)
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *Scheduler) Executions(ctx context.Context, instance string, id, limit int) ([]Execution, error) {
+	if _, err := s.Get(ctx, instance, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	items := []Execution{}
+	err := s.db.SelectContext(ctx, &items, `
+		SELECT e.id, e.job_id, COALESCE(f.status, e.status) AS status,
+		       COALESCE(e.erro, f.ultimo_erro) AS erro, e.executado_em
+		FROM agendamentos_execucoes e
+		LEFT JOIN fila_mensagens f ON f.id = e.job_id
+		WHERE e.agendamento_id = $1
+		ORDER BY e.executado_em DESC
+		LIMIT $2
+	`, id, limit)
+	return items, err
+}
+
+// ============================================
+// DISPARO
+// ============================================
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		item, err := s.claim(ctx)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				log.Printf("⚠️ [agenda] erro ao buscar agendamentos: %v", err)
+			}
+			return
+		}
+		s.fire(ctx, item)
+	}
+}
+
+// claim reserva o próximo agendamento vencido e já avança a próxima execução,
+// para que uma falha no enfileiramento não o dispare em loop.
+func (s *Scheduler) claim(ctx context.Context) (*Schedule, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var item Schedule
+	err = tx.GetContext(ctx, &item, `
+		SELECT `+scheduleColumns+` FROM agendamentos
+		WHERE status = $1 AND proxima_execucao <= NOW()
+		ORDER BY proxima_execucao
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, StatusActive)
+	if err != nil {
+		return nil, err
+	}
+
+	status := item.Status
+	var next *time.Time
+	if item.Tipo == KindCron {
+		n, err := nextRun(&item, time.Now())
+		if err != nil {
+			status = StatusCancelled
+		} else {
+			next = &n
+		}
+	} else {
+		status = StatusDone
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE agendamentos
+		SET status = $2, proxima_execucao = $3, ultima_execucao = NOW(),
+		    execucoes = execucoes + 1, atualizado_em = NOW()
+		WHERE id = $1
+	`, item.ID, status, next)
+	if err != nil {
+		return nil, err
+	}
+
+	return &item, tx.Commit()
+}
+
+func (s *Scheduler) fire(ctx context.Context, item *Schedule) {
+	var req models.SendMessageRequest
+	var jobID *string
+	var errMsg *string
+
+	// Cota esgotada (*ratelimit.Exceeded) também vira uma execução failed
+	err := json.Unmarshal(item.Payload, &req)
+	if err == nil {
+		var job *queue.Job
+		job, err = s.queue.Enqueue(ctx, item.Instance, req, item.ApiKeyID)
+		if err == nil {
+			jobID = &job.ID
+		}
+	}
+
+	status := queue.StatusQueued
+	if err != nil {
+		status = queue.StatusFailed
+		msg := err.Error()
+		errMsg = &msg
+		log.Printf("❌ [agenda] agendamento %d de %s falhou: %v", item.ID, item.Instance, err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO agendamentos_execucoes (agendamento_id, job_id, status, erro)
+		VALUES ($1, $2, $3, $4)
+	`, item.ID, jobID, status, errMsg)
+	if err != nil {
+		log.Printf("⚠️ [agenda] erro ao gravar execução do agendamento %d: %v", item.ID, err)
+	}
+}
+
+// ============================================
+// HELPERS
+// ============================================
+
+func nextRun(item *Schedule, from time.Time) (time.Time, error) {
+	if item.CronExpr == nil {
+		return time.Time{}, errors.New("agendamento sem cron")
+	}
+	sched, err := cronParser.Parse(*item.CronExpr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(item.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return sched.Next(from.In(loc)).UTC(), nil
+}
+
+func parseAt(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("formato inválido")
+}
+
+func clearTiming(opts *models.MessageOptions) *models.MessageOptions {
+	if opts == nil {
+		return nil
+	}
+	cp := *opts
+	cp.Delay = 0
+	cp.ScheduledAt = nil
+	return &cp
+}
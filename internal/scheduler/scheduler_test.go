@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/dbtest"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+func TestNextRunUsesScheduleTimezone(t *testing.T) {
+	expr := "0 9 * * 1-5"
+	item := &Schedule{CronExpr: &expr, Timezone: "America/Sao_Paulo"}
+
+	// Sexta, 12:30 UTC (09:30 em São Paulo): o próximo é segunda às 09:00 locais
+	from := time.Date(2024, 3, 15, 12, 30, 0, 0, time.UTC)
+	got, err := nextRun(item, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 3, 18, 12, 0, 0, 0, time.UTC); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("nextRun() = %v, want %v", got, want)
+	}
+
+	// Timezone inválido cai para UTC em vez de parar o agendamento
+	item.Timezone = "Marte/Olympus"
+	if got, _ := nextRun(item, from); !got.Equal(time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("nextRun() com timezone inválido = %v", got)
+	}
+
+	if _, err := nextRun(&Schedule{Timezone: "UTC"}, from); err == nil {
+		t.Error("nextRun() sem cron deveria falhar")
+	}
+}
+
+func TestParseAt(t *testing.T) {
+	loc, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skip("tzdata indisponível")
+	}
+	want := time.Date(2030, 1, 2, 15, 4, 0, 0, time.UTC)
+
+	for _, value := range []string{
+		"2030-01-02T15:04:00Z",
+		"2030-01-02T12:04:00-03:00",
+		"2030-01-02T12:04:00",
+		" 2030-01-02 12:04 ",
+	} {
+		got, err := parseAt(value, loc)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseAt(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+
+	if _, err := parseAt("amanhã às 9", loc); err == nil {
+		t.Error("parseAt() aceitou texto livre")
+	}
+}
+
+func TestClearTimingKeepsCallerOptions(t *testing.T) {
+	at := time.Now()
+	opts := &models.MessageOptions{ReplyTo: "3EB0ABC", Delay: 30, ScheduledAt: &at}
+
+	got := clearTiming(opts)
+	if got.Delay != 0 || got.ScheduledAt != nil || got.ReplyTo != "3EB0ABC" {
+		t.Errorf("clearTiming() = %+v", got)
+	}
+	if opts.Delay != 30 || opts.ScheduledAt == nil {
+		t.Error("clearTiming() alterou as opções originais")
+	}
+	if clearTiming(nil) != nil {
+		t.Error("clearTiming(nil) != nil")
+	}
+}
+
+// Os pedidos abaixo são recusados antes de tocar no banco.
+func TestCreateRejectsInvalidRequests(t *testing.T) {
+	s := New(nil, nil, 0)
+	message := models.SendMessageRequest{Number: "5511987654321", Type: "text", Text: "oi"}
+
+	tests := []struct {
+		name   string
+		req    models.ScheduleRequest
+		reason string
+	}{
+		{name: "sem quando", req: models.ScheduleRequest{Message: message}, reason: "at ou cron"},
+		{name: "at e cron", req: models.ScheduleRequest{At: "2030-01-02T15:04:05Z", Cron: "* * * * *", Message: message}, reason: "não ambos"},
+		{name: "at no passado", req: models.ScheduleRequest{At: "2001-01-01T00:00:00Z", Message: message}, reason: "passado"},
+		{name: "cron inválido", req: models.ScheduleRequest{Cron: "todo dia", Message: message}, reason: "cron inválido"},
+		{name: "timezone inválido", req: models.ScheduleRequest{Cron: "* * * * *", Timezone: "Marte/Olympus", Message: message}, reason: "timezone"},
+		{name: "sem número", req: models.ScheduleRequest{Cron: "* * * * *", Message: models.SendMessageRequest{Type: "text", Text: "oi"}}, reason: "number"},
+		{name: "tipo desconhecido", req: models.ScheduleRequest{Cron: "* * * * *", Message: models.SendMessageRequest{Number: "5511987654321", Type: "poll"}}, reason: "unsupported"},
+		{
+			name:   "botões sem botões",
+			req:    models.ScheduleRequest{Cron: "* * * * *", Message: models.SendMessageRequest{Number: "5511987654321", Type: "buttons", Payload: json.RawMessage(`{"message":"oi"}`)}},
+			reason: "buttons required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Create(context.Background(), "loja1", tt.req, nil)
+			var re *whatsapp.RequestError
+			if !errors.As(err, &re) || !strings.Contains(re.Message, tt.reason) {
+				t.Errorf("Create() err = %v, want RequestError com %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestDueScheduleEnqueuesLegacyTypes(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db, "fila_mensagens", "agendamentos")
+	s := New(db, queue.New(db, nil, queue.Options{}), 0)
+	ctx := context.Background()
+
+	buttons := json.RawMessage(`{"message":"Escolha","buttons":[{"id":"1","text":"Sim"}]}`)
+	item, err := s.Create(ctx, instance, models.ScheduleRequest{
+		Name:    "lembrete",
+		At:      time.Now().Add(time.Hour).Format(time.RFC3339),
+		Message: models.SendMessageRequest{Number: "5511987654321", Type: "buttons", Payload: buttons},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Create(buttons): %v", err)
+	}
+
+	db.MustExec(`UPDATE agendamentos SET proxima_execucao = NOW() - INTERVAL '1 second' WHERE id = $1`, item.ID)
+	s.runDue(ctx)
+
+	got, err := s.Get(ctx, instance, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusDone || got.Execucoes != 1 {
+		t.Errorf("agendamento após disparo: status %s, %d execuções", got.Status, got.Execucoes)
+	}
+
+	var job struct {
+		Tipo    string `db:"tipo"`
+		Payload string `db:"payload"`
+	}
+	if err := db.Get(&job, `SELECT tipo, payload FROM fila_mensagens WHERE instance = $1`, instance); err != nil {
+		t.Fatalf("job do disparo: %v", err)
+	}
+	var req models.SendMessageRequest
+	if err := json.Unmarshal([]byte(job.Payload), &req); err != nil {
+		t.Fatal(err)
+	}
+	if job.Tipo != "buttons" || whatsapp.ValidateMessage(&req, 0) != nil {
+		t.Errorf("job enfileirado = %s %s", job.Tipo, job.Payload)
+	}
+}
@@ -1,389 +1,466 @@
-package server
-
-import (
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/jmoiron/sqlx"
-	"encoding/json" // <-- Faltava
-
-	// imports reais
-	"github.com/nexus/gowhats/internal/whatsapp"
-	"github.com/nexus/gowhats/internal/handlers"
-	"github.com/nexus/gowhats/internal/models"
-)
-
-type Server struct {
-	app       *fiber.App
-	client    *whatsapp.BaileysClient   // ✔ tipo certo
-	db        *sqlx.DB
-	dbHandler *handlers.DatabaseHandler // ✔ vindo do handlers
-}
-
-func NewServer(db *sqlx.DB) *Server {
-	app := fiber.New(fiber.Config{
-		BodyLimit: 50 * 1024 * 1024,
-	})
-
-	app.Use(cors.New())
-	app.Use(logger.New())
-
-	client := whatsapp.NewBaileysClient(baileysURL)
-	dbHandler := database.NewDatabaseHandler(db, client)
-
-
-	server := &Server{
-		app:       app,
-		client:    client,
-		db:        db,
-		dbHandler: dbHandler,
-	}
-
-	server.setupRoutes()
-
-	return server
-}
-
-func (s *Server) setupRoutes() {
-	// Rota pública (health check)
-	s.app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "ok"})
-	})
-
-	// Todas as rotas /v1 requerem autenticação
-	api := s.app.Group("/v1", s.dbHandler.AuthMiddleware)
-
-	// Rota de informações do usuário
-	api.Get("/me", s.dbHandler.GetMe)
-
-	// ============================================
-	// ROTAS DE API KEYS (Super Admin Only)
-	// ============================================
-	apiKeys := api.Group("/api-keys", s.dbHandler.SuperAdminOnly)
-	apiKeys.Get("/", s.dbHandler.ListApiKeys)
-	apiKeys.Post("/", s.dbHandler.CreateApiKey)
-	apiKeys.Put("/:id", s.dbHandler.UpdateApiKey)
-	apiKeys.Delete("/:id", s.dbHandler.DeleteApiKey)
-
-	// ============================================
-	// ROTAS DE INSTÂNCIAS
-	// ============================================
-	api.Get("/instances", s.dbHandler.ListInstances)
-	api.Post("/instances", s.dbHandler.SuperAdminOnly, s.dbHandler.CreateInstance)
-	api.Delete("/instances/:name", s.dbHandler.SuperAdminOnly, s.dbHandler.DeleteInstance)
-
-	// ============================================
-	// ROTAS DE INSTÂNCIA ESPECÍFICA
-	// ============================================
-	instance := api.Group("/instance/:instance", s.dbHandler.InstanceAccessMiddleware)
-	
-	instance.Get("/info", func(c *fiber.Ctx) error {
-		instName := c.Params("instance")
-		info, err := s.client.GetInstanceInfo(instName)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(info)
-	})
-
-	instance.Get("/sync-status", func(c *fiber.Ctx) error {
-		instName := c.Params("instance")
-		status, err := s.client.GetSyncStatus(instName)
-		if err != nil {
-			return c.JSON(fiber.Map{"syncing": false, "completed": false})
-		}
-		return c.JSON(status)
-	})
-
-	instance.Post("/sync", func(c *fiber.Ctx) error {
-		instName := c.Params("instance")
-		err := s.client.TriggerSync(instName)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(fiber.Map{"status": "started"})
-	})
-
-	// ============================================
-	// ROTAS DE BANCO DE DADOS
-	// ============================================
-	db := api.Group("/db")
-	db.Get("/contacts/:instance", s.dbHandler.InstanceAccessMiddleware, s.dbHandler.GetContacts)
-	db.Get("/groups/:instance", s.dbHandler.InstanceAccessMiddleware, s.dbHandler.GetGroups)
-	db.Get("/stats/:instance", s.dbHandler.InstanceAccessMiddleware, s.dbHandler.GetStats)
-
-	// ============================================
-	// ROTAS DE CONTATOS E GRUPOS (via Node.js)
-	// ============================================
-	api.Get("/contacts/:instance", s.dbHandler.InstanceAccessMiddleware, func(c *fiber.Ctx) error {
-		instName := c.Params("instance")
-		contacts, err := s.client.GetContacts(instName)
-		if err != nil {
-			return c.JSON([]interface{}{})
-		}
-		return c.JSON(contacts)
-	})
-
-	api.Get("/groups/:instance", s.dbHandler.InstanceAccessMiddleware, func(c *fiber.Ctx) error {
-		instName := c.Params("instance")
-		groups, err := s.client.GetGroups(instName)
-		if err != nil {
-			return c.JSON([]interface{}{})
-		}
-		return c.JSON(groups)
-	})
-
-	// ============================================
-	// ROTAS DE MENSAGENS
-	// ============================================
-	message := api.Group("/message")
-
-	message.Post("/text", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		// Verifica acesso à instância
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.SendText(
-	    body["instance"].(string),
-    	body["number"].(string),
-    	body["text"].(string),
-    	nil,
-		)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	message.Post("/buttons", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.SendButtons(
-    		body["instance"].(string),
-    		body["number"].(string),
-    		body["message"].(string),
-    		body["footer"].(string),
-    		body["title"].(string),
-    		body["buttons"].([]map[string]string),
-		)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	message.Post("/list", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.SendList(
-	    	body["instance"].(string),
-    		body["number"].(string),
-    		body["title"].(string),
-    		body["message"].(string),
-    		body["footer"].(string),
-    		body["buttonText"].(string),
-    		body["sections"].([]map[string]interface{}),
-		)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	message.Post("/url-button", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.SendUrlButton(
-    		body["instance"].(string),
-    		body["number"].(string),
-    		body["message"].(string),
-    		body["footer"].(string),
-    		body["title"].(string),
-    		body["buttonText"].(string),
-    		body["url"].(string),
-	)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	message.Post("/copy-button", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.SendCopyButton(
-    		body["instance"].(string),
-    		body["number"].(string),
-    		body["message"].(string),
-    		body["footer"].(string),
-    		body["title"].(string),
-    		body["buttonText"].(string),
-    		body["copyCode"].(string),
-	)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	message.Post("/interactive", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		interactive := &models.InteractivePayload{}
-			json.Unmarshal(c.Body(), &interactive)
-
-	result, err := s.client.SendInteractive(
-    	body["instance"].(string),
-    	body["number"].(string),
-    	interactive,
-    	nil,
-		)
-
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	// ============================================
-	// ROTAS DE SESSÃO (proxy para Node.js)
-	// ============================================
-	session := s.app.Group("/session", s.dbHandler.AuthMiddleware)
-
-	session.Post("/start", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.StartSession(body)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	session.Post("/pair-code", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.RequestPairCode(body)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	session.Post("/logout", func(c *fiber.Ctx) error {
-		var body map[string]interface{}
-		if err := c.BodyParser(&body); err != nil {
-			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
-		}
-
-		instName, _ := body["instance"].(string)
-		if !s.checkInstanceAccess(c, instName) {
-			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
-		}
-
-		result, err := s.client.Logout(body)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
-		}
-		return c.JSON(result)
-	})
-
-	// Arquivos estáticos
-	s.app.Static("/", "./public")
-}
-
-func (s *Server) checkInstanceAccess(c *fiber.Ctx, instName string) bool {
-	if instName == "" {
-		return true
-	}
-
-	isSuperAdmin, _ := c.Locals("isSuperAdmin").(bool)
-	if isSuperAdmin {
-		return true
-	}
-
-	apiKey, ok := c.Locals("apiKey").(*models.ApiKey)
-	if !ok {
-		return false
-	}
-
-	for _, inst := range apiKey.InstanciasPermitidas {
-		if inst == instName {
-			return true
-		}
-	}
-
-	return false
-}
-
-func (s *Server) Listen(addr string) error {
-	return s.app.Listen(addr)
-}
\ No newline at end of file
+package server
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/config"
+	"github.com/nexus/gowhats/internal/aibot"
+	"github.com/nexus/gowhats/internal/audit"
+	"github.com/nexus/gowhats/internal/campaign"
+	"github.com/nexus/gowhats/internal/chatwoot"
+	"github.com/nexus/gowhats/internal/dify"
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/nexus/gowhats/internal/handlers"
+	"github.com/nexus/gowhats/internal/handoff"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/jid"
+	"github.com/nexus/gowhats/internal/metrics"
+	"github.com/nexus/gowhats/internal/middleware"
+	"github.com/nexus/gowhats/internal/queue"
+	"github.com/nexus/gowhats/internal/scheduler"
+	"github.com/nexus/gowhats/internal/settings"
+	"github.com/nexus/gowhats/internal/triggers"
+	"github.com/nexus/gowhats/internal/typebot"
+	"github.com/nexus/gowhats/internal/webhook"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+type Server struct {
+	app       *fiber.App
+	cfg       *config.Config
+	client    *whatsapp.BaileysClient
+	service   *whatsapp.Service
+	db        *sqlx.DB
+	dbHandler *handlers.DatabaseHandler
+
+	dispatcher *webhook.Dispatcher
+	events     *eventbus.Bus
+	queue      *queue.Queue
+	scheduler  *scheduler.Scheduler
+	campaigns  *campaign.Runner
+
+	sessionHandler      *handlers.SessionHandler
+	messageHandler      *handlers.MessageHandler
+	groupHandler        *handlers.GroupHandler
+	webhookHandler      *handlers.WebhookHandler
+	eventHandler        *handlers.EventHandler
+	scheduleHandler     *handlers.ScheduleHandler
+	campaignHandler     *handlers.CampaignHandler
+	chatHandler         *handlers.ChatHandler
+	settingsHandler     *handlers.SettingsHandler
+	eventsHandler       *handlers.EventsConfigHandler
+	streamHandler       *handlers.StreamHandler
+	integrationsHandler *handlers.IntegrationsHandler
+	typebotHandler      *handlers.TypebotHandler
+	handoffHandler      *handlers.HandoffHandler
+	tagsHandler         *handlers.TagsHandler
+	auditHandler        *handlers.AuditHandler
+}
+
+// NewServer é a raiz de composição do gateway: recebe a configuração e o pool
+// do PostgreSQL já aberto e monta cliente, serviço e handlers sobre eles.
+func NewServer(cfg *config.Config, db *sqlx.DB) *Server {
+	app := fiber.New(fiber.Config{
+		BodyLimit: 50 * 1024 * 1024,
+	})
+
+	app.Use(metrics.Middleware)
+	app.Use(cors.New())
+	app.Use(requestid.New())
+	app.Use(logger.New())
+
+	metrics.RegisterDB(db)
+
+	auditLog := audit.New(db)
+	auditLog.Start(context.Background())
+
+	client := whatsapp.NewBaileysClient(cfg.BaileysURL, cfg.BaileysApiKey, db)
+	service := whatsapp.NewService(client)
+	service.Numbers = jid.NewResolver(client, cfg.DefaultCountryCode)
+	connections := whatsapp.NewSupervisor(db, client)
+	connections.Start(context.Background())
+	service.Connections = connections
+	dbHandler := handlers.NewDatabaseHandler(db, client, auditLog)
+
+	dispatcher := webhook.NewDispatcher(db, webhook.Options{
+		GlobalURL:    cfg.WebhookURL,
+		GlobalSecret: cfg.WebhookSecret,
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+	})
+	dispatcher.Start(context.Background())
+
+	bus := eventbus.New(db, dispatcher)
+	bus.Start(context.Background())
+	service.Events = bus
+	connections.Events = bus
+	dbHandler.Events = bus
+	bus.Listen(connections.HandleEvent)
+	bus.Listen(metrics.NewEvents().HandleEvent)
+
+	sendQueue := queue.New(db, service, queue.Options{
+		MaxAttempts: cfg.QueueMaxAttempts,
+	})
+	sendQueue.Start(context.Background())
+
+	sched := scheduler.New(db, sendQueue, 0)
+	sched.Start(context.Background())
+
+	campaigns := campaign.NewRunner(db, sendQueue)
+	campaigns.DefaultCountry = cfg.DefaultCountryCode
+	campaigns.Start(context.Background())
+
+	messageStore := history.NewStore(db)
+	settingsStore := settings.NewStore(db, client)
+
+	integrationStore := integrations.NewStore(db)
+	chatwootConnector := chatwoot.New(db, integrationStore, service, cfg.PublicURL, cfg.GlobalApiKey)
+	chatwootConnector.Start(context.Background())
+	bus.Listen(chatwootConnector.HandleEvent)
+
+	handoffs := handoff.NewStore(db)
+
+	typebotSessions := typebot.NewSessions(db)
+	typebotConnector := typebot.New(integrationStore, typebotSessions, handoffs, service)
+	typebotConnector.Start(context.Background())
+
+	responder := aibot.New(integrationStore, messageStore, handoffs, sendQueue)
+	responder.Start(context.Background())
+
+	difyConnector := dify.New(db, integrationStore, handoffs, chatwootConnector, service, sendQueue)
+	difyConnector.Start(context.Background())
+
+	// Um único bot responde cada mensagem, conforme as regras da instância
+	engine := triggers.New(db, integrationStore, handoffs, chatwootConnector, sendQueue)
+	engine.Register("typebot", typebotConnector)
+	engine.Register("openai", responder)
+	engine.Register("dify", difyConnector)
+	engine.Start(context.Background())
+	bus.Listen(engine.HandleEvent)
+
+	server := &Server{
+		app:       app,
+		cfg:       cfg,
+		client:    client,
+		service:   service,
+		db:        db,
+		dbHandler: dbHandler,
+
+		dispatcher: dispatcher,
+		events:     bus,
+		queue:      sendQueue,
+		scheduler:  sched,
+		campaigns:  campaigns,
+
+		sessionHandler:      handlers.NewSessionHandler(service),
+		messageHandler:      handlers.NewMessageHandler(service, sendQueue, messageStore),
+		groupHandler:        handlers.NewGroupHandler(service),
+		webhookHandler:      handlers.NewWebhookHandler(db, dispatcher, auditLog),
+		eventHandler:        handlers.NewEventHandler(bus, messageStore, settingsStore),
+		scheduleHandler:     handlers.NewScheduleHandler(sched),
+		campaignHandler:     handlers.NewCampaignHandler(campaigns),
+		chatHandler:         handlers.NewChatHandler(messageStore),
+		settingsHandler:     handlers.NewSettingsHandler(settingsStore, auditLog),
+		eventsHandler:       handlers.NewEventsConfigHandler(db, bus, auditLog),
+		streamHandler:       handlers.NewStreamHandler(bus),
+		integrationsHandler: handlers.NewIntegrationsHandler(integrationStore, chatwootConnector, auditLog),
+		typebotHandler:      handlers.NewTypebotHandler(typebotSessions),
+		handoffHandler:      handlers.NewHandoffHandler(handoffs, auditLog),
+		tagsHandler:         handlers.NewTagsHandler(db, auditLog),
+		auditHandler:        handlers.NewAuditHandler(auditLog),
+	}
+
+	server.setupRoutes()
+
+	return server
+}
+
+func (s *Server) setupRoutes() {
+	// Rota pública (health check)
+	s.app.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "ok"})
+	})
+
+	// Métricas do Prometheus (autenticado pela GLOBAL_API_KEY)
+	s.app.Get("/metrics", middleware.Protected(s.cfg), metrics.Handler())
+
+	// Eventos do sidecar Node.js (autenticado pela GLOBAL_API_KEY)
+	s.app.Post("/internal/events", middleware.Protected(s.cfg), s.eventHandler.Ingest)
+
+	// Webhook da inbox do Chatwoot (autenticado pelo token na URL)
+	s.app.Post("/integrations/chatwoot/:instance", s.integrationsHandler.ChatwootWebhook)
+
+	// Todas as rotas /v1 requerem autenticação (e ficam no log de auditoria)
+	api := s.app.Group("/v1", s.auditHandler.Middleware, s.dbHandler.AuthMiddleware)
+
+	// Rota de informações do usuário
+	api.Get("/me", s.dbHandler.GetMe)
+
+	// Escopos das keys: read-only libera os GETs; só super admin e * passam sempre
+	read := s.dbHandler.RequireScope(handlers.ScopeReadOnly)
+	send := s.dbHandler.RequireScope(handlers.ScopeMessagesSend)
+	groupsWrite := s.dbHandler.RequireScope(handlers.ScopeGroupsWrite)
+	admin := s.dbHandler.RequireScope(handlers.ScopeInstancesAdmin)
+
+	// ============================================
+	// ROTAS DE API KEYS (Super Admin Only)
+	// ============================================
+	apiKeys := api.Group("/api-keys", s.dbHandler.SuperAdminOnly)
+	apiKeys.Get("/", s.dbHandler.ListApiKeys)
+	apiKeys.Post("/", s.dbHandler.CreateApiKey)
+	apiKeys.Put("/:id", s.dbHandler.UpdateApiKey)
+	apiKeys.Delete("/:id", s.dbHandler.DeleteApiKey)
+	apiKeys.Post("/:id/rotate", s.dbHandler.RotateApiKey)
+
+	// Log de auditoria (quem fez o quê, quando)
+	api.Get("/audit", s.dbHandler.SuperAdminOnly, s.auditHandler.List)
+
+	// Dead letters de eventos sem instância (entregues só à URL global)
+	api.Get("/webhook/dead-letters", s.dbHandler.SuperAdminOnly, s.webhookHandler.ListDeadLetters)
+	api.Post("/webhook/dead-letters/replay", s.dbHandler.SuperAdminOnly, s.webhookHandler.Replay)
+	api.Post("/webhook/dead-letters/:id/replay", s.dbHandler.SuperAdminOnly, s.webhookHandler.Replay)
+
+	// ============================================
+	// ROTAS DE INSTÂNCIAS
+	// ============================================
+	api.Get("/instances", read, s.dbHandler.ListInstances)
+	api.Post("/instances", s.dbHandler.SuperAdminOnly, s.dbHandler.CreateInstance)
+	api.Delete("/instances/:name", s.dbHandler.SuperAdminOnly, s.dbHandler.DeleteInstance)
+	api.Put("/instances/:name/limits", s.dbHandler.SuperAdminOnly, s.dbHandler.UpdateInstanceLimits)
+
+	// ============================================
+	// ROTAS DE INSTÂNCIA ESPECÍFICA
+	// ============================================
+	instance := api.Group("/instance/:instance", s.dbHandler.InstanceAccessMiddleware)
+
+	instance.Get("/info", read, func(c *fiber.Ctx) error {
+		instName := c.Params("instance")
+		info, err := s.client.GetInstanceInfo(c.UserContext(), instName)
+		if err != nil {
+			return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(info)
+	})
+
+	instance.Get("/sync-status", read, func(c *fiber.Ctx) error {
+		instName := c.Params("instance")
+		status, err := s.client.GetSyncStatus(c.UserContext(), instName)
+		if err != nil {
+			return c.JSON(fiber.Map{"syncing": false, "completed": false})
+		}
+		return c.JSON(status)
+	})
+
+	instance.Post("/sync", admin, func(c *fiber.Ctx) error {
+		instName := c.Params("instance")
+		err := s.client.TriggerSync(c.UserContext(), instName)
+		if err != nil {
+			return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"status": "started"})
+	})
+
+	instance.Get("/state", read, s.sessionHandler.State)
+	instance.Get("/connect", admin, s.sessionHandler.Connect)
+	instance.Post("/pair", admin, s.sessionHandler.Pair)
+	instance.Get("/pair", admin, s.sessionHandler.PairStatus)
+	instance.Delete("/logout", admin, s.sessionHandler.Logout)
+	instance.Post("/message/text", send, s.messageHandler.SendText)
+	instance.Post("/message/interactive", send, s.messageHandler.SendInteractive)
+	instance.Post("/message/media", send, s.messageHandler.SendMedia)
+	instance.Get("/chats/:jid/messages", read, s.chatHandler.Messages)
+	instance.Get("/settings", admin, s.settingsHandler.Get)
+	instance.Put("/settings", admin, s.settingsHandler.Update)
+
+	// ============================================
+	// ROTAS DE WEBHOOK
+	// ============================================
+	instance.Get("/webhook", admin, s.webhookHandler.GetConfig)
+	instance.Put("/webhook", admin, s.webhookHandler.UpdateConfig)
+	instance.Get("/webhook/dead-letters", admin, s.webhookHandler.ListDeadLetters)
+	instance.Post("/webhook/dead-letters/replay", admin, s.webhookHandler.Replay)
+	instance.Post("/webhook/dead-letters/:id/replay", admin, s.webhookHandler.Replay)
+	instance.Get("/events", read, s.streamHandler.Stream)
+	instance.Get("/events/config", admin, s.eventsHandler.GetConfig)
+	instance.Put("/events/config", admin, s.eventsHandler.UpdateConfig)
+
+	// ============================================
+	// ROTAS DE INTEGRAÇÕES (Chatwoot, Typebot, OpenAI, Dify)
+	// ============================================
+	instance.Get("/integrations", admin, s.integrationsHandler.Get)
+	instance.Put("/integrations", admin, s.integrationsHandler.Update)
+	instance.Get("/typebot/sessions", admin, s.typebotHandler.List)
+	instance.Post("/typebot/sessions/:jid/pause", admin, s.typebotHandler.Pause)
+	instance.Post("/typebot/sessions/:jid/resume", admin, s.typebotHandler.Resume)
+	instance.Delete("/typebot/sessions/:jid", admin, s.typebotHandler.End)
+	instance.Get("/handoff", admin, s.handoffHandler.List)
+	instance.Post("/handoff/:jid", admin, s.handoffHandler.Start)
+	instance.Delete("/handoff/:jid", admin, s.handoffHandler.Release)
+	instance.Get("/contacts/:jid/tags", admin, s.tagsHandler.Get)
+	instance.Put("/contacts/:jid/tags", admin, s.tagsHandler.Update)
+
+	// ============================================
+	// ROTAS DE AGENDAMENTO
+	// ============================================
+	schedules := instance.Group("/schedules", send)
+	schedules.Post("/", s.scheduleHandler.Create)
+	schedules.Get("/", s.scheduleHandler.List)
+	schedules.Get("/:id", s.scheduleHandler.Get)
+	schedules.Get("/:id/executions", s.scheduleHandler.Executions)
+	schedules.Post("/:id/pause", s.scheduleHandler.Pause)
+	schedules.Post("/:id/resume", s.scheduleHandler.Resume)
+	schedules.Delete("/:id", s.scheduleHandler.Cancel)
+
+	// ============================================
+	// ROTAS DE CAMPANHAS
+	// ============================================
+	campaignRoutes := instance.Group("/campaigns", send)
+	campaignRoutes.Post("/", s.campaignHandler.Create)
+	campaignRoutes.Get("/", s.campaignHandler.List)
+	campaignRoutes.Get("/:id", s.campaignHandler.Get)
+	campaignRoutes.Get("/:id/recipients", s.campaignHandler.Recipients)
+	campaignRoutes.Post("/:id/pause", s.campaignHandler.Pause)
+	campaignRoutes.Post("/:id/resume", s.campaignHandler.Resume)
+	campaignRoutes.Delete("/:id", s.campaignHandler.Cancel)
+
+	instance.Get("/opt-outs", send, s.campaignHandler.ListOptOuts)
+	instance.Post("/opt-outs", send, s.campaignHandler.AddOptOuts)
+	instance.Delete("/opt-outs/:number", send, s.campaignHandler.RemoveOptOut)
+
+	// ============================================
+	// ROTAS DE GERENCIAMENTO DE GRUPOS
+	// ============================================
+	groups := instance.Group("/groups", groupsWrite)
+	groups.Post("/", s.groupHandler.Create)
+	groups.Post("/join", s.groupHandler.Join)
+	groups.Get("/:group_id", s.groupHandler.Get)
+	groups.Put("/:group_id", s.groupHandler.Update)
+	groups.Post("/:group_id/participants", s.groupHandler.UpdateParticipants)
+	groups.Put("/:group_id/settings", s.groupHandler.UpdateSettings)
+	groups.Get("/:group_id/invite", s.groupHandler.GetInvite)
+	groups.Delete("/:group_id/invite", s.groupHandler.RevokeInvite)
+	groups.Post("/:group_id/leave", s.groupHandler.Leave)
+
+	// ============================================
+	// ROTAS DE BANCO DE DADOS
+	// ============================================
+	db := api.Group("/db", read)
+	db.Get("/contacts/:instance", s.dbHandler.InstanceAccessMiddleware, s.dbHandler.GetContacts)
+	db.Get("/groups/:instance", s.dbHandler.InstanceAccessMiddleware, s.dbHandler.GetGroups)
+	db.Get("/stats/:instance", s.dbHandler.InstanceAccessMiddleware, s.dbHandler.GetStats)
+
+	// ============================================
+	// ROTAS DE CONTATOS E GRUPOS (via Node.js)
+	// ============================================
+	api.Get("/contacts/:instance", read, s.dbHandler.InstanceAccessMiddleware, func(c *fiber.Ctx) error {
+		instName := c.Params("instance")
+		// ?search= filtra por nome ou número (+55 11 9999-8888 casa com o jid)
+		contacts, err := s.service.SearchContacts(c.UserContext(), instName, c.Query("search"))
+		if err != nil {
+			return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		if contacts == nil {
+			contacts = []whatsapp.Contact{}
+		}
+		return c.JSON(contacts)
+	})
+
+	api.Get("/groups/:instance", read, s.dbHandler.InstanceAccessMiddleware, func(c *fiber.Ctx) error {
+		instName := c.Params("instance")
+		groups, err := s.client.GetGroups(c.UserContext(), instName)
+		if err != nil {
+			return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		if groups == nil {
+			groups = []whatsapp.GroupSummary{}
+		}
+		return c.JSON(groups)
+	})
+
+	// ============================================
+	// ROTAS DE MENSAGENS
+	// ============================================
+	message := api.Group("/message", send)
+
+	// Rotas antigas, com a instância no corpo; também passam pela fila
+	message.Post("/text", s.messageHandler.SendLegacy("text"))
+	message.Post("/buttons", s.messageHandler.SendLegacy("buttons"))
+	message.Post("/list", s.messageHandler.SendLegacy("list"))
+	message.Post("/url-button", s.messageHandler.SendLegacy("url-button"))
+	message.Post("/copy-button", s.messageHandler.SendLegacy("copy-button"))
+	message.Post("/interactive", s.messageHandler.SendLegacy("interactive"))
+	message.Post("/media", s.messageHandler.SendMedia)
+	message.Get("/status/:id", s.messageHandler.Status)
+
+	// ============================================
+	// ROTAS DE SESSÃO (proxy para Node.js)
+	// ============================================
+	session := s.app.Group("/session", s.auditHandler.Middleware, s.dbHandler.AuthMiddleware, admin)
+
+	session.Post("/start", func(c *fiber.Ctx) error {
+		var req whatsapp.SessionRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+		}
+
+		if !s.checkInstanceAccess(c, req.Instance) {
+			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
+		}
+
+		result, err := s.client.StartSession(c.UserContext(), req)
+		if err != nil {
+			return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(result)
+	})
+
+	session.Post("/pair-code", func(c *fiber.Ctx) error {
+		var req whatsapp.PairCodeRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+		}
+
+		if !s.checkInstanceAccess(c, req.Instance) {
+			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
+		}
+
+		pairing, err := s.service.PairPhone(c.UserContext(), req.Instance, req.PhoneNumber)
+		if err != nil {
+			return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(whatsapp.PairCodeResponse{Status: "success", Code: pairing.Code})
+	})
+
+	session.Post("/logout", func(c *fiber.Ctx) error {
+		var req whatsapp.SessionRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "JSON inválido"})
+		}
+
+		if !s.checkInstanceAccess(c, req.Instance) {
+			return c.Status(403).JSON(fiber.Map{"error": "Sem permissão para esta instância"})
+		}
+
+		result, err := s.client.Logout(c.UserContext(), req)
+		if err != nil {
+			return c.Status(whatsapp.HTTPStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(result)
+	})
+
+	// Arquivos estáticos
+	s.app.Static("/", "./public")
+}
+
+func (s *Server) checkInstanceAccess(c *fiber.Ctx, instName string) bool {
+	return handlers.HasInstanceAccess(c, instName)
+}
+
+func (s *Server) Listen(addr string) error {
+	return s.app.Listen(addr)
+}
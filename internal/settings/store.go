@@ -0,0 +1,115 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+var ErrInstanceNotFound = errors.New("instância não encontrada")
+
+type cached struct {
+	settings   models.InstanceSettings
+	configured bool
+	loadedAt   time.Time
+}
+
+// Store guarda as configurações de cada instância (instancias.configuracoes)
+// e as empurra para o sidecar, que é quem as aplica no socket. O cache atende
+// as consultas feitas a cada evento recebido.
+type Store struct {
+	db     *sqlx.DB
+	client *whatsapp.BaileysClient
+	ttl    time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cached
+}
+
+func NewStore(db *sqlx.DB, client *whatsapp.BaileysClient) *Store {
+	return &Store{db: db, client: client, ttl: 30 * time.Second, entries: make(map[string]cached)}
+}
+
+// Get devolve as configurações da instância. configured é falso quando ela
+// nunca foi configurada (valem os padrões).
+func (s *Store) Get(ctx context.Context, instance string) (models.InstanceSettings, bool, error) {
+	s.mu.RLock()
+	entry, ok := s.entries[instance]
+	s.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < s.ttl {
+		return entry.settings, entry.configured, nil
+	}
+
+	var raw []byte
+	err := s.db.GetContext(ctx, &raw, `SELECT configuracoes FROM instancias WHERE nome = $1`, instance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.InstanceSettings{}, false, ErrInstanceNotFound
+	}
+	if err != nil {
+		return models.InstanceSettings{}, false, err
+	}
+
+	entry = cached{settings: models.DefaultInstanceSettings(), loadedAt: time.Now()}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &entry.settings); err != nil {
+			return models.InstanceSettings{}, false, err
+		}
+		entry.configured = true
+	}
+
+	s.mu.Lock()
+	s.entries[instance] = entry
+	s.mu.Unlock()
+
+	return entry.settings, entry.configured, nil
+}
+
+// Save grava as configurações da instância. Para aplicá-las no sidecar,
+// chame Push em seguida.
+func (s *Store) Save(ctx context.Context, instance string, settings models.InstanceSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE instancias SET configuracoes = $2, atualizado_em = NOW() WHERE nome = $1
+	`, instance, string(data))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInstanceNotFound
+	}
+
+	s.mu.Lock()
+	s.entries[instance] = cached{settings: settings, configured: true, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Push envia ao sidecar as configurações de uma instância configurada. É
+// chamado após Save e sempre que a instância (re)conecta, já que o sidecar
+// guarda as configurações só em memória.
+func (s *Store) Push(ctx context.Context, instance string) error {
+	settings, configured, err := s.Get(ctx, instance)
+	if err != nil || !configured {
+		return err
+	}
+	return s.client.ApplySettings(ctx, instance, settings)
+}
+
+// IgnoresGroups indica se eventos de grupo da instância não devem ir para os
+// webhooks.
+func (s *Store) IgnoresGroups(ctx context.Context, instance string) bool {
+	settings, _, err := s.Get(ctx, instance)
+	return err == nil && settings.IgnoreGroups
+}
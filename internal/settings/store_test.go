@@ -0,0 +1,83 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/dbtest"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+// sidecar grava as configurações recebidas em PUT /v1/instance/:instance/settings.
+func sidecar(t *testing.T, applied map[string]models.InstanceSettings) *whatsapp.BaileysClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got models.InstanceSettings
+		if r.Method != http.MethodPut || json.NewDecoder(r.Body).Decode(&got) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		applied[r.URL.Path] = got
+		w.Write([]byte(`{"status":"success"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return whatsapp.NewBaileysClient(srv.URL, "", nil)
+}
+
+func TestPushSendsOnlyConfiguredInstances(t *testing.T) {
+	applied := map[string]models.InstanceSettings{}
+	s := NewStore(nil, sidecar(t, applied))
+	s.entries["loja1"] = cached{settings: models.InstanceSettings{RejectCalls: true, IgnoreGroups: true}, configured: true, loadedAt: time.Now()}
+	s.entries["loja2"] = cached{settings: models.DefaultInstanceSettings(), loadedAt: time.Now()}
+
+	ctx := context.Background()
+	if err := s.Push(ctx, "loja1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Push(ctx, "loja2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(applied) != 1 || !applied["/v1/instance/loja1/settings"].RejectCalls {
+		t.Errorf("aplicado no sidecar = %+v, want só loja1", applied)
+	}
+	if !s.IgnoresGroups(ctx, "loja1") || s.IgnoresGroups(ctx, "loja2") {
+		t.Error("IgnoresGroups não segue as configurações em cache")
+	}
+}
+
+func TestSaveAndReload(t *testing.T) {
+	db := dbtest.Open(t)
+	instance := dbtest.Instance(t, db)
+	ctx := context.Background()
+
+	s := NewStore(db, nil)
+	got, configured, err := s.Get(ctx, instance)
+	if err != nil || configured || got != models.DefaultInstanceSettings() {
+		t.Fatalf("instância nova: %+v, configured=%v, %v; want padrões", got, configured, err)
+	}
+
+	want := models.InstanceSettings{RejectCalls: true, RejectCallMessage: "Não atendemos ligações", AlwaysOnline: true}
+	if err := s.Save(ctx, instance, want); err != nil {
+		t.Fatal(err)
+	}
+
+	// Outra réplica, sem cache, lê o que foi gravado
+	got, configured, err = NewStore(db, nil).Get(ctx, instance)
+	if err != nil || !configured || got != want {
+		t.Errorf("Get() após Save = %+v, configured=%v, %v", got, configured, err)
+	}
+
+	if err := s.Save(ctx, "nao-existe-"+instance, want); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("Save() em instância inexistente: err = %v", err)
+	}
+	if _, _, err := s.Get(ctx, "nao-existe-"+instance); !errors.Is(err, ErrInstanceNotFound) {
+		t.Errorf("Get() em instância inexistente: err = %v", err)
+	}
+}
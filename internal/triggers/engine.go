@@ -0,0 +1,422 @@
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nexus/gowhats/internal/handoff"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/queue"
+)
+
+// Bot recebe as mensagens que o motor encaminhou para ele. Deliver não pode
+// bloquear: cada bot tem a própria fila.
+type Bot interface {
+	Deliver(instance string, msg *history.Summary, raw json.RawMessage)
+}
+
+// AgentLookup diz se um atendente está atribuído ao chat (regra no_agent).
+type AgentLookup interface {
+	Assigned(ctx context.Context, instance, jid string) (bool, error)
+}
+
+// Ordem dos bots quando a instância não tem regras.
+var defaultOrder = []string{"typebot", "dify", "openai"}
+
+const workers = 4
+
+// incoming é uma mensagem recebida aguardando o motor.
+type incoming struct {
+	instance string
+	msg      *history.Summary
+	raw      json.RawMessage
+}
+
+// Engine escolhe qual bot atende cada mensagem recebida, conforme as regras
+// de instancias.integracoes.triggers: palavras de parada passam o chat para
+// um humano, o debounce junta mensagens seguidas e a primeira regra que
+// casar decide o bot.
+type Engine struct {
+	db       *sqlx.DB
+	configs  *integrations.Store
+	handoffs *handoff.Store
+	agents   AgentLookup
+	queue    *queue.Queue
+	bots     map[string]Bot
+	inbox    []chan incoming
+
+	mu      sync.Mutex
+	pending map[string]*pending
+
+	reMu    sync.Mutex
+	regexes map[string]*regexp.Regexp
+}
+
+// pending são as mensagens do contato aguardando o fim do debounce.
+type pending struct {
+	msgs  []*history.Summary
+	raw   json.RawMessage
+	timer *time.Timer
+}
+
+func New(db *sqlx.DB, configs *integrations.Store, handoffs *handoff.Store, agents AgentLookup, q *queue.Queue) *Engine {
+	e := &Engine{
+		db:       db,
+		configs:  configs,
+		handoffs: handoffs,
+		agents:   agents,
+		queue:    q,
+		bots:     make(map[string]Bot),
+		inbox:    make([]chan incoming, workers),
+		pending:  make(map[string]*pending),
+		regexes:  make(map[string]*regexp.Regexp),
+	}
+	for i := range e.inbox {
+		e.inbox[i] = make(chan incoming, 256)
+	}
+	return e
+}
+
+// Start sobe os workers que leem a configuração e aplicam as palavras de
+// parada e o debounce. Cada chat cai sempre no mesmo worker, preservando a
+// ordem das mensagens.
+func (e *Engine) Start(ctx context.Context) {
+	for _, ch := range e.inbox {
+		go func(ch chan incoming) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case in := <-ch:
+					e.receive(ctx, in)
+				}
+			}
+		}(ch)
+	}
+}
+
+// Register associa um bot ao nome usado nas regras.
+func (e *Engine) Register(name string, bot Bot) {
+	e.bots[name] = bot
+}
+
+// HandleEvent é o listener do barramento: só filtra o evento e o entrega a um
+// worker, sem consultar o banco (roda dentro do Publish).
+func (e *Engine) HandleEvent(evt models.Event) {
+	if evt.Event != "messages.upsert" || evt.Instance == "" {
+		return
+	}
+
+	var upsert struct {
+		Type    string          `json:"type"`
+		Message json.RawMessage `json:"message"`
+	}
+	if json.Unmarshal(evt.Data, &upsert) != nil || upsert.Type != "notify" {
+		return
+	}
+	msg, ok := history.Summarize(evt.Data)
+	if !ok || msg.FromMe || !strings.Contains(msg.ChatJid, "@") {
+		return
+	}
+	if strings.TrimSpace(msg.Text) == "" && msg.Media == nil {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(evt.Instance + "|" + msg.ChatJid))
+	select {
+	case e.inbox[h.Sum32()%workers] <- incoming{instance: evt.Instance, msg: msg, raw: upsert.Message}:
+	default:
+		log.Printf("⚠️ [gatilhos] fila cheia, mensagem %s de %s sem bot", msg.MessageID, evt.Instance)
+	}
+}
+
+// receive aplica à mensagem a configuração atual da instância.
+func (e *Engine) receive(ctx context.Context, in incoming) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	cfg, err := e.configs.Get(ctx, in.instance)
+	if err != nil || !anyBot(cfg) {
+		return
+	}
+
+	if stopWord(cfg.Triggers, in.msg.Text) {
+		e.handOff(ctx, in.instance, in.msg.ChatJid, cfg.Triggers)
+		return
+	}
+
+	if cfg.Triggers.DebounceSeconds <= 0 {
+		go e.route(in.instance, []*history.Summary{in.msg}, in.raw)
+		return
+	}
+	e.debounce(in.instance, in.msg, in.raw, time.Duration(cfg.Triggers.DebounceSeconds)*time.Second)
+}
+
+// debounce reinicia a espera a cada mensagem nova do contato.
+func (e *Engine) debounce(instance string, msg *history.Summary, raw json.RawMessage, wait time.Duration) {
+	key := instance + "|" + msg.ChatJid
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Se o timer já disparou, as mensagens dele seguem e esta abre outro grupo
+	p, ok := e.pending[key]
+	if ok && p.timer.Stop() {
+		p.timer.Reset(wait)
+	} else {
+		p = &pending{}
+		e.pending[key] = p
+		p.timer = time.AfterFunc(wait, func() {
+			e.mu.Lock()
+			if e.pending[key] == p {
+				delete(e.pending, key)
+			}
+			msgs, raw := p.msgs, p.raw
+			e.mu.Unlock()
+			e.route(instance, msgs, raw)
+		})
+	}
+	p.msgs = append(p.msgs, msg)
+	p.raw = raw
+}
+
+// route aplica as regras às mensagens (já agrupadas) e entrega ao bot.
+func (e *Engine) route(instance string, msgs []*history.Summary, raw json.RawMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	last := msgs[len(msgs)-1]
+	merged := *last
+	var texts []string
+	for _, m := range msgs {
+		if t := strings.TrimSpace(m.Text); t != "" {
+			texts = append(texts, t)
+		}
+	}
+	merged.Text = strings.Join(texts, "\n")
+
+	// A configuração pode ter mudado durante o debounce
+	cfg, err := e.configs.Get(ctx, instance)
+	if err != nil {
+		return
+	}
+	if human, err := e.handoffs.Active(ctx, instance, merged.ChatJid); err != nil || human {
+		return
+	}
+
+	name, err := e.match(ctx, instance, cfg, msgs, &merged)
+	if err != nil {
+		log.Printf("⚠️ [gatilhos] erro ao avaliar regras de %s (%s): %v", merged.ChatJid, instance, err)
+		return
+	}
+	if name == "" || name == "none" || !enabled(cfg, name) {
+		return
+	}
+	if bot, ok := e.bots[name]; ok {
+		bot.Deliver(instance, &merged, raw)
+	}
+}
+
+// match devolve o bot da primeira regra que casar.
+func (e *Engine) match(ctx context.Context, instance string, cfg models.IntegrationsConfig, msgs []*history.Summary, msg *history.Summary) (string, error) {
+	group := strings.HasSuffix(msg.ChatJid, "@g.us")
+
+	if len(cfg.Triggers.Rules) == 0 {
+		if group {
+			return "", nil
+		}
+		for _, name := range defaultOrder {
+			if enabled(cfg, name) {
+				return name, nil
+			}
+		}
+		return "", nil
+	}
+
+	var tags []string
+	tagsLoaded := false
+	for _, rule := range cfg.Triggers.Rules {
+		switch rule.Chat {
+		case "any":
+		case "group":
+			if !group {
+				continue
+			}
+		default:
+			if group {
+				continue
+			}
+		}
+		if len(rule.Keywords) > 0 && !containsKeyword(msg.Text, rule.Keywords) {
+			continue
+		}
+		if rule.Regex != "" {
+			re, err := e.regex(rule.Regex)
+			if err != nil || !re.MatchString(msg.Text) {
+				continue
+			}
+		}
+		if rule.BusinessHours != nil && !InBusinessHours(rule.BusinessHours, time.Now()) {
+			continue
+		}
+		if len(rule.Tags) > 0 {
+			if !tagsLoaded {
+				var err error
+				if tags, err = e.contactTags(ctx, instance, msg.ChatJid); err != nil {
+					return "", err
+				}
+				tagsLoaded = true
+			}
+			if !intersects(tags, rule.Tags) {
+				continue
+			}
+		}
+		if rule.FirstMessageOnly {
+			first, err := e.firstContact(ctx, instance, msgs)
+			if err != nil {
+				return "", err
+			}
+			if !first {
+				continue
+			}
+		}
+		if rule.NoAgent && e.agents != nil {
+			assigned, err := e.agents.Assigned(ctx, instance, msg.ChatJid)
+			if err != nil {
+				return "", err
+			}
+			if assigned {
+				continue
+			}
+		}
+		return rule.Bot, nil
+	}
+	return "", nil
+}
+
+// handOff passa o chat para atendimento humano e avisa o contato.
+func (e *Engine) handOff(ctx context.Context, instance, jid string, cfg models.TriggersConfig) {
+	key := instance + "|" + jid
+	e.mu.Lock()
+	if p, ok := e.pending[key]; ok && p.timer.Stop() {
+		delete(e.pending, key)
+	}
+	e.mu.Unlock()
+
+	// Repetir a palavra com o chat já assumido não reenvia o aviso
+	if human, err := e.handoffs.Active(ctx, instance, jid); err != nil || human {
+		return
+	}
+
+	ttl := time.Duration(cfg.HandoffMinutes) * time.Minute
+	if _, err := e.handoffs.Start(ctx, instance, jid, "palavra de parada", ttl); err != nil {
+		log.Printf("⚠️ [gatilhos] erro ao passar %s para atendimento humano (%s): %v", jid, instance, err)
+		return
+	}
+	if cfg.HandoffMessage != "" {
+		_, err := e.queue.Enqueue(ctx, instance, models.SendMessageRequest{Type: "text", Number: jid, Text: cfg.HandoffMessage}, nil)
+		if err != nil {
+			log.Printf("⚠️ [gatilhos] erro ao avisar %s (%s): %v", jid, instance, err)
+		}
+	}
+}
+
+// firstContact indica se as mensagens agrupadas são as primeiras do chat.
+func (e *Engine) firstContact(ctx context.Context, instance string, msgs []*history.Summary) (bool, error) {
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.MessageID
+	}
+	var previous bool
+	err := e.db.GetContext(ctx, &previous, `
+		SELECT EXISTS (
+			SELECT 1 FROM mensagens
+			WHERE instance = $1 AND jid = $2 AND NOT (message_id = ANY($3))
+		)
+	`, instance, msgs[0].ChatJid, pq.Array(ids))
+	return !previous, err
+}
+
+func (e *Engine) contactTags(ctx context.Context, instance, jid string) ([]string, error) {
+	var tags []string
+	err := e.db.SelectContext(ctx, &tags, `
+		SELECT UNNEST(tags) FROM contatos WHERE instance = $1 AND jid = $2
+	`, instance, jid)
+	return tags, err
+}
+
+func (e *Engine) regex(pattern string) (*regexp.Regexp, error) {
+	e.reMu.Lock()
+	defer e.reMu.Unlock()
+
+	if re, ok := e.regexes[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	e.regexes[pattern] = re
+	return re, nil
+}
+
+// ============================================
+// CONDIÇÕES
+// ============================================
+
+func anyBot(cfg models.IntegrationsConfig) bool {
+	return cfg.Typebot.Enabled || cfg.OpenAI.Enabled || cfg.Dify.Enabled
+}
+
+func enabled(cfg models.IntegrationsConfig, bot string) bool {
+	switch bot {
+	case "typebot":
+		return cfg.Typebot.Enabled
+	case "openai":
+		return cfg.OpenAI.Enabled
+	case "dify":
+		return cfg.Dify.Enabled
+	}
+	return false
+}
+
+func stopWord(cfg models.TriggersConfig, text string) bool {
+	text = strings.TrimSpace(text)
+	for _, w := range cfg.StopWords {
+		if w = strings.TrimSpace(w); w != "" && strings.EqualFold(w, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsKeyword(text string, keywords []string) bool {
+	text = strings.ToLower(text)
+	for _, kw := range keywords {
+		if kw = strings.ToLower(strings.TrimSpace(kw)); kw != "" && strings.Contains(text, kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func intersects(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package triggers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// fakeAgents diz que há atendente atribuído nos chats de assigned.
+type fakeAgents map[string]bool
+
+func (f fakeAgents) Assigned(ctx context.Context, instance, jid string) (bool, error) {
+	return f[jid], nil
+}
+
+func TestMatch(t *testing.T) {
+	const (
+		private  = "5511987654321@s.whatsapp.net"
+		attended = "5511912345678@s.whatsapp.net"
+		group    = "120363012345678901@g.us"
+	)
+	allBots := models.IntegrationsConfig{}
+	allBots.Typebot.Enabled = true
+	allBots.Dify.Enabled = true
+	allBots.OpenAI.Enabled = true
+
+	onlyOpenAI := models.IntegrationsConfig{}
+	onlyOpenAI.OpenAI.Enabled = true
+
+	always := &models.BusinessHours{Timezone: "UTC", Start: "00:00", End: "24:00", Days: []int{0, 1, 2, 3, 4, 5, 6}}
+	never := &models.BusinessHours{Timezone: "UTC", Start: "00:00", End: "24:00", Days: []int{0, 1, 2, 3, 4, 5, 6}, Outside: true}
+
+	withRules := func(rules ...models.TriggerRule) models.IntegrationsConfig {
+		cfg := allBots
+		cfg.Triggers.Rules = rules
+		return cfg
+	}
+
+	tests := []struct {
+		name string
+		cfg  models.IntegrationsConfig
+		chat string
+		text string
+		want string
+	}{
+		{name: "sem regras usa a ordem padrão", cfg: allBots, chat: private, text: "oi", want: "typebot"},
+		{name: "sem regras pula bots desligados", cfg: onlyOpenAI, chat: private, text: "oi", want: "openai"},
+		{name: "sem regras ignora grupos", cfg: allBots, chat: group, text: "oi", want: ""},
+		{name: "sem regras e sem bots", cfg: models.IntegrationsConfig{}, chat: private, text: "oi", want: ""},
+		{
+			name: "primeira regra que casa vence",
+			cfg:  withRules(models.TriggerRule{Bot: "dify", Keywords: []string{"pedido"}}, models.TriggerRule{Bot: "openai"}),
+			chat: private, text: "Meu PEDIDO atrasou", want: "dify",
+		},
+		{
+			name: "palavra-chave ausente cai na regra seguinte",
+			cfg:  withRules(models.TriggerRule{Bot: "dify", Keywords: []string{"pedido"}}, models.TriggerRule{Bot: "openai"}),
+			chat: private, text: "bom dia", want: "openai",
+		},
+		{
+			name: "regex",
+			cfg:  withRules(models.TriggerRule{Bot: "typebot", Regex: `^\d{3}\.\d{3}\.\d{3}-\d{2}$`}),
+			chat: private, text: "123.456.789-00", want: "typebot",
+		},
+		{
+			name: "regex que não casa",
+			cfg:  withRules(models.TriggerRule{Bot: "typebot", Regex: `^\d+$`}),
+			chat: private, text: "abc", want: "",
+		},
+		{
+			name: "regra padrão não vale para grupos",
+			cfg:  withRules(models.TriggerRule{Bot: "openai"}),
+			chat: group, text: "oi", want: "",
+		},
+		{
+			name: "regra de grupo",
+			cfg:  withRules(models.TriggerRule{Bot: "openai", Chat: "group"}, models.TriggerRule{Bot: "dify", Chat: "any"}),
+			chat: group, text: "oi", want: "openai",
+		},
+		{
+			name: "regra de grupo não vale para privado",
+			cfg:  withRules(models.TriggerRule{Bot: "openai", Chat: "group"}, models.TriggerRule{Bot: "dify", Chat: "any"}),
+			chat: private, text: "oi", want: "dify",
+		},
+		{
+			name: "dentro do expediente",
+			cfg:  withRules(models.TriggerRule{Bot: "openai", BusinessHours: always}, models.TriggerRule{Bot: "none"}),
+			chat: private, text: "oi", want: "openai",
+		},
+		{
+			name: "fora do expediente",
+			cfg:  withRules(models.TriggerRule{Bot: "openai", BusinessHours: never}, models.TriggerRule{Bot: "none"}),
+			chat: private, text: "oi", want: "none",
+		},
+		{
+			name: "sem atendente atribuído",
+			cfg:  withRules(models.TriggerRule{Bot: "dify", NoAgent: true}),
+			chat: private, text: "oi", want: "dify",
+		},
+		{
+			name: "com atendente atribuído",
+			cfg:  withRules(models.TriggerRule{Bot: "dify", NoAgent: true}, models.TriggerRule{Bot: "none"}),
+			chat: attended, text: "oi", want: "none",
+		},
+		{
+			name: "nenhuma regra casa",
+			cfg:  withRules(models.TriggerRule{Bot: "dify", Keywords: []string{"pedido"}}),
+			chat: private, text: "oi", want: "",
+		},
+	}
+
+	e := New(nil, nil, nil, fakeAgents{attended: true}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &history.Summary{MessageID: "ABC", ChatJid: tt.chat, Text: tt.text}
+			got, err := e.match(context.Background(), "loja1", tt.cfg, []*history.Summary{msg}, msg)
+			if err != nil {
+				t.Fatalf("match: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("match() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopWord(t *testing.T) {
+	cfg := models.TriggersConfig{StopWords: []string{"atendente", " humano ", ""}}
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "atendente", want: true},
+		{text: "  ATENDENTE ", want: true},
+		{text: "humano", want: true},
+		{text: "quero um atendente", want: false},
+		{text: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := stopWord(cfg, tt.text); got != tt.want {
+			t.Errorf("stopWord(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestContainsKeyword(t *testing.T) {
+	tests := []struct {
+		text     string
+		keywords []string
+		want     bool
+	}{
+		{text: "Quero ver o CARDÁPIO", keywords: []string{"cardápio"}, want: true},
+		{text: "segunda via do boleto", keywords: []string{"pix", " Boleto "}, want: true},
+		{text: "oi", keywords: []string{"pix"}, want: false},
+		{text: "oi", keywords: []string{"", "  "}, want: false},
+		{text: "oi", keywords: nil, want: false},
+	}
+	for _, tt := range tests {
+		if got := containsKeyword(tt.text, tt.keywords); got != tt.want {
+			t.Errorf("containsKeyword(%q, %q) = %v, want %v", tt.text, tt.keywords, got, tt.want)
+		}
+	}
+}
+
+func TestIntersects(t *testing.T) {
+	tests := []struct {
+		have, want []string
+		match      bool
+	}{
+		{have: []string{"vip", "suporte"}, want: []string{"VIP"}, match: true},
+		{have: []string{"vip"}, want: []string{"atacado", "varejo"}, match: false},
+		{have: nil, want: []string{"vip"}, match: false},
+	}
+	for _, tt := range tests {
+		if got := intersects(tt.have, tt.want); got != tt.match {
+			t.Errorf("intersects(%q, %q) = %v, want %v", tt.have, tt.want, got, tt.match)
+		}
+	}
+}
+
+// HandleEvent roda dentro do Publish do barramento: não pode consultar a
+// configuração (o Store sem banco entraria em pânico), só enfileirar.
+func TestHandleEventOnlyQueues(t *testing.T) {
+	e := New(nil, integrations.NewStore(nil), nil, nil, nil)
+
+	upsert := func(id, jid string, fromMe bool) models.Event {
+		data := fmt.Sprintf(`{"type":"notify","message":{"key":{"remoteJid":%q,"fromMe":%v,"id":%q},"messageTimestamp":1700000000,"message":{"conversation":"oi"}}}`, jid, fromMe, id)
+		return models.Event{Instance: "loja1", Event: "messages.upsert", Data: json.RawMessage(data)}
+	}
+	e.HandleEvent(upsert("M1", "5511987654321@s.whatsapp.net", false))
+	e.HandleEvent(upsert("M2", "5511987654321@s.whatsapp.net", false))
+	e.HandleEvent(upsert("M3", "5511987654321@s.whatsapp.net", true))
+	e.HandleEvent(models.Event{Instance: "loja1", Event: "connection.update", Data: json.RawMessage(`{}`)})
+
+	queued := 0
+	for _, ch := range e.inbox {
+		queued += len(ch)
+		// Mensagens do mesmo chat ficam no mesmo worker, em ordem
+		if len(ch) == 2 && (<-ch).msg.MessageID != "M1" {
+			t.Error("mensagens do chat fora de ordem")
+		}
+	}
+	if queued != 2 {
+		t.Errorf("%d mensagens enfileiradas, want 2 (a enviada pela instância fica de fora)", queued)
+	}
+}
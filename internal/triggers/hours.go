@@ -0,0 +1,90 @@
+package triggers
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // fusos disponíveis mesmo em imagens sem zoneinfo
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+const defaultTimezone = "America/Sao_Paulo"
+
+var weekdays = []int{1, 2, 3, 4, 5}
+
+// InBusinessHours diz se now cai no expediente (ou fora dele, com Outside).
+// Expedientes que viram a noite (22:00-06:00) são aceitos.
+func InBusinessHours(h *models.BusinessHours, now time.Time) bool {
+	loc, err := time.LoadLocation(timezone(h))
+	if err != nil {
+		loc = time.UTC
+	}
+	start, errStart := ParseClock(h.Start)
+	end, errEnd := ParseClock(h.End)
+	if errStart != nil || errEnd != nil {
+		return false
+	}
+
+	now = now.In(loc)
+	minute := now.Hour()*60 + now.Minute()
+	day := int(now.Weekday())
+
+	inside := false
+	if start <= end {
+		inside = minute >= start && minute < end && hasDay(h, day)
+	} else if minute >= start {
+		inside = hasDay(h, day)
+	} else if minute < end {
+		// Madrugada: pertence ao expediente iniciado no dia anterior
+		inside = hasDay(h, (day+6)%7)
+	}
+	return inside != h.Outside
+}
+
+// ParseClock converte "HH:MM" em minutos desde a meia-noite.
+func ParseClock(s string) (int, error) {
+	var hh, mm int
+	if _, err := fmt.Sscanf(s, "%d:%d", &hh, &mm); err != nil || hh < 0 || hh > 24 || mm < 0 || mm > 59 || (hh == 24 && mm != 0) {
+		return 0, fmt.Errorf("horário inválido: %q (use HH:MM)", s)
+	}
+	return hh*60 + mm, nil
+}
+
+// ValidateBusinessHours confere horários, dias e fuso de uma regra.
+func ValidateBusinessHours(h *models.BusinessHours) error {
+	if _, err := ParseClock(h.Start); err != nil {
+		return err
+	}
+	if _, err := ParseClock(h.End); err != nil {
+		return err
+	}
+	for _, d := range h.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("dia inválido: %d (0 = domingo ... 6 = sábado)", d)
+		}
+	}
+	if _, err := time.LoadLocation(timezone(h)); err != nil {
+		return fmt.Errorf("fuso horário inválido: %q", h.Timezone)
+	}
+	return nil
+}
+
+func timezone(h *models.BusinessHours) string {
+	if h.Timezone == "" {
+		return defaultTimezone
+	}
+	return h.Timezone
+}
+
+func hasDay(h *models.BusinessHours, day int) bool {
+	days := h.Days
+	if len(days) == 0 {
+		days = weekdays
+	}
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package triggers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestInBusinessHours(t *testing.T) {
+	// 2024-01-15 é uma segunda-feira
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	commercial := models.BusinessHours{Timezone: "UTC", Start: "08:00", End: "18:00"}
+	overnight := models.BusinessHours{Timezone: "UTC", Start: "22:00", End: "06:00", Days: []int{1}}
+
+	tests := []struct {
+		name  string
+		hours models.BusinessHours
+		now   time.Time
+		want  bool
+	}{
+		{name: "dentro do expediente", hours: commercial, now: at(15, 10, 0), want: true},
+		{name: "na abertura", hours: commercial, now: at(15, 8, 0), want: true},
+		{name: "antes de abrir", hours: commercial, now: at(15, 7, 59), want: false},
+		{name: "fim é exclusivo", hours: commercial, now: at(15, 18, 0), want: false},
+		{name: "sábado fora dos dias padrão", hours: commercial, now: at(20, 10, 0), want: false},
+		{name: "sábado configurado", hours: models.BusinessHours{Timezone: "UTC", Start: "08:00", End: "12:00", Days: []int{6}}, now: at(20, 10, 0), want: true},
+		{name: "outside fora do expediente", hours: models.BusinessHours{Timezone: "UTC", Start: "08:00", End: "18:00", Outside: true}, now: at(15, 20, 0), want: true},
+		{name: "outside dentro do expediente", hours: models.BusinessHours{Timezone: "UTC", Start: "08:00", End: "18:00", Outside: true}, now: at(15, 10, 0), want: false},
+		{name: "noturno antes da meia-noite", hours: overnight, now: at(15, 23, 0), want: true},
+		{name: "noturno na madrugada seguinte", hours: overnight, now: at(16, 3, 0), want: true},
+		{name: "madrugada de expediente do dia anterior não configurado", hours: overnight, now: at(15, 3, 0), want: false},
+		{name: "noturno fora do horário", hours: overnight, now: at(15, 12, 0), want: false},
+		{name: "dia inteiro", hours: models.BusinessHours{Timezone: "UTC", Start: "00:00", End: "24:00", Days: []int{0, 1, 2, 3, 4, 5, 6}}, now: at(21, 23, 59), want: true},
+		{name: "fuso padrão São Paulo", hours: models.BusinessHours{Start: "08:00", End: "18:00"}, now: at(15, 12, 0), want: true},
+		{name: "fuso padrão São Paulo antes de abrir", hours: models.BusinessHours{Start: "08:00", End: "18:00"}, now: at(15, 10, 30), want: false},
+		{name: "horário inválido", hours: models.BusinessHours{Timezone: "UTC", Start: "8h", End: "18:00"}, now: at(15, 10, 0), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InBusinessHours(&tt.hours, tt.now); got != tt.want {
+				t.Errorf("InBusinessHours(%+v, %s) = %v, want %v", tt.hours, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "00:00", want: 0},
+		{in: "08:30", want: 510},
+		{in: "23:59", want: 1439},
+		{in: "24:00", want: 1440},
+		{in: "24:01", wantErr: true},
+		{in: "25:00", wantErr: true},
+		{in: "12:60", wantErr: true},
+		{in: "8", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseClock(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseClock(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseClock(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBusinessHours(t *testing.T) {
+	tests := []struct {
+		name    string
+		hours   models.BusinessHours
+		wantErr bool
+	}{
+		{name: "válido", hours: models.BusinessHours{Start: "08:00", End: "18:00", Days: []int{1, 2, 3}}},
+		{name: "fuso explícito", hours: models.BusinessHours{Timezone: "Europe/Lisbon", Start: "08:00", End: "18:00"}},
+		{name: "início inválido", hours: models.BusinessHours{Start: "8h", End: "18:00"}, wantErr: true},
+		{name: "fim inválido", hours: models.BusinessHours{Start: "08:00", End: ""}, wantErr: true},
+		{name: "dia inválido", hours: models.BusinessHours{Start: "08:00", End: "18:00", Days: []int{7}}, wantErr: true},
+		{name: "fuso inválido", hours: models.BusinessHours{Timezone: "Marte/Base", Start: "08:00", End: "18:00"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateBusinessHours(&tt.hours); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateBusinessHours() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
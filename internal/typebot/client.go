@@ -0,0 +1,197 @@
+package typebot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+// APIError é uma resposta de erro da API do Typebot.
+type APIError struct {
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("typebot %s respondeu %d: %s", e.Path, e.StatusCode, e.Body)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Reply é a resposta de startChat/continueChat: as bolhas a exibir e o input
+// que o fluxo aguarda (nil quando o fluxo terminou).
+type Reply struct {
+	SessionID string    `json:"sessionId"`
+	Messages  []Message `json:"messages"`
+	Input     *Input    `json:"input"`
+}
+
+type Message struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"` // text, image, video, audio, embed
+	Content struct {
+		Type     string          `json:"type"` // richText ou markdown
+		RichText json.RawMessage `json:"richText"`
+		Markdown string          `json:"markdown"`
+		URL      string          `json:"url"`
+	} `json:"content"`
+}
+
+type Input struct {
+	ID      string       `json:"id"`
+	Type    string       `json:"type"` // "choice input", "text input", ...
+	Items   []ChoiceItem `json:"items"`
+	Options struct {
+		IsMultipleChoice bool `json:"isMultipleChoice"`
+	} `json:"options"`
+}
+
+type ChoiceItem struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+// Client fala com a API de chat do viewer do Typebot (v6+).
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient recusa na conexão endereços da rede interna, exceto com
+// allowInternal (URL gravada por um super admin).
+func NewClient(baseURL string, allowInternal bool) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    webhook.NewClient(30*time.Second, allowInternal),
+	}
+}
+
+// Start abre uma sessão no fluxo publicado. As variáveis só são aplicadas se
+// existirem no fluxo.
+func (c *Client) Start(ctx context.Context, publicID string, variables map[string]string) (*Reply, error) {
+	var out Reply
+	err := c.post(ctx, "/api/v1/typebots/"+url.PathEscape(publicID)+"/startChat", map[string]interface{}{
+		"isStreamEnabled":         false,
+		"textBubbleContentFormat": "markdown",
+		"prefilledVariables":      variables,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Continue envia a resposta do contato para a sessão.
+func (c *Client) Continue(ctx context.Context, sessionID, message string) (*Reply, error) {
+	var out Reply
+	err := c.post(ctx, "/api/v1/sessions/"+url.PathEscape(sessionID)+"/continueChat", map[string]interface{}{
+		"message":                 message,
+		"textBubbleContentFormat": "markdown",
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	out.SessionID = sessionID
+	return &out, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return &APIError{Path: path, StatusCode: resp.StatusCode, Body: msg}
+	}
+	return json.Unmarshal(body, out)
+}
+
+// Text devolve o texto da bolha no formato do WhatsApp.
+func (m *Message) Text() string {
+	if m.Content.Markdown != "" || len(m.Content.RichText) == 0 {
+		return markdownToWhatsApp(m.Content.Markdown)
+	}
+
+	var nodes []richNode
+	if json.Unmarshal(m.Content.RichText, &nodes) != nil {
+		return ""
+	}
+	var b strings.Builder
+	for i, n := range nodes {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		n.write(&b)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// richNode é um nó do richText (Slate) das bolhas de texto.
+type richNode struct {
+	Type     string     `json:"type"`
+	Text     string     `json:"text"`
+	URL      string     `json:"url"`
+	Bold     bool       `json:"bold"`
+	Italic   bool       `json:"italic"`
+	Children []richNode `json:"children"`
+}
+
+func (n richNode) write(b *strings.Builder) {
+	if len(n.Children) == 0 {
+		text := n.Text
+		if strings.TrimSpace(text) != "" {
+			if n.Bold {
+				text = "*" + text + "*"
+			}
+			if n.Italic {
+				text = "_" + text + "_"
+			}
+		}
+		b.WriteString(text)
+		return
+	}
+	for _, child := range n.Children {
+		child.write(b)
+	}
+	if n.Type == "a" && n.URL != "" {
+		b.WriteString(" (" + n.URL + ")")
+	}
+}
+
+// markdownToWhatsApp converte o negrito do markdown do Typebot e remove os
+// escapes; itálico (_x_) e riscado (~x~) já coincidem.
+func markdownToWhatsApp(s string) string {
+	s = strings.ReplaceAll(s, "**", "*")
+	s = strings.NewReplacer(`\_`, "_", `\*`, "*", `\~`, "~", `\#`, "#", `\-`, "-", `\.`, ".").Replace(s)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,65 @@
+package typebot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/webhook"
+)
+
+func TestClientStartAndContinue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/api/v1/typebots/menu-atendimento/startChat":
+			vars, _ := body["prefilledVariables"].(map[string]interface{})
+			if vars["remoteJid"] != "5511987654321@s.whatsapp.net" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"sessionId":"s1","messages":[{"type":"text","content":{"type":"markdown","markdown":"**Olá**"}}],
+				"input":{"type":"choice input","items":[{"id":"a","content":"Vendas"}]}}`))
+		case "/api/v1/sessions/s1/continueChat":
+			if body["message"] != "Vendas" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"messages":[{"type":"text","content":{"type":"markdown","markdown":"Até logo"}}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	vars := map[string]string{"remoteJid": "5511987654321@s.whatsapp.net"}
+
+	// O httptest escuta em 127.0.0.1: sem a liberação do super admin a
+	// conexão é recusada
+	if _, err := NewClient(srv.URL, false).Start(ctx, "menu-atendimento", vars); !errors.Is(err, webhook.ErrInvalidURL) {
+		t.Fatalf("Typebot na rede interna sem liberação: err = %v", err)
+	}
+
+	client := NewClient(srv.URL+"/", true)
+	reply, err := client.Start(ctx, "menu-atendimento", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.SessionID != "s1" || len(reply.Messages) != 1 || reply.Input == nil || reply.Input.Items[0].Content != "Vendas" {
+		t.Fatalf("Start() = %+v", reply)
+	}
+
+	reply, err = client.Continue(ctx, "s1", "Vendas")
+	if err != nil || reply.SessionID != "s1" || reply.Input != nil {
+		t.Errorf("Continue() = %+v, %v; want fim do fluxo na mesma sessão", reply, err)
+	}
+
+	if _, err := client.Continue(ctx, "expirada", "oi"); !isNotFound(err) {
+		t.Errorf("sessão desconhecida: err = %v, want 404", err)
+	}
+}
@@ -0,0 +1,264 @@
+package typebot
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nexus/gowhats/internal/handoff"
+	"github.com/nexus/gowhats/internal/history"
+	"github.com/nexus/gowhats/internal/integrations"
+	"github.com/nexus/gowhats/internal/models"
+	"github.com/nexus/gowhats/internal/whatsapp"
+)
+
+const (
+	workers = 4
+
+	maxButtons = 3  // acima disso as opções viram lista
+	maxRows    = 10 // limite de linhas por seção de lista
+)
+
+// job é uma mensagem recebida a entregar ao fluxo.
+type job struct {
+	instance string
+	cfg      models.TypebotConfig
+	msg      *history.Summary
+}
+
+// Connector conduz cada contato por um fluxo do Typebot: a mensagem recebida
+// inicia (gatilho) ou continua a sessão e as bolhas de resposta voltam como
+// texto, mídia, botões ou lista.
+type Connector struct {
+	configs  *integrations.Store
+	sessions *Sessions
+	handoffs *handoff.Store
+	service  *whatsapp.Service
+
+	jobs []chan job
+}
+
+func New(configs *integrations.Store, sessions *Sessions, handoffs *handoff.Store, service *whatsapp.Service) *Connector {
+	c := &Connector{
+		configs:  configs,
+		sessions: sessions,
+		handoffs: handoffs,
+		service:  service,
+		jobs:     make([]chan job, workers),
+	}
+	for i := range c.jobs {
+		c.jobs[i] = make(chan job, 256)
+	}
+	return c
+}
+
+// Start sobe os workers. Cada contato cai sempre no mesmo worker, preservando
+// a ordem das respostas.
+func (c *Connector) Start(ctx context.Context) {
+	for _, ch := range c.jobs {
+		go func(ch chan job) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-ch:
+					if err := c.handle(ctx, j); err != nil {
+						log.Printf("⚠️ [typebot] erro no fluxo de %s (%s): %v", j.msg.ChatJid, j.instance, err)
+					}
+				}
+			}
+		}(ch)
+	}
+}
+
+// Deliver agenda uma mensagem encaminhada pelo motor de gatilhos. Só texto
+// (ou resposta a botões/listas) conduz o fluxo.
+func (c *Connector) Deliver(instance string, msg *history.Summary, raw json.RawMessage) {
+	if strings.TrimSpace(msg.Text) == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cfg, err := c.configs.Get(ctx, instance)
+	if err != nil || !cfg.Typebot.Enabled {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(instance + "|" + msg.ChatJid))
+	select {
+	case c.jobs[h.Sum32()%workers] <- job{instance: instance, cfg: cfg.Typebot, msg: msg}:
+	default:
+		log.Printf("⚠️ [typebot] fila cheia, mensagem %s de %s ignorada", msg.MessageID, instance)
+	}
+}
+
+func (c *Connector) handle(ctx context.Context, j job) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	jid, text := j.msg.ChatJid, strings.TrimSpace(j.msg.Text)
+
+	if human, err := c.handoffs.Active(ctx, j.instance, jid); err != nil || human {
+		return err
+	}
+
+	sess, err := c.sessions.Get(ctx, j.instance, jid)
+	if err != nil {
+		return err
+	}
+	if sess != nil && sess.Status == StatusPaused {
+		return nil
+	}
+	if sess != nil && j.cfg.StopKeyword != "" && strings.EqualFold(text, j.cfg.StopKeyword) {
+		return c.sessions.Delete(ctx, j.instance, jid)
+	}
+	if sess != nil && expired(sess, j.cfg) {
+		if err := c.sessions.Delete(ctx, j.instance, jid); err != nil {
+			return err
+		}
+		sess = nil
+	}
+
+	client := NewClient(j.cfg.URL, j.cfg.AllowInternal)
+	var reply *Reply
+	if sess != nil {
+		reply, err = client.Continue(ctx, sess.SessionID, text)
+		if isNotFound(err) {
+			// Sessão expirou do lado do Typebot
+			if err := c.sessions.Delete(ctx, j.instance, jid); err != nil {
+				return err
+			}
+			sess = nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if sess == nil {
+		if !triggered(j.cfg, text) {
+			return nil
+		}
+		reply, err = client.Start(ctx, j.cfg.Typebot, map[string]string{
+			"remoteJid":    jid,
+			"pushName":     j.msg.PushName,
+			"instanceName": j.instance,
+			"message":      text,
+		})
+		if err != nil {
+			return err
+		}
+		if err := c.sessions.Start(ctx, j.instance, jid, reply.SessionID); err != nil {
+			return err
+		}
+	}
+
+	sendErr := c.send(ctx, j.instance, jid, j.cfg, reply)
+
+	// Sem input o fluxo chegou ao fim
+	if reply.Input == nil {
+		if err := c.sessions.Delete(ctx, j.instance, jid); err != nil {
+			return err
+		}
+	} else if err := c.sessions.Touch(ctx, j.instance, jid); err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// send entrega as bolhas na ordem. Um input de escolha vira botões (até 3
+// opções) ou lista, usando o último texto como corpo.
+func (c *Connector) send(ctx context.Context, instance, jid string, cfg models.TypebotConfig, reply *Reply) error {
+	messages := reply.Messages
+	choice := reply.Input != nil && reply.Input.Type == "choice input" && len(reply.Input.Items) > 0
+
+	body := ""
+	if choice && len(messages) > 0 && messages[len(messages)-1].Type == "text" {
+		body = messages[len(messages)-1].Text()
+		messages = messages[:len(messages)-1]
+	}
+
+	for _, m := range messages {
+		var err error
+		switch m.Type {
+		case "text":
+			if text := m.Text(); text != "" {
+				_, err = c.service.SendMessage(ctx, instance, models.SendMessageRequest{Type: "text", Number: jid, Text: text})
+			}
+		case "image", "video", "audio":
+			if m.Content.URL != "" {
+				_, err = c.service.SendMessage(ctx, instance, models.SendMessageRequest{
+					Type: "media", Number: jid, Media: &models.MediaPayload{Type: m.Type, URL: m.Content.URL},
+				})
+			}
+		case "embed":
+			if m.Content.URL != "" {
+				_, err = c.service.SendMessage(ctx, instance, models.SendMessageRequest{Type: "text", Number: jid, Text: m.Content.URL})
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !choice {
+		return nil
+	}
+	if body == "" {
+		body = "Escolha uma opção:"
+	}
+	items := reply.Input.Items
+
+	// A resposta volta com o texto da opção, que o Typebot reconhece
+	if len(items) <= maxButtons {
+		buttons := make([]whatsapp.Button, len(items))
+		for i, item := range items {
+			buttons[i] = whatsapp.Button{ID: item.Content, Text: item.Content}
+		}
+		_, err := c.service.SendButtons(ctx, whatsapp.SendButtonsRequest{
+			Instance: instance, Number: jid, Message: body, Buttons: buttons,
+		})
+		return err
+	}
+
+	var sections []models.ListSection
+	for i := 0; i < len(items); i += maxRows {
+		end := i + maxRows
+		if end > len(items) {
+			end = len(items)
+		}
+		section := models.ListSection{Title: "Opções"}
+		for _, item := range items[i:end] {
+			section.Rows = append(section.Rows, models.ListRow{ID: item.Content, Title: item.Content})
+		}
+		sections = append(sections, section)
+	}
+	buttonText := cfg.ListButtonText
+	if buttonText == "" {
+		buttonText = "Ver opções"
+	}
+	_, err := c.service.SendList(ctx, whatsapp.SendListRequest{
+		Instance: instance, Number: jid, Message: body, ButtonText: buttonText, Sections: sections,
+	})
+	return err
+}
+
+// triggered decide se a mensagem inicia o fluxo para um contato sem sessão.
+func triggered(cfg models.TypebotConfig, text string) bool {
+	if cfg.TriggerType != "keyword" {
+		return true
+	}
+	for _, kw := range cfg.Keywords {
+		if strings.EqualFold(strings.TrimSpace(kw), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func expired(sess *Session, cfg models.TypebotConfig) bool {
+	return cfg.ExpireMinutes > 0 && time.Since(sess.AtualizadoEm) > time.Duration(cfg.ExpireMinutes)*time.Minute
+}
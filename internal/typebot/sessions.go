@@ -0,0 +1,127 @@
+package typebot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrSessionNotFound = errors.New("sessão não encontrada")
+
+const (
+	StatusActive = "active"
+	StatusPaused = "paused" // atendimento humano: o bot não responde o contato
+)
+
+// Session é o estado do contato no fluxo (typebot_sessoes). Um contato
+// pausado sem fluxo em andamento tem SessionID vazio.
+type Session struct {
+	Instance     string    `db:"instance" json:"instance"`
+	Jid          string    `db:"jid" json:"jid"`
+	SessionID    string    `db:"session_id" json:"sessionId,omitempty"`
+	Status       string    `db:"status" json:"status"`
+	CriadoEm     time.Time `db:"criado_em" json:"createdAt"`
+	AtualizadoEm time.Time `db:"atualizado_em" json:"updatedAt"`
+}
+
+type Sessions struct {
+	db *sqlx.DB
+}
+
+func NewSessions(db *sqlx.DB) *Sessions {
+	return &Sessions{db: db}
+}
+
+// Get devolve a sessão do contato ou nil quando não há.
+func (s *Sessions) Get(ctx context.Context, instance, jid string) (*Session, error) {
+	var sess Session
+	err := s.db.GetContext(ctx, &sess, `
+		SELECT instance, jid, session_id, status, criado_em, atualizado_em
+		FROM typebot_sessoes WHERE instance = $1 AND jid = $2
+	`, instance, jid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *Sessions) List(ctx context.Context, instance, status string) ([]Session, error) {
+	sessions := []Session{}
+	err := s.db.SelectContext(ctx, &sessions, `
+		SELECT instance, jid, session_id, status, criado_em, atualizado_em
+		FROM typebot_sessoes
+		WHERE instance = $1 AND ($2 = '' OR status = $2)
+		ORDER BY atualizado_em DESC
+	`, instance, status)
+	return sessions, err
+}
+
+// Start grava uma sessão nova para o contato.
+func (s *Sessions) Start(ctx context.Context, instance, jid, sessionID string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO typebot_sessoes (instance, jid, session_id, status)
+		VALUES ($1, $2, $3, 'active')
+		ON CONFLICT (instance, jid) DO UPDATE
+		SET session_id = EXCLUDED.session_id, status = 'active', criado_em = NOW(), atualizado_em = NOW()
+	`, instance, jid, sessionID)
+	return err
+}
+
+// Touch marca atividade na sessão (conta para a expiração).
+func (s *Sessions) Touch(ctx context.Context, instance, jid string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE typebot_sessoes SET atualizado_em = NOW() WHERE instance = $1 AND jid = $2
+	`, instance, jid)
+	return err
+}
+
+func (s *Sessions) Delete(ctx context.Context, instance, jid string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM typebot_sessoes WHERE instance = $1 AND jid = $2`, instance, jid)
+	return err
+}
+
+// Pause silencia o bot para o contato, com ou sem fluxo em andamento.
+func (s *Sessions) Pause(ctx context.Context, instance, jid string) (*Session, error) {
+	var sess Session
+	err := s.db.GetContext(ctx, &sess, `
+		INSERT INTO typebot_sessoes (instance, jid, session_id, status)
+		VALUES ($1, $2, '', 'paused')
+		ON CONFLICT (instance, jid) DO UPDATE SET status = 'paused', atualizado_em = NOW()
+		RETURNING instance, jid, session_id, status, criado_em, atualizado_em
+	`, instance, jid)
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// Resume devolve o contato ao bot. Sem fluxo em andamento a pausa é apenas
+// removida e o próximo gatilho inicia uma sessão nova.
+func (s *Sessions) Resume(ctx context.Context, instance, jid string) (*Session, error) {
+	sess, err := s.Get(ctx, instance, jid)
+	if err != nil {
+		return nil, err
+	}
+	if sess == nil || sess.Status != StatusPaused {
+		return nil, ErrSessionNotFound
+	}
+	if sess.SessionID == "" {
+		return nil, s.Delete(ctx, instance, jid)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE typebot_sessoes SET status = 'active', atualizado_em = NOW() WHERE instance = $1 AND jid = $2
+	`, instance, jid)
+	if err != nil {
+		return nil, err
+	}
+	sess.Status = StatusActive
+	sess.AtualizadoEm = time.Now()
+	return sess, nil
+}
@@ -0,0 +1,292 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/metrics"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// Cabeçalhos enviados em cada entrega. A assinatura é o HMAC-SHA256 de
+// "<timestamp>.<corpo>" com o segredo do destino, no formato "sha256=<hex>",
+// para que uma entrega capturada não possa ser reenviada com outro horário.
+const (
+	HeaderSignature = "X-Nexus-Signature"
+	HeaderEvent     = "X-Nexus-Event"
+	HeaderDelivery  = "X-Nexus-Delivery"
+	HeaderTimestamp = "X-Nexus-Timestamp"
+)
+
+type Options struct {
+	GlobalURL    string
+	GlobalSecret string
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Timeout      time.Duration
+	Workers      int
+	PollInterval time.Duration // intervalo de busca das retentativas vencidas
+}
+
+// Dispatcher entrega eventos para a URL global e para a URL de cada
+// instância, com retentativas em backoff exponencial. As retentativas ficam na
+// tabela webhook_retries (sobrevivem a reinícios) e as entregas que esgotam as
+// tentativas vão para webhook_dead_letters.
+type Dispatcher struct {
+	db      *sqlx.DB
+	opts    Options
+	client  *http.Client // URL global e destinos liberados para a rede interna
+	guarded *http.Client // demais destinos: recusa a rede interna ao conectar
+	targets *targetCache
+	queue   chan *delivery
+}
+
+type delivery struct {
+	ID       string
+	Instance string
+	Event    string
+	URL      string
+	Secret   string
+	Target   string // "global" ou "instance"
+	Payload  []byte
+	Attempt  int
+	LastCode int
+	LastErr  string
+	RetryID  int64 // linha em webhook_retries, a partir da primeira falha
+}
+
+func NewDispatcher(db *sqlx.DB, opts Options) *Dispatcher {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 6
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 2 * time.Second
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 10 * time.Minute
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+
+	d := &Dispatcher{
+		db:      db,
+		opts:    opts,
+		client:  NewClient(opts.Timeout, true),
+		guarded: NewClient(opts.Timeout, false),
+		targets: newTargetCache(db, 30*time.Second),
+		queue:   make(chan *delivery, 1024),
+	}
+	// Um 30x conta como falha da entrega: o corpo assinado não é reenviado
+	// para outro endereço
+	for _, c := range []*http.Client{d.client, d.guarded} {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	return d
+}
+
+// Start sobe os workers de entrega e o loop das retentativas; eles encerram
+// quando ctx é cancelado.
+func (d *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < d.opts.Workers; i++ {
+		go d.worker(ctx)
+	}
+	go d.retryLoop(ctx)
+}
+
+// Dispatch agenda a entrega do evento para todos os destinos interessados.
+func (d *Dispatcher) Dispatch(evt models.Event) {
+	if evt.ID == "" {
+		evt.ID = uuid.NewString()
+	}
+	if evt.Timestamp.IsZero() {
+		evt.Timestamp = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("❌ [webhook] evento %s inválido: %v", evt.Event, err)
+		return
+	}
+
+	if d.opts.GlobalURL != "" {
+		d.enqueue(&delivery{
+			ID: evt.ID, Instance: evt.Instance, Event: evt.Event,
+			URL: d.opts.GlobalURL, Secret: d.opts.GlobalSecret, Target: "global",
+			Payload: payload,
+		})
+	}
+
+	if evt.Instance == "" {
+		return
+	}
+	target, err := d.targets.get(evt.Instance)
+	if err != nil {
+		log.Printf("⚠️ [webhook] config da instância %s indisponível: %v", evt.Instance, err)
+		return
+	}
+	if target == nil || !target.Enabled || target.URL == "" || !target.wants(evt.Event) {
+		return
+	}
+
+	d.enqueue(&delivery{
+		ID: evt.ID, Instance: evt.Instance, Event: evt.Event,
+		URL: target.URL, Secret: d.secretFor("instance", evt.Instance), Target: "instance",
+		Payload: payload,
+	})
+}
+
+// secretFor devolve o segredo atual do destino. Ele não é persistido junto
+// com retentativas e dead letters.
+func (d *Dispatcher) secretFor(dest, instance string) string {
+	if dest == "instance" {
+		if t, err := d.targets.get(instance); err == nil && t != nil && t.Secret != "" {
+			return t.Secret
+		}
+	}
+	return d.opts.GlobalSecret
+}
+
+// clientFor escolhe o cliente HTTP do destino. Só a URL global e as URLs
+// gravadas por um super admin podem apontar para a rede interna.
+func (d *Dispatcher) clientFor(dl *delivery) *http.Client {
+	if dl.Target == "global" {
+		return d.client
+	}
+	if t, err := d.targets.get(dl.Instance); err == nil && t != nil && t.AllowInternal {
+		return d.client
+	}
+	return d.guarded
+}
+
+// Invalidate descarta a config em cache da instância (após PUT /webhook).
+func (d *Dispatcher) Invalidate(instance string) {
+	d.targets.invalidate(instance)
+}
+
+func (d *Dispatcher) enqueue(dl *delivery) {
+	select {
+	case d.queue <- dl:
+	default:
+		if dl.RetryID != 0 {
+			// Continua no banco; volta quando a reserva expirar
+			return
+		}
+		// Fila cheia: não bloqueia quem emitiu o evento
+		dl.LastErr = "fila de entrega cheia"
+		metrics.WebhookDelivery(dl.Instance, "dead_letter")
+		d.deadLetter(dl)
+	}
+}
+
+func (d *Dispatcher) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dl := <-d.queue:
+			d.deliver(ctx, dl)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, dl *delivery) {
+	dl.Attempt++
+
+	code, err := d.post(ctx, dl)
+	if err == nil {
+		metrics.WebhookDelivery(dl.Instance, "success")
+		d.forgetRetry(dl)
+		return
+	}
+
+	dl.LastCode = code
+	dl.LastErr = err.Error()
+
+	if dl.Attempt >= d.opts.MaxAttempts {
+		log.Printf("❌ [webhook] %s para %s falhou após %d tentativas: %v", dl.Event, dl.URL, dl.Attempt, err)
+		metrics.WebhookDelivery(dl.Instance, "dead_letter")
+		d.deadLetter(dl)
+		d.forgetRetry(dl)
+		return
+	}
+	metrics.WebhookDelivery(dl.Instance, "retry")
+
+	wait := d.backoff(dl.Attempt)
+	if err := d.scheduleRetry(dl, wait); err != nil {
+		// Sem banco, a retentativa fica só em memória
+		log.Printf("⚠️ [webhook] erro ao gravar retentativa de %s: %v", dl.Event, err)
+		time.AfterFunc(wait, func() {
+			if ctx.Err() == nil {
+				d.enqueue(dl)
+			}
+		})
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, dl *delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NexusWA-Webhook/1.0")
+	req.Header.Set(HeaderEvent, dl.Event)
+	req.Header.Set(HeaderDelivery, dl.ID)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if dl.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(dl.Secret, timestamp, dl.Payload))
+	}
+
+	resp, err := d.clientFor(dl).Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("destino respondeu %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff devolve BaseDelay * 2^(tentativa-1), limitado a MaxDelay, com até
+// 20% de jitter para não sincronizar retentativas.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.opts.BaseDelay << uint(attempt-1)
+	if wait <= 0 || wait > d.opts.MaxDelay {
+		wait = d.opts.MaxDelay
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait)/5+1))
+}
+
+// Sign calcula a assinatura enviada em X-Nexus-Signature: HMAC-SHA256 de
+// timestamp + "." + corpo, com o timestamp de X-Nexus-Timestamp.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
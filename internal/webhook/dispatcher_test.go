@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignKnownVectors(t *testing.T) {
+	got := Sign("key", "1700000000", []byte("The quick brown fox jumps over the lazy dog"))
+	if want := "sha256=2f658d6aef4f246e91cd741bbcded7479e9605f9d41c9e248122a117e0e1765b"; got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+	got = Sign("", "", nil)
+	if want := "sha256=0d0ab78babcce47b6860946aad720dcc13630f70074364b65665c4caefb81ecf"; got != want {
+		t.Errorf("Sign() vazio = %s, want %s", got, want)
+	}
+
+	body := []byte(`{"event":"message.received"}`)
+	if Sign("s3gr3d0", "1700000000", body) == Sign("s3gr3d0", "1700000001", body) {
+		t.Error("o timestamp não entra na assinatura")
+	}
+}
+
+// receiver guarda a última entrega recebida e responde com status.
+type receiver struct {
+	status  int
+	headers http.Header
+	body    []byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.headers = req.Header.Clone()
+	r.body, _ = io.ReadAll(req.Body)
+	if r.status == http.StatusFound {
+		w.Header().Set("Location", "http://127.0.0.1:1/outro")
+	}
+	w.WriteHeader(r.status)
+}
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	t.Helper()
+	d := NewDispatcher(nil, Options{Timeout: 2 * time.Second})
+	d.targets.entries["publica"] = cachedTarget{target: &target{Enabled: true}, loadedAt: time.Now()}
+	d.targets.entries["interna"] = cachedTarget{target: &target{Enabled: true, AllowInternal: true}, loadedAt: time.Now()}
+	return d
+}
+
+func TestPostSignsTimestampAndBody(t *testing.T) {
+	rcv := &receiver{status: http.StatusOK}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	d := newTestDispatcher(t)
+	dl := &delivery{ID: "d-1", Event: "message.ack", URL: srv.URL, Secret: "s3gr3d0", Target: "global", Payload: []byte(`{"id":"ABC"}`)}
+	if code, err := d.post(context.Background(), dl); err != nil || code != http.StatusOK {
+		t.Fatalf("post() = %d, %v", code, err)
+	}
+
+	if rcv.headers.Get(HeaderEvent) != "message.ack" || rcv.headers.Get(HeaderDelivery) != "d-1" {
+		t.Errorf("cabeçalhos = %v", rcv.headers)
+	}
+
+	// Verificação do lado do receptor: HMAC de "<timestamp>.<corpo>"
+	ts := rcv.headers.Get(HeaderTimestamp)
+	sig, ok := strings.CutPrefix(rcv.headers.Get(HeaderSignature), "sha256=")
+	if ts == "" || !ok {
+		t.Fatalf("timestamp %q / assinatura %q", ts, rcv.headers.Get(HeaderSignature))
+	}
+	got, _ := hex.DecodeString(sig)
+	mac := hmac.New(sha256.New, []byte("s3gr3d0"))
+	mac.Write([]byte(ts + "."))
+	mac.Write(rcv.body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		t.Error("assinatura não confere com timestamp + corpo")
+	}
+}
+
+func TestPostDoesNotFollowRedirects(t *testing.T) {
+	rcv := &receiver{status: http.StatusFound}
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	d := newTestDispatcher(t)
+	code, err := d.post(context.Background(), &delivery{URL: srv.URL, Target: "global", Payload: []byte(`{}`)})
+	if err == nil || code != http.StatusFound {
+		t.Errorf("post() = %d, %v; want falha com 302", code, err)
+	}
+}
+
+func TestPostGuardsInstanceTargets(t *testing.T) {
+	srv := httptest.NewServer(&receiver{status: http.StatusOK})
+	defer srv.Close()
+	d := newTestDispatcher(t)
+
+	// URL da instância gravada por uma key comum: o loopback é recusado ao conectar
+	_, err := d.post(context.Background(), &delivery{Instance: "publica", URL: srv.URL, Target: "instance", Payload: []byte(`{}`)})
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("destino interno da instância: err = %v, want ErrInvalidURL", err)
+	}
+
+	// Gravada pelo super admin
+	if _, err := d.post(context.Background(), &delivery{Instance: "interna", URL: srv.URL, Target: "instance", Payload: []byte(`{}`)}); err != nil {
+		t.Errorf("destino liberado pelo super admin: %v", err)
+	}
+}
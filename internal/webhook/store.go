@@ -0,0 +1,326 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// ============================================
+// CONFIGURAÇÃO POR INSTÂNCIA (tabela instancias)
+// ============================================
+
+type target struct {
+	URL           string
+	Enabled       bool
+	Secret        string
+	Events        []string
+	AllowInternal bool
+}
+
+func (t *target) wants(event string) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, e := range t.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type cachedTarget struct {
+	target   *target
+	loadedAt time.Time
+}
+
+type targetCache struct {
+	db  *sqlx.DB
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cachedTarget
+}
+
+func newTargetCache(db *sqlx.DB, ttl time.Duration) *targetCache {
+	return &targetCache{db: db, ttl: ttl, entries: make(map[string]cachedTarget)}
+}
+
+func (c *targetCache) get(instance string) (*target, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[instance]
+	c.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < c.ttl {
+		return entry.target, nil
+	}
+
+	cfg, err := GetConfig(c.db, instance)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	var t *target
+	if cfg != nil {
+		t = &target{URL: cfg.URL, Enabled: cfg.Enabled, Secret: cfg.Secret, Events: cfg.Events, AllowInternal: cfg.AllowInternal}
+	}
+
+	c.mu.Lock()
+	c.entries[instance] = cachedTarget{target: t, loadedAt: time.Now()}
+	c.mu.Unlock()
+
+	return t, nil
+}
+
+func (c *targetCache) invalidate(instance string) {
+	c.mu.Lock()
+	delete(c.entries, instance)
+	c.mu.Unlock()
+}
+
+// GetConfig lê a configuração de webhook da instância.
+func GetConfig(db *sqlx.DB, instance string) (*models.WebhookConfig, error) {
+	var row struct {
+		URL     sql.NullString `db:"webhook_url"`
+		Enabled sql.NullBool   `db:"webhook_enabled"`
+		Secret  sql.NullString `db:"webhook_secret"`
+		Events  pq.StringArray `db:"webhook_events"`
+		Interno sql.NullBool   `db:"webhook_rede_interna"`
+	}
+	err := db.Get(&row, `
+		SELECT webhook_url, webhook_enabled, webhook_secret, webhook_events, webhook_rede_interna
+		FROM instancias WHERE nome = $1
+	`, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookConfig{
+		Enabled: row.Enabled.Bool,
+		URL:     row.URL.String,
+		Secret:  row.Secret.String,
+		Events:  row.Events,
+
+		AllowInternal: row.Interno.Bool,
+	}, nil
+}
+
+// SaveConfig grava a configuração de webhook da instância.
+func SaveConfig(db *sqlx.DB, instance string, cfg models.WebhookConfig) error {
+	res, err := db.Exec(`
+		UPDATE instancias
+		SET webhook_url = $2, webhook_enabled = $3, webhook_secret = NULLIF($4, ''),
+		    webhook_events = $5, webhook_rede_interna = $6, atualizado_em = NOW()
+		WHERE nome = $1
+	`, instance, cfg.URL, cfg.Enabled, cfg.Secret, pq.Array(cfg.Events), cfg.AllowInternal)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ============================================
+// DEAD LETTERS
+// ============================================
+
+type DeadLetter struct {
+	ID           int             `db:"id" json:"id"`
+	DeliveryID   string          `db:"delivery_id" json:"deliveryId"`
+	Instance     string          `db:"instance" json:"instance"`
+	Evento       string          `db:"evento" json:"event"`
+	Destino      string          `db:"destino" json:"target"`
+	URL          string          `db:"url" json:"url"`
+	Payload      json.RawMessage `db:"payload" json:"payload"`
+	Tentativas   int             `db:"tentativas" json:"attempts"`
+	UltimoStatus *int            `db:"ultimo_status" json:"lastStatus"`
+	UltimoErro   *string         `db:"ultimo_erro" json:"lastError"`
+	CriadoEm     time.Time       `db:"criado_em" json:"createdAt"`
+}
+
+func (d *Dispatcher) deadLetter(dl *delivery) {
+	var status *int
+	if dl.LastCode > 0 {
+		status = &dl.LastCode
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO webhook_dead_letters (delivery_id, instance, evento, destino, url, payload, tentativas, ultimo_status, ultimo_erro)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, dl.ID, dl.Instance, dl.Event, dl.Target, dl.URL, string(dl.Payload), dl.Attempt, status, dl.LastErr)
+	if err != nil {
+		log.Printf("❌ [webhook] erro ao gravar dead letter: %v", err)
+	}
+}
+
+// DeadLetters lista as entregas que esgotaram as tentativas da instância.
+// Com instance vazio, lista as de eventos sem instância (só da URL global).
+func (d *Dispatcher) DeadLetters(instance string, limit int) ([]DeadLetter, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	items := []DeadLetter{}
+	err := d.db.Select(&items, `
+		SELECT id, delivery_id, instance, evento, destino, url, payload, tentativas,
+		       ultimo_status, ultimo_erro, criado_em
+		FROM webhook_dead_letters
+		WHERE COALESCE(instance, '') = $1
+		ORDER BY criado_em DESC
+		LIMIT $2
+	`, instance, limit)
+	return items, err
+}
+
+// Replay reenfileira dead letters da instância (todas quando ids é vazio) e as
+// remove da tabela. Se falharem de novo, voltam como novas dead letters.
+func (d *Dispatcher) Replay(instance string, ids []int) (int, error) {
+	var items []DeadLetter
+	var err error
+	if len(ids) == 0 {
+		err = d.db.Select(&items, `
+			DELETE FROM webhook_dead_letters WHERE COALESCE(instance, '') = $1
+			RETURNING id, delivery_id, instance, evento, destino, url, payload, tentativas,
+			          ultimo_status, ultimo_erro, criado_em
+		`, instance)
+	} else {
+		err = d.db.Select(&items, `
+			DELETE FROM webhook_dead_letters WHERE COALESCE(instance, '') = $1 AND id = ANY($2)
+			RETURNING id, delivery_id, instance, evento, destino, url, payload, tentativas,
+			          ultimo_status, ultimo_erro, criado_em
+		`, instance, pq.Array(ids))
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		d.enqueue(&delivery{
+			ID: item.DeliveryID, Instance: item.Instance, Event: item.Evento,
+			URL: item.URL, Target: item.Destino, Payload: item.Payload,
+			Secret: d.secretFor(item.Destino, item.Instance),
+		})
+	}
+
+	return len(items), nil
+}
+
+// ============================================
+// RETENTATIVAS
+// ============================================
+
+// scheduleRetry grava (ou reagenda) a próxima tentativa da entrega.
+func (d *Dispatcher) scheduleRetry(dl *delivery, wait time.Duration) error {
+	var status *int
+	if dl.LastCode > 0 {
+		status = &dl.LastCode
+	}
+	next := time.Now().Add(wait)
+	if dl.RetryID != 0 {
+		_, err := d.db.Exec(`
+			UPDATE webhook_retries
+			SET tentativas = $2, ultimo_status = $3, ultimo_erro = $4, next_attempt_at = $5
+			WHERE id = $1
+		`, dl.RetryID, dl.Attempt, status, dl.LastErr, next)
+		return err
+	}
+	return d.db.Get(&dl.RetryID, `
+		INSERT INTO webhook_retries (delivery_id, instance, evento, destino, url, payload, tentativas, ultimo_status, ultimo_erro, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`, dl.ID, dl.Instance, dl.Event, dl.Target, dl.URL, string(dl.Payload), dl.Attempt, status, dl.LastErr, next)
+}
+
+// forgetRetry remove a retentativa depois do sucesso ou da dead letter.
+func (d *Dispatcher) forgetRetry(dl *delivery) {
+	if dl.RetryID == 0 {
+		return
+	}
+	if _, err := d.db.Exec(`DELETE FROM webhook_retries WHERE id = $1`, dl.RetryID); err != nil {
+		log.Printf("⚠️ [webhook] erro ao remover retentativa %d: %v", dl.RetryID, err)
+	}
+}
+
+func (d *Dispatcher) retryLoop(ctx context.Context) {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		d.claimRetries(ctx)
+	}
+}
+
+// claimRetries reserva as retentativas vencidas e as coloca na fila de
+// entrega. A reserva adia next_attempt_at; se o processo cair no meio da
+// entrega, ela volta a vencer e outra réplica (ou o próximo boot) retoma.
+func (d *Dispatcher) claimRetries(ctx context.Context) {
+	free := cap(d.queue) - len(d.queue)
+	if free <= 0 {
+		return
+	}
+	if free > 100 {
+		free = 100
+	}
+
+	var rows []struct {
+		ID           int64           `db:"id"`
+		DeliveryID   string          `db:"delivery_id"`
+		Instance     string          `db:"instance"`
+		Evento       string          `db:"evento"`
+		Destino      string          `db:"destino"`
+		URL          string          `db:"url"`
+		Payload      json.RawMessage `db:"payload"`
+		Tentativas   int             `db:"tentativas"`
+		UltimoStatus *int            `db:"ultimo_status"`
+		UltimoErro   *string         `db:"ultimo_erro"`
+	}
+	lease := 2*d.opts.Timeout + time.Minute
+	err := d.db.SelectContext(ctx, &rows, `
+		UPDATE webhook_retries SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM webhook_retries
+			WHERE next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, delivery_id, COALESCE(instance, '') AS instance, evento, destino, url, payload,
+		          tentativas, ultimo_status, ultimo_erro
+	`, free, int(lease.Seconds()))
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("⚠️ [webhook] erro ao buscar retentativas: %v", err)
+		}
+		return
+	}
+
+	for _, r := range rows {
+		dl := &delivery{
+			ID: r.DeliveryID, Instance: r.Instance, Event: r.Evento,
+			URL: r.URL, Target: r.Destino, Payload: r.Payload,
+			Secret:  d.secretFor(r.Destino, r.Instance),
+			Attempt: r.Tentativas,
+			RetryID: r.ID,
+		}
+		if r.UltimoStatus != nil {
+			dl.LastCode = *r.UltimoStatus
+		}
+		if r.UltimoErro != nil {
+			dl.LastErr = *r.UltimoErro
+		}
+		d.enqueue(dl)
+	}
+}
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrInvalidURL = errors.New("URL de webhook inválida")
+
+// blockedNets são faixas que não aparecem em IsPrivate/IsLoopback mas também
+// não são destinos públicos.
+var blockedNets = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),
+	mustCIDR("100.64.0.0/10"), // CGNAT
+	mustCIDR("192.0.0.0/24"),
+	mustCIDR("198.18.0.0/15"),
+}
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// ValidateURL confere a URL de um destino configurado por uma instância
+// (webhook, fila SQS, integrações). Sem allowInternal (keys que não são super
+// admin), o host precisa resolver só para endereços públicos: loopback,
+// link-local, redes privadas e afins são recusados para que o gateway não seja
+// usado contra a rede interna.
+func ValidateURL(ctx context.Context, raw string, allowInternal bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	if allowInternal {
+		return nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: destino interno (%s)", ErrInvalidURL, host)
+	}
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil || len(addrs) == 0 {
+			return fmt.Errorf("%w: host %s não resolvido", ErrInvalidURL, host)
+		}
+		ips = ips[:0]
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if internalIP(ip) {
+			return fmt.Errorf("%w: destino interno (%s)", ErrInvalidURL, ip)
+		}
+	}
+	return nil
+}
+
+// NewClient devolve o cliente HTTP usado para destinos configurados pelos
+// clientes (webhooks, integrações, filas). Sem allowInternal, o endereço é
+// conferido na hora da conexão, já resolvido: um DNS que passa a apontar para
+// a rede interna depois do cadastro também é recusado. Redirecionamentos
+// passam pela mesma checagem.
+func NewClient(timeout time.Duration, allowInternal bool) *http.Client {
+	if allowInternal {
+		return &http.Client{Timeout: timeout}
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: denyInternal}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // com proxy, o endereço conferido seria o do proxy
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("redirecionamentos demais")
+			}
+			host := strings.TrimSuffix(strings.ToLower(req.URL.Hostname()), ".")
+			if (req.URL.Scheme != "http" && req.URL.Scheme != "https") || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+				return fmt.Errorf("%w: redirecionamento para %s", ErrInvalidURL, req.URL.Redacted())
+			}
+			return nil
+		},
+	}
+}
+
+// denyInternal é o Control do net.Dialer: roda com o endereço já resolvido,
+// imediatamente antes de cada conexão.
+func denyInternal(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+		return fmt.Errorf("%w: destino interno (%s)", ErrInvalidURL, host)
+	}
+	return nil
+}
+
+func internalIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateURL(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		allowInternal bool
+		wantErr       bool
+	}{
+		{name: "IP público", url: "https://93.184.216.34/hook"},
+		{name: "IPv6 público", url: "https://[2606:4700:4700::1111]/hook"},
+		{name: "esquema inválido", url: "ftp://93.184.216.34/hook", wantErr: true},
+		{name: "sem host", url: "https:///hook", wantErr: true},
+		{name: "não é URL", url: "::", wantErr: true},
+		{name: "localhost", url: "http://localhost:8080/hook", wantErr: true},
+		{name: "subdomínio de localhost", url: "http://api.localhost/hook", wantErr: true},
+		{name: "loopback", url: "http://127.0.0.1/hook", wantErr: true},
+		{name: "loopback IPv6", url: "http://[::1]/hook", wantErr: true},
+		{name: "loopback mapeado em IPv6", url: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+		{name: "rede privada 10/8", url: "http://10.0.0.5/hook", wantErr: true},
+		{name: "rede privada 192.168/16", url: "http://192.168.1.10/hook", wantErr: true},
+		{name: "rede privada 172.16/12", url: "http://172.20.0.1/hook", wantErr: true},
+		{name: "metadados da nuvem (link-local)", url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{name: "CGNAT", url: "http://100.64.0.1/hook", wantErr: true},
+		{name: "não especificado", url: "http://0.0.0.0/hook", wantErr: true},
+		{name: "ULA IPv6", url: "http://[fd00::1]/hook", wantErr: true},
+		{name: "super admin pode apontar para a rede interna", url: "http://10.0.0.5/hook", allowInternal: true},
+		{name: "super admin ainda precisa de http(s)", url: "file:///etc/passwd", allowInternal: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateURL(context.Background(), tt.url, tt.allowInternal)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidURL) {
+					t.Errorf("ValidateURL(%q) err = %v, want ErrInvalidURL", tt.url, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ValidateURL(%q): %v", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestInternalIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "8.8.8.8", want: false},
+		{ip: "198.17.255.255", want: false},
+		{ip: "198.18.0.1", want: true},
+		{ip: "192.0.0.8", want: true},
+		{ip: "224.0.0.1", want: true},
+		{ip: "fe80::1", want: true},
+	}
+	for _, tt := range tests {
+		if got := internalIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("internalIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+// O httptest escuta em 127.0.0.1: o cliente protegido não pode conectar, nem
+// direto nem seguindo um redirecionamento de um host liberado.
+func TestNewClientBlocksInternalAtDial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	_, err := NewClient(time.Second, false).Get(srv.URL)
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("cliente protegido conectou em %s: err = %v", srv.URL, err)
+	}
+
+	resp, err := NewClient(time.Second, true).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("cliente liberado: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := denyInternal("tcp", "93.184.216.34:443", nil); err != nil {
+		t.Errorf("IP público recusado: %v", err)
+	}
+	if err := denyInternal("tcp", "[::ffff:10.0.0.1]:80", nil); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("IPv4 privado mapeado em IPv6 aceito: %v", err)
+	}
+}
+
+func TestNewClientRechecksRedirects(t *testing.T) {
+	check := NewClient(time.Second, false).CheckRedirect
+	req := func(raw string) *http.Request {
+		r, _ := http.NewRequest(http.MethodGet, raw, nil)
+		return r
+	}
+
+	if err := check(req("https://hooks.example.com/b"), []*http.Request{req("https://hooks.example.com/a")}); err != nil {
+		t.Errorf("redirecionamento público recusado: %v", err)
+	}
+	if err := check(req("http://localhost/admin"), []*http.Request{req("https://hooks.example.com/a")}); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("redirecionamento para localhost aceito: %v", err)
+	}
+	if err := check(req("file:///etc/passwd"), []*http.Request{req("https://hooks.example.com/a")}); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("redirecionamento para file:// aceito: %v", err)
+	}
+	via := make([]*http.Request, 5)
+	if err := check(req("https://hooks.example.com/z"), via); err == nil {
+		t.Error("sem limite de redirecionamentos")
+	}
+}
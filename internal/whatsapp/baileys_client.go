@@ -1,80 +1,42 @@
 package whatsapp
 
 import (
-	"bytes"
-	"database/sql"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/nexus/gowhats/internal/models"
-
-	_ "github.com/lib/pq"
 )
 
 type BaileysClient struct {
 	BaseURL    string
+	APIKey     string // key de serviço enviada no header "apikey"
 	HTTPClient *http.Client
-	DB         *sql.DB
+	DB         *sqlx.DB
 }
 
-func NewBaileysClient() *BaileysClient {
-	client := &BaileysClient{
-		BaseURL: "http://localhost:3001",
+// NewBaileysClient cria o cliente do sidecar Node.js. O pool do PostgreSQL é
+// aberto uma única vez na inicialização e compartilhado com os handlers.
+func NewBaileysClient(baseURL, apiKey string, db *sqlx.DB) *BaileysClient {
+	return &BaileysClient{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		APIKey:  apiKey,
 		HTTPClient: &http.Client{
 			Timeout: 50 * time.Second,
 		},
+		DB: db,
 	}
-
-	client.initDB()
-
-	return client
 }
 
 // ============================================
 // 🆕 FUNÇÕES DE BANCO DE DADOS
 // ============================================
 
-func (c *BaileysClient) initDB() {
-	host := getEnv("DB_HOST", "localhost")
-	port := getEnv("DB_PORT", "")
-	user := getEnv("DB_USER", "")
-	password := getEnv("DB_PASS", "")
-	dbname := getEnv("DB_NAME", "")
-
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname)
-
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		fmt.Printf("❌ Erro ao conectar PostgreSQL: %v\n", err)
-		return
-	}
-
-	if err := db.Ping(); err != nil {
-		fmt.Printf("❌ Erro ao pingar PostgreSQL: %v\n", err)
-		return
-	}
-
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
-	c.DB = db
-	fmt.Println("✅ PostgreSQL conectado (Go)")
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
 func (c *BaileysClient) GetContactsDB(instance string) ([]map[string]interface{}, error) {
 	if c.DB == nil {
 		return nil, errors.New("banco de dados não conectado")
@@ -177,307 +139,273 @@ func (c *BaileysClient) GetMessagesDB(instance, jid string) ([]map[string]interf
 	return result, nil
 }
 
-// Adicione estes métodos à struct BaileysClient
+// ============================================
+// SESSÃO E INSTÂNCIA
+// ============================================
 
-func (c *BaileysClient) GetSyncStatus(instance string) (map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/v1/instance/%s/sync-status", c.BaseURL, instance)
-	
-	resp, err := c.HTTPClient.Get(url)
-	if err != nil {
+func (c *BaileysClient) GetSyncStatus(ctx context.Context, instance string) (*SyncStatus, error) {
+	var result SyncStatus
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/instance/%s/sync-status", url.PathEscape(instance)), nil, &result); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &result, nil
+}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
+func (c *BaileysClient) TriggerSync(ctx context.Context, instance string) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/v1/instance/%s/sync", url.PathEscape(instance)), nil, nil)
+}
 
-	return result, nil
+// ApplySettings envia as configurações da instância ao sidecar, que passa a
+// aplicá-las (rejeição de chamadas, presença, leitura automática).
+func (c *BaileysClient) ApplySettings(ctx context.Context, instance string, settings models.InstanceSettings) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("/v1/instance/%s/settings", url.PathEscape(instance)), settings, nil)
 }
 
-func (c *BaileysClient) TriggerSync(instance string) error {
-	url := fmt.Sprintf("%s/v1/instance/%s/sync", c.BaseURL, instance)
-	
-	resp, err := c.HTTPClient.Post(url, "application/json", nil)
-	if err != nil {
-		return err
+func (c *BaileysClient) GetInstanceInfo(ctx context.Context, instance string) (*InstanceInfo, error) {
+	var result InstanceInfo
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/instance/%s/info", url.PathEscape(instance)), nil, &result); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	return nil
+	return &result, nil
 }
 
-func (c *BaileysClient) GetInstanceInfo(instance string) (map[string]interface{}, error) {
-	url := fmt.Sprintf("%s/v1/instance/%s/info", c.BaseURL, instance)
-	
-	resp, err := c.HTTPClient.Get(url)
-	if err != nil {
+func (c *BaileysClient) StartSession(ctx context.Context, req SessionRequest) (*StartSessionResponse, error) {
+	var result StartSessionResponse
+	if err := c.do(ctx, http.MethodPost, "/session/start", req, &result); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return &result, nil
+}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+func (c *BaileysClient) RequestPairCode(ctx context.Context, req PairCodeRequest) (*PairCodeResponse, error) {
+	var result PairCodeResponse
+	if err := c.do(ctx, http.MethodPost, "/session/pair-code", req, &result); err != nil {
 		return nil, err
 	}
+	return &result, nil
+}
 
-	return result, nil
+func (c *BaileysClient) Logout(ctx context.Context, req SessionRequest) (*StatusResponse, error) {
+	var result StatusResponse
+	if err := c.do(ctx, http.MethodPost, "/session/logout", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
-// ============================================
-// FUNÇÕES EXISTENTES (NÃO MODIFICADAS)
-// ============================================
+// Connect inicia a sessão e entrega no canal o QR Code, se o Node gerar um.
+// O canal é fechado sem valor quando a instância já está conectada.
+func (c *BaileysClient) Connect(ctx context.Context, instanceKey string) (<-chan string, error) {
+	result, err := c.StartSession(ctx, SessionRequest{Instance: instanceKey})
+	if err != nil {
+		return nil, err
+	}
 
-func (c *BaileysClient) Connect(instanceKey string) (<-chan string, error) {
 	qrChan := make(chan string, 1)
-
-	go func() {
-		defer close(qrChan)
-		
-		payload := map[string]string{"instance": instanceKey}
-		data, _ := json.Marshal(payload)
-		
-		resp, err := c.HTTPClient.Post(c.BaseURL+"/session/start", "application/json", bytes.NewBuffer(data))
-		if err != nil {
-			fmt.Printf("Erro ao conectar ao Baileys: %v\n", err)
-			return
-		}
-		defer resp.Body.Close()
-
-		var result struct {
-			Status string `json:"status"`
-			QRCode string `json:"qrcode"`
-			Error  string `json:"error"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-			fmt.Printf("Decode error: %v\n", err)
-			return
-		}
-
-		if result.Error != "" {
-			fmt.Println("Erro Baileys:", result.Error)
-			return
-		}
-
-		if result.Status == "CONNECTED" {
-			return 
-		}
-
-		if result.Status == "QRCODE" && result.QRCode != "" {
-			qrChan <- result.QRCode
-		}
-	}()
+	if result.Status == "QRCODE" && result.QRCode != "" {
+		qrChan <- result.QRCode
+	}
+	close(qrChan)
 
 	return qrChan, nil
 }
 
-func (c *BaileysClient) PairPhone(instance, phone string) (string, error) {
-	payload := map[string]string{
-		"instance":    instance,
-		"phoneNumber": phone,
-	}
-	data, _ := json.Marshal(payload)
-
-	resp, err := c.HTTPClient.Post(c.BaseURL+"/session/pair-code", "application/json", bytes.NewBuffer(data))
+func (c *BaileysClient) PairPhone(ctx context.Context, instance, phone string) (string, error) {
+	result, err := c.RequestPairCode(ctx, PairCodeRequest{Instance: instance, PhoneNumber: phone})
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Status string `json:"status"`
-		Code   string `json:"code"`
-		Error  string `json:"error"`
-	}
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	if result.Error != "" {
-		return "", errors.New(result.Error)
-	}
-
 	return result.Code, nil
 }
 
-func (c *BaileysClient) GetConnectionInfo(instance string) (map[string]interface{}, error) {
-	resp, err := c.HTTPClient.Get(fmt.Sprintf("%s/v1/instance/%s/info", c.BaseURL, instance))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, errors.New("disconnected")
-	}
-
-	var info map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&info)
-	return info, nil
+func (c *BaileysClient) GetConnectionInfo(ctx context.Context, instance string) (*InstanceInfo, error) {
+	return c.GetInstanceInfo(ctx, instance)
 }
 
-func (c *BaileysClient) IsConnected(instanceKey string) bool {
-	info, err := c.GetConnectionInfo(instanceKey)
+func (c *BaileysClient) IsConnected(ctx context.Context, instanceKey string) bool {
+	info, err := c.GetConnectionInfo(ctx, instanceKey)
 	if err != nil {
 		return false
 	}
-	return info["status"] == "connected"
+	return info.Status == "connected"
 }
 
-func (c *BaileysClient) SendText(instance, number, text string, opts *models.MessageOptions) (string, error) {
-	return c.postRequest("/v1/message/text", map[string]interface{}{
-		"instance": instance, "number": number, "text": text,
-	})
+// ============================================
+// MENSAGENS
+// ============================================
+
+func (c *BaileysClient) SendText(ctx context.Context, req SendTextRequest) (string, error) {
+	return c.send(ctx, "/v1/message/text", req)
 }
 
-func (c *BaileysClient) SendButtons(instance, number, message, footer, title string, buttons []map[string]string) (string, error) {
-	return c.postRequest("/v1/message/buttons", map[string]interface{}{
-		"instance": instance,
-		"number":   number,
-		"message":  message,
-		"footer":   footer,
-		"title":    title,
-		"buttons":  buttons,
-	})
+func (c *BaileysClient) SendButtons(ctx context.Context, req SendButtonsRequest) (string, error) {
+	return c.send(ctx, "/v1/message/buttons", req)
 }
 
-func (c *BaileysClient) SendList(instance, number, title, message, footer, buttonText string, sections []map[string]interface{}) (string, error) {
-	return c.postRequest("/v1/message/list", map[string]interface{}{
-		"instance":   instance,
-		"number":     number,
-		"title":      title,
-		"message":    message,
-		"footer":     footer,
-		"buttonText": buttonText,
-		"sections":   sections,
-	})
+func (c *BaileysClient) SendList(ctx context.Context, req SendListRequest) (string, error) {
+	return c.send(ctx, "/v1/message/list", req)
 }
 
-func (c *BaileysClient) SendUrlButton(instance, number, message, footer, title, buttonText, url string) (string, error) {
-	return c.postRequest("/v1/message/url-button", map[string]interface{}{
-		"instance":   instance,
-		"number":     number,
-		"message":    message,
-		"footer":     footer,
-		"title":      title,
-		"buttonText": buttonText,
-		"url":        url,
-	})
+func (c *BaileysClient) SendUrlButton(ctx context.Context, req SendUrlButtonRequest) (string, error) {
+	return c.send(ctx, "/v1/message/url-button", req)
 }
 
 // ================= BOTÕES NOVOS COMPATÍVEIS =================
 
 // Botão de copiar código
-func (c *BaileysClient) SendCopyButton(instance, number, message, footer, title, buttonText, copyCode string) (string, error) {
-	return c.postRequest("/v1/message/copy-button", map[string]interface{}{
-		"instance":   instance,
-		"number":     number,
-		"message":    message,
-		"footer":     footer,
-		"title":      title,
-		"buttonText": buttonText,
-		"copyCode":   copyCode,
-	})
+func (c *BaileysClient) SendCopyButton(ctx context.Context, req SendCopyButtonRequest) (string, error) {
+	return c.send(ctx, "/v1/message/copy-button", req)
 }
 
 // Botões interativos (listas/carrossel/botões avançados)
-func (c *BaileysClient) SendInteractive(instance, number string, interactive *models.InteractivePayload, opts *models.MessageOptions) (string, error) {
-	return c.postRequest("/v1/message/interactive", map[string]interface{}{
-		"instance":    instance,
-		"number":      number,
-		"interactive": interactive,
-		"options":     opts,
-	})
+func (c *BaileysClient) SendInteractive(ctx context.Context, req SendInteractiveRequest) (string, error) {
+	return c.send(ctx, "/v1/message/interactive", req)
 }
 
-func (c *BaileysClient) GetMessages(instance, jid string) ([]map[string]interface{}, error) {
-	return c.getRequestList(fmt.Sprintf("/v1/messages/%s/%s", instance, jid))
+// Imagem, vídeo, áudio (inclusive PTT), documento ou figurinha
+func (c *BaileysClient) SendMedia(ctx context.Context, req SendMediaRequest) (string, error) {
+	return c.send(ctx, "/v1/message/media", req)
 }
 
-func (c *BaileysClient) GetContacts(instance string) ([]map[string]interface{}, error) {
-	return c.getRequestList(fmt.Sprintf("/v1/contacts/%s", instance))
+// DownloadMedia baixa a mídia de uma mensagem recebida.
+func (c *BaileysClient) DownloadMedia(ctx context.Context, req DownloadMediaRequest) (*MediaFile, error) {
+	var result MediaFile
+	if err := c.do(ctx, http.MethodPost, "/v1/message/download", req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
-func (c *BaileysClient) GetGroups(instance string) ([]map[string]interface{}, error) {
-	return c.getRequestList(fmt.Sprintf("/v1/groups/%s", instance))
+// send envia uma mensagem e devolve o id gerado pelo WhatsApp.
+func (c *BaileysClient) send(ctx context.Context, endpoint string, payload interface{}) (string, error) {
+	var result SendResponse
+	if err := c.do(ctx, http.MethodPost, endpoint, payload, &result); err != nil {
+		return "", err
+	}
+	if result.Status != "" && result.Status != "success" {
+		return "", &BridgeError{Method: http.MethodPost, Endpoint: endpoint, StatusCode: http.StatusBadGateway,
+			Message: fmt.Sprintf("sidecar respondeu status %q", result.Status)}
+	}
+	return result.ID(), nil
 }
 
-func (c *BaileysClient) SearchContacts(instance, query string) ([]map[string]interface{}, error) {
-	contacts, err := c.GetContacts(instance)
+// ============================================
+// CONTATOS E GRUPOS
+// ============================================
+
+func (c *BaileysClient) GetMessages(ctx context.Context, instance, jid string) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/messages/%s/%s", url.PathEscape(instance), url.PathEscape(jid)), nil, &result)
+	return result, err
+}
+
+func (c *BaileysClient) GetContacts(ctx context.Context, instance string) ([]Contact, error) {
+	var result []Contact
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/contacts/%s", url.PathEscape(instance)), nil, &result)
+	return result, err
+}
+
+func (c *BaileysClient) GetGroups(ctx context.Context, instance string) ([]GroupSummary, error) {
+	var result []GroupSummary
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/groups/%s", url.PathEscape(instance)), nil, &result)
+	return result, err
+}
+
+// OnWhatsApp devolve os jids canônicos dos números que têm conta no
+// WhatsApp (usado por jid.Resolver).
+func (c *BaileysClient) OnWhatsApp(ctx context.Context, instance string, jids []string) ([]string, error) {
+	var result CheckNumbersResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/contacts/check", CheckNumbersRequest{Instance: instance, Numbers: jids}, &result); err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, r := range result.Results {
+		if r.Exists && r.Jid != "" {
+			found = append(found, r.Jid)
+		}
+	}
+	return found, nil
+}
+
+func (c *BaileysClient) SearchContacts(ctx context.Context, instance, query string) ([]Contact, error) {
+	contacts, err := c.GetContacts(ctx, instance)
 	if err != nil {
 		return nil, err
 	}
-	var filtered []map[string]interface{}
+	var filtered []Contact
 	query = strings.ToLower(query)
 	for _, contact := range contacts {
-		name, _ := contact["name"].(string)
-		jid, _ := contact["jid"].(string)
-		if query == "" || strings.Contains(strings.ToLower(name), query) || strings.Contains(strings.ToLower(jid), query) {
+		if query == "" || strings.Contains(strings.ToLower(contact.Name), query) || strings.Contains(strings.ToLower(contact.Jid), query) {
 			filtered = append(filtered, contact)
 		}
 	}
 	return filtered, nil
 }
 
-func (c *BaileysClient) postRequest(endpoint string, payload interface{}) (string, error) {
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
-	}
-	resp, err := c.HTTPClient.Post(c.BaseURL+endpoint, "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("http error: %d", resp.StatusCode)
-	}
-	
-	var result map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-	
-	if status, ok := result["status"].(string); ok && status == "success" {
-		if key, ok := result["key"].(map[string]interface{}); ok {
-			if id, ok := key["id"].(string); ok {
-				return id, nil
-			}
-		}
-		return "sent", nil
+// ============================================
+// GERENCIAMENTO DE GRUPOS
+// ============================================
+
+func (c *BaileysClient) CreateGroup(ctx context.Context, req CreateGroupBridgeRequest) (*models.GroupInfo, error) {
+	return c.groupCall(ctx, http.MethodPost, "/v1/group/create", req)
+}
+
+func (c *BaileysClient) GetGroupInfo(ctx context.Context, instance, groupID string) (*models.GroupInfo, error) {
+	return c.groupCall(ctx, http.MethodGet, fmt.Sprintf("/v1/group/%s/%s", url.PathEscape(instance), url.PathEscape(groupID)), nil)
+}
+
+// GroupAction adiciona, remove, promove ou rebaixa participantes.
+func (c *BaileysClient) GroupAction(ctx context.Context, req GroupParticipantsRequest) (*models.GroupInfo, []models.ParticipantResult, error) {
+	var result GroupResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/group/participants", req, &result); err != nil {
+		return nil, nil, err
 	}
-	
-	if key, ok := result["key"].(map[string]interface{}); ok {
-		if id, ok := key["id"].(string); ok {
-			return id, nil
-		}
+	if result.Group == nil {
+		return nil, result.Results, nil
 	}
-	
-	return "sent", nil
+	return result.Group.ToInfo(), result.Results, nil
 }
 
-func (c *BaileysClient) getRequestList(endpoint string) ([]map[string]interface{}, error) {
-	resp, err := c.HTTPClient.Get(c.BaseURL + endpoint)
-	if err != nil {
+func (c *BaileysClient) UpdateGroup(ctx context.Context, req GroupUpdateRequest) (*models.GroupInfo, error) {
+	return c.groupCall(ctx, http.MethodPost, "/v1/group/update", req)
+}
+
+func (c *BaileysClient) UpdateGroupSettings(ctx context.Context, req GroupSettingsBridgeRequest) (*models.GroupInfo, error) {
+	return c.groupCall(ctx, http.MethodPost, "/v1/group/settings", req)
+}
+
+func (c *BaileysClient) GetGroupInvite(ctx context.Context, instance, groupID string) (*models.GroupInvite, error) {
+	var result GroupInviteResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/group/%s/%s/invite", url.PathEscape(instance), url.PathEscape(groupID)), nil, &result); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	var result []map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&result)
-	return result, nil
+	return &models.GroupInvite{Code: result.Code, Link: result.Link}, nil
 }
 
-func (c *BaileysClient) SendMedia(instance, number string, media *models.MediaPayload, opts *models.MessageOptions) (string, error) {
-	return "", nil
+func (c *BaileysClient) RevokeGroupInvite(ctx context.Context, req GroupRequest) (*models.GroupInvite, error) {
+	var result GroupInviteResponse
+	if err := c.do(ctx, http.MethodPost, "/v1/group/invite/revoke", req, &result); err != nil {
+		return nil, err
+	}
+	return &models.GroupInvite{Code: result.Code, Link: result.Link}, nil
 }
 
-func (c *BaileysClient) CreateGroup(instance, subject string, participants []string) (string, error) {
-	return "", nil
+func (c *BaileysClient) JoinGroup(ctx context.Context, req JoinGroupBridgeRequest) (*models.GroupInfo, error) {
+	return c.groupCall(ctx, http.MethodPost, "/v1/group/join", req)
 }
 
-func (c *BaileysClient) GroupAction(instance, groupID string, participants []string, action string) error {
-	return nil
+func (c *BaileysClient) LeaveGroup(ctx context.Context, req GroupRequest) error {
+	return c.do(ctx, http.MethodPost, "/v1/group/leave", req, nil)
 }
 
-// ------------------ Logout Compatível ------------------ //
-func (c *BaileysClient) Logout(data map[string]interface{}) (string, error) {
-	return c.postRequest("/session/logout", data)
+func (c *BaileysClient) groupCall(ctx context.Context, method, endpoint string, payload interface{}) (*models.GroupInfo, error) {
+	var result GroupResponse
+	if err := c.do(ctx, method, endpoint, payload, &result); err != nil {
+		return nil, err
+	}
+	if result.Group == nil {
+		return nil, &BridgeError{Method: method, Endpoint: endpoint, StatusCode: http.StatusBadGateway,
+			Message: "sidecar não devolveu os dados do grupo"}
+	}
+	return result.Group.ToInfo(), nil
 }
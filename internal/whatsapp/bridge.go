@@ -0,0 +1,221 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nexus/gowhats/internal/metrics"
+)
+
+// ============================================
+// TRANSPORTE HTTP PARA O SIDECAR NODE.JS
+// ============================================
+
+// BridgeError representa uma falha devolvida pelo sidecar Node.js. StatusCode
+// é o status HTTP recebido (0 quando o sidecar nem respondeu) e Message é o
+// campo "error" do corpo JSON, quando existir.
+type BridgeError struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+	Message    string
+}
+
+func (e *BridgeError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("sidecar indisponível (%s %s)", e.Method, e.Endpoint)
+	}
+	return fmt.Sprintf("sidecar respondeu %d (%s %s)", e.StatusCode, e.Method, e.Endpoint)
+}
+
+// RequestError indica um pedido inválido do chamador, detectado antes de
+// qualquer chamada ao sidecar.
+type RequestError struct {
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+func invalidRequest(format string, args ...interface{}) error {
+	return &RequestError{Message: fmt.Sprintf(format, args...)}
+}
+
+// HTTPStatus traduz um erro do cliente para o status que deve ser devolvido
+// ao chamador da API: pedidos inválidos viram 400, instância não conectada
+// (ou já conectada, ao parear) vira 409, mídia grande demais vira 413,
+// supervisor ausente vira 503, erros 4xx do sidecar são repassados, 5xx e
+// falhas de rede viram 502 e qualquer outro erro vira 500.
+func HTTPStatus(err error) int {
+	var re *RequestError
+	if errors.As(err, &re) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, ErrMediaTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	if errors.Is(err, ErrNoSupervisor) {
+		return http.StatusServiceUnavailable
+	}
+	var se *StateError
+	if errors.As(err, &se) || errors.Is(err, ErrAlreadyConnected) {
+		return http.StatusConflict
+	}
+	var be *BridgeError
+	if errors.As(err, &be) {
+		if be.StatusCode == 0 || be.StatusCode >= 500 {
+			return http.StatusBadGateway
+		}
+		return be.StatusCode
+	}
+	return http.StatusInternalServerError
+}
+
+// IsTransient indica se vale a pena repetir a operação que falhou: falhas de
+// rede, 5xx, 408/429, timeout e instância desconectada são transitórias. O
+// resto não: pedidos inválidos, demais 4xx do sidecar, instâncias deslogadas
+// ou banidas, operação cancelada, resposta que não decodifica e qualquer erro
+// desconhecido.
+func IsTransient(err error) bool {
+	var re *RequestError
+	if err == nil || errors.As(err, &re) || errors.Is(err, ErrNoSupervisor) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var se *StateError
+	if errors.As(err, &se) {
+		return !se.Permanent()
+	}
+	var be *BridgeError
+	if errors.As(err, &be) {
+		switch {
+		case be.StatusCode == 0, be.StatusCode >= 500:
+			return true
+		case be.StatusCode == http.StatusRequestTimeout, be.StatusCode == http.StatusTooManyRequests:
+			return true
+		case be.StatusCode == http.StatusBadRequest && be.Message == "Disconnected":
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+type apiKeyCtxKey struct{}
+
+// WithAPIKey anexa ao contexto a API Key do chamador, que passa a ser enviada
+// ao sidecar no lugar da key de serviço configurada.
+func WithAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyCtxKey{}, key)
+}
+
+// Segmentos variáveis (instância, jid, grupo) viram parâmetros no rótulo
+// das métricas, para não gerar uma série por instância.
+var operationPatterns = []struct {
+	method string
+	re     *regexp.Regexp
+	repl   string
+}{
+	{"", regexp.MustCompile(`^/v1/instance/[^/]+/`), "/v1/instance/:instance/"},
+	{"", regexp.MustCompile(`^/v1/messages/[^/]+/[^/]+$`), "/v1/messages/:instance/:jid"},
+	{http.MethodGet, regexp.MustCompile(`^/v1/(contacts|groups)/[^/]+$`), "/v1/$1/:instance"},
+	{http.MethodGet, regexp.MustCompile(`^/v1/group/[^/]+/[^/]+`), "/v1/group/:instance/:group"},
+}
+
+func operation(method, endpoint string) string {
+	for _, p := range operationPatterns {
+		if (p.method == "" || p.method == method) && p.re.MatchString(endpoint) {
+			return method + " " + p.re.ReplaceAllString(endpoint, p.repl)
+		}
+	}
+	return method + " " + endpoint
+}
+
+func (c *BaileysClient) apiKeyFor(ctx context.Context) string {
+	if key, ok := ctx.Value(apiKeyCtxKey{}).(string); ok && key != "" {
+		return key
+	}
+	return c.APIKey
+}
+
+// do executa uma chamada JSON ao sidecar. in é serializado como corpo (quando
+// não nil) e a resposta é decodificada em out (quando não nil).
+func (c *BaileysClient) do(ctx context.Context, method, endpoint string, in, out interface{}) (err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	start := time.Now()
+	defer func() {
+		code := ""
+		var bridgeErr *BridgeError
+		if errors.As(err, &bridgeErr) {
+			code = "network"
+			if bridgeErr.StatusCode > 0 {
+				code = strconv.Itoa(bridgeErr.StatusCode)
+			}
+		} else if err != nil {
+			code = "error"
+		}
+		metrics.ObserveBridge(operation(method, endpoint), code, time.Since(start))
+	}()
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+endpoint, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if key := c.apiKeyFor(ctx); key != "" {
+		req.Header.Set("apikey", key)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return &BridgeError{Method: method, Endpoint: endpoint, Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &BridgeError{Method: method, Endpoint: endpoint, StatusCode: resp.StatusCode, Message: err.Error()}
+	}
+
+	if resp.StatusCode >= 400 {
+		var nodeErr struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(raw, &nodeErr)
+		return &BridgeError{Method: method, Endpoint: endpoint, StatusCode: resp.StatusCode, Message: nodeErr.Error}
+	}
+
+	if out == nil || len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("resposta inválida do sidecar (%s %s): %w", method, endpoint, err)
+	}
+	return nil
+}
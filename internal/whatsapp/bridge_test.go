@@ -0,0 +1,124 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPStatusAndIsTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    int
+		transient bool
+	}{
+		{name: "pedido inválido", err: invalidRequest("number required"), status: 400, transient: false},
+		{name: "pedido inválido embrulhado", err: fmt.Errorf("enviar: %w", invalidRequest("x")), status: 400, transient: false},
+		{name: "reconectando", err: &StateError{Instance: "loja1", State: StateReconnecting}, status: 409, transient: true},
+		{name: "aguardando QR", err: &StateError{Instance: "loja1", State: StateQRPending}, status: 409, transient: true},
+		{name: "estado desconhecido", err: &StateError{Instance: "loja1", State: StateCreated}, status: 409, transient: true},
+		{name: "deslogada", err: &StateError{Instance: "loja1", State: StateLoggedOut}, status: 409, transient: false},
+		{name: "banida", err: &StateError{Instance: "loja1", State: StateBanned}, status: 409, transient: false},
+		{name: "já conectada", err: ErrAlreadyConnected, status: 409, transient: false},
+		{name: "sem supervisor", err: ErrNoSupervisor, status: 503, transient: false},
+		{name: "sidecar fora do ar", err: &BridgeError{Method: "POST", Endpoint: "/send"}, status: 502, transient: true},
+		{name: "sidecar 500", err: &BridgeError{StatusCode: 500}, status: 502, transient: true},
+		{name: "sidecar 503", err: &BridgeError{StatusCode: 503}, status: 502, transient: true},
+		{name: "sidecar 408", err: &BridgeError{StatusCode: 408}, status: 408, transient: true},
+		{name: "sidecar 429", err: &BridgeError{StatusCode: 429}, status: 429, transient: true},
+		{name: "sidecar desconectado", err: &BridgeError{StatusCode: 400, Message: "Disconnected"}, status: 400, transient: true},
+		{name: "sidecar 400", err: &BridgeError{StatusCode: 400, Message: "invalid jid"}, status: 400, transient: false},
+		{name: "sidecar 404", err: &BridgeError{StatusCode: 404}, status: 404, transient: false},
+		{name: "timeout do contexto", err: context.DeadlineExceeded, status: 500, transient: true},
+		{name: "cancelado", err: fmt.Errorf("enviar: %w", context.Canceled), status: 500, transient: false},
+		{name: "resposta que não decodifica", err: fmt.Errorf("resposta inválida do sidecar (POST /send): %w", &json.SyntaxError{}), status: 500, transient: false},
+		{name: "erro qualquer", err: errors.New("boom"), status: 500, transient: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTTPStatus(tt.err); got != tt.status {
+				t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.status)
+			}
+			if got := IsTransient(tt.err); got != tt.transient {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.transient)
+			}
+		})
+	}
+}
+
+func TestBridgeErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  *BridgeError
+		want string
+	}{
+		{err: &BridgeError{Method: "POST", Endpoint: "/send", StatusCode: 400, Message: "invalid jid"}, want: "invalid jid"},
+		{err: &BridgeError{Method: "POST", Endpoint: "/send"}, want: "sidecar indisponível (POST /send)"},
+		{err: &BridgeError{Method: "GET", Endpoint: "/info", StatusCode: 502}, want: "sidecar respondeu 502 (GET /info)"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// sidecar sobe um sidecar falso que responde com status e corpo fixos e
+// guarda o header apikey recebido.
+func sidecar(t *testing.T, status int, body string) (*BaileysClient, *string) {
+	t.Helper()
+	var gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("apikey")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return NewBaileysClient(srv.URL+"/", "chave-de-servico", nil), &gotKey
+}
+
+func TestClientSendsCallerAPIKey(t *testing.T) {
+	client, gotKey := sidecar(t, 200, `{"status":"success","key":{"id":"3EB0ABC"}}`)
+
+	id, err := client.SendText(context.Background(), SendTextRequest{Instance: "loja1", Number: "5511987654321", Text: "oi"})
+	if err != nil || id != "3EB0ABC" {
+		t.Fatalf("SendText() = %q, %v", id, err)
+	}
+	if *gotKey != "chave-de-servico" {
+		t.Errorf("apikey sem chamador = %q, want a key de serviço", *gotKey)
+	}
+
+	if _, err := client.SendText(WithAPIKey(context.Background(), "key-do-cliente"), SendTextRequest{Instance: "loja1"}); err != nil {
+		t.Fatal(err)
+	}
+	if *gotKey != "key-do-cliente" {
+		t.Errorf("apikey = %q, want a key do chamador", *gotKey)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	client, _ := sidecar(t, 400, `{"error":"invalid jid"}`)
+	_, err := client.SendText(context.Background(), SendTextRequest{Instance: "loja1"})
+	var be *BridgeError
+	if !errors.As(err, &be) || be.StatusCode != 400 || be.Message != "invalid jid" || be.Endpoint != "/v1/message/text" {
+		t.Fatalf("erro 4xx = %#v", err)
+	}
+
+	client, _ = sidecar(t, 200, `{"status":"error"}`)
+	if _, err := client.SendText(context.Background(), SendTextRequest{}); HTTPStatus(err) != 502 {
+		t.Errorf("status diferente de success: HTTPStatus = %d, want 502 (%v)", HTTPStatus(err), err)
+	}
+
+	down := NewBaileysClient("http://127.0.0.1:1", "", nil)
+	_, err = down.GetInstanceInfo(context.Background(), "loja1")
+	if !errors.As(err, &be) || be.StatusCode != 0 || !IsTransient(err) {
+		t.Errorf("sidecar fora do ar = %#v, want BridgeError transitório sem status", err)
+	}
+}
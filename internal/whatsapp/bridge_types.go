@@ -0,0 +1,292 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// ============================================
+// CONTRATOS DO SIDECAR NODE.JS (nex-buttons/index.js)
+// ============================================
+
+// ---------------- Sessão ----------------
+
+type SessionRequest struct {
+	Instance string `json:"instance"`
+}
+
+type StartSessionResponse struct {
+	Status string `json:"status"` // QRCODE, CONNECTED ou TIMEOUT
+	QRCode string `json:"qrcode"`
+}
+
+type PairCodeRequest struct {
+	Instance    string `json:"instance"`
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+type PairCodeResponse struct {
+	Status string `json:"status"`
+	Code   string `json:"code"`
+}
+
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+type DownloadMediaRequest struct {
+	Instance string          `json:"instance"`
+	Message  json.RawMessage `json:"message"` // WAMessage original
+}
+
+// MediaFile é a mídia baixada pelo sidecar, em base64.
+type MediaFile struct {
+	MimeType string `json:"mimetype"`
+	FileName string `json:"fileName"`
+	Base64   string `json:"base64"`
+}
+
+// ---------------- Instância ----------------
+
+type InstanceInfo struct {
+	Status        string `json:"status"`
+	Jid           string `json:"jid"`
+	Name          string `json:"name"`
+	Avatar        string `json:"avatar"`
+	Contacts      int    `json:"contacts"`
+	Groups        int    `json:"groups"`
+	Messages      int    `json:"messages"`
+	Syncing       bool   `json:"syncing"`
+	SyncPhase     string `json:"syncPhase"`
+	SyncCompleted bool   `json:"syncCompleted"`
+}
+
+type DBStats struct {
+	Contacts int `json:"contacts"`
+	Groups   int `json:"groups"`
+	Messages int `json:"messages"`
+}
+
+type SyncStatus struct {
+	Syncing        bool    `json:"syncing"`
+	Progress       int     `json:"progress"`
+	Total          int     `json:"total"`
+	Phase          string  `json:"phase"`
+	Completed      bool    `json:"completed"`
+	Error          *string `json:"error"`
+	ContactsSynced int     `json:"contactsSynced"`
+	GroupsSynced   int     `json:"groupsSynced"`
+	DBStats        DBStats `json:"dbStats"`
+}
+
+// ---------------- Contatos e grupos ----------------
+
+type Contact struct {
+	Jid     string `json:"jid"`
+	Name    string `json:"name"`
+	IsGroup bool   `json:"is_group"`
+}
+
+// CheckNumbersRequest pergunta ao WhatsApp quais números têm conta.
+type CheckNumbersRequest struct {
+	Instance string   `json:"instance"`
+	Numbers  []string `json:"numbers"`
+}
+
+type CheckNumbersResponse struct {
+	Results []struct {
+		Jid    string `json:"jid"`
+		Exists bool   `json:"exists"`
+	} `json:"results"`
+}
+
+type GroupSummary struct {
+	Jid          string     `json:"jid"`
+	Name         string     `json:"name"`
+	Participants int        `json:"participants"`
+	Owner        string     `json:"owner"`
+	Created      *time.Time `json:"created"`
+}
+
+// ---------------- Gerenciamento de grupos ----------------
+
+type CreateGroupBridgeRequest struct {
+	Instance     string   `json:"instance"`
+	Subject      string   `json:"subject"`
+	Participants []string `json:"participants"`
+	Description  string   `json:"description,omitempty"`
+}
+
+type GroupParticipantsRequest struct {
+	Instance     string   `json:"instance"`
+	GroupID      string   `json:"groupId"`
+	Participants []string `json:"participants"`
+	Action       string   `json:"action"`
+}
+
+type GroupUpdateRequest struct {
+	Instance      string  `json:"instance"`
+	GroupID       string  `json:"groupId"`
+	Subject       *string `json:"subject,omitempty"`
+	Description   *string `json:"description,omitempty"`
+	PictureURL    string  `json:"pictureUrl,omitempty"`
+	PictureBase64 string  `json:"pictureBase64,omitempty"`
+}
+
+type GroupSettingsBridgeRequest struct {
+	Instance string `json:"instance"`
+	GroupID  string `json:"groupId"`
+	Announce *bool  `json:"announce,omitempty"`
+	Locked   *bool  `json:"locked,omitempty"`
+}
+
+type GroupRequest struct {
+	Instance string `json:"instance"`
+	GroupID  string `json:"groupId"`
+}
+
+type JoinGroupBridgeRequest struct {
+	Instance string `json:"instance"`
+	Code     string `json:"code"`
+}
+
+type GroupParticipant struct {
+	ID    string  `json:"id"`
+	Admin *string `json:"admin"` // "admin", "superadmin" ou null
+}
+
+// GroupMetadata é o formato de groupMetadata() do Baileys.
+type GroupMetadata struct {
+	ID           string             `json:"id"`
+	Subject      string             `json:"subject"`
+	Owner        string             `json:"owner"`
+	Desc         string             `json:"desc"`
+	Creation     int64              `json:"creation"`
+	Announce     bool               `json:"announce"`
+	Restrict     bool               `json:"restrict"`
+	Participants []GroupParticipant `json:"participants"`
+}
+
+func (m *GroupMetadata) ToInfo() *models.GroupInfo {
+	info := &models.GroupInfo{
+		ID:           m.ID,
+		Subject:      m.Subject,
+		Description:  m.Desc,
+		Owner:        m.Owner,
+		Creation:     m.Creation,
+		Announce:     m.Announce,
+		Locked:       m.Restrict,
+		Participants: []string{},
+		Admins:       []string{},
+	}
+	for _, p := range m.Participants {
+		info.Participants = append(info.Participants, p.ID)
+		if p.Admin != nil && *p.Admin != "" {
+			info.Admins = append(info.Admins, p.ID)
+		}
+	}
+	return info
+}
+
+type GroupResponse struct {
+	Status  string                     `json:"status"`
+	Group   *GroupMetadata             `json:"group"`
+	Results []models.ParticipantResult `json:"results"`
+}
+
+type GroupInviteResponse struct {
+	Status string `json:"status"`
+	Code   string `json:"code"`
+	Link   string `json:"link"`
+}
+
+// ---------------- Mensagens ----------------
+
+type SendTextRequest struct {
+	Instance string                 `json:"instance"`
+	Number   string                 `json:"number"`
+	Text     string                 `json:"text"`
+	Options  *models.MessageOptions `json:"options,omitempty"`
+}
+
+type Button struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+type SendButtonsRequest struct {
+	Instance string   `json:"instance"`
+	Number   string   `json:"number"`
+	Message  string   `json:"message"`
+	Footer   string   `json:"footer,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Buttons  []Button `json:"buttons"`
+}
+
+type SendListRequest struct {
+	Instance   string               `json:"instance"`
+	Number     string               `json:"number"`
+	Title      string               `json:"title,omitempty"`
+	Message    string               `json:"message"`
+	Footer     string               `json:"footer,omitempty"`
+	ButtonText string               `json:"buttonText,omitempty"`
+	Sections   []models.ListSection `json:"sections"`
+}
+
+type SendUrlButtonRequest struct {
+	Instance   string `json:"instance"`
+	Number     string `json:"number"`
+	Message    string `json:"message"`
+	Footer     string `json:"footer,omitempty"`
+	Title      string `json:"title,omitempty"`
+	ButtonText string `json:"buttonText,omitempty"`
+	URL        string `json:"url"`
+}
+
+type SendCopyButtonRequest struct {
+	Instance   string `json:"instance"`
+	Number     string `json:"number"`
+	Message    string `json:"message"`
+	Footer     string `json:"footer,omitempty"`
+	Title      string `json:"title,omitempty"`
+	ButtonText string `json:"buttonText,omitempty"`
+	CopyCode   string `json:"copyCode"`
+}
+
+type SendInteractiveRequest struct {
+	Instance    string                     `json:"instance"`
+	Number      string                     `json:"number"`
+	Interactive *models.InteractivePayload `json:"interactive"`
+	Options     *models.MessageOptions     `json:"options,omitempty"`
+}
+
+// SendMediaRequest achata o MediaPayload no corpo, como espera o Node.
+type SendMediaRequest struct {
+	Instance string `json:"instance"`
+	Number   string `json:"number"`
+	models.MediaPayload
+	Options *models.MessageOptions `json:"options,omitempty"`
+}
+
+type MessageKey struct {
+	RemoteJid string `json:"remoteJid"`
+	FromMe    bool   `json:"fromMe"`
+	ID        string `json:"id"`
+}
+
+// SendResponse cobre os dois formatos de resposta do Node: {key: {...}} e
+// {messageId: "..."}.
+type SendResponse struct {
+	Status    string      `json:"status"`
+	MessageID string      `json:"messageId"`
+	Key       *MessageKey `json:"key"`
+}
+
+func (r *SendResponse) ID() string {
+	if r.Key != nil && r.Key.ID != "" {
+		return r.Key.ID
+	}
+	return r.MessageID
+}
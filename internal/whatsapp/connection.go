@@ -0,0 +1,544 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// ConnectionState é o estado da conexão de uma instância com o WhatsApp.
+type ConnectionState string
+
+const (
+	StateCreated      ConnectionState = "created"    // nunca conectou (ou estado desconhecido)
+	StateQRPending    ConnectionState = "qr_pending" // aguardando a leitura do QR Code
+	StatePairing      ConnectionState = "pairing"    // código de pareamento emitido ou login em andamento
+	StateConnected    ConnectionState = "connected"
+	StateReconnecting ConnectionState = "reconnecting" // caiu; o supervisor tenta reconectar
+	StateLoggedOut    ConnectionState = "logged_out"   // sessão encerrada no celular ou via API
+	StateBanned       ConnectionState = "banned"       // número bloqueado pelo WhatsApp (403)
+)
+
+// Códigos de desconexão do Baileys (DisconnectReason) tratados à parte.
+const (
+	disconnectLoggedOut       = 401
+	disconnectForbidden       = 403
+	disconnectRestartRequired = 515 // logo depois do pareamento
+)
+
+const (
+	stateEventName      = "instance.state"
+	reconcileInterval   = 2 * time.Minute
+	reconnectBaseDelay  = 10 * time.Second // o sidecar já tenta sozinho 2s depois da queda
+	reconnectMaxDelay   = 5 * time.Minute
+	stateRequestTimeout = 60 * time.Second
+)
+
+// StateError é devolvido pelos envios quando a instância não está conectada.
+// Evita uma chamada ao sidecar só para descobrir isso.
+type StateError struct {
+	Instance string
+	State    ConnectionState
+	Reason   string
+}
+
+func (e *StateError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("instance not connected (state: %s, reason: %s)", e.State, e.Reason)
+	}
+	return fmt.Sprintf("instance not connected (state: %s)", e.State)
+}
+
+// Permanent indica que a instância só volta com uma ação do usuário (novo
+// QR Code ou pareamento), então não adianta repetir o envio.
+func (e *StateError) Permanent() bool {
+	return e.State == StateLoggedOut || e.State == StateBanned
+}
+
+// InstanceState é o estado atual de uma instância, como visto pelo supervisor.
+type InstanceState struct {
+	Instance          string          `json:"instance"`
+	State             ConnectionState `json:"state"`
+	Reason            string          `json:"reason,omitempty"`
+	Since             time.Time       `json:"since"`
+	ReconnectAttempts int             `json:"reconnectAttempts"`
+	NextReconnect     *time.Time      `json:"nextReconnect,omitempty"`
+}
+
+type transition struct {
+	instance   string
+	from       ConnectionState
+	to         ConnectionState
+	reason     string
+	statusCode int
+	at         time.Time
+}
+
+// Supervisor acompanha a conexão de cada instância pelos connection.update
+// do sidecar. O estado fica em memória (consultado a cada envio) e cada
+// transição é gravada em instancias e instancias_estados. Quando a instância
+// cai, o supervisor pede ao sidecar para reconectar com backoff exponencial.
+type Supervisor struct {
+	db     *sqlx.DB
+	client *BaileysClient
+	Events *eventbus.Bus // definido pelo servidor após montar o barramento
+
+	ctx      context.Context
+	mu       sync.Mutex
+	states   map[string]*InstanceState
+	timers   map[string]*time.Timer
+	pairings map[string]*Pairing
+	starting map[string]bool
+
+	// Transições aguardando gravação, em ordem. A fila não tem limite para
+	// que nenhuma transição (nem o instance.state dela) se perca com o banco
+	// lento; wake avisa o gravador.
+	backlogMu sync.Mutex
+	backlog   []transition
+	wake      chan struct{}
+}
+
+func NewSupervisor(db *sqlx.DB, client *BaileysClient) *Supervisor {
+	return &Supervisor{
+		db:       db,
+		client:   client,
+		ctx:      context.Background(),
+		states:   make(map[string]*InstanceState),
+		timers:   make(map[string]*time.Timer),
+		pairings: make(map[string]*Pairing),
+		starting: make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Start carrega os estados gravados, sobe o gravador das transições e
+// confere periodicamente o estado real no sidecar (eventos podem se perder
+// enquanto o gateway está fora do ar).
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		log.Printf("⚠️ [conexao] erro ao carregar estados das instâncias: %v", err)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+				for _, t := range s.drain() {
+					s.persist(t)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		s.reconcile(ctx)
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				s.mu.Lock()
+				for name, t := range s.timers {
+					t.Stop()
+					delete(s.timers, name)
+				}
+				s.mu.Unlock()
+				return
+			case <-ticker.C:
+				s.reconcile(ctx)
+			}
+		}
+	}()
+}
+
+func (s *Supervisor) load(ctx context.Context) error {
+	var rows []struct {
+		Nome   string     `db:"nome"`
+		Estado *string    `db:"estado"`
+		Motivo *string    `db:"estado_motivo"`
+		Desde  *time.Time `db:"estado_desde"`
+	}
+	err := s.db.SelectContext(ctx, &rows, `SELECT nome, estado, estado_motivo, estado_desde FROM instancias`)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range rows {
+		st := &InstanceState{Instance: r.Nome, State: StateCreated}
+		if r.Estado != nil && *r.Estado != "" {
+			st.State = ConnectionState(*r.Estado)
+		}
+		if r.Motivo != nil {
+			st.Reason = *r.Motivo
+		}
+		if r.Desde != nil {
+			st.Since = *r.Desde
+		}
+		s.states[r.Nome] = st
+	}
+	return nil
+}
+
+// ============================================
+// CONSULTA
+// ============================================
+
+// State devolve o estado conhecido da instância (created se nunca foi vista).
+func (s *Supervisor) State(instance string) InstanceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if st, ok := s.states[instance]; ok {
+		return *st
+	}
+	return InstanceState{Instance: instance, State: StateCreated}
+}
+
+// Check é chamado antes de cada envio. Só consulta o sidecar quando o
+// supervisor ainda não viu nenhuma transição da instância (por exemplo logo
+// depois da migração, com estado created sem data).
+func (s *Supervisor) Check(ctx context.Context, instance string) error {
+	st := s.State(instance)
+	if st.State == StateConnected {
+		return nil
+	}
+	if st.State == StateCreated && st.Since.IsZero() {
+		info, err := s.client.GetConnectionInfo(ctx, instance)
+		if err == nil && info.Status == "connected" {
+			s.transition(instance, StateConnected, "confirmado pelo sidecar", 0)
+			return nil
+		}
+	}
+	return &StateError{Instance: instance, State: st.State, Reason: st.Reason}
+}
+
+// ============================================
+// TRANSIÇÕES
+// ============================================
+
+// HandleEvent é o listener do barramento: traduz os connection.update do
+// sidecar em transições. Não bloqueia; a gravação é assíncrona.
+func (s *Supervisor) HandleEvent(evt models.Event) {
+	if evt.Event != "connection.update" || evt.Instance == "" {
+		return
+	}
+	var u struct {
+		Connection *string `json:"connection"`
+		QR         *string `json:"qr"`
+		StatusCode *int    `json:"statusCode"`
+		Reason     *string `json:"reason"`
+		IsNewLogin bool    `json:"isNewLogin"`
+		Me         *string `json:"me"`
+	}
+	if json.Unmarshal(evt.Data, &u) != nil {
+		return
+	}
+
+	code := 0
+	if u.StatusCode != nil {
+		code = *u.StatusCode
+	}
+	reason := ""
+	if u.Reason != nil {
+		reason = *u.Reason
+	}
+
+	connection, me := "", ""
+	if u.Connection != nil {
+		connection = *u.Connection
+	}
+	if u.Me != nil {
+		me = *u.Me
+	}
+	s.updatePairing(evt.Instance, connection, code, reason, u.IsNewLogin, me)
+
+	switch {
+	case u.Connection != nil && *u.Connection == "open":
+		s.transition(evt.Instance, StateConnected, "", 0)
+	case u.Connection != nil && *u.Connection == "close":
+		s.transition(evt.Instance, closeState(s.State(evt.Instance).State, code), reason, code)
+	case u.IsNewLogin:
+		s.transition(evt.Instance, StatePairing, "dispositivo vinculado, finalizando login", 0)
+	case u.QR != nil && *u.QR != "":
+		// O QR é renovado a cada ~20s; durante o pareamento por código ele
+		// continua sendo emitido e não muda o estado
+		if st := s.State(evt.Instance).State; st != StatePairing {
+			s.transition(evt.Instance, StateQRPending, "", 0)
+		}
+	case u.Connection != nil && *u.Connection == "connecting":
+		if s.State(evt.Instance).State == StateConnected {
+			s.transition(evt.Instance, StateReconnecting, "conexão reiniciada", 0)
+		}
+	}
+}
+
+// closeState decide o estado depois de uma queda pelo código do Baileys. Só
+// reconecta quem já estava logado: QR Code ou código de pareamento que
+// expiraram voltam para created, sem gerar um QR novo sozinhos.
+func closeState(from ConnectionState, code int) ConnectionState {
+	switch {
+	case code == disconnectLoggedOut:
+		return StateLoggedOut
+	case code == disconnectForbidden:
+		return StateBanned
+	case code == disconnectRestartRequired:
+		return StateReconnecting
+	case from == StateConnected || from == StateReconnecting:
+		return StateReconnecting
+	}
+	return StateCreated
+}
+
+// Connect pede ao sidecar para iniciar a sessão sem esperar o QR Code: ele
+// chega depois como connection.update (qr_pending) e fica no stream da
+// instância. ctx só fornece a API Key do chamador; a chamada segue mesmo
+// depois que a requisição HTTP termina.
+func (s *Supervisor) Connect(ctx context.Context, instance string) {
+	s.mu.Lock()
+	if s.starting[instance] {
+		s.mu.Unlock()
+		return
+	}
+	s.starting[instance] = true
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.starting, instance)
+			s.mu.Unlock()
+		}()
+
+		reqCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateRequestTimeout)
+		defer cancel()
+		if _, err := s.StartSession(reqCtx, instance); err != nil {
+			log.Printf("⚠️ [conexao] erro ao iniciar a sessão de %s: %v", instance, err)
+		}
+	}()
+}
+
+// StartSession pede ao sidecar para iniciar a sessão e espera a resposta
+// (o primeiro QR Code ou a confirmação de que a sessão salva conectou),
+// registrando a transição correspondente. É o modo bloqueante de Connect.
+func (s *Supervisor) StartSession(ctx context.Context, instance string) (*StartSessionResponse, error) {
+	result, err := s.client.StartSession(ctx, SessionRequest{Instance: instance})
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case result.Status == "CONNECTED":
+		s.transition(instance, StateConnected, "confirmado pelo sidecar", 0)
+	case result.Status == "QRCODE" && s.State(instance).State != StatePairing:
+		s.transition(instance, StateQRPending, "", 0)
+	}
+	return result, nil
+}
+
+// LoggedOut marca a instância como desconectada pelo usuário.
+func (s *Supervisor) LoggedOut(instance, reason string) {
+	s.transition(instance, StateLoggedOut, reason, 0)
+}
+
+func (s *Supervisor) transition(instance string, to ConnectionState, reason string, code int) {
+	now := time.Now()
+
+	s.mu.Lock()
+	st, ok := s.states[instance]
+	if !ok {
+		st = &InstanceState{Instance: instance, State: StateCreated}
+		s.states[instance] = st
+	}
+	from := st.State
+	if from == to && st.Reason == reason {
+		s.mu.Unlock()
+		return
+	}
+	if from != to {
+		st.Since = now
+	}
+	st.State = to
+	st.Reason = reason
+
+	if to == StateReconnecting {
+		s.scheduleLocked(instance, st)
+	} else {
+		st.ReconnectAttempts = 0
+		st.NextReconnect = nil
+		if t, ok := s.timers[instance]; ok {
+			t.Stop()
+			delete(s.timers, instance)
+		}
+	}
+	s.mu.Unlock()
+
+	if from != to && reason != "" {
+		log.Printf("🔌 [conexao] %s: %s → %s (%s)", instance, from, to, reason)
+	} else if from != to {
+		log.Printf("🔌 [conexao] %s: %s → %s", instance, from, to)
+	}
+	s.backlogMu.Lock()
+	s.backlog = append(s.backlog, transition{instance: instance, from: from, to: to, reason: reason, statusCode: code, at: now})
+	s.backlogMu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default: // o gravador já foi avisado
+	}
+}
+
+// drain devolve as transições pendentes, na ordem em que aconteceram.
+func (s *Supervisor) drain() []transition {
+	s.backlogMu.Lock()
+	defer s.backlogMu.Unlock()
+	pending := s.backlog
+	s.backlog = nil
+	return pending
+}
+
+// ============================================
+// RECONEXÃO
+// ============================================
+
+// scheduleLocked agenda a próxima tentativa de reconexão. Chamado com s.mu.
+func (s *Supervisor) scheduleLocked(instance string, st *InstanceState) {
+	if _, pending := s.timers[instance]; pending {
+		return
+	}
+	delay := reconnectDelay(st.ReconnectAttempts)
+	next := time.Now().Add(delay)
+	st.NextReconnect = &next
+	s.timers[instance] = time.AfterFunc(delay, func() { s.reconnect(instance) })
+}
+
+// reconnectDelay dobra a espera a cada tentativa, até reconnectMaxDelay.
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectBaseDelay
+	for i := 0; i < attempt && delay < reconnectMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+	return delay
+}
+
+func (s *Supervisor) reconnect(instance string) {
+	s.mu.Lock()
+	delete(s.timers, instance)
+	st, ok := s.states[instance]
+	if !ok || st.State != StateReconnecting || s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return
+	}
+	st.ReconnectAttempts++
+	attempt := st.ReconnectAttempts
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	log.Printf("🔄 [conexao] reconectando %s (tentativa %d)", instance, attempt)
+
+	reqCtx, cancel := context.WithTimeout(ctx, stateRequestTimeout)
+	defer cancel()
+	result, err := s.client.StartSession(reqCtx, SessionRequest{Instance: instance})
+
+	switch {
+	case err != nil:
+		log.Printf("⚠️ [conexao] erro ao reconectar %s: %v", instance, err)
+	case result.Status == "QRCODE":
+		// As credenciais se perderam: só um novo QR Code resolve
+		s.transition(instance, StateQRPending, "sessão perdida, novo QR Code necessário", 0)
+		return
+	}
+
+	// Sem o "open" do sidecar até a próxima janela, tenta de novo
+	s.mu.Lock()
+	if st, ok := s.states[instance]; ok && st.State == StateReconnecting {
+		s.scheduleLocked(instance, st)
+	}
+	s.mu.Unlock()
+}
+
+// reconcile confere no sidecar as instâncias que o supervisor considera
+// conectadas ou em reconexão.
+func (s *Supervisor) reconcile(ctx context.Context) {
+	s.mu.Lock()
+	var names []string
+	for name, st := range s.states {
+		if st.State == StateConnected || st.State == StateReconnecting {
+			names = append(names, name)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, name := range names {
+		reqCtx, cancel := context.WithTimeout(ctx, stateRequestTimeout)
+		info, err := s.client.GetConnectionInfo(reqCtx, name)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue // sidecar fora do ar: tenta na próxima rodada
+		}
+
+		current := s.State(name).State
+		switch {
+		case info.Status == "connected" && current != StateConnected:
+			s.transition(name, StateConnected, "confirmado pelo sidecar", 0)
+		case info.Status != "connected" && current == StateConnected:
+			s.transition(name, StateReconnecting, "sidecar sem sessão ativa", 0)
+		}
+	}
+}
+
+// ============================================
+// PERSISTÊNCIA
+// ============================================
+
+// persist grava o estado em instancias.estado. A coluna legada status é só do
+// sidecar, que a atualiza a cada connection.update.
+func (s *Supervisor) persist(t transition) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE instancias
+		SET estado = $2, estado_motivo = NULLIF($3, ''), estado_desde = $4,
+		    conectado_em = CASE WHEN $2 = 'connected' THEN $4 ELSE conectado_em END,
+		    desconectado_em = CASE WHEN $2 <> 'connected' AND $5 = 'connected' THEN $4 ELSE desconectado_em END
+		WHERE nome = $1
+	`, t.instance, string(t.to), t.reason, t.at, string(t.from))
+	if err == nil && t.from != t.to {
+		_, err = s.db.ExecContext(ctx, `
+			INSERT INTO instancias_estados (instance, de, para, motivo, status_code, criado_em)
+			VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, 0), $6)
+		`, t.instance, string(t.from), string(t.to), t.reason, t.statusCode, t.at)
+	}
+	if err != nil {
+		log.Printf("⚠️ [conexao] erro ao gravar estado de %s: %v", t.instance, err)
+		return
+	}
+
+	if s.Events != nil && t.from != t.to {
+		data, _ := json.Marshal(map[string]interface{}{
+			"from":       t.from,
+			"to":         t.to,
+			"reason":     t.reason,
+			"statusCode": t.statusCode,
+		})
+		s.Events.Publish(models.Event{Instance: t.instance, Event: stateEventName, Data: data, Timestamp: t.at.UTC()})
+	}
+}
@@ -0,0 +1,159 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestCloseState(t *testing.T) {
+	tests := []struct {
+		from ConnectionState
+		code int
+		want ConnectionState
+	}{
+		{from: StateConnected, code: disconnectLoggedOut, want: StateLoggedOut},
+		{from: StateConnected, code: disconnectForbidden, want: StateBanned},
+		{from: StatePairing, code: disconnectRestartRequired, want: StateReconnecting},
+		{from: StateConnected, code: 428, want: StateReconnecting},
+		{from: StateReconnecting, code: 408, want: StateReconnecting},
+		{from: StateQRPending, code: 408, want: StateCreated},
+		{from: StatePairing, code: 428, want: StateCreated},
+		{from: StateCreated, code: 0, want: StateCreated},
+	}
+	for _, tt := range tests {
+		if got := closeState(tt.from, tt.code); got != tt.want {
+			t.Errorf("closeState(%s, %d) = %s, want %s", tt.from, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestReconnectDelay(t *testing.T) {
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 5 * time.Minute, 5 * time.Minute}
+	for attempt, w := range want {
+		if got := reconnectDelay(attempt); got != w {
+			t.Errorf("reconnectDelay(%d) = %s, want %s", attempt, got, w)
+		}
+	}
+	if got := reconnectDelay(1000); got != reconnectMaxDelay {
+		t.Errorf("reconnectDelay(1000) = %s", got)
+	}
+}
+
+func connectionUpdate(instance, data string) models.Event {
+	return models.Event{Instance: instance, Event: "connection.update", Data: json.RawMessage(data)}
+}
+
+func TestHandleEventFollowsConnection(t *testing.T) {
+	s := NewSupervisor(nil, nil)
+	defer func() {
+		s.mu.Lock()
+		for _, timer := range s.timers {
+			timer.Stop()
+		}
+		s.mu.Unlock()
+	}()
+
+	steps := []struct {
+		data string
+		want ConnectionState
+	}{
+		{data: `{"qr":"2@abc"}`, want: StateQRPending},
+		{data: `{"qr":"2@def"}`, want: StateQRPending}, // QR renovado não é transição
+		{data: `{"connection":"open"}`, want: StateConnected},
+		{data: `{"connection":"close","statusCode":428,"reason":"connectionClosed"}`, want: StateReconnecting},
+		{data: `{"connection":"open"}`, want: StateConnected},
+		{data: `{"connection":"connecting"}`, want: StateReconnecting},
+		{data: `{"connection":"close","statusCode":401}`, want: StateLoggedOut},
+		{data: `{"isNewLogin":true}`, want: StatePairing},
+		{data: `{"connection":"close","statusCode":515}`, want: StateReconnecting},
+		{data: `{"connection":"close","statusCode":403}`, want: StateBanned},
+	}
+	for i, step := range steps {
+		s.HandleEvent(connectionUpdate("loja1", step.data))
+		if got := s.State("loja1").State; got != step.want {
+			t.Fatalf("passo %d (%s): estado %s, want %s", i, step.data, got, step.want)
+		}
+	}
+
+	// Eventos de outro tipo ou sem instância não mexem no estado
+	s.HandleEvent(models.Event{Instance: "loja1", Event: "messages.upsert", Data: json.RawMessage(`{"connection":"open"}`)})
+	s.HandleEvent(connectionUpdate("", `{"connection":"open"}`))
+	if got := s.State("loja1").State; got != StateBanned {
+		t.Errorf("estado mudou com evento alheio: %s", got)
+	}
+
+	var got []string
+	for _, tr := range s.drain() {
+		got = append(got, string(tr.to))
+	}
+	want := "[qr_pending connected reconnecting connected reconnecting logged_out pairing reconnecting banned]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("transições gravadas = %v, want %s", got, want)
+	}
+}
+
+func TestReconnectingSchedulesAndConnectedClears(t *testing.T) {
+	s := NewSupervisor(nil, nil)
+	s.HandleEvent(connectionUpdate("loja1", `{"connection":"open"}`))
+	s.HandleEvent(connectionUpdate("loja1", `{"connection":"close","statusCode":428}`))
+
+	st := s.State("loja1")
+	if st.NextReconnect == nil || time.Until(*st.NextReconnect) > reconnectBaseDelay {
+		t.Fatalf("reconexão não agendada: %+v", st)
+	}
+
+	s.HandleEvent(connectionUpdate("loja1", `{"connection":"open"}`))
+	s.mu.Lock()
+	_, pending := s.timers["loja1"]
+	s.mu.Unlock()
+	if st := s.State("loja1"); pending || st.NextReconnect != nil || st.ReconnectAttempts != 0 {
+		t.Errorf("reconexão continua agendada após conectar: %+v", st)
+	}
+
+	var stateErr *StateError
+	s.LoggedOut("loja1", "logout via API")
+	if err := s.Check(context.Background(), "loja1"); !errors.As(err, &stateErr) || !stateErr.Permanent() {
+		t.Errorf("Check() após logout = %v, want StateError permanente", err)
+	}
+}
+
+// Com o gravador parado (banco lento), as transições se acumulam em ordem em
+// vez de serem descartadas.
+func TestTransitionsAreNotDropped(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// Mais que o antigo buffer de 1024; cada instância alterna entre dois
+	// estados, então toda chamada é uma transição de fato
+	s := NewSupervisor(nil, nil)
+	const n = 2100
+	for i := 0; i < n; i++ {
+		to := StateQRPending
+		if (i/7)%2 == 1 {
+			to = StateCreated
+		}
+		s.transition(fmt.Sprintf("loja%d", i%7), to, "", 0)
+	}
+
+	pending := s.drain()
+	if len(pending) != n {
+		t.Fatalf("%d transições pendentes, want %d", len(pending), n)
+	}
+	for i, tr := range pending {
+		if tr.instance != fmt.Sprintf("loja%d", i%7) {
+			t.Fatalf("transição %d é de %s: ordem trocada", i, tr.instance)
+		}
+	}
+	if len(s.drain()) != 0 {
+		t.Error("drain() não esvaziou a fila")
+	}
+}
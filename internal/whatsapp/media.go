@@ -0,0 +1,145 @@
+package whatsapp
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// ============================================
+// VALIDAÇÃO DE MÍDIA
+// ============================================
+
+var (
+	ErrMediaTooLarge = errors.New("arquivo de mídia excede o tamanho máximo permitido")
+	ErrMediaSource   = errors.New("informe url, base64 ou um arquivo")
+)
+
+// mimeTypes lista os tipos aceitos pelo WhatsApp para cada tipo de mídia.
+// Documentos aceitam qualquer MIME.
+var mimeTypes = map[string][]string{
+	"image":   {"image/jpeg", "image/png"},
+	"video":   {"video/mp4", "video/3gpp"},
+	"audio":   {"audio/ogg", "audio/mpeg", "audio/mp4", "audio/aac", "audio/amr", "audio/wav", "audio/x-wav"},
+	"sticker": {"image/webp"},
+}
+
+// NormalizeMedia completa e valida o payload de mídia: deduz tipo e MIME
+// quando ausentes e confere tamanho e formato. maxSize é o limite em bytes do
+// conteúdo decodificado (0 desativa a checagem).
+func NormalizeMedia(m *models.MediaPayload, maxSize int) error {
+	if m == nil || (m.URL == "" && m.Base64 == "") {
+		return ErrMediaSource
+	}
+	if m.URL != "" && m.Base64 != "" {
+		return errors.New("informe apenas url ou base64, não ambos")
+	}
+
+	if m.Base64 != "" {
+		// Clientes costumam quebrar o base64 em linhas ou deixar espaços nas pontas
+		m.Base64 = strings.Map(dropSpace, m.Base64)
+
+		// Aceita data URI (data:image/png;base64,....)
+		if strings.HasPrefix(m.Base64, "data:") {
+			if idx := strings.Index(m.Base64, ","); idx > 0 {
+				if m.MimeType == "" {
+					m.MimeType = strings.TrimSuffix(strings.TrimPrefix(m.Base64[:idx], "data:"), ";base64")
+				}
+				m.Base64 = m.Base64[idx+1:]
+			}
+		}
+		raw, err := base64.StdEncoding.DecodeString(m.Base64)
+		if err != nil {
+			return errors.New("base64 inválido")
+		}
+		if maxSize > 0 && len(raw) > maxSize {
+			return ErrMediaTooLarge
+		}
+		if m.MimeType == "" {
+			m.MimeType = detectMime(raw)
+		}
+	}
+
+	if m.MimeType == "" {
+		name := m.FileName
+		if name == "" {
+			name = path.Base(strings.SplitN(m.URL, "?", 2)[0])
+		}
+		m.MimeType = mime.TypeByExtension(path.Ext(name))
+	}
+
+	if m.PTT {
+		m.Type = "audio"
+		if m.MimeType == "" {
+			m.MimeType = "audio/ogg; codecs=opus"
+		}
+	}
+
+	if m.Type == "" {
+		m.Type = mediaTypeFromMime(m.MimeType)
+	}
+
+	switch m.Type {
+	case "document":
+		if m.MimeType == "" {
+			m.MimeType = "application/octet-stream"
+		}
+		return nil
+	case "image", "video", "audio", "sticker":
+	default:
+		return fmt.Errorf("tipo de mídia inválido: %q", m.Type)
+	}
+
+	if m.MimeType == "" {
+		// Sem como deduzir (URL sem extensão): o Node resolve ao baixar
+		return nil
+	}
+
+	base, _, _ := mime.ParseMediaType(m.MimeType)
+	for _, allowed := range mimeTypes[m.Type] {
+		if base == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("MIME %q não suportado para %s", m.MimeType, m.Type)
+}
+
+func mediaTypeFromMime(mimeType string) string {
+	base, _, _ := mime.ParseMediaType(mimeType)
+	switch {
+	case base == "image/webp":
+		return "sticker"
+	case strings.HasPrefix(base, "image/"):
+		return "image"
+	case strings.HasPrefix(base, "video/"):
+		return "video"
+	case strings.HasPrefix(base, "audio/"):
+		return "audio"
+	default:
+		return "document"
+	}
+}
+
+// detectMime identifica o conteúdo pelos primeiros bytes. OGG é quase sempre
+// nota de voz (Opus), e o DetectContentType o devolve como application/ogg.
+func detectMime(raw []byte) string {
+	detected := http.DetectContentType(raw)
+	if detected == "application/ogg" {
+		return "audio/ogg; codecs=opus"
+	}
+	return detected
+}
+
+func dropSpace(r rune) rune {
+	if unicode.IsSpace(r) {
+		return -1
+	}
+	return r
+}
@@ -0,0 +1,77 @@
+package whatsapp
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestNormalizeMedia(t *testing.T) {
+	png := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	pdf := base64.StdEncoding.EncodeToString([]byte("%PDF-1.4\n"))
+	ogg := base64.StdEncoding.EncodeToString([]byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00OpusHead"))
+
+	tests := []struct {
+		name     string
+		in       models.MediaPayload
+		maxSize  int
+		wantType string
+		wantMime string
+		wantErr  error // nil = sem erro; errAny = qualquer erro
+	}{
+		{name: "url de imagem pela extensão", in: models.MediaPayload{URL: "https://cdn.example.com/foto.jpg?v=2"}, wantType: "image", wantMime: "image/jpeg"},
+		{name: "tipo pelo MIME informado", in: models.MediaPayload{URL: "https://cdn.example.com/clip", MimeType: "video/mp4"}, wantType: "video", wantMime: "video/mp4"},
+		{name: "extensão pelo filename", in: models.MediaPayload{URL: "https://cdn.example.com/download", FileName: "nota.pdf"}, wantType: "document", wantMime: "application/pdf"},
+		{name: "url sem extensão vira documento", in: models.MediaPayload{URL: "https://cdn.example.com/download"}, wantType: "document", wantMime: "application/octet-stream"},
+		{name: "tipo informado sem MIME dedutível", in: models.MediaPayload{URL: "https://cdn.example.com/download", Type: "image"}, wantType: "image", wantMime: ""},
+		{name: "base64 detecta o conteúdo", in: models.MediaPayload{Base64: png}, wantType: "image", wantMime: "image/png"},
+		{name: "data URI", in: models.MediaPayload{Base64: "data:application/pdf;base64," + pdf}, wantType: "document", wantMime: "application/pdf"},
+		{name: "base64 quebrado em linhas", in: models.MediaPayload{Base64: " " + pdf[:8] + "\r\n" + pdf[8:] + "\n"}, wantType: "document", wantMime: "application/pdf"},
+		{name: "nota de voz em base64 sem MIME", in: models.MediaPayload{Base64: ogg, PTT: true}, wantType: "audio", wantMime: "audio/ogg; codecs=opus"},
+		{name: "OGG sem PTT continua áudio", in: models.MediaPayload{Base64: ogg}, wantType: "audio", wantMime: "audio/ogg; codecs=opus"},
+		{name: "webp vira figurinha", in: models.MediaPayload{URL: "https://cdn.example.com/s.webp"}, wantType: "sticker", wantMime: "image/webp"},
+		{name: "ptt força áudio opus", in: models.MediaPayload{URL: "https://cdn.example.com/voz", PTT: true}, wantType: "audio", wantMime: "audio/ogg; codecs=opus"},
+		{name: "documento aceita qualquer MIME", in: models.MediaPayload{URL: "https://cdn.example.com/a", Type: "document", MimeType: "application/x-custom"}, wantType: "document", wantMime: "application/x-custom"},
+		{name: "sem origem", in: models.MediaPayload{}, wantErr: ErrMediaSource},
+		{name: "url e base64", in: models.MediaPayload{URL: "https://cdn.example.com/a.jpg", Base64: png}, wantErr: errAny},
+		{name: "base64 inválido", in: models.MediaPayload{Base64: "não é base64"}, wantErr: errAny},
+		{name: "acima do tamanho máximo", in: models.MediaPayload{Base64: png}, maxSize: 4, wantErr: ErrMediaTooLarge},
+		{name: "tipo inválido", in: models.MediaPayload{URL: "https://cdn.example.com/a.jpg", Type: "gif"}, wantErr: errAny},
+		{name: "MIME não suportado para o tipo", in: models.MediaPayload{URL: "https://cdn.example.com/a.gif", Type: "image"}, wantErr: errAny},
+		{name: "MIME informado não suportado", in: models.MediaPayload{URL: "https://cdn.example.com/a", MimeType: "video/webm"}, wantErr: errAny},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.in
+			err := NormalizeMedia(&m, tt.maxSize)
+			switch {
+			case tt.wantErr == errAny:
+				if err == nil {
+					t.Fatalf("NormalizeMedia() = nil, want erro (payload %+v)", m)
+				}
+				return
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NormalizeMedia() err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("NormalizeMedia(): %v", err)
+			}
+			if m.Type != tt.wantType || m.MimeType != tt.wantMime {
+				t.Errorf("tipo/MIME = %q/%q, want %q/%q", m.Type, m.MimeType, tt.wantType, tt.wantMime)
+			}
+		})
+	}
+}
+
+func TestNormalizeMediaNil(t *testing.T) {
+	if err := NormalizeMedia(nil, 0); !errors.Is(err, ErrMediaSource) {
+		t.Errorf("NormalizeMedia(nil) err = %v, want ErrMediaSource", err)
+	}
+}
+
+var errAny = errors.New("qualquer erro")
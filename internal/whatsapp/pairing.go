@@ -0,0 +1,216 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nexus/gowhats/internal/jid"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+// PairingStatus é a situação do pareamento por código de uma instância.
+type PairingStatus string
+
+const (
+	PairingCodeIssued PairingStatus = "code_issued" // código entregue, aguardando digitação no celular
+	PairingLinked     PairingStatus = "linked"
+	PairingFailed     PairingStatus = "failed" // expirou, foi recusado ou a conexão caiu
+)
+
+const (
+	// pairCodeTTL é quanto tempo o código vale; depois disso é preciso pedir outro
+	pairCodeTTL      = 2 * time.Minute
+	pairingEventName = "pairing.update"
+)
+
+// ErrAlreadyConnected é devolvido ao pedir pareamento de uma instância já
+// conectada.
+var ErrAlreadyConnected = errors.New("instance already connected")
+
+// ErrNoSupervisor é devolvido pelas operações que dependem do supervisor de
+// conexões (pareamento) quando ele não foi configurado.
+var ErrNoSupervisor = errors.New("connection supervisor not configured")
+
+// Pairing é o pareamento por código em andamento (ou o último) da instância.
+type Pairing struct {
+	Instance  string        `json:"instance"`
+	Phone     string        `json:"phone"` // E.164
+	Code      string        `json:"code"`  // 8 caracteres, ex.: ABCD1234
+	Status    PairingStatus `json:"status"`
+	Reason    string        `json:"reason,omitempty"`
+	Jid       string        `json:"jid,omitempty"`
+	IssuedAt  time.Time     `json:"issuedAt"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	LinkedAt  *time.Time    `json:"linkedAt,omitempty"`
+}
+
+// FormattedCode devolve o código como o WhatsApp exibe (ABCD-1234).
+func (p *Pairing) FormattedCode() string {
+	if len(p.Code) != 8 {
+		return p.Code
+	}
+	return p.Code[:4] + "-" + p.Code[4:]
+}
+
+// ============================================
+// PAREAMENTO POR CÓDIGO
+// ============================================
+
+// Pair pede ao sidecar um código de pareamento para o número (em E.164) e
+// passa a acompanhar o pareamento pelos connection.update. Um código ainda
+// válido para o mesmo número é reaproveitado.
+func (s *Supervisor) Pair(ctx context.Context, instance, phone string) (*Pairing, error) {
+	e164, err := NormalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
+	if s.State(instance).State == StateConnected {
+		return nil, ErrAlreadyConnected
+	}
+
+	s.mu.Lock()
+	if p, ok := s.pairings[instance]; ok && p.Status == PairingCodeIssued && p.Phone == e164 && time.Now().Before(p.ExpiresAt) {
+		current := *p
+		s.mu.Unlock()
+		return &current, nil
+	}
+	s.mu.Unlock()
+
+	raw, err := s.client.PairPhone(ctx, instance, strings.TrimPrefix(e164, "+"))
+	if err != nil {
+		return nil, err
+	}
+	code := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(raw))
+	if !validPairCode(code) {
+		return nil, &BridgeError{Method: http.MethodPost, Endpoint: "/session/pair-code", StatusCode: http.StatusBadGateway,
+			Message: "sidecar devolveu um código de pareamento inválido"}
+	}
+
+	now := time.Now()
+	p := &Pairing{
+		Instance:  instance,
+		Phone:     e164,
+		Code:      code,
+		Status:    PairingCodeIssued,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(pairCodeTTL),
+	}
+	s.mu.Lock()
+	s.pairings[instance] = p
+	current := *p
+	s.mu.Unlock()
+
+	time.AfterFunc(pairCodeTTL, func() { s.expirePairing(instance, code) })
+
+	s.transition(instance, StatePairing, "código de pareamento emitido", 0)
+	s.publishPairing(current)
+	return &current, nil
+}
+
+// PairingStatus devolve o último pareamento por código da instância.
+func (s *Supervisor) PairingStatus(instance string) (*Pairing, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pairings[instance]
+	if !ok {
+		return nil, false
+	}
+	current := *p
+	return &current, true
+}
+
+// expirePairing falha o pareamento se o código não foi usado a tempo.
+func (s *Supervisor) expirePairing(instance, code string) {
+	s.mu.Lock()
+	p, ok := s.pairings[instance]
+	if !ok || p.Code != code || p.Status != PairingCodeIssued {
+		s.mu.Unlock()
+		return
+	}
+	p.Status = PairingFailed
+	p.Reason = "código expirado"
+	current := *p
+	pairingState := s.states[instance] != nil && s.states[instance].State == StatePairing
+	s.mu.Unlock()
+
+	if pairingState {
+		s.transition(instance, StateCreated, "código de pareamento expirado", 0)
+	}
+	s.publishPairing(current)
+}
+
+// updatePairing acompanha o pareamento pelos connection.update: o login novo
+// (ou a conexão aberta) conclui; logout, bloqueio ou queda antes do vínculo
+// falham. O 515 logo depois do vínculo é o reinício normal do login.
+func (s *Supervisor) updatePairing(instance, connection string, code int, reason string, newLogin bool, me string) {
+	s.mu.Lock()
+	p, ok := s.pairings[instance]
+	if !ok || p.Status != PairingCodeIssued {
+		s.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case newLogin || connection == "open":
+		p.Status = PairingLinked
+		p.LinkedAt = &now
+		p.Jid = me
+	case connection == "close" && code != disconnectRestartRequired:
+		p.Status = PairingFailed
+		p.Reason = reason
+		if p.Reason == "" {
+			p.Reason = "conexão encerrada antes do vínculo"
+		}
+	default:
+		s.mu.Unlock()
+		return
+	}
+	current := *p
+	s.mu.Unlock()
+
+	s.publishPairing(current)
+}
+
+// publishPairing emite pairing.update (sem o código) para webhooks e filas.
+func (s *Supervisor) publishPairing(p Pairing) {
+	if s.Events == nil {
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"status":    p.Status,
+		"phone":     p.Phone,
+		"jid":       p.Jid,
+		"reason":    p.Reason,
+		"expiresAt": p.ExpiresAt,
+	})
+	// Fora do caminho de quem publicou o connection.update
+	go s.Events.Publish(models.Event{Instance: p.Instance, Event: pairingEventName, Data: data, Timestamp: time.Now().UTC()})
+}
+
+func validPairCode(code string) bool {
+	if len(code) != 8 {
+		return false
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizePhone valida o número e o devolve em E.164 (+5511999999999).
+// Aceita +, espaços, traços, pontos, parênteses e o prefixo internacional 00;
+// o número precisa vir com o código do país.
+func NormalizePhone(raw string) (string, error) {
+	phone, err := jid.Phone(raw, "")
+	if err != nil {
+		return "", invalidRequest("%s", err.Error())
+	}
+	return "+" + phone, nil
+}
@@ -0,0 +1,166 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "+55 11 98765-4321", want: "+5511987654321"},
+		{raw: "5511987654321", want: "+5511987654321"},
+		{raw: "0044 (20) 7946.0958", want: "+442079460958"},
+		{raw: "+1-415-555-0100", want: "+14155550100"},
+		{raw: "011 98765-4321", wantErr: true}, // sem código do país
+		{raw: "+55 11 9876-abcd", wantErr: true},
+		{raw: "+1234567", wantErr: true},
+		{raw: "+1234567890123456", wantErr: true},
+		{raw: "   ", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhone(tt.raw)
+		if tt.wantErr {
+			var reqErr *RequestError
+			if !errors.As(err, &reqErr) {
+				t.Errorf("NormalizePhone(%q) = %q, %v; want RequestError", tt.raw, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidPairCode(t *testing.T) {
+	valid := []string{"ABCD1234", "ZZZZZZZZ", "00000000"}
+	invalid := []string{"", "ABCD123", "ABCD12345", "abcd1234", "ABCD-123", "ABÇD1234"}
+	for _, code := range valid {
+		if !validPairCode(code) {
+			t.Errorf("validPairCode(%q) = false", code)
+		}
+	}
+	for _, code := range invalid {
+		if validPairCode(code) {
+			t.Errorf("validPairCode(%q) = true", code)
+		}
+	}
+}
+
+func TestFormattedCode(t *testing.T) {
+	if got := (&Pairing{Code: "ABCD1234"}).FormattedCode(); got != "ABCD-1234" {
+		t.Errorf("FormattedCode() = %q", got)
+	}
+	if got := (&Pairing{Code: "ABC"}).FormattedCode(); got != "ABC" {
+		t.Errorf("FormattedCode() de código fora do padrão = %q", got)
+	}
+}
+
+// pairSidecar responde /session/pair-code com code e conta os pedidos.
+type pairSidecar struct {
+	mu       sync.Mutex
+	code     string
+	requests []PairCodeRequest
+}
+
+func (f *pairSidecar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req PairCodeRequest
+	if r.URL.Path != "/session/pair-code" || json.NewDecoder(r.Body).Decode(&req) != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	code := f.code
+	f.mu.Unlock()
+	json.NewEncoder(w).Encode(PairCodeResponse{Status: "success", Code: code})
+}
+
+func TestPairIssuesAndTracksCode(t *testing.T) {
+	sidecar := &pairSidecar{code: "abcd-1234"}
+	srv := httptest.NewServer(sidecar)
+	defer srv.Close()
+
+	s := NewSupervisor(nil, NewBaileysClient(srv.URL, "", nil))
+	ctx := context.Background()
+
+	if _, err := s.Pair(ctx, "loja1", "011 98765-4321"); HTTPStatus(err) != http.StatusBadRequest {
+		t.Fatalf("número sem país: err = %v, want 400", err)
+	}
+
+	p, err := s.Pair(ctx, "loja1", "+55 11 98765-4321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Code != "ABCD1234" || p.Phone != "+5511987654321" || p.Status != PairingCodeIssued || !p.ExpiresAt.After(p.IssuedAt) {
+		t.Fatalf("Pair() = %+v", p)
+	}
+	if len(sidecar.requests) != 1 || sidecar.requests[0].PhoneNumber != "5511987654321" {
+		t.Errorf("pedido ao sidecar = %+v, want o número sem +", sidecar.requests)
+	}
+	if st := s.State("loja1").State; st != StatePairing {
+		t.Errorf("estado = %s, want pairing", st)
+	}
+
+	// Código ainda válido para o mesmo número é reaproveitado
+	if again, err := s.Pair(ctx, "loja1", "5511987654321"); err != nil || again.Code != p.Code || len(sidecar.requests) != 1 {
+		t.Errorf("segundo Pair() = %+v, %v (%d pedidos ao sidecar)", again, err, len(sidecar.requests))
+	}
+
+	// O celular digita o código: login novo e depois a conexão aberta
+	s.HandleEvent(connectionUpdate("loja1", `{"isNewLogin":true,"me":"5511987654321:12@s.whatsapp.net"}`))
+	s.HandleEvent(connectionUpdate("loja1", `{"connection":"open"}`))
+	status, ok := s.PairingStatus("loja1")
+	if !ok || status.Status != PairingLinked || status.Jid != "5511987654321:12@s.whatsapp.net" || status.LinkedAt == nil {
+		t.Errorf("PairingStatus() = %+v", status)
+	}
+	if _, err := s.Pair(ctx, "loja1", "5511987654321"); !errors.Is(err, ErrAlreadyConnected) {
+		t.Errorf("Pair() com a instância conectada: err = %v", err)
+	}
+
+	sidecar.mu.Lock()
+	sidecar.code = "12-34"
+	sidecar.mu.Unlock()
+	if _, err := s.Pair(ctx, "loja2", "+5511912345678"); HTTPStatus(err) != http.StatusBadGateway {
+		t.Errorf("código inválido do sidecar: err = %v, want 502", err)
+	}
+	if _, ok := s.PairingStatus("loja2"); ok {
+		t.Error("pareamento registrado com código inválido")
+	}
+}
+
+func TestPairingFailsWhenConnectionCloses(t *testing.T) {
+	srv := httptest.NewServer(&pairSidecar{code: "WXYZ9876"})
+	defer srv.Close()
+
+	s := NewSupervisor(nil, NewBaileysClient(srv.URL, "", nil))
+	if _, err := s.Pair(context.Background(), "loja1", "+5511987654321"); err != nil {
+		t.Fatal(err)
+	}
+
+	// O 515 logo depois do vínculo é o reinício normal e não falha o pareamento
+	s.HandleEvent(connectionUpdate("loja1", `{"connection":"close","statusCode":515}`))
+	if p, _ := s.PairingStatus("loja1"); p.Status != PairingCodeIssued {
+		t.Fatalf("pareamento após 515 = %s, want code_issued", p.Status)
+	}
+
+	s.HandleEvent(connectionUpdate("loja1", `{"connection":"close","statusCode":401,"reason":"loggedOut"}`))
+	if p, _ := s.PairingStatus("loja1"); p.Status != PairingFailed || p.Reason != "loggedOut" {
+		t.Errorf("pareamento após queda = %+v, want failed", p)
+	}
+
+	// O código expirado não falha de novo um pareamento já encerrado
+	s.expirePairing("loja1", "WXYZ9876")
+	if p, _ := s.PairingStatus("loja1"); p.Reason != "loggedOut" {
+		t.Errorf("expirePairing sobrescreveu o motivo: %q", p.Reason)
+	}
+}
@@ -1,106 +1,392 @@
-package whatsapp
-
-import (
-	"errors"
-	"time"
-
-	"github.com/nexus/gowhats/internal/models"
-)
-
-type Service struct {
-	Client *BaileysClient
-}
-
-func NewService() *Service {
-	return &Service{
-		Client: NewBaileysClient(),
-	}
-}
-
-func (s *Service) SendMessage(instanceKey string, req models.SendMessageRequest) (string, error) {
-	if !s.Client.IsConnected(instanceKey) {
-		return "", errors.New("instance not connected")
-	}
-	if req.Options != nil && req.Options.Delay > 0 {
-		time.Sleep(time.Duration(req.Options.Delay) * time.Second)
-	}
-	switch req.Type {
-	case "text":
-		return s.Client.SendText(instanceKey, req.Number, req.Text, req.Options)
-	case "interactive":
-		return s.Client.SendInteractive(instanceKey, req.Number, req.Interactive, req.Options)
-	case "media":
-		return s.Client.SendMedia(instanceKey, req.Number, req.Media, req.Options)
-	default:
-		return "", errors.New("unsupported message type")
-	}
-}
-
-func (s *Service) GetInstanceInfo(instanceKey string) (map[string]interface{}, error) {
-	return s.Client.GetConnectionInfo(instanceKey)
-}
-
-func (s *Service) GetContacts(instanceKey string) ([]map[string]interface{}, error) {
-	return s.Client.GetContacts(instanceKey)
-}
-
-func (s *Service) GetGroups(instanceKey string) ([]map[string]interface{}, error) {
-	return s.Client.GetGroups(instanceKey)
-}
-
-func (s *Service) SearchContacts(instanceKey, query string) ([]map[string]interface{}, error) {
-	return s.Client.SearchContacts(instanceKey, query)
-}
-
-func (s *Service) GetMessages(instanceKey, jid string) ([]map[string]interface{}, error) {
-	return s.Client.GetMessages(instanceKey, jid)
-}
-
-// 🔥 Botões nativos
-func (s *Service) SendButtons(instanceKey, number, message, footer, title string, buttons []map[string]string) (string, error) {
-	if !s.Client.IsConnected(instanceKey) {
-		return "", errors.New("instance not connected")
-	}
-	return s.Client.SendButtons(instanceKey, number, message, footer, title, buttons)
-}
-
-// 🔥 Lista de seleção
-func (s *Service) SendList(instanceKey, number, title, message, footer, buttonText string, sections []map[string]interface{}) (string, error) {
-	if !s.Client.IsConnected(instanceKey) {
-		return "", errors.New("instance not connected")
-	}
-	return s.Client.SendList(instanceKey, number, title, message, footer, buttonText, sections)
-}
-
-// 🔥 Botão com URL
-func (s *Service) SendUrlButton(instanceKey, number, message, footer, title, buttonText, url string) (string, error) {
-	if !s.Client.IsConnected(instanceKey) {
-		return "", errors.New("instance not connected")
-	}
-	return s.Client.SendUrlButton(instanceKey, number, message, footer, title, buttonText, url)
-}
-
-// 🔥 Botão de copiar
-func (s *Service) SendCopyButton(instanceKey, number, message, footer, title, buttonText, copyCode string) (string, error) {
-	if !s.Client.IsConnected(instanceKey) {
-		return "", errors.New("instance not connected")
-	}
-	return s.Client.SendCopyButton(instanceKey, number, message, footer, title, buttonText, copyCode)
-}
-
-// Funções placeholder mantidas para compatibilidade com handlers
-func (s *Service) PairPhone(instanceKey, phone string) (string, error) {
-	return s.Client.PairPhone(instanceKey, phone)
-}
-
-func (s *Service) ManageGroup(instanceKey string, action string, req models.GroupActionRequest) error {
-	return s.Client.GroupAction(instanceKey, req.GroupID, req.Participants, action)
-}
-
-func (s *Service) CreateGroup(instanceKey string, req models.CreateGroupRequest) (string, error) {
-	return s.Client.CreateGroup(instanceKey, req.Subject, req.Participants)
-}
-
-func (s *Service) GetEventBus() interface{} {
-	return nil
-}
\ No newline at end of file
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/nexus/gowhats/internal/eventbus"
+	"github.com/nexus/gowhats/internal/jid"
+	"github.com/nexus/gowhats/internal/models"
+)
+
+type Service struct {
+	Client      *BaileysClient
+	Events      *eventbus.Bus // definido pelo servidor após montar o barramento
+	Connections *Supervisor   // estado das conexões; nil = pergunta ao sidecar
+	Numbers     *jid.Resolver // normaliza destinatários e resolve o nono dígito
+}
+
+func NewService(client *BaileysClient) *Service {
+	return &Service{
+		Client:  client,
+		Numbers: jid.NewResolver(client, ""),
+	}
+}
+
+func (s *Service) SendMessage(ctx context.Context, instanceKey string, req models.SendMessageRequest) (string, error) {
+	if err := s.prepareSend(ctx, instanceKey, &req.Number); err != nil {
+		return "", err
+	}
+	switch req.Type {
+	case "text":
+		return s.Client.SendText(ctx, SendTextRequest{Instance: instanceKey, Number: req.Number, Text: req.Text, Options: req.Options})
+	case "interactive":
+		return s.Client.SendInteractive(ctx, SendInteractiveRequest{Instance: instanceKey, Number: req.Number, Interactive: req.Interactive, Options: req.Options})
+	case "media":
+		if req.Media == nil {
+			return "", invalidRequest("media payload required")
+		}
+		return s.Client.SendMedia(ctx, SendMediaRequest{Instance: instanceKey, Number: req.Number, MediaPayload: *req.Media, Options: req.Options})
+	case "buttons":
+		var b SendButtonsRequest
+		if err := decodeLegacy(req.Payload, &b); err != nil {
+			return "", err
+		}
+		b.Instance, b.Number = instanceKey, req.Number
+		return s.Client.SendButtons(ctx, b)
+	case "list":
+		var l SendListRequest
+		if err := decodeLegacy(req.Payload, &l); err != nil {
+			return "", err
+		}
+		l.Instance, l.Number = instanceKey, req.Number
+		return s.Client.SendList(ctx, l)
+	case "url-button":
+		var u SendUrlButtonRequest
+		if err := decodeLegacy(req.Payload, &u); err != nil {
+			return "", err
+		}
+		u.Instance, u.Number = instanceKey, req.Number
+		return s.Client.SendUrlButton(ctx, u)
+	case "copy-button":
+		var cb SendCopyButtonRequest
+		if err := decodeLegacy(req.Payload, &cb); err != nil {
+			return "", err
+		}
+		cb.Instance, cb.Number = instanceKey, req.Number
+		return s.Client.SendCopyButton(ctx, cb)
+	default:
+		return "", invalidRequest("unsupported message type")
+	}
+}
+
+// decodeLegacy lê o corpo original das rotas antigas, guardado no job.
+func decodeLegacy(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		return invalidRequest("payload required")
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return invalidRequest("invalid payload: %s", err.Error())
+	}
+	return nil
+}
+
+// ValidateMessage confere o conteúdo de um envio antes de ele entrar na fila
+// ou num agendamento, com as mesmas regras de SendMessage; o número é
+// resolvido só no envio. Mídias são normalizadas (ver NormalizeMedia). Erros
+// de conteúdo são *RequestError; mídia acima de maxMediaSize é
+// ErrMediaTooLarge.
+func ValidateMessage(req *models.SendMessageRequest, maxMediaSize int) error {
+	switch req.Type {
+	case "text":
+		if req.Text == "" {
+			return invalidRequest("text required")
+		}
+	case "interactive":
+		if req.Interactive == nil {
+			return invalidRequest("interactive payload required")
+		}
+	case "media":
+		if req.Media == nil {
+			return invalidRequest("media payload required")
+		}
+		if err := NormalizeMedia(req.Media, maxMediaSize); err != nil {
+			if errors.Is(err, ErrMediaTooLarge) {
+				return err
+			}
+			return invalidRequest("%s", err.Error())
+		}
+	case "buttons":
+		var b SendButtonsRequest
+		if err := decodeLegacy(req.Payload, &b); err != nil {
+			return err
+		}
+		if len(b.Buttons) == 0 {
+			return invalidRequest("buttons required")
+		}
+	case "list":
+		var l SendListRequest
+		if err := decodeLegacy(req.Payload, &l); err != nil {
+			return err
+		}
+		if len(l.Sections) == 0 {
+			return invalidRequest("sections required")
+		}
+	case "url-button":
+		var u SendUrlButtonRequest
+		if err := decodeLegacy(req.Payload, &u); err != nil {
+			return err
+		}
+		if u.URL == "" {
+			return invalidRequest("url required")
+		}
+	case "copy-button":
+		var cb SendCopyButtonRequest
+		if err := decodeLegacy(req.Payload, &cb); err != nil {
+			return err
+		}
+		if cb.CopyCode == "" {
+			return invalidRequest("copyCode required")
+		}
+	default:
+		return invalidRequest("unsupported message type %q (text, interactive, media, buttons, list, url-button, copy-button)", req.Type)
+	}
+	return nil
+}
+
+// checkConnected falha rápido quando a instância não está conectada, pelo
+// estado mantido pelo supervisor. Sem supervisor, pergunta ao sidecar; o
+// estado é desconhecido, então a falha é um StateError com StateCreated.
+func (s *Service) checkConnected(ctx context.Context, instanceKey string) error {
+	if s.Connections != nil {
+		return s.Connections.Check(ctx, instanceKey)
+	}
+	if !s.Client.IsConnected(ctx, instanceKey) {
+		return &StateError{Instance: instanceKey, State: StateCreated, Reason: "sidecar sem sessão ativa"}
+	}
+	return nil
+}
+
+// prepareSend confere a conexão e troca o número pelo jid normalizado.
+func (s *Service) prepareSend(ctx context.Context, instanceKey string, number *string) error {
+	if err := s.checkConnected(ctx, instanceKey); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*number) == "" {
+		return invalidRequest("number required")
+	}
+	resolved, err := s.resolve(ctx, instanceKey, *number)
+	if err != nil {
+		return err
+	}
+	*number = resolved
+	return nil
+}
+
+// resolve normaliza um número ou jid; números inválidos viram RequestError.
+func (s *Service) resolve(ctx context.Context, instanceKey, raw string) (string, error) {
+	if s.Numbers == nil {
+		return raw, nil
+	}
+	j, err := s.Numbers.Resolve(ctx, instanceKey, raw)
+	if err != nil {
+		return "", invalidRequest("%s", err.Error())
+	}
+	return j.String(), nil
+}
+
+// resolveParticipants normaliza a lista de participantes de um grupo com uma
+// única consulta ao WhatsApp.
+func (s *Service) resolveParticipants(ctx context.Context, instanceKey string, participants []string) ([]string, error) {
+	if s.Numbers == nil || len(participants) == 0 {
+		return participants, nil
+	}
+	jids, err := s.Numbers.ResolveAll(ctx, instanceKey, participants)
+	if err != nil {
+		return nil, invalidRequest("%s", err.Error())
+	}
+	out := make([]string, len(jids))
+	for i, j := range jids {
+		out[i] = j.String()
+	}
+	return out, nil
+}
+
+func (s *Service) GetInstanceInfo(ctx context.Context, instanceKey string) (*InstanceInfo, error) {
+	return s.Client.GetConnectionInfo(ctx, instanceKey)
+}
+
+func (s *Service) GetContacts(ctx context.Context, instanceKey string) ([]Contact, error) {
+	return s.Client.GetContacts(ctx, instanceKey)
+}
+
+func (s *Service) GetGroups(ctx context.Context, instanceKey string) ([]GroupSummary, error) {
+	return s.Client.GetGroups(ctx, instanceKey)
+}
+
+// SearchContacts busca por nome ou jid. Uma busca por telefone formatado
+// (+55 11 9999-8888) é reduzida aos dígitos para casar com o jid.
+func (s *Service) SearchContacts(ctx context.Context, instanceKey, query string) ([]Contact, error) {
+	if digits := phoneDigits(query); digits != "" {
+		query = digits
+	}
+	return s.Client.SearchContacts(ctx, instanceKey, query)
+}
+
+func (s *Service) GetMessages(ctx context.Context, instanceKey, chatJid string) ([]map[string]interface{}, error) {
+	resolved, err := s.resolve(ctx, instanceKey, chatJid)
+	if err != nil {
+		return nil, err
+	}
+	return s.Client.GetMessages(ctx, instanceKey, resolved)
+}
+
+// phoneDigits devolve os dígitos se o texto for só um telefone formatado.
+func phoneDigits(query string) string {
+	var b strings.Builder
+	for _, r := range query {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case strings.ContainsRune("+-(). ", r):
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// 🔥 Botões nativos
+func (s *Service) SendButtons(ctx context.Context, req SendButtonsRequest) (string, error) {
+	if err := s.prepareSend(ctx, req.Instance, &req.Number); err != nil {
+		return "", err
+	}
+	return s.Client.SendButtons(ctx, req)
+}
+
+// 🔥 Lista de seleção
+func (s *Service) SendList(ctx context.Context, req SendListRequest) (string, error) {
+	if err := s.prepareSend(ctx, req.Instance, &req.Number); err != nil {
+		return "", err
+	}
+	return s.Client.SendList(ctx, req)
+}
+
+// 🔥 Botão com URL
+func (s *Service) SendUrlButton(ctx context.Context, req SendUrlButtonRequest) (string, error) {
+	if err := s.prepareSend(ctx, req.Instance, &req.Number); err != nil {
+		return "", err
+	}
+	return s.Client.SendUrlButton(ctx, req)
+}
+
+// 🔥 Botão de copiar
+func (s *Service) SendCopyButton(ctx context.Context, req SendCopyButtonRequest) (string, error) {
+	if err := s.prepareSend(ctx, req.Instance, &req.Number); err != nil {
+		return "", err
+	}
+	return s.Client.SendCopyButton(ctx, req)
+}
+
+// PairPhone pede um código de pareamento para o número e acompanha o vínculo
+// do dispositivo (consultado em PairingStatus).
+func (s *Service) PairPhone(ctx context.Context, instanceKey, phone string) (*Pairing, error) {
+	if s.Connections == nil {
+		return nil, ErrNoSupervisor
+	}
+	return s.Connections.Pair(ctx, instanceKey, phone)
+}
+
+// ============================================
+// GRUPOS
+// ============================================
+
+var groupActions = map[string]bool{"add": true, "remove": true, "promote": true, "demote": true}
+
+func (s *Service) ManageGroup(ctx context.Context, instanceKey string, action string, req models.GroupActionRequest) (*models.GroupInfo, []models.ParticipantResult, error) {
+	if !groupActions[action] {
+		return nil, nil, invalidRequest("invalid action %q (add, remove, promote, demote)", action)
+	}
+	if len(req.Participants) == 0 {
+		return nil, nil, invalidRequest("participants required")
+	}
+	participants, err := s.resolveParticipants(ctx, instanceKey, req.Participants)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.Client.GroupAction(ctx, GroupParticipantsRequest{
+		Instance:     instanceKey,
+		GroupID:      groupJID(req.GroupID),
+		Participants: participants,
+		Action:       action,
+	})
+}
+
+func (s *Service) CreateGroup(ctx context.Context, instanceKey string, req models.CreateGroupRequest) (*models.GroupInfo, error) {
+	if strings.TrimSpace(req.Subject) == "" {
+		return nil, invalidRequest("subject required")
+	}
+	participants, err := s.resolveParticipants(ctx, instanceKey, req.Participants)
+	if err != nil {
+		return nil, err
+	}
+	return s.Client.CreateGroup(ctx, CreateGroupBridgeRequest{
+		Instance:     instanceKey,
+		Subject:      req.Subject,
+		Participants: participants,
+		Description:  req.Description,
+	})
+}
+
+func (s *Service) GetGroup(ctx context.Context, instanceKey, groupID string) (*models.GroupInfo, error) {
+	return s.Client.GetGroupInfo(ctx, instanceKey, groupJID(groupID))
+}
+
+func (s *Service) UpdateGroup(ctx context.Context, instanceKey, groupID string, req models.UpdateGroupRequest) (*models.GroupInfo, error) {
+	return s.Client.UpdateGroup(ctx, GroupUpdateRequest{
+		Instance:      instanceKey,
+		GroupID:       groupJID(groupID),
+		Subject:       req.Subject,
+		Description:   req.Description,
+		PictureURL:    req.PictureURL,
+		PictureBase64: req.PictureBase64,
+	})
+}
+
+func (s *Service) UpdateGroupSettings(ctx context.Context, instanceKey, groupID string, req models.GroupSettingsRequest) (*models.GroupInfo, error) {
+	if req.Announce == nil && req.Locked == nil {
+		return nil, invalidRequest("announce or locked required")
+	}
+	return s.Client.UpdateGroupSettings(ctx, GroupSettingsBridgeRequest{
+		Instance: instanceKey,
+		GroupID:  groupJID(groupID),
+		Announce: req.Announce,
+		Locked:   req.Locked,
+	})
+}
+
+func (s *Service) GetGroupInvite(ctx context.Context, instanceKey, groupID string) (*models.GroupInvite, error) {
+	return s.Client.GetGroupInvite(ctx, instanceKey, groupJID(groupID))
+}
+
+func (s *Service) RevokeGroupInvite(ctx context.Context, instanceKey, groupID string) (*models.GroupInvite, error) {
+	return s.Client.RevokeGroupInvite(ctx, GroupRequest{Instance: instanceKey, GroupID: groupJID(groupID)})
+}
+
+func (s *Service) JoinGroup(ctx context.Context, instanceKey string, req models.JoinGroupRequest) (*models.GroupInfo, error) {
+	code := strings.TrimSpace(req.Code)
+	code = strings.TrimPrefix(code, "https://")
+	code = strings.TrimPrefix(code, "chat.whatsapp.com/")
+	if code == "" {
+		return nil, invalidRequest("invite code required")
+	}
+	return s.Client.JoinGroup(ctx, JoinGroupBridgeRequest{Instance: instanceKey, Code: code})
+}
+
+func (s *Service) LeaveGroup(ctx context.Context, instanceKey, groupID string) error {
+	return s.Client.LeaveGroup(ctx, GroupRequest{Instance: instanceKey, GroupID: groupJID(groupID)})
+}
+
+// groupJID aceita o id com ou sem o sufixo @g.us.
+func groupJID(id string) string {
+	if id == "" || strings.Contains(id, "@") {
+		return id
+	}
+	return id + "@g.us"
+}
+
+func (s *Service) GetEventBus() *eventbus.Bus {
+	return s.Events
+}
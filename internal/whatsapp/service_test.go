@@ -0,0 +1,59 @@
+package whatsapp
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nexus/gowhats/internal/models"
+)
+
+func TestValidateMessage(t *testing.T) {
+	image := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+	valid := []models.SendMessageRequest{
+		{Type: "text", Text: "oi"},
+		{Type: "interactive", Interactive: &models.InteractivePayload{Type: "button"}},
+		{Type: "media", Media: &models.MediaPayload{Base64: image}},
+		{Type: "buttons", Payload: json.RawMessage(`{"message":"Escolha","buttons":[{"id":"1","text":"Sim"}]}`)},
+		{Type: "list", Payload: json.RawMessage(`{"message":"Cardápio","sections":[{"title":"Pizzas","rows":[{"id":"p1","title":"Calabresa"}]}]}`)},
+		{Type: "url-button", Payload: json.RawMessage(`{"message":"Pedido","url":"https://loja.example/pedido/1"}`)},
+		{Type: "copy-button", Payload: json.RawMessage(`{"message":"Seu PIX","copyCode":"00020126"}`)},
+	}
+	for _, req := range valid {
+		if err := ValidateMessage(&req, 0); err != nil {
+			t.Errorf("ValidateMessage(%s) = %v", req.Type, err)
+		}
+	}
+
+	// A mídia sai normalizada, como no envio direto
+	media := models.SendMessageRequest{Type: "media", Media: &models.MediaPayload{Base64: image}}
+	ValidateMessage(&media, 0)
+	if media.Media.Type != "image" || media.Media.MimeType != "image/png" {
+		t.Errorf("mídia não normalizada: %+v", media.Media)
+	}
+
+	invalid := []models.SendMessageRequest{
+		{Type: "text"},
+		{Type: "interactive"},
+		{Type: "media"},
+		{Type: "media", Media: &models.MediaPayload{Base64: "não é base64"}},
+		{Type: "buttons"},
+		{Type: "buttons", Payload: json.RawMessage(`{"message":"sem botões"}`)},
+		{Type: "list", Payload: json.RawMessage(`{"sections":"pizzas"}`)},
+		{Type: "url-button", Payload: json.RawMessage(`{"message":"sem url"}`)},
+		{Type: "copy-button", Payload: json.RawMessage(`{"message":"sem código"}`)},
+		{Type: "poll"},
+	}
+	for _, req := range invalid {
+		var re *RequestError
+		if err := ValidateMessage(&req, 0); !errors.As(err, &re) {
+			t.Errorf("ValidateMessage(%s, %s) = %v, want *RequestError", req.Type, req.Payload, err)
+		}
+	}
+
+	big := models.SendMessageRequest{Type: "media", Media: &models.MediaPayload{Base64: image}}
+	if err := ValidateMessage(&big, 10); !errors.Is(err, ErrMediaTooLarge) || HTTPStatus(err) != 413 {
+		t.Errorf("mídia acima do limite: err = %v", err)
+	}
+}
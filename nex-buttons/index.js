@@ -5,7 +5,10 @@ const {
     jidNormalizedUser,
     delay,
     makeCacheableSignalKeyStore,
-    fetchLatestBaileysVersion
+    fetchLatestBaileysVersion,
+    downloadMediaMessage,
+    normalizeMessageContent,
+    getContentType
 } = require('@whiskeysockets/baileys');
 require('dotenv').config();
 const pino = require('pino');
@@ -325,12 +328,15 @@ async function saveGroup(instance, jid, nome) {
     } catch (err) {}
 }
 
-async function saveMessage(instance, jid, tipo, conteudo) {
+// Envios feitos pelo sidecar. O gateway Go completa a mesma linha (pelo
+// message_id) quando recebe o messages.upsert correspondente.
+async function saveMessage(instance, jid, tipo, conteudo, messageId = null) {
     try {
         await pool.query(`
-            INSERT INTO mensagens (instance, jid, tipo, conteudo)
-            VALUES ($1, $2, $3, $4)
-        `, [instance, jid, tipo, conteudo]);
+            INSERT INTO mensagens (instance, jid, tipo, conteudo, message_id, from_me, enviado_em)
+            VALUES ($1, $2, $3, $4, $5, TRUE, NOW())
+            ON CONFLICT (instance, message_id) WHERE message_id IS NOT NULL DO NOTHING
+        `, [instance, jid, tipo, conteudo, messageId]);
     } catch (err) {}
 }
 
@@ -399,11 +405,57 @@ async function logAccess(apiKeyId, endpoint, metodo, ip, statusCode) {
 
 const app = express();
 app.use(cors());
-app.use(bodyParser.json({ limit: '50mb' }));
+// Mídias chegam em base64 (~33% maiores que o arquivo original)
+app.use(bodyParser.json({ limit: '100mb' }));
 
 const PORT = 3001;
 
 const sessions = new Map();
+
+// ============================================
+// CONFIGURAÇÕES POR INSTÂNCIA (enviadas pelo gateway Go)
+// ============================================
+
+const instanceSettings = new Map();
+const presenceTimers = new Map();
+
+const DEFAULT_SETTINGS = {
+    reject_calls: false,
+    reject_call_message: '',
+    ignore_groups: false,
+    always_online: false,
+    read_messages: false,
+    sync_history: true,
+    read_status: false
+};
+
+function getSettings(instanceId) {
+    return { ...DEFAULT_SETTINGS, ...(instanceSettings.get(instanceId) || {}) };
+}
+
+// Aplica o que pode mudar com o socket aberto. sync_history só vale na
+// próxima conexão (é opção do makeWASocket).
+async function applySettings(instanceId) {
+    const sock = sessions.get(instanceId);
+    const settings = getSettings(instanceId);
+
+    clearInterval(presenceTimers.get(instanceId));
+    presenceTimers.delete(instanceId);
+    if (!sock) return;
+
+    try {
+        if (settings.always_online) {
+            await sock.sendPresenceUpdate('available');
+            presenceTimers.set(instanceId, setInterval(() => {
+                sock.sendPresenceUpdate('available').catch(() => {});
+            }, 4 * 60 * 1000));
+        } else {
+            await sock.sendPresenceUpdate('unavailable');
+        }
+    } catch (err) {
+        console.log(`[${instanceId}] ⚠️ Falha ao aplicar presença:`, err.message);
+    }
+}
 const qrCodes = new Map();
 const retryCounters = new Map();
 const localStore = new Map();
@@ -426,6 +478,26 @@ function getSyncStatus(instanceId) {
     return syncStatus.get(instanceId);
 }
 
+// ============================================
+// EVENTOS PARA O GATEWAY GO (webhooks)
+// ============================================
+
+const GATEWAY_EVENTS_URL = process.env.GATEWAY_EVENTS_URL || 'http://localhost:8082/internal/events';
+
+// Publica um evento no gateway Go, que cuida de assinatura, retentativas e
+// entrega para os webhooks. Falhas aqui nunca derrubam o socket.
+function emitEvent(instance, event, data) {
+    if (!GATEWAY_EVENTS_URL) return;
+    fetch(GATEWAY_EVENTS_URL, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+            'apikey': process.env.GLOBAL_API_KEY || ''
+        },
+        body: JSON.stringify({ instance, event, data, timestamp: new Date().toISOString() })
+    }).catch(err => console.log(`[${instance}] ⚠️ Falha ao publicar ${event}:`, err.message));
+}
+
 // ============================================
 // MIDDLEWARE DE AUTENTICAÇÃO
 // ============================================
@@ -437,6 +509,15 @@ const authMiddleware = async (req, res, next) => {
         return res.status(401).json({ error: 'API Key não fornecida' });
     }
 
+    // Key de serviço do gateway Go (GLOBAL_API_KEY / BAILEYS_API_KEY)
+    const serviceKey = process.env.BAILEYS_API_KEY || process.env.GLOBAL_API_KEY;
+    if (serviceKey && apiKey === serviceKey) {
+        req.auth = { valid: true, isSuperAdmin: true };
+        req.apiKeyData = { id: null, nome: 'gateway', tipo: 'super_admin', instancias_permitidas: null };
+        req.isSuperAdmin = true;
+        return next();
+    }
+
     const validation = await validateApiKey(apiKey);
     
     if (!validation.valid) {
@@ -606,7 +687,7 @@ async function startSession(instanceId) {
         browser: ["NexusWa_Api", "Chrome", "1.0.0"],
         markOnlineOnConnect: true,
         generateHighQualityLinkPreview: true,
-        syncFullHistory: true,
+        syncFullHistory: getSettings(instanceId).sync_history,
         connectTimeoutMs: 60000,
         defaultQueryTimeoutMs: 60000,
         retryRequestDelayMs: 500,
@@ -645,6 +726,11 @@ async function startSession(instanceId) {
                 await saveContact(instanceId, contact.id, nome);
             }
         }
+        emitEvent(instanceId, 'contacts.upsert', contacts);
+    });
+
+    sock.ev.on('contacts.update', (updates) => {
+        emitEvent(instanceId, 'contacts.update', updates);
     });
 
     // Mensagens
@@ -665,10 +751,50 @@ async function startSession(instanceId) {
                         await saveContact(instanceId, jid, nome);
                     }
                 }
+                emitEvent(instanceId, 'messages.upsert', { type, message: m });
+
+                // Leitura automática (mensagens novas recebidas)
+                if (type === 'notify' && !m.key.fromMe) {
+                    const settings = getSettings(instanceId);
+                    const isStatus = jid === 'status@broadcast';
+                    if ((isStatus && settings.read_status) || (!isStatus && settings.read_messages)) {
+                        sock.readMessages([m.key]).catch(() => {});
+                    }
+                }
             }
         }
     });
 
+    // Chamadas: rejeição automática conforme as configurações da instância
+    sock.ev.on('call', async (calls) => {
+        const settings = getSettings(instanceId);
+        for (const call of calls) {
+            emitEvent(instanceId, 'call', call);
+            if (!settings.reject_calls || call.status !== 'offer') continue;
+            try {
+                await sock.rejectCall(call.id, call.from);
+                if (settings.reject_call_message) {
+                    await sock.sendMessage(call.from, { text: settings.reject_call_message });
+                }
+            } catch (err) {
+                console.log(`[${instanceId}] ⚠️ Falha ao rejeitar chamada:`, err.message);
+            }
+        }
+    });
+
+    // Acks (servidor, entregue, lida, reproduzida) e recibos por participante
+    sock.ev.on('messages.update', (updates) => {
+        for (const u of updates) {
+            emitEvent(instanceId, 'messages.update', u);
+        }
+    });
+
+    sock.ev.on('message-receipt.update', (updates) => {
+        for (const u of updates) {
+            emitEvent(instanceId, 'message-receipt.update', u);
+        }
+    });
+
     // Chats
     sock.ev.on('chats.set', async ({ chats }) => {
         const storeData = getStore(instanceId);
@@ -694,9 +820,33 @@ async function startSession(instanceId) {
         }
     });
 
+    // Grupos
+    sock.ev.on('groups.upsert', (groups) => {
+        emitEvent(instanceId, 'groups.upsert', groups);
+    });
+
+    sock.ev.on('groups.update', (updates) => {
+        emitEvent(instanceId, 'groups.update', updates);
+    });
+
+    sock.ev.on('group-participants.update', (update) => {
+        emitEvent(instanceId, 'group-participants.update', update);
+    });
+
     // Conexão
     sock.ev.on('connection.update', async (update) => {
-        const { connection, lastDisconnect, qr } = update;
+        const { connection, lastDisconnect, qr, isNewLogin } = update;
+
+        if (connection || qr || isNewLogin) {
+            emitEvent(instanceId, 'connection.update', {
+                connection: connection || null,
+                qr: qr || null,
+                statusCode: lastDisconnect?.error?.output?.statusCode || null,
+                reason: lastDisconnect?.error?.message || null,
+                isNewLogin: !!isNewLogin,
+                me: isNewLogin ? (sock.authState.creds.me?.id || null) : null
+            });
+        }
 
         if (qr) {
             console.log(`[${instanceId}] 📷 QR Code gerado!`);
@@ -1043,6 +1193,13 @@ app.get('/v1/instance/:instance/sync-status', authMiddleware, instanceAccessMidd
     res.json({ ...status, dbStats });
 });
 
+app.put('/v1/instance/:instance/settings', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance } = req.params;
+    instanceSettings.set(instance, { ...DEFAULT_SETTINGS, ...(req.body || {}) });
+    await applySettings(instance);
+    res.json({ status: 'success', settings: getSettings(instance), connected: sessions.has(instance) });
+});
+
 app.post('/v1/instance/:instance/sync', authMiddleware, instanceAccessMiddleware, async (req, res) => {
     const { instance } = req.params;
     const sock = sessions.get(instance);
@@ -1105,7 +1262,7 @@ app.post('/v1/message/text', authMiddleware, instanceAccessMiddleware, async (re
     try {
         const jid = number.includes('@') ? number : `${number}@s.whatsapp.net`;
         const sent = await sock.sendMessage(jid, { text });
-        await saveMessage(instance, jid, 'text', text);
+        await saveMessage(instance, jid, 'text', text, sent?.key?.id);
         res.json({ status: 'success', key: sent.key });
     } catch(e) { 
         res.status(500).json({ error: e.message }); 
@@ -1126,8 +1283,8 @@ app.post('/v1/message/buttons', authMiddleware, instanceAccessMiddleware, async
             footer: footer || 'NexusWA',
             buttons: buttons.map(b => ({ id: b.id, text: b.text }))
         });
-        await saveMessage(instance, jid, 'buttons', JSON.stringify({ message, footer, title, buttons }));
-        return res.json({ status: 'success', messageId: result?.key?.id || 'sent' });
+        await saveMessage(instance, jid, 'buttons', JSON.stringify({ message, footer, title, buttons }), result?.key?.id);
+        return res.json({ status: 'success', messageId: result?.key?.id || null });
     } catch (e) {
         return res.status(500).json({ error: e.message });
     }
@@ -1159,8 +1316,8 @@ app.post('/v1/message/list', authMiddleware, instanceAccessMiddleware, async (re
                 })
             }]
         });
-        await saveMessage(instance, jid, 'list', JSON.stringify({ title, message, footer, buttonText, sections }));
-        res.json({ status: "success", messageId: result?.key?.id || 'sent' });
+        await saveMessage(instance, jid, 'list', JSON.stringify({ title, message, footer, buttonText, sections }), result?.key?.id);
+        res.json({ status: "success", messageId: result?.key?.id || null });
     } catch (e) {
         res.status(500).json({ error: e.message });
     }
@@ -1186,8 +1343,8 @@ app.post('/v1/message/url-button', authMiddleware, instanceAccessMiddleware, asy
                 })
             }]
         });
-        await saveMessage(instance, jid, 'url-button', JSON.stringify({ message, footer, title, buttonText, url }));
-        res.json({ status: "success", messageId: result?.key?.id || 'sent' });
+        await saveMessage(instance, jid, 'url-button', JSON.stringify({ message, footer, title, buttonText, url }), result?.key?.id);
+        res.json({ status: "success", messageId: result?.key?.id || null });
     } catch (e) {
         res.status(500).json({ error: e.message });
     }
@@ -1212,8 +1369,8 @@ app.post('/v1/message/copy-button', authMiddleware, instanceAccessMiddleware, as
                 })
             }]
         });
-        await saveMessage(instance, jid, 'copy-button', JSON.stringify({ message, footer, title, buttonText, copyCode }));
-        res.json({ status: "success", messageId: result?.key?.id || 'sent' });
+        await saveMessage(instance, jid, 'copy-button', JSON.stringify({ message, footer, title, buttonText, copyCode }), result?.key?.id);
+        res.json({ status: "success", messageId: result?.key?.id || null });
     } catch (e) {
         res.status(500).json({ error: e.message });
     }
@@ -1239,8 +1396,8 @@ app.post('/v1/message/interactive', authMiddleware, instanceAccessMiddleware, as
                 title: interactive.header?.text || '',
                 buttons: buttons
             });
-            await saveMessage(instance, jid, 'interactive', JSON.stringify(interactive));
-            return res.json({ status: 'success', messageId: result?.key?.id || 'sent' });
+            await saveMessage(instance, jid, 'interactive', JSON.stringify(interactive), result?.key?.id);
+            return res.json({ status: 'success', messageId: result?.key?.id || null });
         }
         
         const sent = await sock.sendMessage(jid, { 
@@ -1253,6 +1410,250 @@ app.post('/v1/message/interactive', authMiddleware, instanceAccessMiddleware, as
     }
 });
 
+app.post('/v1/message/media', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, number, type, url, base64, mimetype, caption, filename, ptt } = req.body;
+    const sock = sessions.get(instance);
+    if (!sock) return res.status(400).json({ error: 'Disconnected' });
+    if (!url && !base64) return res.status(400).json({ error: 'Informe url ou base64' });
+
+    try {
+        const jid = number.includes('@') ? number : `${number}@s.whatsapp.net`;
+        const source = base64 ? Buffer.from(base64, 'base64') : { url };
+
+        let content;
+        switch (type) {
+            case 'image':
+                content = { image: source, caption, mimetype };
+                break;
+            case 'video':
+                content = { video: source, caption, mimetype };
+                break;
+            case 'audio':
+                content = {
+                    audio: source,
+                    mimetype: mimetype || (ptt ? 'audio/ogg; codecs=opus' : 'audio/mpeg'),
+                    ptt: !!ptt
+                };
+                break;
+            case 'document':
+                content = {
+                    document: source,
+                    mimetype: mimetype || 'application/octet-stream',
+                    fileName: filename || 'arquivo',
+                    caption
+                };
+                break;
+            case 'sticker':
+                content = { sticker: source };
+                break;
+            default:
+                return res.status(400).json({ error: `Tipo de mídia inválido: ${type}` });
+        }
+
+        const sent = await sock.sendMessage(jid, content);
+        await saveMessage(instance, jid, type, JSON.stringify({ url: url || null, mimetype, caption, filename, ptt: !!ptt }), sent?.key?.id);
+        res.json({ status: 'success', key: sent.key });
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+// Baixa a mídia de um WAMessage recebido (usado pelos conectores do gateway)
+app.post('/v1/message/download', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, message } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+    if (!message?.message) return res.status(400).json({ error: 'message obrigatório' });
+
+    try {
+        const content = normalizeMessageContent(message.message);
+        const type = getContentType(content);
+        const media = content?.[type];
+        if (!media?.mimetype) return res.status(400).json({ error: 'Mensagem sem mídia' });
+
+        const buffer = await downloadMediaMessage(message, 'buffer', {}, {
+            logger: pino({ level: 'silent' }),
+            reuploadRequest: sock.updateMediaMessage
+        });
+        res.json({
+            status: 'success',
+            mimetype: media.mimetype,
+            fileName: media.fileName || null,
+            base64: buffer.toString('base64')
+        });
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+// ============================================
+// ROTAS DE GERENCIAMENTO DE GRUPOS
+// ============================================
+
+function toUserJid(number) {
+    return number.includes('@') ? number : `${number.replace(/\D/g, '')}@s.whatsapp.net`;
+}
+
+function toGroupJid(groupId) {
+    return groupId.includes('@') ? groupId : `${groupId}@g.us`;
+}
+
+// Resolve a sessão conectada ou responde o erro adequado
+function requireSocket(instance, res) {
+    const sock = sessions.get(instance);
+    if (!sock) {
+        res.status(400).json({ error: 'Disconnected' });
+        return null;
+    }
+    return sock;
+}
+
+async function groupResponse(sock, instance, groupId, extra = {}) {
+    const group = await sock.groupMetadata(groupId);
+    await saveGroup(instance, group.id, group.subject);
+    return { status: 'success', group, ...extra };
+}
+
+app.post('/v1/group/create', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, subject, participants = [], description } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+    if (!subject) return res.status(400).json({ error: 'subject obrigatório' });
+
+    try {
+        const created = await sock.groupCreate(subject, participants.map(toUserJid));
+        if (description) await sock.groupUpdateDescription(created.id, description);
+        res.json(await groupResponse(sock, instance, created.id));
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+app.get('/v1/group/:instance/:groupId', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, groupId } = req.params;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+
+    try {
+        res.json(await groupResponse(sock, instance, toGroupJid(groupId)));
+    } catch (e) {
+        res.status(404).json({ error: e.message });
+    }
+});
+
+app.post('/v1/group/participants', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, groupId, participants = [], action } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+    if (!['add', 'remove', 'promote', 'demote'].includes(action)) {
+        return res.status(400).json({ error: `Ação inválida: ${action}` });
+    }
+    if (!participants.length) return res.status(400).json({ error: 'participants obrigatório' });
+
+    try {
+        const gid = toGroupJid(groupId);
+        const results = await sock.groupParticipantsUpdate(gid, participants.map(toUserJid), action);
+        res.json(await groupResponse(sock, instance, gid, {
+            results: results.map(r => ({ jid: r.jid, status: String(r.status) }))
+        }));
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+app.post('/v1/group/update', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, groupId, subject, description, pictureUrl, pictureBase64 } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+
+    try {
+        const gid = toGroupJid(groupId);
+        if (subject !== undefined && subject !== null) await sock.groupUpdateSubject(gid, subject);
+        if (description !== undefined && description !== null) await sock.groupUpdateDescription(gid, description);
+        if (pictureUrl || pictureBase64) {
+            const picture = pictureBase64 ? Buffer.from(pictureBase64, 'base64') : { url: pictureUrl };
+            await sock.updateProfilePicture(gid, picture);
+        }
+        res.json(await groupResponse(sock, instance, gid));
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+app.post('/v1/group/settings', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, groupId, announce, locked } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+
+    try {
+        const gid = toGroupJid(groupId);
+        if (announce !== undefined && announce !== null) {
+            await sock.groupSettingUpdate(gid, announce ? 'announcement' : 'not_announcement');
+        }
+        if (locked !== undefined && locked !== null) {
+            await sock.groupSettingUpdate(gid, locked ? 'locked' : 'unlocked');
+        }
+        res.json(await groupResponse(sock, instance, gid));
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+app.get('/v1/group/:instance/:groupId/invite', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, groupId } = req.params;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+
+    try {
+        const code = await sock.groupInviteCode(toGroupJid(groupId));
+        res.json({ status: 'success', code, link: `https://chat.whatsapp.com/${code}` });
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+app.post('/v1/group/invite/revoke', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, groupId } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+
+    try {
+        const code = await sock.groupRevokeInvite(toGroupJid(groupId));
+        res.json({ status: 'success', code, link: `https://chat.whatsapp.com/${code}` });
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+app.post('/v1/group/join', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, code } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+    if (!code) return res.status(400).json({ error: 'code obrigatório' });
+
+    try {
+        const gid = await sock.groupAcceptInvite(code);
+        res.json(await groupResponse(sock, instance, gid));
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
+app.post('/v1/group/leave', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, groupId } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+
+    try {
+        const gid = toGroupJid(groupId);
+        await sock.groupLeave(gid);
+        await pool.query('DELETE FROM grupos WHERE instance = $1 AND jid = $2', [instance, gid]).catch(() => {});
+        res.json({ status: 'success' });
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
 // ============================================
 // ROTAS DE CONTATOS E GRUPOS
 // ============================================
@@ -1281,6 +1682,21 @@ app.get('/v1/contacts/:instance', authMiddleware, instanceAccessMiddleware, asyn
     }
 });
 
+// Quais números têm conta no WhatsApp (resolve o nono dígito no gateway)
+app.post('/v1/contacts/check', authMiddleware, instanceAccessMiddleware, async (req, res) => {
+    const { instance, numbers = [] } = req.body;
+    const sock = requireSocket(instance, res);
+    if (!sock) return;
+    if (!numbers.length) return res.status(400).json({ error: 'numbers obrigatório' });
+
+    try {
+        const results = await sock.onWhatsApp(...numbers.map(toUserJid));
+        res.json({ status: 'success', results: (results || []).map(r => ({ jid: r.jid, exists: !!r.exists })) });
+    } catch (e) {
+        res.status(500).json({ error: e.message });
+    }
+});
+
 app.get('/v1/groups/:instance', authMiddleware, instanceAccessMiddleware, async (req, res) => {
     const { instance } = req.params;
     try {
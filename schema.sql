@@ -126,4 +126,394 @@ CREATE INDEX IF NOT EXISTS idx_logs_acesso_key ON logs_acesso(api_key_id);
 -- ============================================
 -- CRIAR SUPER ADMIN PADRÃO (primeira execução)
 -- ============================================
--- A key será: nexus_superadmin_XXXXXXXX (gerada no Node.js)
\ No newline at end of file
+-- A key será: nexus_superadmin_XXXXXXXX (gerada no Node.js)
+
+-- ============================================
+-- WEBHOOKS (gateway Go)
+-- ============================================
+
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS webhook_secret TEXT;
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS webhook_events TEXT[];   -- NULL = todos os eventos
+
+-- Entregas que esgotaram as retentativas (podem ser reprocessadas via API)
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id SERIAL PRIMARY KEY,
+    delivery_id VARCHAR(64) NOT NULL,
+    instance VARCHAR(100),
+    evento VARCHAR(100) NOT NULL,
+    destino VARCHAR(20) NOT NULL,               -- 'global' ou 'instance'
+    url TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    tentativas INTEGER DEFAULT 0,
+    ultimo_status INTEGER,
+    ultimo_erro TEXT,
+    criado_em TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_dead_letters_instance ON webhook_dead_letters(instance, criado_em DESC);
+
+-- ============================================
+-- FILA DE ENVIO (gateway Go)
+-- ============================================
+
+CREATE TABLE IF NOT EXISTS fila_mensagens (
+    id UUID PRIMARY KEY,
+    instance VARCHAR(100) NOT NULL,
+    numero VARCHAR(100) NOT NULL,
+    tipo VARCHAR(20) NOT NULL,                  -- text, interactive, media
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued', -- queued, sending, sent, failed, cancelled
+    tentativas INTEGER DEFAULT 0,
+    agendado_para TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    message_id VARCHAR(255),
+    ultimo_erro TEXT,
+    api_key_id INTEGER REFERENCES api_keys(id) ON DELETE SET NULL,
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    atualizado_em TIMESTAMPTZ DEFAULT NOW(),
+    enviado_em TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_fila_mensagens_status ON fila_mensagens(status, agendado_para);
+CREATE INDEX IF NOT EXISTS idx_fila_mensagens_instance ON fila_mensagens(instance, status, agendado_para, criado_em);
+
+-- ============================================
+-- AGENDAMENTOS (gateway Go)
+-- ============================================
+
+CREATE TABLE IF NOT EXISTS agendamentos (
+    id SERIAL PRIMARY KEY,
+    instance VARCHAR(100) NOT NULL,
+    nome VARCHAR(255) DEFAULT '',
+    tipo VARCHAR(10) NOT NULL,                  -- 'once' ou 'cron'
+    cron_expr VARCHAR(100),
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    payload JSONB NOT NULL,                     -- SendMessageRequest
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active, paused, cancelled, done
+    proxima_execucao TIMESTAMPTZ,
+    ultima_execucao TIMESTAMPTZ,
+    execucoes INTEGER DEFAULT 0,
+    api_key_id INTEGER REFERENCES api_keys(id) ON DELETE SET NULL,
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    atualizado_em TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS agendamentos_execucoes (
+    id SERIAL PRIMARY KEY,
+    agendamento_id INTEGER NOT NULL REFERENCES agendamentos(id) ON DELETE CASCADE,
+    job_id UUID,                                -- fila_mensagens.id
+    status VARCHAR(20) NOT NULL,
+    erro TEXT,
+    executado_em TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_agendamentos_due ON agendamentos(status, proxima_execucao);
+CREATE INDEX IF NOT EXISTS idx_agendamentos_instance ON agendamentos(instance, criado_em DESC);
+CREATE INDEX IF NOT EXISTS idx_agendamentos_execucoes ON agendamentos_execucoes(agendamento_id, executado_em DESC);
+
+-- ============================================
+-- CAMPANHAS (gateway Go)
+-- ============================================
+
+CREATE TABLE IF NOT EXISTS campanhas (
+    id SERIAL PRIMARY KEY,
+    instance VARCHAR(100) NOT NULL,
+    nome VARCHAR(255) DEFAULT '',
+    payload JSONB NOT NULL,                     -- modelo (SendMessageRequest)
+    status VARCHAR(20) NOT NULL DEFAULT 'running', -- running, paused, cancelled, completed
+    intervalo_min INTEGER NOT NULL DEFAULT 8,   -- segundos
+    intervalo_max INTEGER NOT NULL DEFAULT 20,  -- segundos
+    limite_diario INTEGER NOT NULL DEFAULT 0,   -- 0 = sem limite
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    total INTEGER DEFAULT 0,
+    proximo_envio TIMESTAMPTZ,
+    api_key_id INTEGER REFERENCES api_keys(id) ON DELETE SET NULL,
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    atualizado_em TIMESTAMPTZ DEFAULT NOW(),
+    concluido_em TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS campanha_destinatarios (
+    id SERIAL PRIMARY KEY,
+    campanha_id INTEGER NOT NULL REFERENCES campanhas(id) ON DELETE CASCADE,
+    numero VARCHAR(100) NOT NULL,
+    variaveis JSONB DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, queued, opted_out, cancelled
+    job_id UUID,                                -- fila_mensagens.id
+    erro TEXT,
+    liberado_em TIMESTAMPTZ,
+    atualizado_em TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Números que pediram para não receber campanhas
+CREATE TABLE IF NOT EXISTS opt_outs (
+    instance VARCHAR(100) NOT NULL,
+    numero VARCHAR(100) NOT NULL,
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (instance, numero)
+);
+
+CREATE INDEX IF NOT EXISTS idx_campanhas_due ON campanhas(status, proximo_envio);
+CREATE INDEX IF NOT EXISTS idx_campanhas_instance ON campanhas(instance, criado_em DESC);
+CREATE INDEX IF NOT EXISTS idx_campanha_destinatarios ON campanha_destinatarios(campanha_id, status, id);
+CREATE INDEX IF NOT EXISTS idx_campanha_destinatarios_liberado ON campanha_destinatarios(status, liberado_em);
+
+-- ============================================
+-- HISTÓRICO DE MENSAGENS (gateway Go)
+-- ============================================
+
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS message_id VARCHAR(100);   -- key.id do WhatsApp
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS from_me BOOLEAN DEFAULT FALSE;
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS sender_jid VARCHAR(100);   -- autor (participante em grupos)
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS push_name VARCHAR(255);
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS enviado_em TIMESTAMPTZ;    -- messageTimestamp
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS texto TEXT;
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS quoted_id VARCHAR(100);
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS midia JSONB;               -- mimetype, fileName, size...
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS raw JSONB;                 -- WAMessage original
+
+UPDATE mensagens SET enviado_em = criado_em WHERE enviado_em IS NULL;
+ALTER TABLE mensagens ALTER COLUMN enviado_em SET DEFAULT NOW();
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mensagens_message_id ON mensagens(instance, message_id) WHERE message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_mensagens_historico ON mensagens(instance, jid, enviado_em DESC, id DESC);
+
+-- ============================================
+-- ACKS / RECIBOS DE ENTREGA (gateway Go)
+-- ============================================
+
+ALTER TABLE mensagens ADD COLUMN IF NOT EXISTS status VARCHAR(20);        -- último ack: server_ack, delivered, read, played
+
+CREATE TABLE IF NOT EXISTS mensagens_status (
+    id SERIAL PRIMARY KEY,
+    instance VARCHAR(100) NOT NULL,
+    message_id VARCHAR(100) NOT NULL,
+    jid VARCHAR(100),
+    participant VARCHAR(100) NOT NULL DEFAULT '', -- recibos de grupo: quem recebeu/leu
+    status VARCHAR(20) NOT NULL,                -- pending, error, server_ack, delivered, read, played
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (instance, message_id, status, participant)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mensagens_status_message ON mensagens_status(message_id);
+
+-- ============================================
+-- CONFIGURAÇÕES POR INSTÂNCIA (gateway Go)
+-- ============================================
+
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS configuracoes JSONB;      -- models.InstanceSettings; NULL = padrões
+
+-- ============================================
+-- BARRAMENTO DE EVENTOS (gateway Go)
+-- ============================================
+
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS eventos JSONB;            -- models.EventsConfig (rabbitmq, sqs, websocket); NULL = padrões
+
+-- ============================================
+-- INTEGRAÇÕES: CHATWOOT (gateway Go)
+-- ============================================
+
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS integracoes JSONB;        -- models.IntegrationsConfig; NULL = tudo desligado
+
+CREATE TABLE IF NOT EXISTS chatwoot_conversas (
+    instance VARCHAR(100) NOT NULL,
+    jid VARCHAR(100) NOT NULL,
+    inbox_id INTEGER NOT NULL,
+    contact_id INTEGER NOT NULL,
+    conversation_id INTEGER NOT NULL,
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    atualizado_em TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (instance, jid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chatwoot_conversas_conversation ON chatwoot_conversas(instance, conversation_id);
+
+-- ============================================
+-- INTEGRAÇÕES: TYPEBOT (gateway Go)
+-- ============================================
+
+CREATE TABLE IF NOT EXISTS typebot_sessoes (
+    instance VARCHAR(100) NOT NULL,
+    jid VARCHAR(100) NOT NULL,
+    session_id VARCHAR(100) NOT NULL DEFAULT '', -- vazio = pausado sem fluxo em andamento
+    status VARCHAR(20) NOT NULL DEFAULT 'active', -- active, paused
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    atualizado_em TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (instance, jid)
+);
+
+-- ============================================
+-- ATENDIMENTO HUMANO / RESPOSTAS COM IA (gateway Go)
+-- ============================================
+
+CREATE TABLE IF NOT EXISTS atendimento_humano (
+    instance VARCHAR(100) NOT NULL,
+    jid VARCHAR(100) NOT NULL,
+    motivo TEXT,
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    expira_em TIMESTAMPTZ,                      -- NULL = até ser liberado
+    PRIMARY KEY (instance, jid)
+);
+
+-- ============================================
+-- INTEGRAÇÕES: DIFY (gateway Go)
+-- ============================================
+
+CREATE TABLE IF NOT EXISTS dify_conversas (
+    instance VARCHAR(100) NOT NULL,
+    jid VARCHAR(100) NOT NULL,
+    conversation_id VARCHAR(100) NOT NULL DEFAULT '', -- vazio em apps de workflow
+    criado_em TIMESTAMPTZ DEFAULT NOW(),
+    atualizado_em TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (instance, jid)
+);
+
+-- ============================================
+-- MOTOR DE GATILHOS DOS BOTS (gateway Go)
+-- ============================================
+
+ALTER TABLE contatos ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}'; -- usadas nas regras (tags)
+
+-- ============================================
+-- ESCOPOS E ROTAÇÃO DE API KEYS (gateway Go)
+-- ============================================
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[];                                 -- * = acesso total (migração mais abaixo)
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS substituida_por INTEGER REFERENCES api_keys(id) ON DELETE SET NULL; -- key nova após rotação
+
+-- ============================================
+-- LIMITES E COTAS (gateway Go)
+-- ============================================
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS limite_rps NUMERIC(10,2);       -- requisições por segundo (NULL = sem limite)
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS limite_mensagens_dia INTEGER;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS cota_mensagens_mes INTEGER;     -- planos revendidos
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS limite_rps NUMERIC(10,2);
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS limite_mensagens_dia INTEGER;
+
+CREATE TABLE IF NOT EXISTS uso_mensagens (
+    api_key_id INTEGER NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    instance VARCHAR(100) NOT NULL,
+    dia DATE NOT NULL,
+    mensagens INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (api_key_id, instance, dia)
+);
+
+CREATE INDEX IF NOT EXISTS idx_uso_mensagens_instance ON uso_mensagens(instance, dia);
+
+-- ============================================
+-- AUDITORIA (gateway Go)
+-- ============================================
+
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(10);   -- mantém o autor mesmo após apagar a key
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS instance VARCHAR(100);
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS rota VARCHAR(255);        -- padrão da rota (/v1/instance/:instance/...)
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS latencia_ms INTEGER;
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS request_id VARCHAR(64);
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS acao VARCHAR(50);         -- alterações administrativas (api_key.update...)
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS antes JSONB;
+ALTER TABLE logs_acesso ADD COLUMN IF NOT EXISTS depois JSONB;
+
+-- Apagar uma key não pode apagar (nem bloquear) o histórico dela
+ALTER TABLE logs_acesso DROP CONSTRAINT IF EXISTS logs_acesso_api_key_id_fkey;
+ALTER TABLE logs_acesso ADD CONSTRAINT logs_acesso_api_key_id_fkey
+    FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_logs_acesso_instance ON logs_acesso(instance, id DESC);
+CREATE INDEX IF NOT EXISTS idx_logs_acesso_criado_em ON logs_acesso(criado_em);
+
+-- ============================================
+-- ESTADO DAS CONEXÕES (gateway Go)
+-- ============================================
+
+-- status (connected, connecting, disconnected) é gravado só pelo sidecar; estado, só pelo
+-- supervisor do gateway
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS estado VARCHAR(30) DEFAULT 'created'; -- created, qr_pending, pairing, connected, reconnecting, logged_out, banned
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS estado_motivo TEXT;
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS estado_desde TIMESTAMP;
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS conectado_em TIMESTAMP;
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS desconectado_em TIMESTAMP;
+
+-- Histórico das transições
+CREATE TABLE IF NOT EXISTS instancias_estados (
+    id BIGSERIAL PRIMARY KEY,
+    instance VARCHAR(100) NOT NULL,
+    de VARCHAR(30),
+    para VARCHAR(30) NOT NULL,
+    motivo TEXT,
+    status_code INTEGER,                        -- DisconnectReason do Baileys
+    criado_em TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_instancias_estados_instance ON instancias_estados(instance, criado_em DESC);
+
+-- ============================================
+-- WEBHOOKS: RETENTATIVAS (gateway Go)
+-- ============================================
+
+-- Entregas aguardando nova tentativa; o dispatcher reserva as vencidas
+-- adiando next_attempt_at, então sobrevivem a reinícios e a várias réplicas
+CREATE TABLE IF NOT EXISTS webhook_retries (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id VARCHAR(64) NOT NULL,
+    instance VARCHAR(100),
+    evento VARCHAR(100) NOT NULL,
+    destino VARCHAR(20) NOT NULL,               -- 'global' ou 'instance'
+    url TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    tentativas INTEGER DEFAULT 0,
+    ultimo_status INTEGER,
+    ultimo_erro TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    criado_em TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_retries_next ON webhook_retries(next_attempt_at);
+
+-- ============================================
+-- FILA DE ENVIO: RESERVA (gateway Go)
+-- ============================================
+
+-- Job em 'sending' fica reservado até locked_until; só reservas vencidas
+-- voltam para 'queued' (reinício ou outra réplica)
+ALTER TABLE fila_mensagens ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+-- ============================================
+-- ESCOPOS: MIGRAÇÃO DAS KEYS ANTIGAS (gateway Go)
+-- ============================================
+
+-- Keys anteriores aos escopos (NULL) passam a ter acesso total explícito;
+-- daqui em diante lista vazia = nenhum acesso
+UPDATE api_keys SET scopes = ARRAY['*'] WHERE scopes IS NULL;
+ALTER TABLE api_keys ALTER COLUMN scopes SET DEFAULT '{}';
+ALTER TABLE api_keys ALTER COLUMN scopes SET NOT NULL;
+
+-- ============================================
+-- FILA DE ENVIO: COTAS (gateway Go)
+-- ============================================
+
+-- Dia em que o job foi contado em uso_mensagens (NULL = não contado); usado
+-- para devolver a cota quando o job termina failed ou cancelled
+ALTER TABLE fila_mensagens ADD COLUMN IF NOT EXISTS cota_dia DATE;
+
+-- ============================================
+-- WEBHOOKS: REDE INTERNA (gateway Go)
+-- ============================================
+
+-- URL gravada por um super admin: a entrega pode conectar em endereços
+-- internos. Nas demais, o endereço é conferido a cada conexão
+ALTER TABLE instancias ADD COLUMN IF NOT EXISTS webhook_rede_interna BOOLEAN DEFAULT FALSE;
+
+-- ============================================
+-- CAMPANHAS: NÚMEROS NORMALIZADOS (gateway Go)
+-- ============================================
+
+-- Destinatários e opt-outs usam a mesma normalização do pacote jid: celulares
+-- brasileiros gravados sem o nono dígito ganham a forma com ele
+INSERT INTO opt_outs (instance, numero, criado_em)
+SELECT instance, '55' || substr(numero, 3, 2) || '9' || substr(numero, 5), criado_em
+FROM opt_outs WHERE numero ~ '^55[1-9][0-9][6-9][0-9]{7}$'
+ON CONFLICT DO NOTHING;
+
+UPDATE campanha_destinatarios
+SET numero = '55' || substr(numero, 3, 2) || '9' || substr(numero, 5)
+WHERE status = 'pending' AND numero ~ '^55[1-9][0-9][6-9][0-9]{7}$';